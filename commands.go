@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/distributed"
+	"github.com/mostafatalebi/loadtest/pkg/importer"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// outputs of the commands which print a result
+const (
+	OutputText = "text"
+	OutputJson = "json"
+)
+
+var outputFlag = &config.Flag{Name: "output", Value: "string", Usage: "how the result is printed: text (default) or json"}
+
+// Command is a subcommand of load48, its help is generated from its flags
+type Command struct {
+	Name string
+	// the positional args shown in the usage, like <result.json>
+	Args    string
+	Summary string
+	Flags   []*config.Flag
+	Run     func(args *config.Args) error
+}
+
+var Commands = []*Command{
+	{
+		Name:    "run",
+		Summary: "runs the test defined by the config file, or by the flags of a test without a config file",
+		Flags: append(append(append([]*config.Flag{}, config.FileFlags...), config.CliFlags...),
+			outputFlag,
+			&config.Flag{Name: "out", Value: "string", Usage: "saves the result as json to the file, to be read by report and compare"},
+			&config.Flag{Name: "agent", Value: "string", Repeatable: true, Usage: "runs the test on the agent (load48 agent) at the address, the load is split across all agents"},
+			&config.Flag{Name: "agent-token", Value: "string", Usage: "the token the agents are run with (load48 agent --token), needed by --agent"},
+			&config.Flag{Name: "dry-run", Usage: "runs each chain once, one request at a time, and prints every rendered request, its response status, assertions and extracted variables instead of the stats"},
+			&config.Flag{Name: "offline", Usage: "with --dry-run, renders the requests without sending them, the variables of responses are placeholders like <$token>"},
+		),
+		Run: RunTest,
+	},
+	{
+		Name:    "agent",
+		Summary: "runs its share of the tests of a coordinator (load48 run --agent), one test at a time",
+		Flags: []*config.Flag{
+			{Name: "listen", Value: "string", Usage: "the address the agent listens at, default " + distributed.DefaultAgentAddress + ", like :" + distributed.DefaultAgentPort + " for all interfaces"},
+			{Name: "token", Value: "string", Usage: "the token a coordinator needs to run tests on the agent (load48 run --agent-token), required"},
+		},
+		Run: RunAgent,
+	},
+	{
+		Name:    "validate",
+		Summary: "checks the config file without running the test, and reports all of its errors with their lines",
+		Flags:   config.FileFlags,
+		Run:     ValidateConfig,
+	},
+	{
+		Name:    "report",
+		Args:    "<result.json>",
+		Summary: "prints a result saved by run --out",
+		Flags:   []*config.Flag{outputFlag},
+		Run:     ReportResult,
+	},
+	{
+		Name:    "compare",
+		Args:    "<baseline.json> <current.json>",
+		Summary: "compares two results saved by run --out, and fails if the current one is regressed",
+		Flags: []*config.Flag{
+			{Name: "max-regression", Value: "float", Usage: "the most the average duration may grow (in percent) and the error rate may grow (in percentage points), default 10"},
+		},
+		Run: CompareResults,
+	},
+	{
+		Name:    "import",
+		Args:    "har <session.har> | curl <command>... | openapi <spec.yaml>",
+		Summary: "makes a config of the requests of a har file (recorded by a browser), of curl commands, or of the operations of an OpenAPI 3 document",
+		Flags: []*config.Flag{
+			{Name: "host", Value: "string", Repeatable: true, Usage: "imports only the requests to the host"},
+			{Name: "include-static", Usage: "imports the requests of images, fonts, styles and scripts of a har file too"},
+			{Name: "operation", Value: "string", Repeatable: true, Usage: "imports the operation of the OpenAPI document, by its operationId or like \"GET /users/{id}\""},
+			{Name: "tag", Value: "string", Repeatable: true, Usage: "imports the operations of the OpenAPI document having the tag"},
+			{Name: "server", Value: "string", Usage: "the base url of the requests, instead of the first server of the OpenAPI document"},
+			{Name: "out", Value: "string", Usage: "writes the config to the file instead of printing it"},
+		},
+		Run: ImportConfig,
+	},
+	{
+		Name:    "version",
+		Summary: "prints the version of load48",
+		Run: func(args *config.Args) error {
+			PrintVersion()
+			return nil
+		},
+	},
+}
+
+// FindCommand returns the command by its name, nil if there is none
+func FindCommand(name string) *Command {
+	for _, cmd := range Commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// RunCommand runs the command of the args (without the program name)
+// and returns the exit code. Args starting with a flag run the test,
+// as load48 --file=config.yml did before there were commands.
+func RunCommand(args []string) int {
+	if len(args) == 0 {
+		PrintHelp()
+		return 1
+	}
+	switch args[0] {
+	case "help", "--help", "-h":
+		if len(args) > 1 {
+			if cmd := FindCommand(args[1]); cmd != nil {
+				PrintCommandHelp(cmd)
+				return 0
+			}
+		}
+		PrintHelp()
+		return 0
+	case "--version", "-v":
+		PrintVersion()
+		return 0
+	}
+	var cmd *Command
+	if strings.HasPrefix(args[0], "-") {
+		cmd = FindCommand("run")
+	} else if cmd = FindCommand(args[0]); cmd != nil {
+		args = args[1:]
+	} else {
+		fmt.Printf("unknown command %v, see load48 help\n", args[0])
+		return 1
+	}
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			PrintCommandHelp(cmd)
+			return 0
+		}
+	}
+	parsed, err := config.ParseArgs(args, cmd.Flags)
+	if err != nil {
+		fmt.Printf("%v, see load48 %v --help\n", err.Error(), cmd.Name)
+		return 1
+	}
+	if err = cmd.Run(parsed); err != nil {
+		PrintError(err)
+		return 1
+	}
+	return 0
+}
+
+// RunTest runs the test and prints its result, or saves it by --out
+func RunTest(args *config.Args) error {
+	return runTest(args, os.Stdout, os.Stderr)
+}
+
+// runs the test, its result is written to stdout. The progress of the
+// test goes to stdout too, or to stderr if the result is printed as json.
+// Once the test is interrupted, the result of the requests sent so far
+// is printed and saved.
+func runTest(args *config.Args, stdout, stderr io.Writer) error {
+	if len(args.Positional) > 0 {
+		return errors.New("unexpected arg " + args.Positional[0])
+	}
+	var output, err = outputOf(args)
+	if err != nil {
+		return err
+	}
+	dryRun, _ := strconv.ParseBool(args.Get("dry-run"))
+	offline, _ := strconv.ParseBool(args.Get("offline"))
+	if offline && !dryRun {
+		return errors.New("--offline is only used with --dry-run")
+	}
+	var progress = stdout
+	if output == OutputJson {
+		progress = stderr
+	}
+	if agents := args.GetAll("agent"); len(agents) > 0 {
+		if dryRun {
+			return errors.New("--dry-run runs the test locally, it is not used with --agent")
+		}
+		return runOnAgents(args, agents, output, stdout, progress)
+	}
+	cnf, err := LoadConfigs(args)
+	if err != nil {
+		return err
+	}
+	lt, err := loadtest.New(cnf...)
+	if err != nil {
+		return err
+	}
+	defer lt.Close()
+	lt.SetOutput(progress)
+	if err = lt.ConfigureLogs(); err != nil {
+		return err
+	}
+	if dryRun {
+		return lt.DryRun(stdout, offline)
+	}
+	ctx, stop := interruptContext(progress)
+	defer stop()
+	fmt.Fprintln(progress, "starting the test...")
+	if err = lt.Start(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	var result = lt.Result()
+	result.Version = UnderstandVersion(Version)
+	if output == OutputJson {
+		if err = printJson(stdout, result); err != nil {
+			return err
+		}
+	} else {
+		lt.PrintWorkersStats()
+		lt.PrintGeneralInfo()
+	}
+	if err = saveResult(args, result, progress); err != nil {
+		return err
+	}
+	return interrupted(ctx)
+}
+
+// runs the test of the config file on the agents, as their coordinator
+func runOnAgents(args *config.Args, agents []string, output string, stdout, progress io.Writer) error {
+	var fileName = args.Get("file")
+	if fileName == "" {
+		return errors.New("--agent needs a config file, the flags of a test are not sent to agents")
+	}
+	var token = args.Get("agent-token")
+	if token == "" {
+		return errors.New("--agent needs --agent-token, the token the agents are run with")
+	}
+	configLoader, err := newYamlLoader(args)
+	if err != nil {
+		return err
+	}
+	cnf, err := configLoader.LoadConfigs(fileName)
+	if err != nil {
+		return err
+	}
+	if err = distributed.CanShare(cnf, len(agents)); err != nil {
+		return err
+	}
+	document, err := configLoader.Composed()
+	if err != nil {
+		return err
+	}
+	coordinator := distributed.NewCoordinator(agents, token)
+	coordinator.OnProgress = func(running int, scenarios []*loadtest.ScenarioResult) {
+		var sent, errs int64
+		for _, sr := range scenarios {
+			for _, sm := range sr.Targets {
+				sent += sm.TotalSent
+				errs += sm.Errors()
+			}
+		}
+		fmt.Fprintf(progress, "%v of %v agent(s) running, %v request(s) sent, %v error(s)\n", running, len(agents), sent, errs)
+	}
+	ctx, stop := interruptContext(progress)
+	defer stop()
+	fmt.Fprintf(progress, "starting the test on %v agent(s)...\n", len(agents))
+	result, err := coordinator.Run(ctx, document)
+	if result == nil {
+		return err
+	}
+	result.Version = UnderstandVersion(Version)
+	if output == OutputJson {
+		if err = printJson(stdout, result); err != nil {
+			return err
+		}
+	} else {
+		result.Fprint(stdout)
+	}
+	if err = saveResult(args, result, progress); err != nil {
+		return err
+	}
+	return interrupted(ctx)
+}
+
+// the error of a test stopped by an interrupt, once its result is kept
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errors.New("the test is interrupted, the result has the requests sent before")
+	}
+	return nil
+}
+
+// RunAgent runs an agent until the process is stopped
+func RunAgent(args *config.Args) error {
+	if len(args.Positional) > 0 {
+		return errors.New("unexpected arg " + args.Positional[0])
+	}
+	var token = args.Get("token")
+	if token == "" {
+		return errors.New("--token is required, coordinators run tests on the agent with it")
+	}
+	var address = args.Get("listen")
+	if address == "" {
+		address = distributed.DefaultAgentAddress
+	}
+	fmt.Printf("the agent is listening at %v\n", address)
+	return distributed.NewAgent(token).ListenAndServe(address)
+}
+
+// saves the result to the file of --out, if it is given
+func saveResult(args *config.Args, result *loadtest.Result, w io.Writer) error {
+	if out := args.Get("out"); out != "" {
+		if err := result.Save(out); err != nil {
+			return errors.New("cannot save the result: " + err.Error())
+		}
+		fmt.Fprintf(w, "the result is saved to %v\n", out)
+	}
+	return nil
+}
+
+// LoadConfigs loads the configs from the yaml file, or from the flags
+// of a test without a config file. The yaml file is merged with the
+// overlay of --env and the --set overrides. Configs are validated as
+// they are loaded.
+func LoadConfigs(args *config.Args) ([]*config.Config, error) {
+	var fileName = args.Get("file")
+	if fileName == "" {
+		return config.NewConfigCli().LoadConfigs(args)
+	}
+	configLoader, err := newYamlLoader(args)
+	if err != nil {
+		return nil, err
+	}
+	return configLoader.LoadConfigs(fileName)
+}
+
+// returns the loader of the config file of --file, with the
+// overlay of --env and the --set overrides
+func newYamlLoader(args *config.Args) (*config.ConfigYaml, error) {
+	var fileName = args.Get("file")
+	if given := args.Given(config.CliFlags); len(given) > 0 {
+		return nil, errors.New("--" + given[0] + " cannot be used with a config file, set it in the file instead")
+	}
+	if !strings.HasSuffix(fileName, ".yaml") && !strings.HasSuffix(fileName, ".yml") {
+		return nil, errors.New("cannot understand config type of " + fileName + ", .yml and .yaml files are supported")
+	}
+	var configLoader = config.NewConfigYaml()
+	configLoader.SetEnv(args.Get("env"))
+	configLoader.AddOverrides(args.GetAll("set")...)
+	return configLoader, nil
+}
+
+// ValidateConfig checks the config file without running the test
+func ValidateConfig(args *config.Args) error {
+	var fileName = args.Get("file")
+	if fileName == "" {
+		return errors.New("no config file is given (use: load48 validate --file=someFile.yml)")
+	}
+	cnf, err := LoadConfigs(args)
+	if err != nil {
+		return err
+	}
+	var targets = 0
+	for _, cc := range cnf {
+		if !cc.DataSource {
+			targets++
+		}
+	}
+	fmt.Printf("%v is valid, %v target(s) found\n", fileName, targets)
+	return nil
+}
+
+// ReportResult prints a result saved by run --out
+func ReportResult(args *config.Args) error {
+	if len(args.Positional) != 1 {
+		return errors.New("a result file is needed (use: load48 report result.json)")
+	}
+	output, err := outputOf(args)
+	if err != nil {
+		return err
+	}
+	result, err := loadtest.LoadResult(args.Positional[0])
+	if err != nil {
+		return err
+	}
+	if output == OutputJson {
+		return printJson(os.Stdout, result)
+	}
+	result.Print()
+	return nil
+}
+
+// CompareResults compares the targets of two results, and fails
+// if any of them is regressed by more than --max-regression
+func CompareResults(args *config.Args) error {
+	if len(args.Positional) != 2 {
+		return errors.New("two result files are needed (use: load48 compare baseline.json current.json)")
+	}
+	var maxRegression = 10.0
+	if args.Has("max-regression") {
+		var err error
+		if maxRegression, err = strconv.ParseFloat(args.Get("max-regression"), 64); err != nil || maxRegression < 0 {
+			return errors.New("--max-regression must be a number, zero or greater")
+		}
+	}
+	baseline, err := loadtest.LoadResult(args.Positional[0])
+	if err != nil {
+		return err
+	}
+	current, err := loadtest.LoadResult(args.Positional[1])
+	if err != nil {
+		return err
+	}
+	var regressed = 0
+	for _, c := range loadtest.CompareResults(baseline, current) {
+		c.Print()
+		for _, r := range c.Regressions(maxRegression) {
+			fmt.Printf("--- REGRESSION: %v \n", r)
+			regressed++
+		}
+	}
+	fmt.Println()
+	if regressed > 0 {
+		return fmt.Errorf("%v regression(s) found", regressed)
+	}
+	fmt.Println("no regression found")
+	return nil
+}
+
+// ImportConfig makes a config of recorded requests. A curl command given
+// as @file (or - for stdin) is read from the file, which can hold many
+// commands.
+func ImportConfig(args *config.Args) error {
+	if len(args.Positional) < 2 {
+		return errors.New("a har file, curl commands or an OpenAPI document are needed (use: load48 import har session.har)")
+	}
+	if args.Positional[0] == "openapi" {
+		return importOpenApi(args)
+	}
+	var opts = importer.Options{Hosts: args.GetAll("host"), IncludeStatic: args.Has("include-static")}
+	var requests = make([]*importer.Request, 0)
+	var source = args.Positional[1]
+	switch args.Positional[0] {
+	case "har":
+		if len(args.Positional) > 2 {
+			return errors.New("only one har file can be imported at once")
+		}
+		b, err := ioutil.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		if requests, err = importer.ParseHar(b, opts); err != nil {
+			return err
+		}
+	case "curl":
+		source = "curl commands"
+		for _, arg := range args.Positional[1:] {
+			var commands = []string{arg}
+			if arg == "-" || strings.HasPrefix(arg, "@") {
+				var b []byte
+				var err error
+				if arg == "-" {
+					b, err = ioutil.ReadAll(os.Stdin)
+				} else {
+					b, err = ioutil.ReadFile(arg[1:])
+				}
+				if err != nil {
+					return err
+				}
+				commands = importer.SplitCurlCommands(string(b))
+			}
+			for _, command := range commands {
+				req, err := importer.ParseCurl(command)
+				if err != nil {
+					return err
+				}
+				requests = append(requests, req)
+			}
+		}
+	default:
+		return errors.New("cannot import " + args.Positional[0] + ", har, curl and openapi are supported")
+	}
+	var im = importer.New(source, requests, opts)
+	if len(im.Targets) == 0 {
+		return errors.New("no request is found to import")
+	}
+	return writeImport(args, im)
+}
+
+func importOpenApi(args *config.Args) error {
+	if len(args.Positional) != 2 {
+		return errors.New("one OpenAPI document is needed (use: load48 import openapi spec.yaml)")
+	}
+	b, err := ioutil.ReadFile(args.Positional[1])
+	if err != nil {
+		return err
+	}
+	im, err := importer.ParseOpenApi(args.Positional[1], b, importer.OpenApiOptions{
+		Operations: args.GetAll("operation"),
+		Tags:       args.GetAll("tag"),
+		Server:     args.Get("server"),
+	})
+	if err != nil {
+		return err
+	}
+	return writeImport(args, im)
+}
+
+// prints the config of the import, or writes it to the file of --out
+func writeImport(args *config.Args, im *importer.Import) error {
+	b, err := im.Yaml()
+	if err != nil {
+		return err
+	}
+	var out = args.Get("out")
+	if out == "" {
+		fmt.Print(string(b))
+		return nil
+	}
+	if err = ioutil.WriteFile(out, b, 0644); err != nil {
+		return err
+	}
+	var variables = 0
+	for _, t := range im.Targets {
+		variables += len(t.Variables)
+	}
+	fmt.Printf("%v target(s) imported to %v, %v variable(s) extracted, %v reused value(s) found\n",
+		len(im.Targets), out, variables, len(im.Reused))
+	return nil
+}
+
+func outputOf(args *config.Args) (string, error) {
+	switch output := args.Get("output"); output {
+	case "", OutputText:
+		return OutputText, nil
+	case OutputJson:
+		return OutputJson, nil
+	default:
+		return "", errors.New("--output must be one of: text, json")
+	}
+}
+
+func printJson(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// PrintError prints the error of a command, all the
+// errors of a config are printed one per line
+func PrintError(err error) {
+	if errs, ok := err.(config.ConfigErrors); ok {
+		fmt.Printf("incorrect config, %v error(s) found:\n", len(errs))
+		for _, e := range errs {
+			fmt.Println("  " + e.Error())
+		}
+		return
+	}
+	fmt.Println(err.Error())
+}
@@ -39,6 +39,23 @@ func main() {
 		}
 
 	})
+	mx.HandleFunc("/multi/products", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(200)
+		writer.Write([]byte(`{ "data" : [{"id" : 1}, {"id" : 2}, {"id" : 3}]}`))
+	})
+	mx.HandleFunc("/multi/product", func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("id") == "" {
+			writer.WriteHeader(404)
+			writer.Write([]byte(`product not found`))
+			return
+		}
+		writer.WriteHeader(200)
+		writer.Write([]byte(`{ "data" : {"id" : ` + request.URL.Query().Get("id") + `}}`))
+	})
+	mx.HandleFunc("/multi/checkout", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(200)
+		writer.Write([]byte(`{ "data" : {"ok" : true}}`))
+	})
 	mx.HandleFunc("/multi/verifyToken", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Header.Get("X-Sample-Token") == "token-someSampleValue" {
 			writer.WriteHeader(200)
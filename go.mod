@@ -1,15 +1,22 @@
 module github.com/mostafatalebi/loadtest
 
-go 1.14
+go 1.24
 
 require (
 	github.com/gavv/deepcopy v0.0.0-20160510082458-5dc2cad7a351
-	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/gojektech/valkyrie v0.0.0-20180215180059-6aee720afcdf
 	github.com/mostafatalebi/dynamic-params v0.0.7
 	github.com/rs/xid v1.2.1
 	github.com/stretchr/testify v1.6.1
 	github.com/tidwall/gjson v1.6.1
 	go.uber.org/atomic v1.7.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/tidwall/match v1.0.1 // indirect
+	github.com/tidwall/pretty v1.0.2 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
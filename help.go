@@ -2,27 +2,58 @@ package main
 
 import (
 	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
 	"strings"
 )
 
 func PrintHelp() {
 	PrintAuthorInformation()
-	fmt.Println(`--url string required Target URL to send request to.
-	--method string required HTTP method of the request
-	--worker-count int required The number of concurrent request-sending-worker.
-
-	--per-worker int required Number of sequential requests each worker sends.
-
-	--header-* string optional Any param starting with --header- will be treated as a request
-	header
+	fmt.Println("\nUsage: load48 <command> [flags]")
+	fmt.Println("\nCommands:")
+	for _, cmd := range Commands {
+		fmt.Printf("  %-10v %v\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Println("\nload48 --file=config.yml (flags without a command) runs the test.")
+	fmt.Println("Use load48 help <command> or load48 <command> --help for the flags of a command.")
+}
 
-	--exec-duration-header-name string optional You can set you server to send a response header
-	in debug or test mode which holds the real app duration for that request, and its format
-	must be in duration format (1s, 256ms etc.). Valid units are Valid time units are "ns",
-		"us" (or "µs"), "ms", "s", "m", "h".
+// PrintCommandHelp prints the usage of the command and its flags,
+// as they are defined by the command
+func PrintCommandHelp(cmd *Command) {
+	var usage = "load48 " + cmd.Name
+	if len(cmd.Flags) > 0 {
+		usage += " [flags]"
+	}
+	if cmd.Args != "" {
+		usage += " " + cmd.Args
+	}
+	fmt.Printf("Usage: %v\n\n%v\n", usage, cmd.Summary)
+	if len(cmd.Flags) == 0 {
+		return
+	}
+	fmt.Println("\nFlags:")
+	for _, f := range cmd.Flags {
+		fmt.Println(FlagUsage(f))
+	}
+}
 
-	--cache-usage-header-name string optional A response header which holds a "0" or "1" value
-	and determines if app has served this request from cache`)
+// FlagUsage returns the help of the flag, like:
+//
+//	--url string (repeatable)
+//	      url of a target
+func FlagUsage(f *config.Flag) string {
+	var name = "--" + f.Name
+	if f.IsPrefix() {
+		name = "--" + strings.TrimSuffix(f.Name, "*") + "<name>"
+	}
+	var line = "  " + name
+	if !f.IsSwitch() {
+		line += " " + f.Value
+	}
+	if f.Repeatable || f.IsPrefix() {
+		line += " (repeatable)"
+	}
+	return line + "\n        " + f.Usage
 }
 
 func PrintVersion() {
@@ -47,4 +78,4 @@ func PrintAuthorInformation() {
 	fmt.Println("Author: Mostafa Talebi")
 	fmt.Println("Email: most.talebi@gmail.com")
 	fmt.Println("Github: http://github.com/mostafatalebi/load48")
-}
\ No newline at end of file
+}
@@ -1,75 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"github.com/mostafatalebi/dynamic-params"
-	"github.com/mostafatalebi/loadtest/pkg/config"
-	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"io"
 	"os"
 	"os/signal"
-	"strings"
 )
 
 var Version = ""
 
 func main() {
-	CheckCommandEntry()
-	cp := dyanmic_params.NewDynamicParams(dyanmic_params.SrcNameArgs, os.Args)
-	fileName, _ := cp.GetAsString("file")
-	var cnf []*config.Config
-	var err error
-	if fileName == ""  {
-		var configLoader = config.NewConfig("cli")
-		cnf, err = configLoader.LoadConfigs(os.Args)
-		if err != nil {
-			fmt.Println("incorrect config", err.Error())
-			return
-		}
-	} else if len(fileName) > 0 && (strings.Contains(fileName, ".yaml") || strings.Contains(fileName, ".yml")) {
-		var configLoader = config.NewConfig("yaml")
-		cnf, err = configLoader.LoadConfigs(fileName)
-		if err != nil {
-			fmt.Println("incorrect config", err.Error())
-			return
-		}
-	} else {
-		fmt.Println("no config file is found (use --file=someFile arg)")
-		os.Exit(1)
-		return
-	}
-	if cnf == nil {
-		fmt.Println("cannot understand config type, 'cli' and 'yml' are supported")
-		os.Exit(1)
-	}
-	lt := loadtest.NewLoadTest(cnf...)
-	initCancelInterrupt()
-	fmt.Println("starting the test...")
-	lt.StartWorkers()
-	lt.PrintWorkersStats()
-	lt.PrintGeneralInfo()
+	os.Exit(RunCommand(os.Args[1:]))
 }
 
-func CheckCommandEntry() {
-	if len(os.Args) > 1 && (os.Args[1] == "--help" || os.Args[1] == "-h") {
-		PrintHelp()
-		os.Exit(0)
-		return
-	} else if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
-		PrintVersion()
-		os.Exit(0)
-		return
-	}
-}
-
-func initCancelInterrupt() {
+// returns a context which is cancelled by the first interrupt (Ctrl-C),
+// the test then starts no more iterations and its result so far is
+// kept; a second interrupt exits at once. The returned func stops
+// listening to interrupts.
+func interruptContext(w io.Writer) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
-	go func(){
-		for sig := range c {
-			if sig == os.Interrupt {
-				fmt.Printf("Shutting down the test...\n")
+	go func() {
+		for range c {
+			if ctx.Err() != nil {
 				os.Exit(1)
 			}
+			fmt.Fprintf(w, "Shutting down the test, interrupt again to exit at once...\n")
+			cancel()
 		}
 	}()
-}
\ No newline at end of file
+	return ctx, func() {
+		signal.Stop(c)
+		close(c)
+		cancel()
+	}
+}
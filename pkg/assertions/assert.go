@@ -1,12 +1,26 @@
 package assertions
 
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 const (
 	AssertStatusIsOk = "status-is-ok"
 	AssertBodyString = "body-string"
+	AssertContentType = "content-type"
+	AssertGrpcStatus = "grpc-status"
+	AssertBodyHex = "body-hex"
 )
 
 var ListOfAssertions = map[string]Assertion{
 	AssertBodyString : &AssertionBodyString{},
+	AssertBodyHex : &AssertionBodyHex{},
+	AssertContentType : &AssertionContentType{},
+	AssertGrpcStatus : &AssertionGrpcStatus{},
 	AssertStatusIsOk : &AssertionStatusIsOk{
 		input: []int{200,201},
 	},
@@ -20,11 +34,76 @@ type Assertion interface {
 	Assert() error
 }
 
+// NewAssertionFromName returns a new instance of the assertion, so
+// targets do not share their inputs and tests; nil is returned
+// for an unknown name
 func NewAssertionFromName(assertName string) Assertion {
-	if v, ok := ListOfAssertions[assertName]; ok {
-		return v
+	switch assertName {
+	case AssertBodyString:
+		return &AssertionBodyString{}
+	case AssertBodyHex:
+		return &AssertionBodyHex{}
+	case AssertContentType:
+		return &AssertionContentType{}
+	case AssertGrpcStatus:
+		return &AssertionGrpcStatus{
+			input: []grpc.Code{grpc.OK},
+		}
+	case AssertStatusIsOk:
+		return &AssertionStatusIsOk{
+			input: []int{200, 201},
+		}
 	}
 	return nil
 }
 
+// ParseAssertion creates the assertion by its name and the value given
+// in the config: the string to look for in the body for body-string, and
+// a comma separated list of accepted status codes for status-is-ok (and
+// of grpc status codes, like OK or NOT_FOUND, for grpc-status), the
+// media type of the response for content-type, and the bytes to look
+// for in the response, in hex, for body-hex.
+func ParseAssertion(assertName, value string) (Assertion, error) {
+	asrt := NewAssertionFromName(assertName)
+	if asrt == nil {
+		var names = make([]string, 0, len(ListOfAssertions))
+		for name := range ListOfAssertions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown assertion %v, assertions are: %v", assertName, strings.Join(names, ", "))
+	}
+	switch assertName {
+	case AssertStatusIsOk:
+		var codes = make([]int, 0)
+		for _, v := range strings.Split(value, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("%v needs a comma separated list of status codes, %q is not a status code", assertName, v)
+			}
+			codes = append(codes, code)
+		}
+		if err := asrt.SetInput(codes); err != nil {
+			return nil, err
+		}
+	case AssertGrpcStatus:
+		var codes = make([]grpc.Code, 0)
+		for _, v := range strings.Split(value, ",") {
+			code, err := grpc.ParseCode(v)
+			if err != nil {
+				return nil, fmt.Errorf("%v needs a comma separated list of grpc status codes, %v", assertName, err.Error())
+			}
+			codes = append(codes, code)
+		}
+		if err := asrt.SetInput(codes); err != nil {
+			return nil, err
+		}
+	default:
+		if err := asrt.SetTest(value); err != nil {
+			return nil, err
+		}
+	}
+	return asrt, nil
+}
+
 
@@ -0,0 +1,50 @@
+package assertions
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// AssertionBodyHex checks that the response contains the bytes of the
+// test, which is given in hex, like "0a ff 00"
+type AssertionBodyHex struct {
+	input []byte
+	test  []byte
+}
+
+func (a *AssertionBodyHex) SetInput(input interface{}) error {
+	if v, ok := input.([]byte); ok {
+		a.input = v
+		return nil
+	} else if v, ok := input.(string); ok {
+		a.input = []byte(v)
+		return nil
+	}
+	return errors.New("input must be bytes for body-hex assertion")
+}
+
+func (a *AssertionBodyHex) SetTest(test interface{}) error {
+	if v, ok := test.([]byte); ok {
+		a.test = v
+		return nil
+	}
+	v, ok := test.(string)
+	if !ok {
+		return errors.New("test must be string for body-hex assertion")
+	}
+	b, err := hex.DecodeString(strings.Join(strings.Fields(v), ""))
+	if err != nil || len(b) == 0 {
+		return errors.New("body-hex needs the bytes in hex, like 0a ff 00")
+	}
+	a.test = b
+	return nil
+}
+
+func (a *AssertionBodyHex) Assert() error {
+	if bytes.Contains(a.input, a.test) {
+		return nil
+	}
+	return errors.New("failed to assert that the bytes '" + hex.EncodeToString(a.test) + "' exist in the response")
+}
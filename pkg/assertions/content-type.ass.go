@@ -0,0 +1,49 @@
+package assertions
+
+import (
+	"errors"
+	"mime"
+	"strings"
+)
+
+// AssertionContentType checks the media type of the Content-Type header
+// of the response, its params (like charset) are not compared
+type AssertionContentType struct {
+	input string
+	test  string
+}
+
+func (a *AssertionContentType) SetInput(input interface{}) error {
+	v, ok := input.(string)
+	if !ok {
+		return errors.New("input must be string for content-type assertion")
+	}
+	a.input = v
+	return nil
+}
+
+func (a *AssertionContentType) SetTest(test interface{}) error {
+	v, ok := test.(string)
+	if !ok {
+		return errors.New("test must be string for content-type assertion")
+	}
+	if strings.TrimSpace(v) == "" {
+		return errors.New("content-type needs a media type, like application/json")
+	}
+	a.test = v
+	return nil
+}
+
+func (a *AssertionContentType) Assert() error {
+	if mediaType(a.input) == mediaType(a.test) {
+		return nil
+	}
+	return errors.New("failed to assert that the content type '" + a.input + "' is '" + a.test + "'")
+}
+
+func mediaType(v string) string {
+	if parsed, _, err := mime.ParseMediaType(v); err == nil {
+		return parsed
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
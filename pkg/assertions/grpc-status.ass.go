@@ -0,0 +1,46 @@
+package assertions
+
+import (
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
+	"strings"
+)
+
+// AssertionGrpcStatus checks that the status code of a grpc call
+// is one of the accepted ones, OK by default
+type AssertionGrpcStatus struct {
+	input []grpc.Code
+	test  grpc.Code
+}
+
+func (a *AssertionGrpcStatus) SetInput(input interface{}) error {
+	v, ok := input.([]grpc.Code)
+	if !ok {
+		return errors.New("input must be a list of codes for grpc-status assertion")
+	}
+	a.input = v
+	return nil
+}
+
+func (a *AssertionGrpcStatus) SetTest(test interface{}) error {
+	switch v := test.(type) {
+	case grpc.Code:
+		a.test = v
+	case int:
+		a.test = grpc.Code(v)
+	default:
+		return errors.New("test must be a code for grpc-status assertion")
+	}
+	return nil
+}
+
+func (a *AssertionGrpcStatus) Assert() error {
+	var names = make([]string, 0, len(a.input))
+	for _, v := range a.input {
+		if v == a.test {
+			return nil
+		}
+		names = append(names, v.String())
+	}
+	return errors.New("failed to assert that the grpc status '" + a.test.String() + "' is one of '" + strings.Join(names, ", ") + "'")
+}
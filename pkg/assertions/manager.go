@@ -4,10 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"reflect"
 )
 
 type AssertionManager struct {
 	assertions map[string]Assertion
+	// failed assertions are logged here, nil is the logger of logger.Configure
+	log *logger.Logger
 }
 
 func NewAssertionManagerWithDefaults(assertionsMap map[string]Assertion) *AssertionManager {
@@ -15,7 +18,9 @@ func NewAssertionManagerWithDefaults(assertionsMap map[string]Assertion) *Assert
 		assertionsMap = make(map[string]Assertion, 0)
 	}
 	for _, v := range DefaultAssertions {
-		assertionsMap[v] = ListOfAssertions[v]
+		if _, ok := assertionsMap[v]; !ok {
+			assertionsMap[v] = NewAssertionFromName(v)
+		}
 	}
 
 
@@ -24,6 +29,38 @@ func NewAssertionManagerWithDefaults(assertionsMap map[string]Assertion) *Assert
 	}
 }
 
+// Clone returns a copy of the manager with copies of its assertions.
+// The inputs and tests set on the copy for a response do not change the
+// original, so requests sent at the same time each assert their own
+// response on a clone.
+func (a *AssertionManager) Clone() *AssertionManager {
+	if a == nil {
+		return nil
+	}
+	var assertionsMap = make(map[string]Assertion, len(a.assertions))
+	for name, asrt := range a.assertions {
+		assertionsMap[name] = copyOf(asrt)
+	}
+	return &AssertionManager{assertions: assertionsMap, log: a.log}
+}
+
+// a shallow copy of the assertion, the assertions are pointers to
+// structs whose fields are replaced, not changed, by SetInput and SetTest
+func copyOf(asrt Assertion) Assertion {
+	v := reflect.ValueOf(asrt)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return asrt
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(Assertion)
+}
+
+// SetLogger sets where failed assertions are logged
+func (a *AssertionManager) SetLogger(log *logger.Logger) {
+	a.log = log
+}
+
 func (a *AssertionManager) Exists(name string) bool {
 	if a.assertions == nil || len(a.assertions) == 0 {
 		return false
@@ -62,7 +99,7 @@ func (a *AssertionManager) ChainRunner(names ...string) error {
 		if a.Exists(v) {
 			anyExists = true
 			if err := a.Run(v); err != nil {
-				logger.Error("assertion failed ["+v+"]", err)
+				a.log.Error("assertion failed ["+v+"]", err)
 				return err
 			}
 		}
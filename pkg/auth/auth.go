@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// types of authentication
+const (
+	TypeOAuth2 = "oauth2"
+	TypeJwt    = "jwt"
+	TypeBasic  = "basic"
+	TypeApiKey = "api-key"
+	// no authentication, for a target which opts out of the one of the test
+	TypeNone = "none"
+)
+
+// grants of oauth2
+const (
+	GrantClientCredentials = "client-credentials"
+	GrantPassword          = "password"
+)
+
+// how the client of oauth2 authenticates to the token url
+const (
+	ClientAuthBasic = "basic"
+	ClientAuthBody  = "body"
+)
+
+const (
+	DefaultHeader       = "Authorization"
+	DefaultApiKeyHeader = "X-Api-Key"
+	DefaultJwtTtl       = 5 * time.Minute
+	// a token is renewed this long before it expires, or at the half
+	// of its lifetime when it is shorter
+	DefaultRefreshBefore = 30 * time.Second
+	DefaultTokenTimeout  = 10 * time.Second
+	// a failed fetch of a token is not tried again before this long,
+	// the requests in between fail with its error right away
+	DefaultFailureBackoff = time.Second
+)
+
+// Config is how the requests of a target are authenticated
+type Config struct {
+	Type string
+	// the header the credentials are sent in, Authorization by default
+	// (X-Api-Key for api-key)
+	Header string
+	// oauth2
+	TokenUrl     string
+	Grant        string
+	ClientId     string
+	ClientSecret string
+	ClientAuth   string
+	Scope        string
+	// the password grant and basic
+	Username string
+	Password string
+	// jwt, Key is the secret of HS256 or the pem private key of RS256
+	Algorithm string
+	Key       []byte
+	Claims    map[string]interface{}
+	Ttl       time.Duration
+	// api-key
+	ApiKey string
+}
+
+// Provider gives the credentials of the requests of a config. Tokens are
+// fetched (or minted) once and shared by all the requests which use the
+// provider, they are renewed before they expire. A token is renewed by
+// one fetch in the background, the requests go on with the current one
+// until it expires; only the requests having no valid token wait for it.
+type Provider struct {
+	config *Config
+	client *http.Client
+	jwt    *jwtSigner
+	lock   sync.Mutex
+	value  string
+	// when the value must be renewed and when it expires, zero if never
+	renewAt   time.Time
+	expiresAt time.Time
+	// closed once the running fetch is done, nil if none is running
+	fetched chan struct{}
+	// the last failure of a fetch, and when the token is fetched again
+	err     error
+	retryAt time.Time
+}
+
+// New checks the config and returns its provider
+func New(cfg *Config) (*Provider, error) {
+	var p = &Provider{config: cfg}
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+		if cfg.Type == TypeApiKey {
+			cfg.Header = DefaultApiKeyHeader
+		}
+	}
+	switch cfg.Type {
+	case TypeOAuth2:
+		if cfg.TokenUrl == "" {
+			return nil, errors.New("auth.token-url is needed by oauth2")
+		}
+		switch cfg.Grant {
+		case "":
+			cfg.Grant = GrantClientCredentials
+		case GrantClientCredentials, GrantPassword:
+		default:
+			return nil, errors.New("auth.grant must be one of: client-credentials, password")
+		}
+		if cfg.Grant == GrantPassword && cfg.Username == "" {
+			return nil, errors.New("auth.username is needed by the password grant")
+		}
+		switch cfg.ClientAuth {
+		case "":
+			cfg.ClientAuth = ClientAuthBasic
+		case ClientAuthBasic, ClientAuthBody:
+		default:
+			return nil, errors.New("auth.client-auth must be one of: basic, body")
+		}
+		p.client = &http.Client{Timeout: DefaultTokenTimeout}
+	case TypeJwt:
+		if cfg.Ttl == 0 {
+			cfg.Ttl = DefaultJwtTtl
+		} else if cfg.Ttl < 0 {
+			return nil, errors.New("auth.ttl cannot be negative")
+		}
+		signer, err := newJwtSigner(cfg.Algorithm, cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		p.jwt = signer
+	case TypeBasic:
+		if cfg.Username == "" {
+			return nil, errors.New("auth.username is needed by basic")
+		}
+		p.value = "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.Username+":"+cfg.Password))
+	case TypeApiKey:
+		if cfg.ApiKey == "" {
+			return nil, errors.New("auth.key is needed by api-key")
+		}
+		p.value = cfg.ApiKey
+	case TypeNone:
+	default:
+		return nil, errors.New("auth.type must be one of: oauth2, jwt, basic, api-key, none")
+	}
+	return p, nil
+}
+
+// Header is the header the credentials are sent in, none when the
+// provider is nil or of the none type
+func (p *Provider) Header() string {
+	if p == nil || p.config.Type == TypeNone {
+		return ""
+	}
+	return p.config.Header
+}
+
+// Secrets are the secret values of the config, like its password or its
+// api key, the ones which are set
+func (p *Provider) Secrets() []string {
+	if p == nil {
+		return nil
+	}
+	var secrets []string
+	for _, secret := range []string{p.config.ClientSecret, p.config.Password, p.config.ApiKey} {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// Apply sets the credentials on the headers of a request, a token
+// is fetched or minted if there is none or it is about to expire
+func (p *Provider) Apply(headers http.Header) error {
+	if p == nil || p.config.Type == TypeNone {
+		return nil
+	}
+	value, err := p.credentials()
+	if err != nil {
+		return err
+	}
+	headers.Set(p.config.Header, value)
+	return nil
+}
+
+func (p *Provider) credentials() (string, error) {
+	if p.config.Type == TypeBasic || p.config.Type == TypeApiKey {
+		return p.value, nil
+	}
+	p.lock.Lock()
+	var now = time.Now()
+	var valid = p.value != "" && (p.expiresAt.IsZero() || now.Before(p.expiresAt))
+	if valid && (p.renewAt.IsZero() || now.Before(p.renewAt)) {
+		defer p.lock.Unlock()
+		return p.value, nil
+	}
+	var backoff = p.err != nil && now.Before(p.retryAt)
+	if p.fetched == nil && !backoff {
+		p.fetched = make(chan struct{})
+		go p.renew()
+	}
+	if valid {
+		defer p.lock.Unlock()
+		return p.value, nil
+	}
+	if p.fetched == nil {
+		defer p.lock.Unlock()
+		return "", p.err
+	}
+	var fetched = p.fetched
+	p.lock.Unlock()
+	<-fetched
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.value, nil
+}
+
+// fetches or mints a token, out of the lock, and releases the requests
+// waiting for it
+func (p *Provider) renew() {
+	var now = time.Now()
+	var token string
+	var lifetime time.Duration
+	var err error
+	if p.config.Type == TypeJwt {
+		token, err = p.jwt.mint(p.config.Claims, now, p.config.Ttl)
+		lifetime = p.config.Ttl
+	} else {
+		token, lifetime, err = p.fetchToken()
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	close(p.fetched)
+	p.fetched = nil
+	if err != nil {
+		p.err, p.retryAt = err, time.Now().Add(DefaultFailureBackoff)
+		return
+	}
+	p.err = nil
+	p.value = "Bearer " + token
+	p.renewAt, p.expiresAt = time.Time{}, time.Time{}
+	if lifetime > 0 {
+		var before = DefaultRefreshBefore
+		if before > lifetime/2 {
+			before = lifetime / 2
+		}
+		p.renewAt = now.Add(lifetime - before)
+		p.expiresAt = now.Add(lifetime)
+	}
+}
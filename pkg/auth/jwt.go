@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+// algorithms of jwt
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+)
+
+type jwtSigner struct {
+	algorithm string
+	secret    []byte
+	key       *rsa.PrivateKey
+}
+
+func newJwtSigner(algorithm string, key []byte) (*jwtSigner, error) {
+	if len(key) == 0 {
+		return nil, errors.New("auth.key or auth.key-file is needed by jwt")
+	}
+	switch algorithm {
+	case "", AlgorithmHS256:
+		return &jwtSigner{algorithm: AlgorithmHS256, secret: key}, nil
+	case AlgorithmRS256:
+		rsaKey, err := parseRsaKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &jwtSigner{algorithm: AlgorithmRS256, key: rsaKey}, nil
+	}
+	return nil, errors.New("auth.algorithm must be one of: HS256, RS256")
+}
+
+// parses a pem rsa private key, in pkcs#1 or pkcs#8
+func parseRsaKey(key []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("the key of RS256 must be a pem private key")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("the key of RS256 is not a private key: " + err.Error())
+	}
+	rsaKey, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the key of RS256 is not an rsa key")
+	}
+	return rsaKey, nil
+}
+
+// mints a token with the claims, its iat and exp are set by now and
+// the ttl unless the claims have them
+func (s *jwtSigner) mint(claims map[string]interface{}, now time.Time, ttl time.Duration) (string, error) {
+	var payload = make(map[string]interface{}, len(claims)+2)
+	for k, v := range claims {
+		payload[k] = v
+	}
+	if _, ok := payload["iat"]; !ok {
+		payload["iat"] = now.Unix()
+	}
+	if _, ok := payload["exp"]; !ok {
+		payload["exp"] = now.Add(ttl).Unix()
+	}
+	header, err := json.Marshal(map[string]string{"alg": s.algorithm, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	var signed = base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	var signature []byte
+	if s.algorithm == AlgorithmRS256 {
+		var digest = sha256.Sum256([]byte(signed))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+	} else {
+		var mac = hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// requests an access token from the token url by the grant of the
+// config, it returns the token and how long it lasts, zero if the
+// server does not tell
+func (p *Provider) fetchToken() (string, time.Duration, error) {
+	var cfg = p.config
+	var form = url.Values{}
+	if cfg.Grant == GrantPassword {
+		form.Set("grant_type", "password")
+		form.Set("username", cfg.Username)
+		form.Set("password", cfg.Password)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if cfg.Scope != "" {
+		form.Set("scope", cfg.Scope)
+	}
+	if cfg.ClientAuth == ClientAuthBody {
+		form.Set("client_id", cfg.ClientId)
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientAuth == ClientAuthBasic && cfg.ClientId != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientId), url.QueryEscape(cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token url answered %v: %v", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token tokenResponse
+	if err = json.Unmarshal(body, &token); err != nil {
+		return "", 0, errors.New("the response of the token url is not json: " + err.Error())
+	}
+	if token.AccessToken == "" {
+		return "", 0, errors.New("the response of the token url has no access_token")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
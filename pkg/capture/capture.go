@@ -0,0 +1,349 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// categories of failures
+const (
+	CategoryTimeout     = "timeout"
+	CategoryConnRefused = "conn-refused"
+	CategoryAssertion   = "assertion"
+	CategoryExtraction  = "extraction"
+	// any other failure, like a request which cannot be sent
+	CategoryFailed = "failed"
+)
+
+var Categories = []string{CategoryTimeout, CategoryConnRefused, CategoryAssertion, CategoryExtraction, CategoryFailed}
+
+// formats of the dumps
+const (
+	// a line of json per dump, in capture-<target>.jsonl
+	FormatJsonl = "jsonl"
+	// a json file per dump, capture-<target>-<category>-<n>.json
+	FormatFiles = "files"
+)
+
+// defaults of Config
+const (
+	DefaultMaxFailures = 10
+	DefaultMaxBody     = 64 * 1024
+)
+
+// Redacted is written instead of the value of a secret header
+const Redacted = "[redacted]"
+
+// the headers which are redacted by default, the ones of the auth and
+// the signing of a target are added to them
+var DefaultSecrets = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Amz-Security-Token"}
+
+// the query parameters of urls which are redacted, like the ones of
+// tokens and of presigned urls; they are matched ignoring the case
+var DefaultSecretParams = []string{"access_token", "token", "api_key", "apikey", "key", "password", "secret",
+	"client_secret", "signature", "sig", "X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token"}
+
+// shorter values are too common to be told apart from the rest of a
+// url, they are not redacted where they are found
+const minSecretLength = 4
+
+// Config is which failures of a target are captured and where
+type Config struct {
+	// the first MaxFailures failures of each category are captured
+	MaxFailures int
+	// bodies are truncated to MaxBody bytes
+	MaxBody int
+	Format  string
+	// the directory of the dumps, the current one when it is empty
+	Dir string
+	// the categories which are captured, all of them when it is empty
+	On []string
+	// the values of the secret headers, and of the variables found in
+	// them, are written as they are sent instead of Redacted
+	KeepSecrets bool
+	// the headers which are redacted besides DefaultSecrets
+	Secrets []string
+	// the values which are redacted wherever they are found in the url,
+	// like the api key or the password of the auth of the target
+	SecretValues []string
+}
+
+// Validate checks the config and sets its defaults
+func (c *Config) Validate() error {
+	if c.MaxFailures < 0 || c.MaxBody < 0 {
+		return errors.New("capture.max-failures and capture.max-body cannot be negative")
+	}
+	if c.MaxFailures == 0 {
+		c.MaxFailures = DefaultMaxFailures
+	}
+	if c.MaxBody == 0 {
+		c.MaxBody = DefaultMaxBody
+	}
+	switch c.Format {
+	case "":
+		c.Format = FormatJsonl
+	case FormatJsonl, FormatFiles:
+	default:
+		return errors.New("capture.format must be one of: jsonl, files")
+	}
+	for _, on := range c.On {
+		if !isCategory(on) {
+			return errors.New("capture.on must be made of: " + strings.Join(Categories, ", "))
+		}
+	}
+	return nil
+}
+
+func isCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Message is the request or the response of a dump
+type Message struct {
+	Method string      `json:"method,omitempty"`
+	Url    string      `json:"url,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"headers,omitempty"`
+	Body   string      `json:"body"`
+	// the size of the body before it is truncated
+	BodySize  int  `json:"body-size"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Dump is a failed request, its response (nil when none is received)
+// and the variables it was built with
+type Dump struct {
+	Time      time.Time         `json:"time"`
+	Target    string            `json:"target"`
+	Category  string            `json:"category"`
+	Error     string            `json:"error"`
+	Request   *Message          `json:"request"`
+	Response  *Message          `json:"response,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// SetResponse sets the status and the headers of the response, its
+// body is given once the request is done
+func (d *Dump) SetResponse(status int, header http.Header) {
+	if d == nil {
+		return
+	}
+	d.Response = &Message{Status: status, Header: header.Clone()}
+}
+
+// Capturer writes the dumps of the failures of a target
+type Capturer struct {
+	config *Config
+	target string
+	lock   sync.Mutex
+	// captured failures by category
+	counts map[string]int
+	// the dumps saved, and the most which can be
+	saved *atomic.Int64
+	room  int64
+}
+
+// New makes the capturer of a target, cfg must be validated
+func New(cfg *Config, target string) *Capturer {
+	var categories = len(cfg.On)
+	if categories == 0 {
+		categories = len(Categories)
+	}
+	return &Capturer{config: cfg, target: target, counts: make(map[string]int),
+		saved: atomic.NewInt64(0), room: int64(categories * cfg.MaxFailures)}
+}
+
+// HasRoom reports whether a dump can still be saved, once all the
+// captured categories are full the requests are not dumped anymore
+func (c *Capturer) HasRoom() bool {
+	return c != nil && c.saved.Load() < c.room
+}
+
+// Begin starts the dump of a request, whose body is body, built with
+// the variables. It is nil when the capturer is nil or has no room.
+func (c *Capturer) Begin(req *http.Request, body []byte, variables map[string]string) *Dump {
+	if !c.HasRoom() {
+		return nil
+	}
+	var d = &Dump{
+		Target:    c.target,
+		Request:   &Message{Method: req.Method, Url: req.URL.String(), Header: req.Header.Clone()},
+		Variables: variables,
+	}
+	d.Request.setBody(body, c.config.MaxBody)
+	return d
+}
+
+// Save writes the dump of a request which failed by err, of the
+// category, with the body of its response. It is written only if the
+// category is captured and has room for it.
+func (c *Capturer) Save(d *Dump, category string, err error, body []byte) error {
+	if c == nil || d == nil || err == nil || !c.captures(category) {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.counts[category] >= c.config.MaxFailures {
+		return nil
+	}
+	c.counts[category]++
+	c.saved.Inc()
+	if !c.config.KeepSecrets {
+		c.redact(d)
+	}
+	d.Time = time.Now()
+	d.Category = category
+	d.Error = err.Error()
+	if d.Response != nil {
+		d.Response.setBody(body, c.config.MaxBody)
+	}
+	if c.config.Format == FormatFiles {
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		var name = fmt.Sprintf("capture-%v-%v-%v.json", fileName(c.target), category, c.counts[category])
+		return c.write(name, func(path string) error {
+			return ioutil.WriteFile(path, b, os.FileMode(0644))
+		})
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return c.write(fmt.Sprintf("capture-%v.jsonl", fileName(c.target)), func(path string) error {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.FileMode(0644))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// the directory of the dumps is made before the first one is written
+func (c *Capturer) write(name string, write func(path string) error) error {
+	if c.config.Dir != "" {
+		if err := os.MkdirAll(c.config.Dir, os.FileMode(0775)); err != nil {
+			return err
+		}
+	}
+	return write(filepath.Join(c.config.Dir, name))
+}
+
+// replaces the values of the secret headers and query parameters of a
+// dump, the variables whose values are sent in them (like an extracted
+// token) and the secret values found in its url
+func (c *Capturer) redact(d *Dump) {
+	var secrets []string
+	for _, m := range []*Message{d.Request, d.Response} {
+		if m == nil {
+			continue
+		}
+		for _, name := range append(DefaultSecrets, c.config.Secrets...) {
+			for _, value := range m.Header.Values(name) {
+				secrets = append(secrets, value)
+				// the credentials of a value like Bearer <token>
+				if fields := strings.Fields(value); len(fields) > 1 {
+					secrets = append(secrets, fields[len(fields)-1])
+				}
+				m.Header.Set(name, Redacted)
+			}
+		}
+	}
+	var params []string
+	d.Request.Url, params = redactParams(d.Request.Url)
+	secrets = append(secrets, params...)
+	for name, value := range d.Variables {
+		for _, secret := range secrets {
+			if len(value) >= minSecretLength && strings.Contains(secret, value) {
+				d.Variables[name] = Redacted
+				secrets = append(secrets, value)
+				break
+			}
+		}
+	}
+	for _, secret := range append(secrets, c.config.SecretValues...) {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		d.Request.Url = strings.ReplaceAll(d.Request.Url, secret, Redacted)
+		d.Request.Url = strings.ReplaceAll(d.Request.Url, url.QueryEscape(secret), Redacted)
+	}
+}
+
+// redacts the values of the secret query parameters of the url, it
+// returns the url and the values
+func redactParams(rawUrl string) (string, []string) {
+	var i = strings.Index(rawUrl, "?")
+	if i < 0 {
+		return rawUrl, nil
+	}
+	var values []string
+	var pairs = strings.Split(rawUrl[i+1:], "&")
+	for j, pair := range pairs {
+		var kv = strings.SplitN(pair, "=", 2)
+		name, err := url.QueryUnescape(kv[0])
+		if len(kv) < 2 || err != nil || !isSecretParam(name) {
+			continue
+		}
+		if value, err := url.QueryUnescape(kv[1]); err == nil {
+			values = append(values, value)
+		}
+		pairs[j] = kv[0] + "=" + Redacted
+	}
+	return rawUrl[:i+1] + strings.Join(pairs, "&"), values
+}
+
+func isSecretParam(name string) bool {
+	for _, secret := range DefaultSecretParams {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Capturer) captures(category string) bool {
+	if len(c.config.On) == 0 {
+		return true
+	}
+	for _, on := range c.config.On {
+		if on == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Message) setBody(body []byte, max int) {
+	m.BodySize = len(body)
+	if len(body) > max {
+		body, m.Truncated = body[:max], true
+	}
+	m.Body = string(body)
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// the target's name as a part of a file name
+func fileName(target string) string {
+	return unsafeChars.ReplaceAllString(target, "_")
+}
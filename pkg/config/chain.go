@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// returns the names of the targets in the order they are chained. Each
+// target comes after the targets in its depends-on and before the targets
+// in its next, so a chain can be any graph without cycles; when the order
+// of two targets is not constrained, they keep their order in the yaml file.
+func (t *YamlConfigTargets) chainOrder() ([]string, error) {
+	// edges from each target to the targets which must run after it
+	var after = make(map[string][]string)
+	var waitingFor = make(map[string]int)
+	for _, name := range t.Names {
+		target := t.Targets[name]
+		if target == nil {
+			continue
+		}
+		for _, dep := range target.DependsOn {
+			if _, ok := t.Targets[dep]; !ok {
+				return nil, errors.New("target " + name + " depends on undefined target " + dep)
+			}
+			after[dep] = append(after[dep], name)
+			waitingFor[name]++
+		}
+		for _, next := range target.Next {
+			if _, ok := t.Targets[next]; !ok {
+				return nil, errors.New("next of target " + name + " is undefined target " + next)
+			}
+			after[name] = append(after[name], next)
+			waitingFor[next]++
+		}
+	}
+	var order = make([]string, 0, len(t.Names))
+	var done = make(map[string]bool)
+	for len(order) < len(t.Names) {
+		var picked = ""
+		for _, name := range t.Names {
+			if !done[name] && waitingFor[name] == 0 {
+				picked = name
+				break
+			}
+		}
+		if picked == "" {
+			var cycle = make([]string, 0)
+			for _, name := range t.Names {
+				if !done[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, errors.New("targets depend on each other in a cycle: " + strings.Join(cycle, ", "))
+		}
+		done[picked] = true
+		order = append(order, picked)
+		for _, name := range after[picked] {
+			waitingFor[name]--
+		}
+	}
+	return order, nil
+}
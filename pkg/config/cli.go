@@ -3,10 +3,12 @@ package config
 import (
 	"errors"
 	"fmt"
-	dyanmic_params "github.com/mostafatalebi/dynamic-params"
 	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strconv"
 )
 
 type ConfigCli struct {
@@ -17,56 +19,183 @@ func NewConfigCli() *ConfigCli {
 	return &ConfigCli{}
 }
 
+// LoadConfigs loads the configs of a test defined by the cli flags
+// (CliFlags), each --url is a target. It takes either the *Args of the
+// command or the raw args. The flags are mapped the way a yaml config is,
+// so they are validated the same way; all errors are returned at once by
+// a ConfigErrors.
 func (c *ConfigCli) LoadConfigs(vars ...interface{}) ([]*Config, error) {
-	fmt.Println("Warning: load48 is executed using cli params instead of yaml, it is strongly recommended to use .yaml file instead of command-line params")
-	args := make([]string, 0)
-	if vars == nil || len(vars) == 0 {
-		return nil, errors.New("os.Args is need as first param")
-	} else if v, ok := vars[0].([]string); ok {
+	if len(vars) == 0 {
+		return nil, errors.New("args are needed as first param")
+	}
+	var args *Args
+	switch v := vars[0].(type) {
+	case *Args:
 		args = v
-		c.rawArgs = args
+	case []string:
+		c.rawArgs = v
+		var err error
+		if args, err = ParseArgs(v, CliFlags); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("args are needed as first param")
+	}
+	var errs = ConfigErrors{}
+	main, err := c.mainSection(args)
+	if err != nil {
+		errs = append(errs, err...)
+	}
+	target, err := c.targetSection(args)
+	if err != nil {
+		errs = append(errs, err...)
+	}
+	var urls = args.GetAll(FieldUrl)
+	if len(urls) == 0 {
+		errs.add(position{}, "--"+FieldUrl, "url is required")
+	}
+	var logs = &YamlConfigSectionLogs{
+		Dir:    args.Get(FieldLogDir),
+		Level:  args.Get(FieldLogLevel),
+		Mode:   args.Get(FieldLogMode),
+		Format: args.Get(FieldLogFormat),
+	}
+	logs.Enabled, _ = strconv.ParseBool(args.Get(FieldEnableLogs))
+	var mapper = NewConfigYaml()
+	var logsErr error
+	if mapper.logs, logsErr = parseLogs(logs); logsErr != nil {
+		errs.add(position{}, "logs", logsErr.Error())
+	}
+	var configs = make([]*Config, 0, len(urls))
+	for i, u := range urls {
+		var t = *target
+		t.Url = u
+		cc, err := mapper.mapYmlToConfig("", main, fmt.Sprintf("target%v", i+1), &t, logs)
+		if err != nil {
+			c.addFieldErrors(&errs, err)
+			continue
+		}
+		configs = append(configs, cc)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return configs, nil
+}
+
+// the flags of the main section of a yaml config
+func (c *ConfigCli) mainSection(args *Args) (*YamlConfigSectionMain, ConfigErrors) {
+	var errs = ConfigErrors{}
+	var main = &YamlConfigSectionMain{
+		Strategy:   args.Get(FieldStrategy),
+		Duration:   args.Get(FieldDuration),
+		Pacing:     args.Get(FieldPacing),
+		CookieSeed: args.GetPrefixed("cookie-"),
 	}
 	var err error
-	cnf := &Config{}
-	var cp = dyanmic_params.NewDynamicParams(dyanmic_params.SrcNameArgs, args)
-	cnf.Method, _ = cp.GetAsQuotedString(FieldMethod)
-	cnf.Url, _ = cp.GetAsQuotedString(FieldUrl)
-	cnInt, _ := cp.GetStringAsInt(FieldConcurrency)
-	if cnInt == 0 {
-		return nil, errors.New("[cli] --concurrency cannot be zero")
-	}
-	cnf.Concurrency = int64(cnInt)
-	cnInt, _ = cp.GetStringAsInt(FieldNumberOfRequests)
-	if cnInt == 0 {
-		return nil, errors.New("[cli] --request-count cannot be zero")
-	}
-	cnf.NumberOfRequests = int64(cnInt)
-	cnf.ExecDurationHeaderName, _ = cp.GetAsString(FieldExecDurationHeaderName)
-	cnf.CacheUsageHeaderName, _ = cp.GetAsString(FieldCacheUsageHeaderName)
-	cnf.MaxTimeout, _ = cp.GetStringAsInt(FieldMaxTimeout)
-	cnf.EnabledLogs, _ = cp.GetStringAsBool(FieldEnableLogs)
-	var assertionsMap = GetMapValuesFromArgs("--assert-", c.rawArgs)
-	cnf.Assertions, err = c.ParseAssertions(assertionsMap)
+	if main.Concurrency, err = parseIntFlag(args, FieldConcurrency); err != nil {
+		errs.add(position{}, "--"+FieldConcurrency, err.Error())
+	} else if !args.Has(FieldConcurrency) {
+		main.Concurrency = 1
+	}
+	if main.NumberOfRequests, err = parseIntFlag(args, FieldNumberOfRequests); err != nil {
+		errs.add(position{}, "--"+FieldNumberOfRequests, err.Error())
+	}
+	if args.Has(FieldRate) {
+		main.Executor = ExecutorRate
+		if main.Rate, err = strconv.ParseFloat(args.Get(FieldRate), 64); err != nil {
+			errs.add(position{}, "--"+FieldRate, "rate must be a number")
+		}
+	}
+	if args.Has(FieldCookies) {
+		if main.Cookies, err = strconv.ParseBool(args.Get(FieldCookies)); err != nil {
+			errs.add(position{}, "--"+FieldCookies, "cookies must be true or false")
+		}
+	}
+	if len(main.CookieSeed) > 0 {
+		main.Cookies = true
+	}
+	return main, errs
+}
+
+// the flags of a target of a yaml config, all targets share them
+func (c *ConfigCli) targetSection(args *Args) (*YamlConfigSectionTarget, ConfigErrors) {
+	var errs = ConfigErrors{}
+	var target = &YamlConfigSectionTarget{
+		Method:                 args.Get(FieldMethod),
+		Headers:                args.GetPrefixed("header-"),
+		Assertions:             args.GetPrefixed("assert-"),
+		FormBody:               args.Get(FieldFormBody),
+		ExecDurationHeaderName: args.Get(FieldExecDurationHeaderName),
+		CacheUsageHeaderName:   args.Get(FieldCacheUsageHeaderName),
+	}
+	if args.Has(FieldBodyFile) {
+		if args.Has(FieldFormBody) {
+			errs.add(position{}, "--"+FieldBodyFile, "body-file cannot be given with form-body")
+		}
+		b, err := ioutil.ReadFile(args.Get(FieldBodyFile))
+		if err != nil {
+			errs.add(position{}, "--"+FieldBodyFile, err.Error())
+		}
+		target.FormBody = string(b)
+	}
+	maxTimeout, err := parseIntFlag(args, FieldMaxTimeout)
 	if err != nil {
-		return nil, errors.New("wrong assertions found")
-	} else if cnf.Assertions == nil {
-		cnf.Assertions = assertions.NewAssertionManagerWithDefaults(nil)
+		errs.add(position{}, "--"+FieldMaxTimeout, err.Error())
+	}
+	target.MaxTimeout = int(maxTimeout)
+	if args.Has(FieldThinkTime) {
+		target.ThinkTime = &YamlConfigThinkTime{Type: curr.ThinkFixed, Value: args.Get(FieldThinkTime)}
+	}
+	return target, errs
+}
+
+// the yaml names of the fields whose flags are named differently
+var flagsOfFields = map[string]string{"httpMethod": FieldMethod}
+
+// adds the errors of mapYmlToConfig by the flags of their fields,
+// unless the flag has an error already (like a value which is not
+// a number, which is then zero)
+func (c *ConfigCli) addFieldErrors(errs *ConfigErrors, err error) {
+	fes, ok := err.(fieldErrors)
+	if !ok {
+		errs.add(position{}, "", err.Error())
+		return
+	}
+	var reported = make(map[string]bool)
+	for _, e := range *errs {
+		reported[e.Path] = true
+	}
+	for _, fe := range fes {
+		var flag = fe.field
+		if f, ok := flagsOfFields[flag]; ok {
+			flag = f
+		}
+		if !reported["--"+flag] {
+			errs.add(position{}, "--"+flag, fe.Error())
+		}
 	}
-	var headersMap = GetMapValuesFromArgs("--header-", c.rawArgs)
-	cnf.Headers, err = c.ParseHeaders(headersMap)
+}
+
+func parseIntFlag(args *Args, name string) (int64, error) {
+	if !args.Has(name) {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(args.Get(name), 10, 64)
 	if err != nil {
-		return nil, errors.New("wrong headers found")
+		return 0, errors.New(name + " must be an integer")
 	}
-	cnf.FormBody, _ = cp.GetAsString(FieldFormBody)
-	return []*Config{cnf}, nil
+	return v, nil
 }
 
 func (c *ConfigCli) ParseAssertions(valuesMap map[string]string) (*assertions.AssertionManager, error) {
 	if valuesMap != nil && len(valuesMap) > 0 {
 		var assertionMap = map[string]assertions.Assertion{}
 		for k, v := range valuesMap {
-			asrt := assertions.NewAssertionFromName(k)
-			asrt.SetTest(v)
+			asrt, err := assertions.ParseAssertion(k, v)
+			if err != nil {
+				return nil, err
+			}
 			assertionMap[k] = asrt
 		}
 		return assertions.NewAssertionManagerWithDefaults(assertionMap), nil
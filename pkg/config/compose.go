@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// the key of the files included by a config file
+const includeKey = "include"
+
+// SetEnv sets the environment whose overlay is merged onto the config
+// file, for config.yml and env staging the overlay is config.staging.yml
+func (c *ConfigYaml) SetEnv(env string) {
+	c.env = env
+}
+
+// AddOverrides adds values which override the ones of the config file,
+// each one like main.concurrency=50
+func (c *ConfigYaml) AddOverrides(overrides ...string) {
+	c.overrides = append(c.overrides, overrides...)
+}
+
+// returns the config of the file, composed of the files it includes,
+// the env overlay and the overrides. Problems of the files are added to
+// errs; the error returned means the config cannot be composed at all.
+func (c *ConfigYaml) compose(fileName string, errs *ConfigErrors) (*yaml.Node, error) {
+	c.files = make(map[*yaml.Node]string)
+	c.baseDir = filepath.Dir(fileName)
+	root, err := c.loadFile(fileName, "", nil, errs)
+	if err != nil {
+		return nil, err
+	}
+	if c.env != "" {
+		var ext = filepath.Ext(fileName)
+		var overlayName = strings.TrimSuffix(fileName, ext) + "." + c.env + ext
+		if _, err := os.Stat(overlayName); err != nil {
+			return nil, fmt.Errorf("overlay of env %v is not found: %v", c.env, overlayName)
+		}
+		overlay, err := c.loadFile(overlayName, c.displayName(overlayName), nil, errs)
+		if err != nil {
+			return nil, err
+		}
+		root = mergeNodes(root, overlay)
+	}
+	for _, o := range c.overrides {
+		if err := setOverride(root, o); err != nil {
+			errs.add(position{}, "", err.Error())
+		}
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// loads the file, merged onto the files it includes. Each file is
+// decoded strictly on its own, so unknown fields and wrong values
+// are reported by the file (name, empty for the main file) and
+// line they are found at.
+func (c *ConfigYaml) loadFile(fileName, name string, including []string, errs *ConfigErrors) (*yaml.Node, error) {
+	abs, _ := filepath.Abs(fileName)
+	for _, f := range including {
+		if f == abs {
+			return nil, errors.New("config files include each other: " + fileName)
+		}
+	}
+	including = append(including, abs)
+	b, err := c.readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var doc = &yaml.Node{}
+	if err = yaml.Unmarshal(b, doc); err != nil {
+		if name != "" {
+			return nil, errors.New(name + ", " + err.Error())
+		}
+		return nil, err
+	}
+	// the text of the file is decoded strictly for its unknown fields,
+	// its values are checked once their environment variables are replaced
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err = dec.Decode(&YamlConfigHolder{}); err != nil && err != io.EOF {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+		for _, e := range typeErr.Errors {
+			if unknownField.MatchString(e) {
+				errs.addDecodeError(name, e)
+			}
+		}
+	}
+	if !c.untrusted {
+		interpolateEnv(doc, name, errs)
+	}
+	if err = doc.Decode(&YamlConfigHolder{}); err != nil && len(doc.Content) > 0 {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+		for _, e := range typeErr.Errors {
+			errs.addDecodeError(name, e)
+		}
+	}
+	var root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		root = doc.Content[0]
+	}
+	c.markFile(root, name)
+
+	var merged *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != includeKey {
+			continue
+		}
+		var includes StringList
+		if err := root.Content[i+1].Decode(&includes); err != nil {
+			return nil, errors.New(fileName + ": include must be a file or a list of files")
+		}
+		for _, inc := range includes {
+			if !filepath.IsAbs(inc) {
+				inc = filepath.Join(filepath.Dir(fileName), inc)
+			}
+			fragment, err := c.loadFile(inc, c.displayName(inc), including, errs)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeNodes(merged, fragment)
+		}
+		root.Content = append(root.Content[:i:i], root.Content[i+2:]...)
+		break
+	}
+	return mergeNodes(merged, root), nil
+}
+
+// the name of a file in the errors, relative to the main config file
+func (c *ConfigYaml) displayName(fileName string) string {
+	if rel, err := filepath.Rel(c.baseDir, fileName); err == nil {
+		return rel
+	}
+	return fileName
+}
+
+// records the file of the node and all of its children
+func (c *ConfigYaml) markFile(node *yaml.Node, name string) {
+	c.files[node] = name
+	for _, child := range node.Content {
+		c.markFile(child, name)
+	}
+}
+
+// merges overlay onto base: maps are merged key by key, any other
+// value of overlay (a scalar or a list) replaces the one of base
+func mergeNodes(base, overlay *yaml.Node) *yaml.Node {
+	if base == nil {
+		return overlay
+	}
+	if overlay == nil {
+		return base
+	}
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+	var merged = *base
+	merged.Content = append([]*yaml.Node{}, base.Content...)
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		var key, value = overlay.Content[i], overlay.Content[i+1]
+		var found = false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				if value.Kind != yaml.MappingNode {
+					// errors of the value are reported at the overlay's line
+					merged.Content[j] = key
+				}
+				merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
+
+// a copy of the node and of all of its children
+func copyNode(node *yaml.Node) *yaml.Node {
+	var copied = *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+// sets the value of an override like main.concurrency=50 on the root,
+// maps on the path are created if they do not exist
+func setOverride(root *yaml.Node, override string) error {
+	var parts = strings.SplitN(override, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New("override " + override + " must be like main.concurrency=50")
+	}
+	var node = root
+	var keys = strings.Split(parts[0], ".")
+	for i, key := range keys {
+		var last = i == len(keys)-1
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			var index = -1
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value == key {
+					index = j
+					break
+				}
+			}
+			if index < 0 {
+				index = len(node.Content)
+				node.Content = append(node.Content, nil, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			}
+			if last {
+				// the tag of the value is resolved as if it was written in a file,
+				// both nodes are new, as the value is not at any line of the files
+				node.Content[index+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: parts[1]}
+			}
+			if last || node.Content[index] == nil {
+				node.Content[index] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+			}
+			next = node.Content[index+1]
+		case yaml.SequenceNode:
+			// targets given as a list are found by their names
+			for _, item := range node.Content {
+				for j := 0; item.Kind == yaml.MappingNode && j+1 < len(item.Content); j += 2 {
+					if item.Content[j].Value == "name" && item.Content[j+1].Value == key && !last {
+						next = item
+					}
+				}
+			}
+		}
+		if next == nil {
+			return errors.New("override " + override + ": " + strings.Join(keys[:i+1], ".") + " cannot be set")
+		}
+		node = next
+	}
+	return nil
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// the error of the decoder for a field which is not in the config
+var unknownField = regexp.MustCompile(`^line \d+: field .+ not found in type `)
+
+// replaces ${NAME} and ${NAME:-default} in the values of the node (and
+// of its children) with the value of the environment variable, the
+// default is used when the variable is not set or empty. A variable
+// which is not set and has no default is an error. The values are
+// replaced once the file is parsed, so the value of a variable is taken
+// as is: its colons, quotes and new lines are not read as yaml. A plain
+// value takes the type of what it is replaced by, like an int.
+func interpolateEnv(node *yaml.Node, fileName string, errs *ConfigErrors) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if !envReference.MatchString(node.Value) {
+			return
+		}
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			m := envReference.FindStringSubmatch(ref)
+			value, ok := os.LookupEnv(m[1])
+			if ok && value != "" {
+				return value
+			}
+			if m[2] != "" {
+				return m[3]
+			}
+			if !ok {
+				errs.add(position{file: fileName, line: node.Line}, "", "environment variable "+m[1]+" is not set")
+			}
+			return value
+		})
+		if node.Style&(yaml.TaggedStyle|yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+	case yaml.MappingNode:
+		// the keys are left as they are
+		for i := 1; i < len(node.Content); i += 2 {
+			interpolateEnv(node.Content[i], fileName, errs)
+		}
+	default:
+		for _, child := range node.Content {
+			interpolateEnv(child, fileName, errs)
+		}
+	}
+}
@@ -1,9 +1,20 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/auth"
+	"github.com/mostafatalebi/loadtest/pkg/capture"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/signing"
 	variable "github.com/mostafatalebi/loadtest/pkg/variables"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -15,10 +26,175 @@ const (
 	FieldUrl                    = "url"
 	FieldMaxTimeout             = "max-timeout"
 	FieldEnableLogs             = "enable-logs"
-	FieldFormBody             = "form-body"
+	FieldFormBody               = "form-body"
+	FieldBodyFile               = "body-file"
 	FieldAssertBodyString       = "assert-body-string"
+	FieldCookies                = "cookies"
+	FieldThinkTime              = "think-time"
+	FieldPacing                 = "pacing"
+	FieldStrategy               = "strategy"
+	FieldDuration               = "duration"
+	FieldRate                   = "rate"
+	FieldLogDir                 = "log-dir"
+	FieldLogLevel               = "log-level"
+	FieldLogMode                = "log-mode"
+	FieldLogFormat              = "log-format"
 )
 
+// strategies decide how requests are shared between targets
+const (
+	// targets are chained, each one can use the variables of the previous ones
+	StrategySeq        = "seq"
+	StrategyRoundRobin = "round-robin"
+	StrategyParallel   = "parallel"
+	StrategyWeighted   = "weighted"
+)
+
+// what to do with the rest of a chain when a target fails
+const (
+	OnFailureContinue = "continue"
+	OnFailureStop     = "stop"
+	OnFailureRetry    = "retry"
+)
+
+// schedulers of the weighted strategy
+const (
+	// deterministic, spreads the picks of each target evenly
+	// (the smooth weighted round-robin used by nginx)
+	SchedulerSmooth = "smooth"
+	// picks each target randomly with a probability proportional to its weight
+	SchedulerRandom = "random"
+)
+
+// executors decide how iterations of a scenario are started
+const (
+	// a fixed number of virtual users (concurrency), each starting its next
+	// iteration as soon as the previous one ends, for request-count
+	// iterations or for duration
+	ExecutorClosedLoop = "closed-loop"
+	// iterations are started at a constant rate (per second), no matter how
+	// long they take; concurrency caps the iterations in flight
+	ExecutorRate = "rate"
+	// like rate, but the rate changes linearly through stages
+	ExecutorRamping = "ramping"
+)
+
+// Stage is a step of the ramping executor, during which the rate
+// goes linearly from the previous stage's target to its own
+type Stage struct {
+	Duration time.Duration
+	Target   float64
+}
+
+// protocols of targets
+const (
+	ProtocolHttp = "http"
+	// the target calls a method of a grpc service, its body is the
+	// json of the request message and its headers are the metadata
+	ProtocolGrpc = "grpc"
+	// the target opens a websocket connection and runs a script of
+	// messages on it, its headers are the headers of the handshake
+	ProtocolWebsocket = "websocket"
+	// the target sends its body over a tcp connection, or as a udp
+	// datagram, and reads the response as the socket config says
+	ProtocolTcp = "tcp"
+	ProtocolUdp = "udp"
+)
+
+// encodings of the payload of tcp and udp targets
+const (
+	EncodingText   = "text"
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+// GrpcConfig is the method called by a grpc target
+type GrpcConfig struct {
+	// like helloworld.Greeter/SayHello
+	Method string
+	// the descriptor of the method when it is loaded from proto files,
+	// without them it is nil and the server reflection is used
+	Descriptor *grpc.Method
+}
+
+// SocketConfig is how a tcp or udp target sends its payload (the body)
+// and reads the response
+type SocketConfig struct {
+	// text (default), hex or base64, for the payload and ReadUntil
+	Encoding string
+	// the response is read when one of these is given: until the
+	// delimiter is received, the length is read, or the timeout ends
+	Read        bool
+	ReadUntil   []byte
+	ReadLength  int
+	ReadTimeout time.Duration
+}
+
+// formats of streaming responses
+const (
+	// server-sent events, an event ends with an empty line
+	StreamSse = "sse"
+	// an event per line, like ndjson or chunked long-polls
+	StreamLines = "lines"
+)
+
+// StreamConfig is how the streaming response of a target is read: its
+// events are read until the server ends it, MaxEvents are read or
+// Duration is over, whichever comes first
+type StreamConfig struct {
+	Format    string
+	MaxEvents int
+	Duration  time.Duration
+}
+
+// how long a tcp or udp target waits for the response it reads,
+// when neither socket.read.timeout nor max-timeout is given
+const DefaultSocketReadTimeout = 10 * time.Second
+
+// DecodePayload returns the bytes of a payload in the encoding
+func DecodePayload(encoding, payload string) ([]byte, error) {
+	switch encoding {
+	case EncodingHex:
+		b, err := hex.DecodeString(strings.Join(strings.Fields(payload), ""))
+		if err != nil {
+			return nil, errors.New("payload is not valid hex")
+		}
+		return b, nil
+	case EncodingBase64:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+		if err != nil {
+			return nil, errors.New("payload is not valid base64")
+		}
+		return b, nil
+	}
+	return []byte(payload), nil
+}
+
+// how long an expect step of a websocket script waits for its reply,
+// when neither the step nor the target gives a timeout
+const DefaultWebsocketTimeout = 10 * time.Second
+
+// WebsocketConfig is the script a websocket target runs on each connection
+type WebsocketConfig struct {
+	Script []*WebsocketStep
+	// how long an expect step waits, unless the step has its own timeout
+	Timeout time.Duration
+	// how long the connection is kept open after the script
+	Hold time.Duration
+}
+
+// WebsocketStep is a step of a websocket script, it either sends a message,
+// waits for a message containing Expect or sleeps
+type WebsocketStep struct {
+	Send    string
+	Expect  string
+	Timeout time.Duration
+	Sleep   time.Duration
+}
+
+// name of the variable holding the current item of a loop-over
+const DefaultLoopVar = "$item"
+
 
 
 type Config struct {
@@ -33,10 +209,56 @@ type Config struct {
 	Headers                http.Header
 	FormBody               string
 	LogFileDirectory       string
+	// the level, mode, format, rotation and sampling of the logs, nil
+	// for the defaults
+	Log                    *logger.Options
 	ExecDurationHeaderName string
 	CacheUsageHeaderName   string
 	VariablesMap           variable.VariableMap
 	Strategy               string `yaml:"-"`
+	Cookies                bool
+	CookieSeed             map[string]string
+	OnFailure              string
+	When                   []*variable.Condition
+	Repeat                 int
+	LoopOver               string
+	LoopVar                string
+	ThinkTime              *curr.ThinkTime
+	Retry                  *RetryConfig
+	// sets the credentials of each request, nil without authentication
+	Auth                   *auth.Provider
+	// signs the final request of an http target
+	Signing                *signing.Config
+	// dumps the failed requests of an http target, nil when they are not
+	Capture                *capture.Capturer
+	// a data-source is run before the test, and again each Refresh
+	// while the test runs when it is not zero
+	DataSource bool
+	Refresh    time.Duration
+	Pacing                 time.Duration
+	Weight                 int
+	Scheduler              string
+	Scenario               string
+	Executor               string
+	Duration               time.Duration
+	Rate                   float64
+	Stages                 []Stage
+	StartDelay             time.Duration
+	Protocol               string
+	Grpc                   *GrpcConfig
+	Websocket              *WebsocketConfig
+	Socket                 *SocketConfig
+	Graphql                *GraphqlConfig
+	Stream                 *StreamConfig
+}
+
+// StatsName is the name the stats of the target are kept by: the name
+// of the operation of a graphql target, else the name of the target
+func (c *Config) StatsName() string {
+	if c.Graphql != nil && c.Graphql.OperationName != "" {
+		return c.Graphql.OperationName
+	}
+	return c.TargetName
 }
 
 
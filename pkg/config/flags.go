@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Flag is a command-line flag. The help of the commands is generated
+// from these definitions, and args are checked against them.
+type Flag struct {
+	// name without the leading --, a name ending with * is a prefix,
+	// like header-* for --header-Origin=...
+	Name string
+	// the kind of value shown in the help (string, int, duration...),
+	// empty for a switch, which is either given alone or as --name=false
+	Value string
+	Usage string
+	// the flag can be given more than once
+	Repeatable bool
+}
+
+func (f *Flag) IsPrefix() bool {
+	return strings.HasSuffix(f.Name, "*")
+}
+
+func (f *Flag) IsSwitch() bool {
+	return f.Value == ""
+}
+
+// flags of a config file
+var FileFlags = []*Flag{
+	{Name: "file", Value: "string", Usage: "the yaml config file of the test"},
+	{Name: "env", Value: "string", Usage: "merges the overlay of the env onto the config file, for --env=staging and config.yml the overlay is config.staging.yml"},
+	{Name: "set", Value: "string", Repeatable: true, Usage: "overrides a value of the config file, like --set main.concurrency=50"},
+}
+
+// flags of a test defined on the command line, without a config file
+var CliFlags = []*Flag{
+	{Name: FieldUrl, Value: "string", Repeatable: true, Usage: "url of a target, each --url is a target of its own (target1, target2...)"},
+	{Name: FieldMethod, Value: "string", Usage: "http method of the requests (default GET)"},
+	{Name: "header-*", Value: "string", Usage: "a request header, like --header-Origin=http://example.com"},
+	{Name: FieldFormBody, Value: "string", Usage: "the form body of the requests"},
+	{Name: FieldBodyFile, Value: "string", Usage: "a file holding the body of the requests"},
+	{Name: "assert-*", Value: "string", Usage: "an assertion of the responses, like --assert-status-is-ok=200,204 or --assert-body-string=done"},
+	{Name: FieldConcurrency, Value: "int", Usage: "the number of virtual users, or the most iterations in flight for --rate (default 1)"},
+	{Name: FieldNumberOfRequests, Value: "int", Usage: "the number of iterations, optional if --duration is given"},
+	{Name: FieldStrategy, Value: "string", Usage: "how requests are shared between targets: seq (default), parallel, round-robin"},
+	{Name: FieldDuration, Value: "duration", Usage: "runs the test for the duration, like 30s or 5m"},
+	{Name: FieldRate, Value: "float", Usage: "starts iterations at the rate (per second) instead of back to back"},
+	{Name: FieldMaxTimeout, Value: "int", Usage: "timeout of the requests, in seconds"},
+	{Name: FieldThinkTime, Value: "duration", Usage: "a fixed think time before each request"},
+	{Name: FieldPacing, Value: "duration", Usage: "the minimum duration of an iteration"},
+	{Name: FieldCookies, Usage: "gives each virtual user its own cookie jar"},
+	{Name: "cookie-*", Value: "string", Usage: "a cookie each cookie jar starts with, like --cookie-session=abc"},
+	{Name: FieldExecDurationHeaderName, Value: "string", Usage: "a response header holding the duration taken by the app (like 1s or 256ms)"},
+	{Name: FieldCacheUsageHeaderName, Value: "string", Usage: "a response header which is 1 when the response is served from the cache"},
+	{Name: FieldEnableLogs, Usage: "writes the logs of the test to a file"},
+	{Name: FieldLogDir, Value: "string", Usage: "the directory of the log file"},
+	{Name: FieldLogLevel, Value: "string", Usage: "the least level of the logs: debug, info (default), warn, error, fatal"},
+	{Name: FieldLogMode, Value: "string", Usage: "where the logs are written: file (default) or stderr"},
+	{Name: FieldLogFormat, Value: "string", Usage: "the format of the logs: text (default) or json"},
+}
+
+// Args are the args of a command, parsed by their flags
+type Args struct {
+	values map[string][]string
+	// values of the prefix flags, by prefix (like header-) and name
+	prefixed map[string]map[string]string
+	// args which are not flags, like the file names of compare
+	Positional []string
+}
+
+// ParseArgs parses the args by the flags. A flag is given as --name=value
+// or as --name value (switches only as --name or --name=value); args
+// which are not flags are positional. An unknown flag is an error.
+func ParseArgs(args []string, flags []*Flag) (*Args, error) {
+	var parsed = &Args{values: map[string][]string{}, prefixed: map[string]map[string]string{}}
+	for i := 0; i < len(args); i++ {
+		var arg = args[i]
+		if !strings.HasPrefix(arg, "--") {
+			parsed.Positional = append(parsed.Positional, arg)
+			continue
+		}
+		var name, value = strings.TrimPrefix(arg, "--"), ""
+		var hasValue = false
+		if at := strings.Index(name, "="); at >= 0 {
+			name, value, hasValue = name[:at], name[at+1:], true
+		}
+		var f = findFlag(flags, name)
+		if f == nil {
+			return nil, errors.New("unknown flag --" + name)
+		}
+		if !hasValue {
+			if f.IsSwitch() {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return nil, errors.New("flag --" + name + " needs a value")
+			}
+		}
+		if f.IsPrefix() {
+			var prefix = strings.TrimSuffix(f.Name, "*")
+			if parsed.prefixed[prefix] == nil {
+				parsed.prefixed[prefix] = map[string]string{}
+			}
+			parsed.prefixed[prefix][strings.TrimPrefix(name, prefix)] = value
+			continue
+		}
+		if len(parsed.values[name]) > 0 && !f.Repeatable {
+			return nil, errors.New("flag --" + name + " is given more than once")
+		}
+		parsed.values[name] = append(parsed.values[name], value)
+	}
+	return parsed, nil
+}
+
+// the flag of the name, prefix flags match any name
+// starting with the prefix (and longer than it)
+func findFlag(flags []*Flag, name string) *Flag {
+	for _, f := range flags {
+		if f.IsPrefix() {
+			var prefix = strings.TrimSuffix(f.Name, "*")
+			if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+				return f
+			}
+		} else if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the flag, empty if it is not given
+func (a *Args) Get(name string) string {
+	if v := a.values[name]; len(v) > 0 {
+		return v[len(v)-1]
+	}
+	return ""
+}
+
+// GetAll returns all the values of a repeatable flag
+func (a *Args) GetAll(name string) []string {
+	return a.values[name]
+}
+
+func (a *Args) Has(name string) bool {
+	return len(a.values[name]) > 0
+}
+
+// GetPrefixed returns the values of a prefix flag by their names,
+// for the prefix header- and --header-Origin=x it is {Origin: x}
+func (a *Args) GetPrefixed(prefix string) map[string]string {
+	return a.prefixed[prefix]
+}
+
+// Given returns the names of the flags given among the flags,
+// prefix flags by their prefix, sorted
+func (a *Args) Given(flags []*Flag) []string {
+	var names = make([]string, 0)
+	for _, f := range flags {
+		if f.IsPrefix() && len(a.prefixed[strings.TrimSuffix(f.Name, "*")]) > 0 || a.Has(f.Name) {
+			names = append(names, f.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"regexp"
+	"strings"
+)
+
+// GraphqlConfig is the operation a graphql target sends, its body is
+// built from it for each request
+type GraphqlConfig struct {
+	Query string
+	// the operation of the query which is executed, by default the
+	// name of the first operation of the query
+	OperationName string
+	// the variables of the operation, values can use the variables of
+	// the test, like id: $userId
+	Variables map[string]interface{}
+}
+
+// the name of an operation, like the GetUser of query GetUser($id: ID!)
+var graphqlOperation = regexp.MustCompile(`(?m)^\s*(query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// the name of the first named operation of the query, if any
+func graphqlOperationName(query string) string {
+	if m := graphqlOperation.FindStringSubmatch(query); m != nil {
+		return m[2]
+	}
+	return ""
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Body returns the json body of a request of the operation. The query is
+// sent as it is, the variables of the test are only replaced in the values
+// of the operation's variables: a value which is a single variable, like
+// $userIds, keeps the type of the variable (a number, an array or an
+// object), other strings have the variables replaced in them.
+func (g *GraphqlConfig) Body(vars variable.VariableMap) (string, error) {
+	var req = graphqlRequest{Query: g.Query, OperationName: g.OperationName}
+	if len(g.Variables) > 0 {
+		req.Variables = replaceGraphqlVariables(vars, g.Variables).(map[string]interface{})
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func replaceGraphqlVariables(vars variable.VariableMap, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var replaced = make(map[string]interface{}, len(v))
+		for k, item := range v {
+			replaced[k] = replaceGraphqlVariables(vars, item)
+		}
+		return replaced
+	case []interface{}:
+		var replaced = make([]interface{}, 0, len(v))
+		for _, item := range v {
+			replaced = append(replaced, replaceGraphqlVariables(vars, item))
+		}
+		return replaced
+	case string:
+		if entry, ok := vars[strings.TrimSpace(v)]; ok && entry != nil {
+			switch entry.Type {
+			case variable.VarNumber, variable.VarArr, variable.VarObj:
+				if json.Valid([]byte(entry.Value)) {
+					return json.RawMessage(entry.Value)
+				}
+			}
+			return entry.Value
+		}
+		return variable.ReplaceVariables(vars, v)
+	}
+	return value
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// failures a request can be retried on, besides status codes
+const (
+	RetryOnTimeout     = "timeout"
+	RetryOnConnRefused = "connection-refused"
+	RetryOnAssertion   = "assertion"
+)
+
+// attempts of a request with a retry policy, when max-attempts is not given
+const DefaultRetryMaxAttempts = 3
+
+// RetryConfig is how the failed requests of a target are sent again
+type RetryConfig struct {
+	// attempts of a request, the first one included
+	MaxAttempts int
+	// constant, exponential or jittered, see curr.NewBackoff
+	Backoff string
+	// the wait before the first retry
+	Delay time.Duration
+	// no more retries are made once the wait would be longer,
+	// zero does not limit it
+	MaxDelay time.Duration
+	// the failures which are retried: timeout, connection-refused,
+	// assertion, status codes like 503 or classes of them like 5xx;
+	// all failures are retried when it is empty
+	On []string
+}
+
+// a status code, or a class of them
+var retryStatus = regexp.MustCompile(`^([0-9]+|[1-5]xx)$`)
+
+// Validate checks the policy and sets its defaults
+func (rc *RetryConfig) Validate() error {
+	if rc.MaxAttempts == 0 {
+		rc.MaxAttempts = DefaultRetryMaxAttempts
+	} else if rc.MaxAttempts < 1 {
+		return errors.New("retry.max-attempts must be at least 1")
+	}
+	switch rc.Backoff {
+	case "":
+		rc.Backoff = curr.BackoffConstant
+	case curr.BackoffConstant, curr.BackoffExponential, curr.BackoffJittered:
+	default:
+		return errors.New("retry.backoff must be one of: constant, exponential, jittered")
+	}
+	if rc.Delay < 0 || rc.MaxDelay < 0 {
+		return errors.New("retry.delay and retry.max-delay cannot be negative")
+	}
+	if rc.Backoff != curr.BackoffConstant && rc.Delay == 0 {
+		return errors.New("retry.delay is needed by the " + rc.Backoff + " backoff")
+	}
+	if rc.MaxDelay != 0 && rc.MaxDelay < rc.Delay {
+		return errors.New("retry.max-delay cannot be less than retry.delay")
+	}
+	for _, on := range rc.On {
+		switch on {
+		case RetryOnTimeout, RetryOnConnRefused, RetryOnAssertion:
+		default:
+			if !retryStatus.MatchString(on) {
+				return errors.New("retry.on must be timeout, connection-refused, assertion, a status code like 503 or a class like 5xx, not " + on)
+			}
+		}
+	}
+	return nil
+}
+
+// Wait returns the wait between the attempts of a request
+func (rc *RetryConfig) Wait() *curr.Wait {
+	return curr.NewBackoff(rc.Backoff, rc.Delay, rc.MaxDelay)
+}
+
+// RetriesOn reports whether a failure is retried, given its kind (one of
+// the RetryOn constants, or empty for other failures) and the status code
+// of the response, zero without a response
+func (rc *RetryConfig) RetriesOn(kind string, status int) bool {
+	if len(rc.On) == 0 {
+		return true
+	}
+	var code = strconv.Itoa(status)
+	for _, on := range rc.On {
+		if kind != "" && on == kind {
+			return true
+		}
+		if status == 0 || !retryStatus.MatchString(on) {
+			continue
+		}
+		if on == code || (len(on) == 3 && on[1:] == "xx" && on[0] == code[0] && len(code) == 3) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is an error found in a config. Line is its line in the
+// config file (zero when not known), File is the file it is found in
+// when it is not the main config file (an include or an env overlay),
+// and Path is the section it belongs to, like targets.login
+type ConfigError struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	var s = e.Message
+	if e.Path != "" {
+		s = e.Path + ": " + s
+	}
+	if e.Line > 0 {
+		s = fmt.Sprintf("line %v: %v", e.Line, s)
+	}
+	if e.File != "" {
+		s = e.File + ", " + s
+	}
+	return s
+}
+
+// position of a node in the config files
+type position struct {
+	file string
+	line int
+}
+
+// ConfigErrors holds all the errors found in a config,
+// so they are reported at once
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	var lines = make([]string, 0, len(e))
+	for _, ce := range e {
+		lines = append(lines, ce.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// adds the error, unless it is already added (settings of
+// the main section are checked once per target)
+func (e *ConfigErrors) add(pos position, path, message string) {
+	for _, ce := range *e {
+		if ce.File == pos.file && ce.Line == pos.line && ce.Path == path && ce.Message == message {
+			return
+		}
+	}
+	*e = append(*e, &ConfigError{File: pos.file, Line: pos.line, Path: path, Message: message})
+}
+
+var decodeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// adds an error of the yaml decoder, like "line 5: field enable not found"
+func (e *ConfigErrors) addDecodeError(file, message string) {
+	if m := decodeErrorLine.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		e.add(position{file: file, line: line}, "", m[2])
+		return
+	}
+	e.add(position{file: file}, "", message)
+}
+
+// sorts the errors by their files (the main file first) and lines,
+// the ones without a line go last
+func (e ConfigErrors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].File != e[j].File {
+			return e[i].File == "" || (e[j].File != "" && e[i].File < e[j].File)
+		}
+		if e[i].Line == 0 || e[j].Line == 0 {
+			return e[j].Line == 0 && e[i].Line != 0
+		}
+		return e[i].Line < e[j].Line
+	})
+}
+
+// an error of a field of a target, or of a main
+// section's field when main is true
+type fieldError struct {
+	field string
+	main  bool
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+// the errors of a target's fields
+type fieldErrors []*fieldError
+
+func (e fieldErrors) Error() string {
+	var lines = make([]string, 0, len(e))
+	for _, fe := range e {
+		lines = append(lines, fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *fieldErrors) add(field string, err error) {
+	if err != nil {
+		*e = append(*e, &fieldError{field: field, err: err})
+	}
+}
+
+func (e *fieldErrors) addMain(field string, err error) {
+	if err != nil {
+		*e = append(*e, &fieldError{field: field, main: true, err: err})
+	}
+}
+
+// adds the errors returned by mapYmlToConfig for a target of the
+// section (targets or data-sources), each one at the line of its field
+func (c *ConfigYaml) addTargetErrors(errs *ConfigErrors, section, scenarioName, targetName string, err error) {
+	fes, ok := err.(fieldErrors)
+	if !ok {
+		errs.add(c.lineOf(section, targetName), section+"."+targetName, err.Error())
+		return
+	}
+	for _, fe := range fes {
+		if !fe.main {
+			errs.add(c.lineOf(section, targetName, fe.field), section+"."+targetName, fe.Error())
+			continue
+		}
+		// a main setting of a scenario is either its own or taken from main
+		if scenarioName != "" && c.hasPath("scenarios", scenarioName, fe.field) {
+			errs.add(c.lineOf("scenarios", scenarioName, fe.field), "scenarios."+scenarioName, fe.Error())
+		} else {
+			errs.add(c.lineOf("main", fe.field), "main", fe.Error())
+		}
+	}
+}
+
+// returns the node of the key at the path, like ("targets", "login", "url"),
+// and the deepest node found on the way. Targets given as a list are
+// found by their name.
+func (c *ConfigYaml) find(path ...string) (found *yaml.Node, deepest *yaml.Node) {
+	if c.root == nil || len(c.root.Content) == 0 {
+		return nil, nil
+	}
+	var node = c.root.Content[0]
+	deepest = node
+	for _, key := range path {
+		var next, keyNode *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					keyNode, next = node.Content[i], node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			for _, item := range node.Content {
+				if item.Kind != yaml.MappingNode {
+					continue
+				}
+				for i := 0; i+1 < len(item.Content); i += 2 {
+					if item.Content[i].Value == "name" && item.Content[i+1].Value == key {
+						keyNode, next = item, item
+					}
+				}
+			}
+		}
+		if next == nil {
+			return nil, deepest
+		}
+		deepest = keyNode
+		node = next
+	}
+	return deepest, deepest
+}
+
+// returns the position of the key at the path, or of
+// its deepest part which is found in the config
+func (c *ConfigYaml) lineOf(path ...string) position {
+	_, deepest := c.find(path...)
+	if deepest == nil {
+		return position{}
+	}
+	return position{file: c.files[deepest], line: deepest.Line}
+}
+
+func (c *ConfigYaml) hasPath(path ...string) bool {
+	found, _ := c.find(path...)
+	return found != nil
+}
+
+var httpMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace}
+
+// an empty method is sent as GET
+func validateMethod(method string) error {
+	if method == "" {
+		return nil
+	}
+	for _, m := range httpMethods {
+		if strings.ToUpper(method) == m {
+			return nil
+		}
+	}
+	return errors.New("httpMethod must be one of: " + strings.Join(httpMethods, ", "))
+}
+
+// the url must be an absolute http(s) url, ws(s) for websocket targets
+// and tcp://host:port or udp://host:port for tcp and udp targets, unless
+// it starts with a variable, like $baseUrl/users
+func validateUrl(u string, protocol string) error {
+	if u == "" {
+		return errors.New("url is required")
+	}
+	if strings.HasPrefix(u, "$") {
+		return nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return errors.New("url is not valid: " + err.Error())
+	}
+	if protocol == ProtocolTcp || protocol == ProtocolUdp {
+		if parsed.Scheme != protocol || parsed.Port() == "" {
+			return fmt.Errorf("url must be like %v://host:port", protocol)
+		}
+	} else if protocol == ProtocolWebsocket {
+		if parsed.Scheme != "ws" && parsed.Scheme != "wss" {
+			return errors.New("url must start with ws:// or wss://")
+		}
+	} else if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errors.New("url must start with http:// or https://")
+	}
+	if parsed.Host == "" {
+		return errors.New("url has no host")
+	}
+	return nil
+}
+
+var variableReference = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// reports whether the variable is defined. As variables are replaced
+// as they are found in a value, $userId is replaced by $user too
+func isDefined(defined map[string]bool, ref string) bool {
+	for name := range defined {
+		if strings.HasPrefix(ref, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checks that each variable used by the targets of a chain is defined by
+// a data-source, a previous target (only when the strategy is seq, as
+// other strategies do not pass variables between targets) or is built-in
+func (c *ConfigYaml) checkVariables(errs *ConfigErrors, scenarioName string, chain []string, strategy string) {
+	var defined = map[string]bool{variable.VarStatus: true}
+	if c.yamlConfig.DataSources != nil {
+		for _, name := range c.yamlConfig.DataSources.Names {
+			if ds := c.yamlConfig.DataSources.Targets[name]; ds != nil {
+				for v := range ds.Variables {
+					defined[v] = true
+				}
+			}
+		}
+	}
+	var where = ""
+	if scenarioName != "" {
+		where = " (in scenario " + scenarioName + ")"
+	}
+	for _, targetName := range chain {
+		target, ok := c.yamlConfig.Targets.Get(targetName)
+		if !ok || target == nil {
+			continue
+		}
+		var available = defined
+		if target.LoopOver != "" {
+			available = make(map[string]bool, len(defined)+2)
+			for v := range defined {
+				available[v] = true
+			}
+			var loopVar = target.LoopVar
+			if loopVar == "" {
+				loopVar = DefaultLoopVar
+			}
+			available[loopVar] = true
+			available[variable.VarIndex] = true
+		}
+		var uses = map[string][]string{
+			"url":       {target.Url},
+			"form-body": {target.FormBody},
+			"loop-over": {target.LoopOver},
+			"when":      target.When,
+		}
+		for _, v := range target.Headers {
+			uses["headers"] = append(uses["headers"], v)
+		}
+		if target.Websocket != nil {
+			for _, st := range target.Websocket.Script {
+				if st != nil {
+					uses["websocket"] = append(uses["websocket"], st.Send, st.Expect)
+				}
+			}
+		}
+		// the query of a graphql target has graphql variables, like $id
+		if target.Graphql != nil {
+			uses["graphql"] = stringsOf(target.Graphql.Variables)
+		}
+		// a websocket script can use the variables its replies set
+		var inScript = available
+		if target.Websocket != nil && len(target.Variables) > 0 {
+			inScript = make(map[string]bool, len(available)+len(target.Variables))
+			for v := range available {
+				inScript[v] = true
+			}
+			for v := range target.Variables {
+				inScript[v] = true
+			}
+		}
+		for _, field := range []string{"url", "headers", "form-body", "when", "loop-over", "websocket", "graphql"} {
+			for _, value := range uses[field] {
+				for _, ref := range variableReference.FindAllString(value, -1) {
+					if field == "websocket" && isDefined(inScript, ref) {
+						continue
+					}
+					if !isDefined(available, ref) {
+						errs.add(c.lineOf("targets", targetName, field), "targets."+targetName,
+							"variable "+ref+" is not defined by a data-source or a previous target"+where)
+					}
+				}
+			}
+		}
+		if strategy == "" || strategy == StrategySeq {
+			for v := range target.Variables {
+				defined[v] = true
+			}
+		}
+	}
+}
+
+// the strings of a value decoded from yaml, the ones in its maps and lists too
+func stringsOf(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case map[string]interface{}:
+		var all = make([]string, 0)
+		for _, item := range v {
+			all = append(all, stringsOf(item)...)
+		}
+		return all
+	case []interface{}:
+		var all = make([]string, 0)
+		for _, item := range v {
+			all = append(all, stringsOf(item)...)
+		}
+		return all
+	}
+	return nil
+}
+
+// refresh is only used by data-sources
+func (c *ConfigYaml) checkRefresh(errs *ConfigErrors) {
+	if c.yamlConfig.Targets == nil {
+		return
+	}
+	for _, name := range c.yamlConfig.Targets.Names {
+		if target := c.yamlConfig.Targets.Targets[name]; target != nil && target.Refresh != nil {
+			errs.add(c.lineOf("targets", name, "refresh"), "targets."+name, "refresh is only used by data-sources")
+		}
+	}
+}
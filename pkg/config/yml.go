@@ -1,42 +1,285 @@
 package config
 
 import (
+	"bytes"
 	"errors"
-	"github.com/go-yaml/yaml"
+	"fmt"
 	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/auth"
+	"github.com/mostafatalebi/loadtest/pkg/capture"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
 	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/signing"
 	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 type YamlConfigHolder struct {
-	Logs        *YamlConfigSectionLogs              `yaml:"logs"`
-	Main        *YamlConfigSectionMain              `yaml:"main"`
-	DataSources map[string]*YamlConfigSectionTarget `yaml:"data-sources"`
-	Targets     map[string]*YamlConfigSectionTarget `yaml:"targets"`
+	// files merged under this one, this file's values win
+	Include     StringList                            `yaml:"include"`
+	Logs        *YamlConfigSectionLogs                `yaml:"logs"`
+	Main        *YamlConfigSectionMain                `yaml:"main"`
+	DataSources *YamlConfigTargets                    `yaml:"data-sources"`
+	Targets     *YamlConfigTargets                    `yaml:"targets"`
+	Scenarios   map[string]*YamlConfigSectionScenario `yaml:"scenarios"`
+	// how the requests of all targets are authenticated, unless a
+	// target has its own auth
+	Auth *YamlConfigAuth `yaml:"auth"`
+	// which failures of all http targets are dumped, unless a target
+	// has its own capture
+	Capture *YamlConfigCapture `yaml:"capture"`
 }
 
 type YamlConfigSectionMain struct {
 	Concurrency      int64  `yaml:"concurrency"`
 	NumberOfRequests int64  `yaml:"request-count"`
 	Strategy         string `yaml:"strategy"`
+	// gives each virtual user (or each chain iteration in seq mode)
+	// its own cookie jar
+	Cookies    bool              `yaml:"cookies"`
+	CookieSeed map[string]string `yaml:"cookie-seed"`
+	// minimum duration of an iteration, like 5s or 500ms
+	Pacing string `yaml:"pacing"`
+	// scheduler of the weighted strategy, smooth (default) or random
+	Scheduler string `yaml:"scheduler"`
+	// closed-loop (default), rate or ramping
+	Executor string             `yaml:"executor"`
+	Duration string             `yaml:"duration"`
+	Rate     float64            `yaml:"rate"`
+	Stages   []*YamlConfigStage `yaml:"stages"`
 }
 
+type YamlConfigStage struct {
+	Duration string  `yaml:"duration"`
+	Target   float64 `yaml:"target"`
+}
+
+// A scenario is a chain of targets (by their names in the targets
+// section) with its own load settings, any setting not given is
+// taken from the main section. All scenarios run simultaneously.
+type YamlConfigSectionScenario struct {
+	YamlConfigSectionMain `yaml:",inline"`
+	StartDelay            string   `yaml:"start-delay"`
+	Targets               []string `yaml:"targets"`
+}
+
+// returns the settings of m, with the ones not set
+// taken from parent
+func (m YamlConfigSectionMain) inherit(parent *YamlConfigSectionMain) *YamlConfigSectionMain {
+	if parent == nil {
+		return &m
+	}
+	if m.Concurrency == 0 {
+		m.Concurrency = parent.Concurrency
+	}
+	if m.NumberOfRequests == 0 {
+		m.NumberOfRequests = parent.NumberOfRequests
+	}
+	if m.Strategy == "" {
+		m.Strategy = parent.Strategy
+	}
+	if !m.Cookies {
+		m.Cookies = parent.Cookies
+	}
+	if m.CookieSeed == nil {
+		m.CookieSeed = parent.CookieSeed
+	}
+	if m.Pacing == "" {
+		m.Pacing = parent.Pacing
+	}
+	if m.Scheduler == "" {
+		m.Scheduler = parent.Scheduler
+	}
+	if m.Executor == "" {
+		m.Executor = parent.Executor
+	}
+	if m.Duration == "" {
+		m.Duration = parent.Duration
+	}
+	if m.Rate == 0 {
+		m.Rate = parent.Rate
+	}
+	if m.Stages == nil {
+		m.Stages = parent.Stages
+	}
+	return &m
+}
+
+// think time before a target, either a duration for a fixed think
+// time (think-time: 2s) or a distribution
+type YamlConfigThinkTime struct {
+	Type   string `yaml:"type"`
+	Value  string `yaml:"value"`
+	Min    string `yaml:"min"`
+	Max    string `yaml:"max"`
+	Mean   string `yaml:"mean"`
+	StdDev string `yaml:"std-dev"`
+}
+
+func (t *YamlConfigThinkTime) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var fixed string
+	if err := unmarshal(&fixed); err == nil {
+		t.Type = curr.ThinkFixed
+		t.Value = fixed
+		return nil
+	}
+	type plain YamlConfigThinkTime
+	return unmarshal((*plain)(t))
+}
+
+// how the failed requests of a target are retried: max-attempts counts
+// the first attempt too, backoff is constant (default), exponential or
+// jittered starting from delay, and on lists the failures which are
+// retried (all of them when it is not given)
+type YamlConfigRetry struct {
+	MaxAttempts int        `yaml:"max-attempts"`
+	Backoff     string     `yaml:"backoff"`
+	Delay       string     `yaml:"delay"`
+	MaxDelay    string     `yaml:"max-delay"`
+	On          StringList `yaml:"on"`
+}
+
+// how often a data-source is run again while the test runs, either a
+// duration (refresh: 5m) or a value in ms or sec
 type YamlConfigRefresh struct {
 	RefreshType string `yaml:"type"`
 	Value       int    `yaml:"value"`
+	// the duration, when refresh is given as one
+	Every string `yaml:"-"`
+}
+
+func (r *YamlConfigRefresh) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var every string
+	if err := unmarshal(&every); err == nil {
+		r.Every = every
+		return nil
+	}
+	type plain YamlConfigRefresh
+	return unmarshal((*plain)(r))
 }
 
 type YamlConfigSectionLogs struct {
 	Enabled bool   `yaml:"enabled"`
 	Dir     string `yaml:"dir"`
+	// debug, info (default), warn, error or fatal
+	Level string `yaml:"level"`
+	// file (default) or stderr
+	Mode string `yaml:"mode"`
+	// text (default) or json
+	Format string `yaml:"format"`
+	// the log file is rotated once it grows over max-size megabytes
+	MaxSize    int64 `yaml:"max-size"`
+	MaxBackups int   `yaml:"max-backups"`
+	// of each message key, the first messages are written, then one of every
+	Sample *YamlConfigLogSample `yaml:"sample"`
+}
+
+type YamlConfigLogSample struct {
+	First int `yaml:"first"`
+	Every int `yaml:"every"`
+}
+
+// YamlConfigTargets holds the targets in the order they are written in
+// the yaml file. Targets are given either as a map by their names, or as
+// a list in which each target has a name.
+type YamlConfigTargets struct {
+	Names   []string
+	Targets map[string]*YamlConfigSectionTarget
+}
+
+func (t *YamlConfigTargets) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	t.Targets = make(map[string]*YamlConfigSectionTarget)
+	var ref = &nodeRef{}
+	if err := unmarshal(ref); err != nil {
+		return err
+	}
+	var node = ref.node
+	if node.Kind == yaml.SequenceNode {
+		var list []*YamlConfigSectionTarget
+		err := unmarshal(&list)
+		var problems = make([]string, 0)
+		for i, target := range list {
+			if target == nil {
+				continue
+			}
+			if target.Name == "" {
+				problems = append(problems, fmt.Sprintf("line %v: target has no name", node.Content[i].Line))
+				continue
+			}
+			if _, ok := t.Targets[target.Name]; ok {
+				problems = append(problems, fmt.Sprintf("line %v: target %v is defined more than once", node.Content[i].Line, target.Name))
+				continue
+			}
+			t.Names = append(t.Names, target.Name)
+			t.Targets[target.Name] = target
+		}
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			problems = append(problems, typeErr.Errors...)
+		} else if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return &yaml.TypeError{Errors: problems}
+		}
+		return nil
+	}
+	// a map of targets, the keys of the node keep their order
+	err := unmarshal(&t.Targets)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		t.Names = append(t.Names, node.Content[i].Value)
+	}
+	return err
 }
 
-type YamlConfigTargets map[string]*YamlConfigSectionTarget
+// keeps the node it is decoded from
+type nodeRef struct {
+	node *yaml.Node
+}
+
+func (r *nodeRef) UnmarshalYAML(value *yaml.Node) error {
+	r.node = value
+	return nil
+}
+
+// Get returns the target by its name
+func (t *YamlConfigTargets) Get(name string) (*YamlConfigSectionTarget, bool) {
+	if t == nil {
+		return nil, false
+	}
+	target, ok := t.Targets[name]
+	return target, ok
+}
+
+// Add adds the target after the ones added before it, it is how a
+// program builds the targets of a config
+func (t *YamlConfigTargets) Add(name string, target *YamlConfigSectionTarget) *YamlConfigTargets {
+	if t.Targets == nil {
+		t.Targets = make(map[string]*YamlConfigSectionTarget)
+	}
+	if _, ok := t.Targets[name]; !ok {
+		t.Names = append(t.Names, name)
+	}
+	t.Targets[name] = target
+	return t
+}
+
+func (t *YamlConfigTargets) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.Names)
+}
 
 type YamlConfigSectionTarget struct {
+	// name of the target, when targets are given as a list
+	Name                   string               `yaml:"name"`
 	Assertions             map[string]string    `yaml:"assertions"`
 	Headers                map[string]string    `yaml:"headers"`
 	Method                 string               `yaml:"httpMethod"`
@@ -50,105 +293,1146 @@ type YamlConfigSectionTarget struct {
 	Variables              variable.VariableMap `yaml:"variables"`
 	Strategy               string               `yaml:"-"`
 	Refresh                *YamlConfigRefresh   `yaml:"refresh"`
+	OnFailure              string               `yaml:"on-failure"`
+	When                   StringList           `yaml:"when"`
+	Repeat                 int                  `yaml:"repeat"`
+	LoopOver               string               `yaml:"loop-over"`
+	LoopVar                string               `yaml:"loop-var"`
+	ThinkTime              *YamlConfigThinkTime `yaml:"think-time"`
+	Retry                  *YamlConfigRetry     `yaml:"retry"`
+	Weight                 *int                 `yaml:"weight"`
+	// targets which must run before this one in a chain
+	DependsOn StringList `yaml:"depends-on"`
+	// targets which must run after this one in a chain
+	Next StringList `yaml:"next"`
+	// http (default), grpc, websocket, tcp or udp
+	Protocol  string               `yaml:"protocol"`
+	Grpc      *YamlConfigGrpc      `yaml:"grpc"`
+	Websocket *YamlConfigWebsocket `yaml:"websocket"`
+	Socket    *YamlConfigSocket    `yaml:"socket"`
+	// the body of an http target is built from the graphql operation
+	Graphql *YamlConfigGraphql `yaml:"graphql"`
+	// the response of an http target is read as a stream of events
+	Stream *YamlConfigStream `yaml:"stream"`
+	// the target's own authentication, instead of the one of the test
+	Auth *YamlConfigAuth `yaml:"auth"`
+	// how the requests of an http target are signed
+	Signing *YamlConfigSigning `yaml:"signing"`
+	// the target's own capture, instead of the one of the test
+	Capture *YamlConfigCapture `yaml:"capture"`
+}
+
+// the method of a grpc target and the .proto files which define it, without
+// them the method is looked up by the server reflection. Relative paths are
+// relative to the directory of the config file.
+type YamlConfigGrpc struct {
+	Method      string     `yaml:"method"`
+	Proto       StringList `yaml:"proto"`
+	ImportPaths StringList `yaml:"import-paths"`
+}
+
+// the script of a websocket target; timeout is how long an expect step
+// waits for its reply (max-timeout or 10s by default) and hold is how
+// long the connection is kept open after the script
+type YamlConfigWebsocket struct {
+	Script  []*YamlConfigWebsocketStep `yaml:"script"`
+	Timeout string                     `yaml:"timeout"`
+	Hold    string                     `yaml:"hold"`
+}
+
+// a step of a websocket script has one of send, expect or sleep
+type YamlConfigWebsocketStep struct {
+	Send    string `yaml:"send"`
+	Expect  string `yaml:"expect"`
+	Timeout string `yaml:"timeout"`
+	Sleep   string `yaml:"sleep"`
+}
+
+// how a tcp or udp target sends its form-body, in the encoding (text,
+// hex or base64), and reads the response; without read it is not read
+type YamlConfigSocket struct {
+	Encoding string                `yaml:"encoding"`
+	Read     *YamlConfigSocketRead `yaml:"read"`
+}
+
+// the response is read until the delimiter, until the length is read,
+// or until the timeout (max-timeout or 10s by default, when until or
+// length is given) ends, whichever comes first
+type YamlConfigSocketRead struct {
+	Until   string `yaml:"until"`
+	Length  int    `yaml:"length"`
+	Timeout string `yaml:"timeout"`
+}
+
+// the operation of a graphql target, its query is given inline or by
+// query-file (relative to the directory of the config file)
+type YamlConfigGraphql struct {
+	Query         string                 `yaml:"query"`
+	QueryFile     string                 `yaml:"query-file"`
+	OperationName string                 `yaml:"operation-name"`
+	Variables     map[string]interface{} `yaml:"variables"`
+}
+
+// how a streaming response is read: format is sse (default) or lines,
+// it is read until max-events are read or duration is over, without
+// them until the server ends it
+type YamlConfigStream struct {
+	Format    string `yaml:"format"`
+	MaxEvents int    `yaml:"max-events"`
+	Duration  string `yaml:"duration"`
+}
+
+// how requests are authenticated: type is oauth2, jwt, basic, api-key
+// or none. key is the api key of api-key or the secret of HS256 jwts,
+// key-file (relative to the directory of the config file) holds the
+// secret or the pem private key of RS256 jwts.
+type YamlConfigAuth struct {
+	Type         string                 `yaml:"type"`
+	Header       string                 `yaml:"header"`
+	TokenUrl     string                 `yaml:"token-url"`
+	Grant        string                 `yaml:"grant"`
+	ClientId     string                 `yaml:"client-id"`
+	ClientSecret string                 `yaml:"client-secret"`
+	ClientAuth   string                 `yaml:"client-auth"`
+	Scope        string                 `yaml:"scope"`
+	Username     string                 `yaml:"username"`
+	Password     string                 `yaml:"password"`
+	Algorithm    string                 `yaml:"algorithm"`
+	Key          string                 `yaml:"key"`
+	KeyFile      string                 `yaml:"key-file"`
+	Claims       map[string]interface{} `yaml:"claims"`
+	Ttl          string                 `yaml:"ttl"`
+}
+
+// how requests are signed: type is hmac or aws-sigv4. An hmac signature
+// is made by key (or the key of key-file) over the canonical parts, the
+// headers part has the given headers. Aws signatures are made by the
+// keys of an access key, for the region and the service (s3 by default).
+type YamlConfigSigning struct {
+	Type            string     `yaml:"type"`
+	Key             string     `yaml:"key"`
+	KeyFile         string     `yaml:"key-file"`
+	Header          string     `yaml:"header"`
+	TimestampHeader string     `yaml:"timestamp-header"`
+	Canonical       StringList `yaml:"canonical"`
+	Headers         StringList `yaml:"headers"`
+	Encoding        string     `yaml:"encoding"`
+	AccessKey       string     `yaml:"access-key"`
+	SecretKey       string     `yaml:"secret-key"`
+	SessionToken    string     `yaml:"session-token"`
+	Region          string     `yaml:"region"`
+	Service         string     `yaml:"service"`
+}
+
+// which failed requests are dumped with their responses: the first
+// max-failures of each category (on), with bodies truncated to max-body
+// kilobytes, as jsonl or files in dir (the directory of the logs by default).
+// The secret headers are redacted unless redact is false.
+type YamlConfigCapture struct {
+	MaxFailures int        `yaml:"max-failures"`
+	MaxBody     int        `yaml:"max-body"`
+	Format      string     `yaml:"format"`
+	Dir         string     `yaml:"dir"`
+	On          StringList `yaml:"on"`
+	Redact      *bool      `yaml:"redact"`
+}
+
+// StringList accepts either a single string or a list of strings
+type StringList []string
+
+func (s *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*s = StringList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
 }
 
 type ConfigYaml struct {
-	rawBytes   []byte
 	yamlConfig *YamlConfigHolder
+	// the composed document, to find the lines of errors
+	root *yaml.Node
+	// the file of each node of root, empty for the main file
+	files   map[*yaml.Node]string
+	baseDir string
+	// env of the overlay and the overrides (like main.concurrency=50)
+	env       string
+	overrides []string
+	// the document given instead of a file, see LoadConfigs
+	document []byte
+	// the config is given by another host, see Untrusted
+	untrusted bool
+	// descriptors of the proto files of grpc targets, by the files
+	protos map[string]*grpc.Descriptors
+	// the provider of the auth section, shared by the targets
+	auth *auth.Provider
+	// the options of the logs section
+	logs *logger.Options
+	// the capture section, each target has a capturer of its own
+	capture *capture.Config
 }
 
+// the name of a document given to LoadConfigs in the errors
+const givenDocument = "<document>"
+
 func NewConfigYaml() *ConfigYaml {
 	return &ConfigYaml{}
 }
 
+// LoadConfigs loads the configs of the targets from the yaml file,
+// composed of the files it includes, the env overlay and the overrides.
+// The config is validated as a whole: unknown fields, wrong values and
+// undefined variables are all reported at once by a ConfigErrors, each
+// error with its line in the file. Instead of the name of a file, the
+// document itself can be given as []byte, like the one of Composed, or
+// a *YamlConfigHolder built by a program.
 func (c *ConfigYaml) LoadConfigs(vars ...interface{}) ([]*Config, error) {
 	if len(vars) == 0 {
 		return nil, errors.New("yaml config file is required")
 	}
-	var fileName = vars[0].(string)
-	b, err := c.readFile(fileName)
-	if err != nil {
-		return nil, err
+	var fileName string
+	var errs = &ConfigErrors{}
+	switch v := vars[0].(type) {
+	case string:
+		fileName = v
+	case []byte:
+		c.document = v
+		fileName = givenDocument
+	case *YamlConfigHolder:
+		// a config built by a program, its errors have no lines
+		if len(v.Include) > 0 {
+			return nil, errors.New("include is only used by config files")
+		}
+		c.yamlConfig = v
+		return c.load(errs)
+	default:
+		return nil, errors.New("yaml config file is required")
 	}
-	cnf := &Config{}
-	err = yaml.Unmarshal(b, cnf)
+	root, err := c.compose(fileName, errs)
 	if err != nil {
 		return nil, err
 	}
-	c.rawBytes = b
+	c.root = root
 	ymlCnf := &YamlConfigHolder{}
-	err = yaml.Unmarshal(c.rawBytes, ymlCnf)
+	if err = c.root.Decode(ymlCnf); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+		// errors of the files are already found while composing,
+		// the rest are made by the overrides
+		if len(*errs) == 0 {
+			for _, e := range typeErr.Errors {
+				errs.addDecodeError("", e)
+			}
+		}
+	}
 	c.yamlConfig = ymlCnf
-	if err != nil {
-		return nil, err
+	return c.load(errs)
+}
+
+// maps the decoded config to the configs of the targets, the errors
+// are added to errs, which is returned if it is not empty
+func (c *ConfigYaml) load(errs *ConfigErrors) ([]*Config, error) {
+	var err error
+	if c.yamlConfig.Auth != nil {
+		if c.auth, err = c.parseAuth(c.yamlConfig.Auth); err != nil {
+			errs.add(c.lineOf("auth"), "auth", err.Error())
+		}
+	}
+	if c.yamlConfig.Capture != nil {
+		if c.capture, err = parseCapture(c.yamlConfig.Capture); err != nil {
+			errs.add(c.lineOf("capture"), "capture", err.Error())
+		}
+		if c.untrusted && c.yamlConfig.Capture.Dir != "" {
+			errs.add(c.lineOf("capture", "dir"), "capture", errUntrustedDir("capture").Error())
+		}
+	}
+	if c.yamlConfig.Logs != nil {
+		if c.logs, err = parseLogs(c.yamlConfig.Logs); err != nil {
+			errs.add(c.lineOf("logs"), "logs", err.Error())
+		}
+		if c.untrusted && c.yamlConfig.Logs.Dir != "" {
+			errs.add(c.lineOf("logs", "dir"), "logs", errUntrustedDir("logs").Error())
+		}
 	}
 	var configs = make([]*Config, 0)
-	if c.yamlConfig != nil && c.yamlConfig.Targets != nil && len(c.yamlConfig.Targets) > 0 {
-		for targetName, unconvertedConfig := range c.yamlConfig.Targets {
-			if unconvertedConfig != nil {
-				cc, err := c.mapYmlToConfig(targetName, unconvertedConfig, c.yamlConfig.Logs)
-				if err != nil {
-					logger.InfoOut("config failed", err.Error())
-					continue
+	var main = c.yamlConfig.Main
+	if main == nil {
+		main = &YamlConfigSectionMain{}
+	}
+	if len(c.yamlConfig.Scenarios) > 0 {
+		configs = append(configs, c.loadScenarios(main, errs)...)
+	} else if c.yamlConfig.Targets.Len() > 0 {
+		names, err := c.yamlConfig.Targets.chainOrder()
+		if err != nil {
+			errs.add(c.lineOf("targets"), "targets", err.Error())
+		} else {
+			for _, targetName := range names {
+				if unconvertedConfig := c.yamlConfig.Targets.Targets[targetName]; unconvertedConfig != nil {
+					cc, err := c.mapYmlToConfig("", main, targetName, unconvertedConfig, c.yamlConfig.Logs)
+					if err != nil {
+						c.addTargetErrors(errs, "targets", "", targetName, err)
+						continue
+					}
+					configs = append(configs, cc)
 				}
-				configs = append(configs, cc)
 			}
+			c.checkVariables(errs, "", names, main.Strategy)
 		}
+	} else {
+		errs.add(position{}, "", "no target is defined")
 	}
-	if c.yamlConfig != nil && c.yamlConfig.DataSources != nil && len(c.yamlConfig.DataSources) > 0 {
-		for targetName, unconvertedConfig := range c.yamlConfig.DataSources {
-			if unconvertedConfig != nil {
-				cc, err := c.mapYmlToConfig(targetName, unconvertedConfig, c.yamlConfig.Logs)
+	if c.yamlConfig.DataSources.Len() > 0 {
+		for _, targetName := range c.yamlConfig.DataSources.Names {
+			if unconvertedConfig := c.yamlConfig.DataSources.Targets[targetName]; unconvertedConfig != nil {
+				cc, err := c.mapDataSource(main, targetName, unconvertedConfig)
 				if err != nil {
-					logger.InfoOut("config failed", err.Error())
+					c.addTargetErrors(errs, "data-sources", "", targetName, err)
 					continue
 				}
 				configs = append(configs, cc)
 			}
 		}
 	}
+	c.checkRefresh(errs)
+	if len(*errs) > 0 {
+		errs.sort()
+		return nil, *errs
+	}
 	return configs, nil
 }
 
-func (c *ConfigYaml) mapYmlToConfig(targetName string, ymlConfig *YamlConfigSectionTarget, logsConfig *YamlConfigSectionLogs) (*Config, error) {
+// maps a data-source, which is mapped as a target is, with its refresh
+func (c *ConfigYaml) mapDataSource(main *YamlConfigSectionMain, name string, ymlConfig *YamlConfigSectionTarget) (*Config, error) {
+	cc, err := c.mapYmlToConfig("", main, name, ymlConfig, c.yamlConfig.Logs)
+	if err != nil {
+		return nil, err
+	}
+	cc.DataSource = true
+	if cc.Refresh, err = parseRefresh(ymlConfig.Refresh); err != nil {
+		return nil, fieldErrors{{field: "refresh", err: err}}
+	}
+	return cc, nil
+}
+
+// creates the configs of the targets of each scenario, in the order given
+// by the scenario. Scenarios are sorted by name.
+func (c *ConfigYaml) loadScenarios(main *YamlConfigSectionMain, errs *ConfigErrors) []*Config {
+	var names = make([]string, 0, len(c.yamlConfig.Scenarios))
+	for name := range c.yamlConfig.Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var configs = make([]*Config, 0)
+	for _, scenarioName := range names {
+		var path = "scenarios." + scenarioName
+		scenario := c.yamlConfig.Scenarios[scenarioName]
+		if scenario == nil || len(scenario.Targets) == 0 {
+			errs.add(c.lineOf("scenarios", scenarioName), path, "scenario has no targets")
+			continue
+		}
+		startDelay, err := parseOptionalDuration("start-delay", scenario.StartDelay)
+		if err != nil {
+			errs.add(c.lineOf("scenarios", scenarioName, "start-delay"), path, err.Error())
+		}
+		var settings = scenario.YamlConfigSectionMain.inherit(main)
+		var chain = make([]string, 0, len(scenario.Targets))
+		for _, targetName := range scenario.Targets {
+			target, ok := c.yamlConfig.Targets.Get(targetName)
+			if !ok || target == nil {
+				errs.add(c.lineOf("scenarios", scenarioName, "targets"), path, "target "+targetName+" is not defined")
+				continue
+			}
+			chain = append(chain, targetName)
+			cc, err := c.mapYmlToConfig(scenarioName, settings, targetName, target, c.yamlConfig.Logs)
+			if err != nil {
+				c.addTargetErrors(errs, "targets", scenarioName, targetName, err)
+				continue
+			}
+			cc.StartDelay = startDelay
+			configs = append(configs, cc)
+		}
+		c.checkVariables(errs, scenarioName, chain, settings.Strategy)
+	}
+	return configs
+}
+
+func (c *ConfigYaml) mapYmlToConfig(scenarioName string, main *YamlConfigSectionMain, targetName string, ymlConfig *YamlConfigSectionTarget, logsConfig *YamlConfigSectionLogs) (*Config, error) {
 	cc := &Config{}
+	var errs = fieldErrors{}
 	var err error
 	cc.VariablesMap = ymlConfig.Variables
-	cc.Assertions, err = c.ParseAssertions(ymlConfig.Assertions)
-	if err != nil {
-		return nil, err
+	cc.Protocol = ymlConfig.Protocol
+	if cc.Protocol == "" {
+		cc.Protocol = ProtocolHttp
 	}
-	cc.Headers, err = c.ParseHeaders(ymlConfig.Headers)
-	if err != nil {
-		return nil, err
+	var assertionValues = ymlConfig.Assertions
+	if cc.Protocol == ProtocolGrpc {
+		assertionValues = withGrpcStatus(assertionValues)
 	}
-	cc.NumberOfRequests = c.yamlConfig.Main.NumberOfRequests
-	cc.Concurrency = c.yamlConfig.Main.Concurrency
+	cc.Assertions, err = c.ParseAssertions(assertionValues)
+	errs.add("assertions", err)
+	cc.Headers, err = c.ParseHeaders(ymlConfig.Headers)
+	errs.add("headers", err)
+	cc.NumberOfRequests = main.NumberOfRequests
+	cc.Concurrency = main.Concurrency
 	cc.FormBody = ymlConfig.FormBody
 	cc.Method = strings.ToUpper(ymlConfig.Method)
+	errs.add("httpMethod", validateMethod(cc.Method))
 	cc.Url = ymlConfig.Url
+	errs.add("url", validateUrl(cc.Url, cc.Protocol))
 	cc.TargetName = targetName
 	cc.MaxTimeout = ymlConfig.MaxTimeout
+	if cc.MaxTimeout < 0 {
+		errs.add("max-timeout", errors.New("max-timeout cannot be negative"))
+	}
 	if logsConfig != nil {
 		cc.EnabledLogs = logsConfig.Enabled
 		cc.LogFileDirectory = logsConfig.Dir
 	}
+	cc.Log = c.logs
 	cc.ExecDurationHeaderName = ymlConfig.ExecDurationHeaderName
 	cc.CacheUsageHeaderName = ymlConfig.CacheUsageHeaderName
-	cc.Strategy = c.yamlConfig.Main.Strategy
+	cc.Strategy = main.Strategy
+	switch cc.Strategy {
+	case "":
+		cc.Strategy = StrategySeq
+	case StrategySeq, StrategyParallel, StrategyRoundRobin, StrategyWeighted:
+	default:
+		errs.addMain("strategy", errors.New("strategy must be one of: seq, parallel, round-robin, weighted"))
+	}
+	cc.OnFailure, err = c.parseOnFailure(ymlConfig.OnFailure)
+	errs.add("on-failure", err)
+	for _, w := range ymlConfig.When {
+		cond, err := variable.ParseCondition(w)
+		if err != nil {
+			errs.add("when", err)
+			continue
+		}
+		cc.When = append(cc.When, cond)
+	}
+	cc.Repeat = ymlConfig.Repeat
+	if cc.Repeat < 0 {
+		errs.add("repeat", errors.New("repeat cannot be negative"))
+	}
+	cc.LoopOver = ymlConfig.LoopOver
+	cc.LoopVar = ymlConfig.LoopVar
+	cc.ThinkTime, err = c.parseThinkTime(ymlConfig.ThinkTime)
+	errs.add("think-time", err)
+	cc.Retry, err = c.parseRetry(ymlConfig.Retry)
+	errs.add("retry", err)
+	cc.Auth = c.auth
+	if ymlConfig.Auth != nil {
+		cc.Auth, err = c.parseAuth(ymlConfig.Auth)
+		errs.add("auth", err)
+	}
+	cc.Pacing, err = parseOptionalDuration("pacing", main.Pacing)
+	errs.addMain("pacing", err)
+	cc.Weight = 1
+	if ymlConfig.Weight != nil {
+		if *ymlConfig.Weight < 1 {
+			errs.add("weight", errors.New("weight must be 1 or more, leave the target out of the test to send it no requests"))
+		}
+		cc.Weight = *ymlConfig.Weight
+	}
+	cc.Scheduler = main.Scheduler
+	if cc.Scheduler != "" && cc.Scheduler != SchedulerSmooth && cc.Scheduler != SchedulerRandom {
+		errs.addMain("scheduler", errors.New("scheduler must be one of: smooth, random"))
+	}
+	cc.Scenario = scenarioName
+	c.mapExecutor(main, cc, &errs)
+	cc.Cookies = main.Cookies
+	cc.CookieSeed = main.CookieSeed
+	c.mapProtocol(ymlConfig, cc, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return cc, nil
 }
 
+// checks the fields which depend on the protocol of the target, and
+// loads the method of a grpc target from its proto files
+func (c *ConfigYaml) mapProtocol(ymlConfig *YamlConfigSectionTarget, cc *Config, errs *fieldErrors) {
+	if cc.Protocol != ProtocolGrpc && ymlConfig.Grpc != nil {
+		errs.add("grpc", errors.New("grpc is only used by grpc targets (protocol: grpc)"))
+	}
+	if cc.Protocol != ProtocolWebsocket && ymlConfig.Websocket != nil {
+		errs.add("websocket", errors.New("websocket is only used by websocket targets (protocol: websocket)"))
+	}
+	if cc.Protocol != ProtocolTcp && cc.Protocol != ProtocolUdp && ymlConfig.Socket != nil {
+		errs.add("socket", errors.New("socket is only used by tcp and udp targets (protocol: tcp or udp)"))
+	}
+	if cc.Protocol != ProtocolHttp && ymlConfig.Graphql != nil {
+		errs.add("graphql", errors.New("graphql is only used by http targets"))
+	}
+	if cc.Protocol != ProtocolHttp && ymlConfig.Stream != nil {
+		errs.add("stream", errors.New("stream is only used by http targets"))
+	}
+	if cc.Protocol != ProtocolHttp && ymlConfig.Signing != nil {
+		errs.add("signing", errors.New("signing is only used by http targets"))
+	}
+	if cc.Protocol != ProtocolHttp && ymlConfig.Capture != nil {
+		errs.add("capture", errors.New("capture is only used by http targets"))
+	}
+	switch cc.Protocol {
+	case ProtocolHttp:
+		if _, ok := ymlConfig.Assertions[assertions.AssertGrpcStatus]; ok {
+			errs.add("assertions", errors.New("grpc-status is for grpc targets, http targets use status-is-ok"))
+		}
+		if ymlConfig.Graphql != nil {
+			c.mapGraphql(ymlConfig, cc, errs)
+		}
+		if ymlConfig.Stream != nil {
+			c.mapStream(ymlConfig.Stream, cc, errs)
+		}
+		if ymlConfig.Signing != nil {
+			var err error
+			cc.Signing, err = c.parseSigning(ymlConfig.Signing)
+			errs.add("signing", err)
+		}
+		c.mapCapture(ymlConfig, cc, errs)
+	case ProtocolGrpc:
+		c.mapGrpc(ymlConfig, cc, errs)
+	case ProtocolWebsocket:
+		c.mapWebsocket(ymlConfig, cc, errs)
+	case ProtocolTcp, ProtocolUdp:
+		c.mapSocket(ymlConfig, cc, errs)
+	default:
+		errs.add("protocol", errors.New("protocol must be one of: http, grpc, websocket, tcp, udp"))
+	}
+}
+
+func (c *ConfigYaml) mapGrpc(ymlConfig *YamlConfigSectionTarget, cc *Config, errs *fieldErrors) {
+	if cc.Method != "" {
+		errs.add("httpMethod", errors.New("httpMethod is not used by grpc targets, their method is grpc.method"))
+	}
+	for _, name := range []string{assertions.AssertStatusIsOk, assertions.AssertContentType} {
+		if _, ok := ymlConfig.Assertions[name]; ok {
+			errs.add("assertions", fmt.Errorf("%v is for http targets, grpc targets use grpc-status", name))
+		}
+	}
+	if ymlConfig.Grpc == nil || ymlConfig.Grpc.Method == "" {
+		errs.add("grpc", errors.New("grpc targets need grpc.method, like helloworld.Greeter/SayHello"))
+		return
+	}
+	cc.Grpc = &GrpcConfig{Method: ymlConfig.Grpc.Method}
+	if len(ymlConfig.Grpc.Proto) == 0 {
+		return
+	}
+	descriptors, err := c.loadProtos(ymlConfig.Grpc.Proto, ymlConfig.Grpc.ImportPaths)
+	if err != nil {
+		errs.add("grpc", err)
+		return
+	}
+	cc.Grpc.Descriptor, err = descriptors.Method(cc.Grpc.Method)
+	errs.add("grpc", err)
+}
+
+// maps the operation of a graphql target, which is sent by POST as json
+func (c *ConfigYaml) mapGraphql(ymlConfig *YamlConfigSectionTarget, cc *Config, errs *fieldErrors) {
+	var gql = ymlConfig.Graphql
+	if cc.FormBody != "" {
+		errs.add("form-body", errors.New("form-body is not used by graphql targets, their body is built from graphql"))
+	}
+	if cc.Method == "" {
+		cc.Method = http.MethodPost
+	} else if cc.Method != http.MethodPost {
+		errs.add("httpMethod", errors.New("graphql targets are sent by POST"))
+	}
+	cc.Graphql = &GraphqlConfig{Query: gql.Query, OperationName: gql.OperationName, Variables: gql.Variables}
+	if gql.Query != "" && gql.QueryFile != "" {
+		errs.add("graphql", errors.New("graphql has both query and query-file, only one of them is used"))
+	} else if gql.QueryFile != "" {
+		b, err := c.readRelative(gql.QueryFile)
+		if err != nil {
+			errs.add("graphql", errors.New("cannot read the query-file: "+err.Error()))
+		}
+		cc.Graphql.Query = string(b)
+	} else if gql.Query == "" {
+		errs.add("graphql", errors.New("graphql needs query or query-file"))
+	}
+	if cc.Graphql.OperationName == "" {
+		cc.Graphql.OperationName = graphqlOperationName(cc.Graphql.Query)
+	}
+	if cc.Headers == nil {
+		cc.Headers = http.Header{}
+	}
+	if cc.Headers.Get("Content-Type") == "" {
+		cc.Headers.Set("Content-Type", "application/json")
+	}
+}
+
+func (c *ConfigYaml) mapStream(stream *YamlConfigStream, cc *Config, errs *fieldErrors) {
+	var err error
+	cc.Stream = &StreamConfig{Format: stream.Format, MaxEvents: stream.MaxEvents}
+	switch cc.Stream.Format {
+	case "":
+		cc.Stream.Format = StreamSse
+	case StreamSse, StreamLines:
+	default:
+		errs.add("stream", errors.New("stream.format must be one of: sse, lines"))
+	}
+	if cc.Stream.MaxEvents < 0 {
+		errs.add("stream", errors.New("stream.max-events cannot be negative"))
+	}
+	cc.Stream.Duration, err = parseOptionalDuration("stream.duration", stream.Duration)
+	errs.add("stream", err)
+}
+
+// maps how a tcp or udp target sends its payload and reads the response
+func (c *ConfigYaml) mapSocket(ymlConfig *YamlConfigSectionTarget, cc *Config, errs *fieldErrors) {
+	if cc.Method != "" {
+		errs.add("httpMethod", fmt.Errorf("httpMethod is not used by %v targets", cc.Protocol))
+	}
+	if len(ymlConfig.Headers) > 0 {
+		errs.add("headers", fmt.Errorf("headers are not used by %v targets", cc.Protocol))
+	}
+	for _, name := range []string{assertions.AssertStatusIsOk, assertions.AssertContentType, assertions.AssertGrpcStatus} {
+		if _, ok := ymlConfig.Assertions[name]; ok {
+			errs.add("assertions", fmt.Errorf("%v is not used by %v targets, they use body-string or body-hex", name, cc.Protocol))
+		}
+	}
+	if ymlConfig.Auth != nil {
+		errs.add("auth", fmt.Errorf("auth is not used by %v targets", cc.Protocol))
+	}
+	// nor is the auth of the test
+	cc.Auth = nil
+	cc.Socket = &SocketConfig{Encoding: EncodingText}
+	var socket = ymlConfig.Socket
+	if socket == nil {
+		socket = &YamlConfigSocket{}
+	}
+	switch socket.Encoding {
+	case "":
+	case EncodingText, EncodingHex, EncodingBase64:
+		cc.Socket.Encoding = socket.Encoding
+	default:
+		errs.add("socket", errors.New("socket.encoding must be one of: text, hex, base64"))
+		return
+	}
+	// a payload with variables is decoded once they are replaced
+	if !strings.Contains(cc.FormBody, "$") {
+		if _, err := DecodePayload(cc.Socket.Encoding, cc.FormBody); err != nil {
+			errs.add("form-body", err)
+		}
+	}
+	if socket.Read == nil {
+		return
+	}
+	var err error
+	cc.Socket.Read = true
+	cc.Socket.ReadLength = socket.Read.Length
+	if cc.Socket.ReadLength < 0 {
+		errs.add("socket", errors.New("socket.read.length cannot be negative"))
+	}
+	if socket.Read.Until != "" {
+		if cc.Socket.ReadUntil, err = DecodePayload(cc.Socket.Encoding, socket.Read.Until); err != nil {
+			errs.add("socket", errors.New("socket.read.until is not valid "+cc.Socket.Encoding))
+		}
+	}
+	cc.Socket.ReadTimeout, err = parseOptionalDuration("socket.read.timeout", socket.Read.Timeout)
+	errs.add("socket", err)
+	if socket.Read.Until == "" && socket.Read.Length == 0 && socket.Read.Timeout == "" {
+		errs.add("socket", errors.New("socket.read needs until, length or timeout"))
+	}
+	if cc.Socket.ReadTimeout == 0 {
+		cc.Socket.ReadTimeout = time.Duration(cc.MaxTimeout) * time.Second
+	}
+	if cc.Socket.ReadTimeout == 0 {
+		cc.Socket.ReadTimeout = DefaultSocketReadTimeout
+	}
+}
+
+// maps the script of a websocket target, each step must
+// have one of send, expect or sleep
+func (c *ConfigYaml) mapWebsocket(ymlConfig *YamlConfigSectionTarget, cc *Config, errs *fieldErrors) {
+	if cc.Method != "" {
+		errs.add("httpMethod", errors.New("httpMethod is not used by websocket targets"))
+	}
+	if cc.FormBody != "" {
+		errs.add("form-body", errors.New("form-body is not used by websocket targets, their messages are sent by websocket.script"))
+	}
+	for _, name := range []string{assertions.AssertStatusIsOk, assertions.AssertContentType, assertions.AssertGrpcStatus} {
+		if _, ok := ymlConfig.Assertions[name]; ok {
+			errs.add("assertions", fmt.Errorf("%v is not used by websocket targets, they use body-string on the last message received", name))
+		}
+	}
+	var ws = ymlConfig.Websocket
+	if ws == nil || len(ws.Script) == 0 {
+		errs.add("websocket", errors.New("websocket targets need websocket.script, a list of send, expect and sleep steps"))
+		return
+	}
+	var err error
+	cc.Websocket = &WebsocketConfig{Script: make([]*WebsocketStep, 0, len(ws.Script))}
+	cc.Websocket.Timeout, err = parseOptionalDuration("websocket.timeout", ws.Timeout)
+	errs.add("websocket", err)
+	if cc.Websocket.Timeout == 0 {
+		cc.Websocket.Timeout = time.Duration(cc.MaxTimeout) * time.Second
+	}
+	if cc.Websocket.Timeout == 0 {
+		cc.Websocket.Timeout = DefaultWebsocketTimeout
+	}
+	cc.Websocket.Hold, err = parseOptionalDuration("websocket.hold", ws.Hold)
+	errs.add("websocket", err)
+	for i, st := range ws.Script {
+		if st == nil {
+			continue
+		}
+		var field = fmt.Sprintf("websocket.script[%v]", i)
+		var step = &WebsocketStep{Send: st.Send, Expect: st.Expect}
+		step.Sleep, err = parseOptionalDuration(field+".sleep", st.Sleep)
+		errs.add("websocket", err)
+		step.Timeout, err = parseOptionalDuration(field+".timeout", st.Timeout)
+		errs.add("websocket", err)
+		var kinds = 0
+		for _, set := range []bool{st.Send != "", st.Expect != "", st.Sleep != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			errs.add("websocket", errors.New(field+" must have one of send, expect or sleep"))
+		} else if st.Timeout != "" && st.Expect == "" {
+			errs.add("websocket", errors.New(field+".timeout is only used by expect steps"))
+		}
+		if step.Expect != "" && step.Timeout == 0 {
+			step.Timeout = cc.Websocket.Timeout
+		}
+		cc.Websocket.Script = append(cc.Websocket.Script, step)
+	}
+}
+
+// loads the proto files, the ones of several targets are loaded once
+func (c *ConfigYaml) loadProtos(files, importPaths []string) (*grpc.Descriptors, error) {
+	if c.untrusted {
+		return nil, errUntrusted
+	}
+	var key = strings.Join(files, ",") + ";" + strings.Join(importPaths, ",")
+	if d, ok := c.protos[key]; ok {
+		return d, nil
+	}
+	var relative = func(paths []string) []string {
+		var joined = make([]string, 0, len(paths))
+		for _, p := range paths {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(c.baseDir, p)
+			}
+			joined = append(joined, p)
+		}
+		return joined
+	}
+	d, err := grpc.LoadProtoFiles(relative(files), relative(importPaths))
+	if err != nil {
+		return nil, err
+	}
+	if c.protos == nil {
+		c.protos = make(map[string]*grpc.Descriptors)
+	}
+	c.protos[key] = d
+	return d, nil
+}
+
+// grpc targets assert that the status is OK, unless they assert another one
+func withGrpcStatus(values map[string]string) map[string]string {
+	if _, ok := values[assertions.AssertGrpcStatus]; ok {
+		return values
+	}
+	var copied = map[string]string{assertions.AssertGrpcStatus: grpc.OK.String()}
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+func (c *ConfigYaml) mapExecutor(main *YamlConfigSectionMain, cc *Config, errs *fieldErrors) {
+	var err error
+	cc.Executor = main.Executor
+	if cc.Executor == "" {
+		cc.Executor = ExecutorClosedLoop
+	}
+	cc.Duration, err = parseOptionalDuration("duration", main.Duration)
+	errs.addMain("duration", err)
+	cc.Rate = main.Rate
+	for _, st := range main.Stages {
+		if st == nil {
+			continue
+		}
+		d, err := parseOptionalDuration("stages.duration", st.Duration)
+		errs.addMain("stages", err)
+		cc.Stages = append(cc.Stages, Stage{Duration: d, Target: st.Target})
+	}
+	switch cc.Executor {
+	case ExecutorClosedLoop:
+		if cc.NumberOfRequests < 1 && cc.Duration == 0 {
+			errs.addMain("request-count", errors.New("request-count must be greater than zero, unless a duration is given"))
+		}
+	case ExecutorRate:
+		if cc.Rate <= 0 {
+			errs.addMain("rate", errors.New("rate executor needs a rate greater than zero"))
+		} else if cc.Duration == 0 && cc.NumberOfRequests == 0 {
+			errs.addMain("executor", errors.New("rate executor needs a duration or a request-count"))
+		}
+	case ExecutorRamping:
+		if len(cc.Stages) == 0 {
+			errs.addMain("executor", errors.New("ramping executor needs at least one stage"))
+		}
+	default:
+		errs.addMain("executor", errors.New("executor must be one of: closed-loop, rate, ramping"))
+	}
+	if cc.Concurrency < 1 {
+		errs.addMain("concurrency", errors.New("concurrency must be greater than zero"))
+	}
+}
+
+func (c *ConfigYaml) parseOnFailure(v string) (string, error) {
+	switch v {
+	case "":
+		return OnFailureContinue, nil
+	case OnFailureContinue, OnFailureStop, OnFailureRetry:
+		return v, nil
+	}
+	return "", errors.New("on-failure must be one of: continue, stop, retry")
+}
+
+func (c *ConfigYaml) parseThinkTime(yt *YamlConfigThinkTime) (*curr.ThinkTime, error) {
+	if yt == nil {
+		return nil, nil
+	}
+	var err error
+	tt := &curr.ThinkTime{Distribution: yt.Type}
+	if tt.Distribution == "" {
+		tt.Distribution = curr.ThinkFixed
+	}
+	if tt.Value, err = parseOptionalDuration("think-time.value", yt.Value); err != nil {
+		return nil, err
+	}
+	if tt.Min, err = parseOptionalDuration("think-time.min", yt.Min); err != nil {
+		return nil, err
+	}
+	if tt.Max, err = parseOptionalDuration("think-time.max", yt.Max); err != nil {
+		return nil, err
+	}
+	if tt.Mean, err = parseOptionalDuration("think-time.mean", yt.Mean); err != nil {
+		return nil, err
+	}
+	if tt.StdDev, err = parseOptionalDuration("think-time.std-dev", yt.StdDev); err != nil {
+		return nil, err
+	}
+	if err = tt.Validate(); err != nil {
+		return nil, err
+	}
+	return tt, nil
+}
+
+func (c *ConfigYaml) parseRetry(yr *YamlConfigRetry) (*RetryConfig, error) {
+	if yr == nil {
+		return nil, nil
+	}
+	var err error
+	rc := &RetryConfig{MaxAttempts: yr.MaxAttempts, Backoff: yr.Backoff, On: yr.On}
+	if rc.Delay, err = parseOptionalDuration("retry.delay", yr.Delay); err != nil {
+		return nil, err
+	}
+	if rc.MaxDelay, err = parseOptionalDuration("retry.max-delay", yr.MaxDelay); err != nil {
+		return nil, err
+	}
+	if err = rc.Validate(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func parseRefresh(yr *YamlConfigRefresh) (time.Duration, error) {
+	if yr == nil {
+		return 0, nil
+	}
+	if yr.Every != "" {
+		d, err := parseOptionalDuration("refresh", yr.Every)
+		if err == nil && d <= 0 {
+			err = errors.New("refresh must be positive")
+		}
+		return d, err
+	}
+	if yr.Value <= 0 {
+		return 0, errors.New("refresh.value must be positive")
+	}
+	switch yr.RefreshType {
+	case "ms":
+		return time.Duration(yr.Value) * time.Millisecond, nil
+	case "sec":
+		return time.Duration(yr.Value) * time.Second, nil
+	}
+	return 0, errors.New("refresh.type must be one of: ms, sec")
+}
+
+func (c *ConfigYaml) parseAuth(ya *YamlConfigAuth) (*auth.Provider, error) {
+	ttl, err := parseOptionalDuration("auth.ttl", ya.Ttl)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.readKey("auth", ya.Key, ya.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return auth.New(&auth.Config{
+		Type:         ya.Type,
+		Header:       ya.Header,
+		TokenUrl:     ya.TokenUrl,
+		Grant:        ya.Grant,
+		ClientId:     ya.ClientId,
+		ClientSecret: ya.ClientSecret,
+		ClientAuth:   ya.ClientAuth,
+		Scope:        ya.Scope,
+		Username:     ya.Username,
+		Password:     ya.Password,
+		Algorithm:    ya.Algorithm,
+		Key:          key,
+		Claims:       ya.Claims,
+		Ttl:          ttl,
+		ApiKey:       ya.Key,
+	})
+}
+
+func parseCapture(yc *YamlConfigCapture) (*capture.Config, error) {
+	var cfg = &capture.Config{
+		MaxFailures: yc.MaxFailures,
+		MaxBody:     yc.MaxBody * 1024,
+		Format:      yc.Format,
+		Dir:         yc.Dir,
+		On:          yc.On,
+		KeepSecrets: yc.Redact != nil && !*yc.Redact,
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// gives the target a capturer by its own capture, or by the one of the
+// test; the dumps are written next to the logs unless a dir is given
+func (c *ConfigYaml) mapCapture(ymlConfig *YamlConfigSectionTarget, cc *Config, errs *fieldErrors) {
+	var cfg = c.capture
+	if ymlConfig.Capture != nil {
+		if c.untrusted && ymlConfig.Capture.Dir != "" {
+			errs.add("capture", errUntrustedDir("capture"))
+			return
+		}
+		var err error
+		if cfg, err = parseCapture(ymlConfig.Capture); err != nil {
+			errs.add("capture", err)
+			return
+		}
+	}
+	if cfg == nil {
+		return
+	}
+	var own = *cfg
+	if own.Dir == "" {
+		own.Dir = cc.LogFileDirectory
+	}
+	// the headers the credentials and the signature are sent in
+	if header := cc.Auth.Header(); header != "" {
+		own.Secrets = append(own.Secrets, header)
+	}
+	if cc.Signing != nil && cc.Signing.Header != "" {
+		own.Secrets = append(own.Secrets, cc.Signing.Header)
+	}
+	own.SecretValues = cc.Auth.Secrets()
+	if cc.Signing != nil {
+		own.SecretValues = append(own.SecretValues, string(cc.Signing.Key), cc.Signing.SecretKey, cc.Signing.SessionToken)
+	}
+	var name = cc.StatsName()
+	if cc.Scenario != "" {
+		name = cc.Scenario + "." + name
+	}
+	cc.Capture = capture.New(&own, name)
+}
+
+// the options of the logger by the logs section
+func parseLogs(yl *YamlConfigSectionLogs) (*logger.Options, error) {
+	var opts = &logger.Options{
+		Mode:       yl.Mode,
+		Level:      yl.Level,
+		Format:     yl.Format,
+		MaxSize:    yl.MaxSize * 1024 * 1024,
+		MaxBackups: yl.MaxBackups,
+	}
+	if yl.Sample != nil {
+		opts.SampleFirst, opts.SampleEvery = yl.Sample.First, yl.Sample.Every
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func (c *ConfigYaml) parseSigning(ys *YamlConfigSigning) (*signing.Config, error) {
+	key, err := c.readKey("signing", ys.Key, ys.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var sc = &signing.Config{
+		Type:            ys.Type,
+		Key:             key,
+		Header:          ys.Header,
+		TimestampHeader: ys.TimestampHeader,
+		Canonical:       ys.Canonical,
+		Headers:         ys.Headers,
+		Encoding:        ys.Encoding,
+		AccessKey:       ys.AccessKey,
+		SecretKey:       ys.SecretKey,
+		SessionToken:    ys.SessionToken,
+		Region:          ys.Region,
+		Service:         ys.Service,
+	}
+	if err = sc.Validate(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// the key of a section, given inline or by a file relative
+// to the directory of the config file
+func (c *ConfigYaml) readKey(section, key, keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return []byte(key), nil
+	}
+	if key != "" {
+		return nil, errors.New(section + " has both key and key-file, only one of them is used")
+	}
+	b, err := c.readRelative(keyFile)
+	if err != nil {
+		return nil, errors.New("cannot read the key-file: " + err.Error())
+	}
+	return b, nil
+}
+
+// parses a duration like 1s or 250ms, an empty value is zero
+func parseOptionalDuration(field, v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New(field + " must be a duration like 1s or 250ms")
+	}
+	return d, nil
+}
+
+// the error of an untrusted config which reads a file
+var errUntrusted = errors.New("the config is given by another host, it cannot read the files of this one")
+
+// the error of an untrusted config which sets the dir files are written to
+func errUntrustedDir(section string) error {
+	return errors.New(section + ".dir is not allowed, the config is given by another host, it cannot write to the dirs of this one")
+}
+
+// Untrusted marks the config as given by another host, like the test
+// of an agent: it cannot read the files of this host (include,
+// query-file, key-file and proto) nor set the dirs its logs and dumps
+// are written to, and its ${NAME} are not replaced by the environment
+// variables of this host
+func (c *ConfigYaml) Untrusted() {
+	c.untrusted = true
+}
+
 func (c *ConfigYaml) readFile(fileName string) ([]byte, error) {
+	if fileName == givenDocument && c.document != nil {
+		return c.document, nil
+	}
+	if c.untrusted {
+		return nil, errUntrusted
+	}
 	return ioutil.ReadFile(fileName)
 }
 
+// reads a file of a field, relative to the directory of the config file
+func (c *ConfigYaml) readRelative(path string) ([]byte, error) {
+	if c.untrusted {
+		return nil, errUntrusted
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.baseDir, path)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Composed returns the document of the config loaded by LoadConfigs, as
+// composed of the files it includes, the env overlay and the overrides.
+// The query-file of graphql and the key-file of auth and signing are
+// inlined as query and key, so it is loaded the same way without any of
+// those files; the proto files of grpc targets are not.
+func (c *ConfigYaml) Composed() ([]byte, error) {
+	if c.root == nil {
+		return nil, errors.New("no config is loaded")
+	}
+	var root = copyNode(c.root)
+	if err := c.inlineFiles(root, ""); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// replaces the files read by the node, a section or any node holding
+// sections, with their content
+func (c *ConfigYaml) inlineFiles(node *yaml.Node, section string) error {
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			if err := c.inlineFiles(child, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var key, value = node.Content[i], node.Content[i+1]
+		var inlined string
+		switch {
+		case section == "graphql" && key.Value == "query-file":
+			inlined = "query"
+		case (section == "auth" || section == "signing") && key.Value == "key-file":
+			inlined = "key"
+		}
+		if inlined == "" {
+			if err := c.inlineFiles(value, key.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := c.readRelative(value.Value)
+		if err != nil {
+			return errors.New(section + ": cannot read the " + key.Value + ": " + err.Error())
+		}
+		node.Content[i] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: inlined}
+		node.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(b)}
+	}
+	return nil
+}
+
 func (c *ConfigYaml) ParseAssertions(valuesMap map[string]string) (*assertions.AssertionManager, error) {
 	if valuesMap != nil && len(valuesMap) > 0 {
 		var assertionMap = map[string]assertions.Assertion{}
 		for k, v := range valuesMap {
-			asrt := assertions.NewAssertionFromName(k)
-			asrt.SetTest(v)
+			asrt, err := assertions.ParseAssertion(k, v)
+			if err != nil {
+				return nil, err
+			}
 			assertionMap[k] = asrt
 		}
 		return assertions.NewAssertionManagerWithDefaults(assertionMap), nil
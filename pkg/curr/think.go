@@ -0,0 +1,116 @@
+package curr
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	ThinkFixed       = "fixed"
+	ThinkUniform     = "uniform"
+	ThinkNormal      = "normal"
+	ThinkExponential = "exponential"
+)
+
+// ThinkTime is the pause a virtual user takes before a step, like a real
+// user reading a page before clicking the next link. Durations are drawn
+// from the given distribution:
+// fixed uses Value, uniform picks between Min and Max, normal uses Mean
+// and StdDev and exponential uses Mean. Max (if set) caps the normal and
+// exponential distributions, and no duration is ever negative.
+type ThinkTime struct {
+	Distribution string
+	Value        time.Duration
+	Min          time.Duration
+	Max          time.Duration
+	Mean         time.Duration
+	StdDev       time.Duration
+}
+
+func (t *ThinkTime) Validate() error {
+	switch t.Distribution {
+	case ThinkFixed:
+		if t.Value < 0 {
+			return errors.New("think-time value cannot be negative")
+		}
+	case ThinkUniform:
+		if t.Min < 0 || t.Max < t.Min {
+			return errors.New("think-time of uniform type needs 0 <= min <= max")
+		}
+	case ThinkNormal:
+		if t.Mean < 0 || t.StdDev < 0 {
+			return errors.New("think-time of normal type needs non-negative mean and std-dev")
+		}
+	case ThinkExponential:
+		if t.Mean <= 0 {
+			return errors.New("think-time of exponential type needs a positive mean")
+		}
+	default:
+		return errors.New("think-time type must be one of: fixed, uniform, normal, exponential")
+	}
+	return nil
+}
+
+// Duration draws a new think time
+func (t *ThinkTime) Duration() time.Duration {
+	if t == nil {
+		return 0
+	}
+	var d time.Duration
+	switch t.Distribution {
+	case ThinkFixed:
+		d = t.Value
+	case ThinkUniform:
+		d = t.Min
+		if t.Max > t.Min {
+			d += time.Duration(rand.Int63n(int64(t.Max - t.Min)))
+		}
+	case ThinkNormal:
+		d = t.Mean + time.Duration(rand.NormFloat64()*float64(t.StdDev))
+	case ThinkExponential:
+		d = time.Duration(rand.ExpFloat64() * float64(t.Mean))
+	}
+	if t.Max > 0 && d > t.Max {
+		d = t.Max
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// Think sleeps for a newly drawn think time, or until done is closed
+// (like when the test stops), and returns the time slept and whether
+// all of it is slept
+func (t *ThinkTime) Think(done <-chan struct{}) (time.Duration, bool) {
+	return sleep(t.Duration(), done)
+}
+
+// Pace sleeps for what is left of the pacing duration since start, so
+// an iteration which started at start takes at least pacing. It returns
+// the time slept, the sleep ends early once done is closed.
+func Pace(start time.Time, pacing time.Duration, done <-chan struct{}) time.Duration {
+	if pacing <= 0 {
+		return 0
+	}
+	slept, _ := sleep(pacing-time.Since(start), done)
+	return slept
+}
+
+// sleeps for d or until done is closed, it reports false if done is
+// closed first; a nil done never is
+func sleep(d time.Duration, done <-chan struct{}) (time.Duration, bool) {
+	if d <= 0 {
+		return 0, true
+	}
+	var start = time.Now()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return d, true
+	case <-done:
+		return time.Since(start), false
+	}
+}
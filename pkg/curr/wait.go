@@ -2,55 +2,134 @@ package curr
 
 import (
 	"errors"
+	"math/rand"
 	"time"
 )
 
 const (
 	MaxWaitError = "maximum wait limit passed"
-	BadArgs = "backoff and interval values cannot be greater than maxWait value"
+	StoppedError = "waiting is stopped"
+	BadArgs      = "backoff and interval values cannot be greater than maxWait value"
+)
+
+// kinds of backoff of NewBackoff
+const (
+	BackoffConstant    = "constant"
+	BackoffExponential = "exponential"
+	BackoffJittered    = "jittered"
 )
 
 type Wait struct {
 	interval time.Duration
-	backoff time.Duration
-	maxWait time.Duration
-	itr int64
-	err error
+	backoff  time.Duration
+	maxWait  time.Duration
+	// the interval is multiplied by it after each wait, when it is above 1
+	factor float64
+	// each wait is a random duration up to the interval
+	jitter   bool
+	itr      int64
+	err      error
 	stopChan chan bool
+	done     <-chan struct{}
 }
 
-
+// NewWait returns a wait which sleeps interval first, and backoff longer
+// each time after it. A zero maxWait does not limit the wait.
 func NewWait(interval, backoff, maxWait time.Duration) *Wait {
-	if interval > maxWait || backoff > maxWait {
+	if maxWait != 0 && (interval > maxWait || backoff > maxWait) {
 		return nil
 	}
 	return &Wait{
 		interval: interval,
-		maxWait: maxWait,
-		backoff: backoff,
+		maxWait:  maxWait,
+		backoff:  backoff,
 	}
 }
 
-func (w *Wait) SetChan(ch chan bool){
+// NewBackoff returns the wait of a kind of backoff starting from delay:
+// constant sleeps delay each time, exponential doubles it after each wait
+// and jittered sleeps a random duration up to the exponential one. The
+// waiting ends once the delay passes maxWait, when it is not zero.
+func NewBackoff(kind string, delay, maxWait time.Duration) *Wait {
+	var w = &Wait{interval: delay, maxWait: maxWait}
+	switch kind {
+	case BackoffExponential:
+		w.factor = 2
+	case BackoffJittered:
+		w.factor = 2
+		w.jitter = true
+	}
+	return w
+}
+
+// SetChan sets the channel which stops the waiting, by a value sent
+// on it or by closing it
+func (w *Wait) SetChan(ch chan bool) {
 	w.stopChan = ch
 }
 
+// SetDone sets a channel which stops the waiting once it is closed,
+// like the Done of a context
+func (w *Wait) SetDone(done <-chan struct{}) {
+	w.done = done
+}
+
 func (w *Wait) Waiting() bool {
 	if w.itr > 0 {
 		w.interval += w.backoff
+		if w.factor > 1 {
+			w.interval = time.Duration(float64(w.interval) * w.factor)
+		}
 	}
 
 	if w.maxWait != 0 && w.maxWait < w.interval {
-		 w.err = errors.New(MaxWaitError)
-		 return false
+		w.err = errors.New(MaxWaitError)
+		return false
 	}
 
-	time.Sleep(w.interval)
+	var d = w.interval
+	if w.jitter && d > 0 {
+		d = time.Duration(rand.Int63n(int64(d) + 1))
+	}
+	if w.stopped() {
+		return false
+	}
+	if w.stopChan == nil && w.done == nil {
+		time.Sleep(d)
+	} else {
+		timer := time.NewTimer(d)
+		select {
+		case <-w.stopChan:
+			timer.Stop()
+			w.err = errors.New(StoppedError)
+			return false
+		case <-w.done:
+			timer.Stop()
+			w.err = errors.New(StoppedError)
+			return false
+		case <-timer.C:
+		}
+	}
 	w.err = nil
 	w.itr++
 	return true
 }
 
+// whether the stop channel is already sent to or closed, or done is closed
+func (w *Wait) stopped() bool {
+	if w.stopChan == nil && w.done == nil {
+		return false
+	}
+	select {
+	case <-w.stopChan:
+	case <-w.done:
+	default:
+		return false
+	}
+	w.err = errors.New(StoppedError)
+	return true
+}
+
 func (w *Wait) Error() error {
 	return w.err
 }
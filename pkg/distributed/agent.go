@@ -0,0 +1,232 @@
+package distributed
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the address of an agent by default, it is only reached from its host
+const DefaultAgentAddress = "127.0.0.1:" + DefaultAgentPort
+
+// how long a loaded test waits for its start by default, it is
+// dropped if the coordinator does not start it by then
+const DefaultStartTimeout = time.Minute
+
+// Agent runs the tests given by a coordinator, one at a time. A test is
+// run in two steps: POST /run loads it and answers with a stream of
+// messages, the first one is ready; POST /start?id= starts it, then the
+// stream goes on with the stats of the test until it is done. The
+// requests must have the token of the agent as a bearer token, the
+// configs they send cannot read the files of the agent.
+type Agent struct {
+	StartTimeout time.Duration
+	token        string
+	lock         *sync.Mutex
+	// the id of the test the agent runs, empty if none
+	running string
+	starts  map[string]chan struct{}
+}
+
+// NewAgent makes an agent which runs the tests of the coordinators
+// having the token, no request is accepted when it is empty
+func NewAgent(token string) *Agent {
+	return &Agent{
+		StartTimeout: DefaultStartTimeout,
+		token:        token,
+		lock:         &sync.Mutex{},
+		starts:       make(map[string]chan struct{}),
+	}
+}
+
+// Handler returns the http handler of the agent
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", a.run)
+	mux.HandleFunc("/start", a.start)
+	return a.authorized(mux)
+}
+
+// only the requests with the token of the agent are handled
+func (a *Agent) authorized(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			http.Error(w, "the token of the agent is needed", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe runs the agent at the address, like 127.0.0.1:7048
+func (a *Agent) ListenAndServe(address string) error {
+	return http.ListenAndServe(address, a.Handler())
+}
+
+func (a *Agent) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req = &RunRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "not a run request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, err := a.reserve(req.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	defer a.release(req.Id)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	var stream = newStream(w)
+	var loader = config.NewConfigYaml()
+	loader.Untrusted()
+	lt, err := a.load(loader, req)
+	if err != nil {
+		stream.send(&Message{State: StateFailed, Error: err.Error()})
+		return
+	}
+	defer lt.Close()
+	if !stream.send(&Message{State: StateReady}) {
+		return
+	}
+	select {
+	case <-start:
+	case <-r.Context().Done():
+		fmt.Printf("the coordinator is gone, test %v is dropped\n", req.Id)
+		return
+	case <-time.After(a.StartTimeout):
+		stream.send(&Message{State: StateFailed, Error: "the test is not started in " + a.StartTimeout.String()})
+		return
+	}
+	fmt.Printf("running share %v of %v of test %v...\n", req.Index+1, req.Count, req.Id)
+	var startedAt = time.Now()
+	var done = make(chan struct{})
+	var runErr error
+	// once the coordinator is gone, the test is stopped
+	go func() {
+		runErr = lt.Start(r.Context())
+		close(done)
+	}()
+	var interval = req.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stream.send(&Message{State: StateRunning, Scenarios: lt.Snapshot()})
+		case <-done:
+			if runErr != nil {
+				stream.send(&Message{State: StateFailed, Error: runErr.Error()})
+				return
+			}
+			stream.send(&Message{State: StateDone, StartedAt: startedAt, Duration: time.Since(startedAt), Scenarios: lt.Snapshot()})
+			fmt.Printf("test %v is done\n", req.Id)
+			return
+		}
+	}
+}
+
+// loads the agent's share of the test, it has a logger of its own so
+// the tests of coordinators do not touch the globals of the agent
+func (a *Agent) load(loader *config.ConfigYaml, req *RunRequest) (*loadtest.LoadTest, error) {
+	configs, err := loader.LoadConfigs(req.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err = Share(configs, req.Index, req.Count); err != nil {
+		return nil, err
+	}
+	lt, err := loadtest.New(configs...)
+	if err != nil {
+		return nil, err
+	}
+	if err = lt.SetOptions(&loadtest.Options{Output: os.Stdout}); err != nil {
+		lt.Close()
+		return nil, err
+	}
+	return lt, nil
+}
+
+func (a *Agent) start(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var id = r.URL.Query().Get("id")
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	start, ok := a.starts[id]
+	if !ok {
+		http.Error(w, "test "+id+" is not waiting for its start", http.StatusNotFound)
+		return
+	}
+	close(start)
+	delete(a.starts, id)
+}
+
+// reserves the agent for the test, the channel is closed by its start
+func (a *Agent) reserve(id string) (chan struct{}, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if id == "" {
+		return nil, fmt.Errorf("the test has no id")
+	}
+	if a.running != "" {
+		return nil, fmt.Errorf("the agent runs test %v", a.running)
+	}
+	a.running = id
+	var start = make(chan struct{})
+	a.starts[id] = start
+	return start, nil
+}
+
+func (a *Agent) release(id string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.running = ""
+	delete(a.starts, id)
+}
+
+// writes messages as json lines, each one is flushed as it is written
+type stream struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	failed  bool
+}
+
+func newStream(w http.ResponseWriter) *stream {
+	flusher, _ := w.(http.Flusher)
+	return &stream{w: w, enc: json.NewEncoder(w), flusher: flusher}
+}
+
+// sends the message, it reports false once the coordinator cannot be reached
+func (s *stream) send(m *Message) bool {
+	if s.failed {
+		return false
+	}
+	if err := s.enc.Encode(m); err != nil {
+		fmt.Printf("cannot send the stats to the coordinator: %v\n", err.Error())
+		s.failed = true
+		return false
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/rs/xid"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Coordinator runs a test on its agents: each agent loads the config and
+// takes its share of the load, once all of them are ready they are started
+// together, and the stats they stream back are merged into one result
+type Coordinator struct {
+	// addresses of the agents, like 10.0.0.2:7048
+	Agents []string
+	// how often the agents send the stats of the test
+	Interval time.Duration
+	// called with the merged stats of all agents so far, after each
+	// interval; running is the number of agents whose test is not done
+	OnProgress func(running int, scenarios []*loadtest.ScenarioResult)
+	// the token of the agents, see NewAgent
+	token  string
+	client *http.Client
+}
+
+func NewCoordinator(agents []string, token string) *Coordinator {
+	return &Coordinator{Agents: agents, Interval: DefaultInterval, token: token, client: &http.Client{}}
+}
+
+// the connection to an agent during a test
+type agentRun struct {
+	address string
+	body    io.ReadCloser
+	dec     *json.Decoder
+	// the stats sent last
+	scenarios []*loadtest.ScenarioSnapshot
+	done      bool
+}
+
+// Run runs the test of the config document (see config.ConfigYaml.Composed)
+// on the agents. If an agent fails, the test fails and the other agents
+// stop their test. Once ctx is done while the test runs, the agents stop
+// their test too, and the stats they sent so far are returned with the
+// error of ctx.
+func (c *Coordinator) Run(ctx context.Context, document []byte) (*loadtest.Result, error) {
+	if len(c.Agents) == 0 {
+		return nil, errors.New("no agent is given to run the test")
+	}
+	var parent = ctx
+	ctx, cancel := context.WithCancel(ctx)
+	// the agents drop the test if the coordinator is gone before its start
+	defer cancel()
+	var id = xid.New().String()
+	var runs = make([]*agentRun, len(c.Agents))
+	var errs = make([]error, len(c.Agents))
+	wg := &sync.WaitGroup{}
+	for i, address := range c.Agents {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			runs[i], errs[i] = c.prepare(ctx, id, i, address, document)
+		}(i, address)
+	}
+	wg.Wait()
+	for _, r := range runs {
+		if r != nil {
+			defer r.body.Close()
+		}
+	}
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	var startedAt = time.Now()
+	for i, address := range c.Agents {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			errs[i] = c.start(ctx, id, address)
+		}(i, address)
+	}
+	wg.Wait()
+	if err := firstError(errs); err != nil {
+		return nil, err
+	}
+
+	var lock = &sync.Mutex{}
+	var stop = make(chan struct{})
+	if c.OnProgress != nil {
+		go c.reportProgress(runs, lock, stop)
+	}
+	// the first agent which fails fails the test, the others are not waited for
+	var failure error
+	var fail = &sync.Once{}
+	for _, r := range runs {
+		wg.Add(1)
+		go func(r *agentRun) {
+			defer wg.Done()
+			if err := c.follow(r, lock); err != nil {
+				fail.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}(r)
+	}
+	wg.Wait()
+	close(stop)
+	if failure != nil && parent.Err() == nil {
+		return nil, failure
+	}
+	var parts = make([][]*loadtest.ScenarioSnapshot, 0, len(runs))
+	for _, r := range runs {
+		parts = append(parts, r.scenarios)
+	}
+	return &loadtest.Result{
+		StartedAt: startedAt,
+		Duration:  time.Since(startedAt),
+		Scenarios: loadtest.MergeSnapshots(parts...),
+	}, parent.Err()
+}
+
+// sends the test to the agent, and waits until it is ready
+func (c *Coordinator) prepare(ctx context.Context, id string, index int, address string, document []byte) (*agentRun, error) {
+	b, err := json.Marshal(&RunRequest{Id: id, Config: document, Index: index, Count: len(c.Agents), Interval: c.Interval})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, agentUrl(address)+"/run", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("agent %v: %v", address, err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("agent %v cannot be reached: %v", address, err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("agent %v: %v", address, strings.TrimSpace(string(body)))
+	}
+	var r = &agentRun{address: address, body: resp.Body, dec: json.NewDecoder(resp.Body)}
+	m, err := r.next()
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if m.State != StateReady {
+		resp.Body.Close()
+		return nil, fmt.Errorf("agent %v is not ready, its state is %v", address, m.State)
+	}
+	return r, nil
+}
+
+func (c *Coordinator) start(ctx context.Context, id, address string) error {
+	req, err := http.NewRequest(http.MethodPost, agentUrl(address)+"/start?id="+id, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("agent %v cannot be started: %v", address, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("agent %v cannot be started: %v", address, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// reads the stats of the agent until its test is done
+func (c *Coordinator) follow(r *agentRun, lock *sync.Mutex) error {
+	for {
+		m, err := r.next()
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		r.scenarios = m.Scenarios
+		r.done = m.State == StateDone
+		lock.Unlock()
+		if r.done {
+			return nil
+		}
+	}
+}
+
+func (c *Coordinator) reportProgress(runs []*agentRun, lock *sync.Mutex, stop chan struct{}) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			var running = 0
+			var parts = make([][]*loadtest.ScenarioSnapshot, 0, len(runs))
+			lock.Lock()
+			for _, r := range runs {
+				if !r.done {
+					running++
+				}
+				parts = append(parts, r.scenarios)
+			}
+			lock.Unlock()
+			c.OnProgress(running, loadtest.MergeSnapshots(parts...))
+		}
+	}
+}
+
+// the next message of the agent, a failed message is returned as an error
+func (r *agentRun) next() (*Message, error) {
+	var m = &Message{}
+	if err := r.dec.Decode(m); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("agent %v stopped before the test is done", r.address)
+		}
+		return nil, fmt.Errorf("agent %v: %v", r.address, err.Error())
+	}
+	if m.State == StateFailed {
+		return nil, fmt.Errorf("agent %v: %v", r.address, m.Error)
+	}
+	return m, nil
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package distributed
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"net"
+	"strings"
+	"time"
+)
+
+// the port of an agent when its address has none
+const DefaultAgentPort = "7048"
+
+// how often agents send the stats of their tests by default
+const DefaultInterval = time.Second
+
+// states of the messages of an agent
+const (
+	// the test is loaded and waits for its start
+	StateReady = "ready"
+	// the stats of the running test so far
+	StateRunning = "running"
+	// the test is ended, its final stats
+	StateDone = "done"
+	// the test cannot be loaded or run, the error says why
+	StateFailed = "failed"
+)
+
+// RunRequest is sent by the coordinator to each agent, to load the test
+// of the config and wait for its start
+type RunRequest struct {
+	Id string `json:"id"`
+	// the composed yaml document of the config
+	Config []byte `json:"config"`
+	// the share of the agent, index of count agents
+	Index    int           `json:"index"`
+	Count    int           `json:"count"`
+	Interval time.Duration `json:"interval"`
+}
+
+// Message is a line (json) of the stream an agent sends back to the
+// run request; snapshots hold the stats so far, not the ones since the
+// previous message
+type Message struct {
+	State     string                       `json:"state"`
+	Error     string                       `json:"error,omitempty"`
+	StartedAt time.Time                    `json:"started-at,omitempty"`
+	Duration  time.Duration                `json:"duration,omitempty"`
+	Scenarios []*loadtest.ScenarioSnapshot `json:"scenarios,omitempty"`
+}
+
+// the base url of the agent at the address, like http://10.0.0.2:7048
+func agentUrl(address string) string {
+	if strings.Contains(address, "://") {
+		return strings.TrimRight(address, "/")
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultAgentPort)
+	}
+	return "http://" + address
+}
@@ -0,0 +1,69 @@
+// Package distributed runs a test on several agents (load48 agent) at
+// once. The coordinator gives each agent its share of the load, starts
+// them together and merges the stats they stream back into one result.
+package distributed
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+)
+
+// CanShare reports whether the load of the configs can be split across
+// count agents: each agent needs at least one virtual user, and one
+// iteration when the iterations are counted. Agents read no files, so
+// grpc targets use the server reflection instead of proto files.
+func CanShare(configs []*config.Config, count int) error {
+	for _, cc := range configs {
+		if cc.Grpc != nil && cc.Grpc.Descriptor != nil {
+			return fmt.Errorf("grpc.proto of target %v is not sent to agents, leave it out to use the server reflection", cc.TargetName)
+		}
+		if cc.DataSource {
+			continue
+		}
+		if cc.Concurrency < int64(count) {
+			return fmt.Errorf("concurrency %v of target %v cannot be split across %v agents", cc.Concurrency, cc.TargetName, count)
+		}
+		if cc.NumberOfRequests > 0 && cc.NumberOfRequests < int64(count) {
+			return fmt.Errorf("request-count %v of target %v cannot be split across %v agents", cc.NumberOfRequests, cc.TargetName, count)
+		}
+	}
+	return nil
+}
+
+// Share gives the agent index (from 0) of count agents its part of the
+// load of the configs. Concurrency and request-count are split evenly,
+// the first agents take what remains of the division; the rate and the
+// targets of the stages are divided.
+func Share(configs []*config.Config, index, count int) error {
+	if index < 0 || index >= count {
+		return fmt.Errorf("agent %v is not one of %v agents", index, count)
+	}
+	if err := CanShare(configs, count); err != nil {
+		return err
+	}
+	for _, cc := range configs {
+		if cc.DataSource {
+			// each agent runs the data-sources itself
+			continue
+		}
+		cc.Concurrency = shareOf(cc.Concurrency, index, count)
+		if cc.NumberOfRequests > 0 {
+			cc.NumberOfRequests = shareOf(cc.NumberOfRequests, index, count)
+		}
+		cc.Rate /= float64(count)
+		var stages = make([]config.Stage, len(cc.Stages))
+		for i, st := range cc.Stages {
+			stages[i] = config.Stage{Duration: st.Duration, Target: st.Target / float64(count)}
+		}
+		cc.Stages = stages
+	}
+	return nil
+}
+
+func shareOf(v int64, index, count int) int64 {
+	var share = v / int64(count)
+	if int64(index) < v%int64(count) {
+		share++
+	}
+	return share
+}
@@ -0,0 +1,135 @@
+package grpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the largest message which is read, like the default of grpc servers
+const MaxMessageSize = 4 << 20
+
+// Response is what a call returns: its messages, the status and the metadata
+type Response struct {
+	Status   Code
+	Message  string
+	Messages [][]byte
+	Header   http.Header
+	Trailer  http.Header
+}
+
+// NewTransport returns a transport for the calls: http urls are called
+// with http/2 without tls (h2c), https urls with http/2 over tls
+func NewTransport() *http.Transport {
+	var protocols = &http.Protocols{}
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Transport{
+		Protocols:           protocols,
+		MaxIdleConnsPerHost: 1024,
+		MaxIdleConns:        1024,
+		TLSClientConfig:     &tls.Config{NextProtos: []string{"h2"}},
+	}
+}
+
+// NewRequest creates the request of a call of the method on the server of
+// baseUrl, like http://localhost:50051, with the metadata as its headers
+func NewRequest(baseUrl string, method *Method, metadata http.Header, messages [][]byte, timeout time.Duration) (*http.Request, error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + method.Path()
+	var body = &bytes.Buffer{}
+	for _, m := range messages {
+		var prefix [5]byte
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(m)))
+		body.Write(prefix[:])
+		body.Write(m)
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range metadata {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if timeout > 0 {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout.Milliseconds(), 10)+"m")
+	}
+	return req, nil
+}
+
+// ReadResponse reads the messages and the status of a call from its response
+func ReadResponse(resp *http.Response) (*Response, error) {
+	var r = &Response{Header: resp.Header, Messages: make([][]byte, 0)}
+	if resp.StatusCode != http.StatusOK {
+		r.Status = codeOfHttpStatus(resp.StatusCode)
+		r.Message = "the response is " + resp.Status
+		return r, nil
+	}
+	var prefix [5]byte
+	for {
+		if _, err := io.ReadFull(resp.Body, prefix[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read the response: %v", err.Error())
+		}
+		if prefix[0] != 0 {
+			return nil, errors.New("the response is compressed, compression is not supported")
+		}
+		var size = binary.BigEndian.Uint32(prefix[1:])
+		if size > MaxMessageSize {
+			return nil, fmt.Errorf("a message of the response has %v bytes, more than %v", size, MaxMessageSize)
+		}
+		var m = make([]byte, size)
+		if _, err := io.ReadFull(resp.Body, m); err != nil {
+			return nil, fmt.Errorf("cannot read the response: %v", err.Error())
+		}
+		r.Messages = append(r.Messages, m)
+	}
+	r.Trailer = resp.Trailer
+	// a response without messages may have its status in the headers
+	var status = resp.Trailer.Get("Grpc-Status")
+	r.Message = resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		r.Message = resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return nil, errors.New("the response has no grpc status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("the grpc status %q is not a number", status)
+	}
+	r.Status = Code(code)
+	if m, err := url.PathUnescape(r.Message); err == nil {
+		r.Message = m
+	}
+	return r, nil
+}
+
+// Invoke calls the method and reads its response
+func Invoke(client *http.Client, baseUrl string, method *Method, metadata http.Header, messages [][]byte) (*Response, error) {
+	req, err := NewRequest(baseUrl, method, metadata, messages, client.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ReadResponse(resp)
+}
@@ -0,0 +1,221 @@
+package grpc
+
+import (
+	"fmt"
+)
+
+// the numbers of the fields of descriptor.proto which are read
+const (
+	fileName        = 1
+	filePackage     = 2
+	fileDependency  = 3
+	fileMessageType = 4
+	fileEnumType    = 5
+	fileService     = 6
+	fileSyntax      = 12
+
+	messageName       = 1
+	messageField      = 2
+	messageNestedType = 3
+	messageEnumType   = 4
+	messageOptions    = 7
+	messageOneofDecl  = 8
+	// in MessageOptions
+	messageOptionsMapEntry = 7
+
+	fieldName       = 1
+	fieldNumber     = 3
+	fieldLabel      = 4
+	fieldType       = 5
+	fieldTypeName   = 6
+	fieldOptions    = 8
+	fieldOneofIndex = 9
+	fieldJsonName   = 10
+	// in FieldOptions
+	fieldOptionsPacked = 2
+	labelRepeated      = 3
+
+	enumName        = 1
+	enumValue       = 2
+	enumValueName   = 1
+	enumValueNumber = 2
+
+	serviceName   = 1
+	serviceMethod = 2
+
+	methodName            = 1
+	methodInputType       = 2
+	methodOutputType      = 3
+	methodClientStreaming = 5
+	methodServerStreaming = 6
+)
+
+// a FileDescriptorProto, as sent by the server reflection
+type fileDescriptor struct {
+	name         string
+	dependencies []string
+	fields       map[int32][]wireValue
+}
+
+func parseFileDescriptor(b []byte) (*fileDescriptor, error) {
+	fields, err := readFields(b)
+	if err != nil {
+		return nil, fmt.Errorf("the file descriptor cannot be read: %v", err.Error())
+	}
+	var fd = &fileDescriptor{name: lastString(fields[fileName]), fields: fields}
+	for _, dep := range fields[fileDependency] {
+		fd.dependencies = append(fd.dependencies, string(dep.b))
+	}
+	return fd, nil
+}
+
+// adds the messages, enums and services of the file; the types are
+// resolved once all the files are added
+func (d *Descriptors) addFileDescriptor(fd *fileDescriptor) error {
+	if d.files[fd.name] {
+		return nil
+	}
+	d.files[fd.name] = true
+	var pkg = lastString(fd.fields[filePackage])
+	var proto3 = lastString(fd.fields[fileSyntax]) == "proto3"
+	for _, v := range fd.fields[fileMessageType] {
+		if err := d.addMessageDescriptor(pkg, v.b, proto3); err != nil {
+			return err
+		}
+	}
+	for _, v := range fd.fields[fileEnumType] {
+		if err := d.addEnumDescriptor(pkg, v.b); err != nil {
+			return err
+		}
+	}
+	for _, v := range fd.fields[fileService] {
+		fields, err := readFields(v.b)
+		if err != nil {
+			return err
+		}
+		var s = &Service{FullName: fullName(pkg, lastString(fields[serviceName]))}
+		for _, mv := range fields[serviceMethod] {
+			mf, err := readFields(mv.b)
+			if err != nil {
+				return err
+			}
+			s.Methods = append(s.Methods, &Method{
+				Name:            lastString(mf[methodName]),
+				Service:         s.FullName,
+				ClientStreaming: lastNumber(mf[methodClientStreaming]) != 0,
+				ServerStreaming: lastNumber(mf[methodServerStreaming]) != 0,
+				inputType:       lastString(mf[methodInputType]),
+				outputType:      lastString(mf[methodOutputType]),
+				scope:           pkg,
+			})
+		}
+		if err := d.addService(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Descriptors) addMessageDescriptor(scope string, b []byte, proto3 bool) error {
+	fields, err := readFields(b)
+	if err != nil {
+		return err
+	}
+	var m = &Message{FullName: fullName(scope, lastString(fields[messageName]))}
+	if options := fields[messageOptions]; len(options) > 0 {
+		of, err := readFields(options[len(options)-1].b)
+		if err != nil {
+			return err
+		}
+		m.MapEntry = lastNumber(of[messageOptionsMapEntry]) != 0
+	}
+	var oneofs = make([]string, 0)
+	for _, v := range fields[messageOneofDecl] {
+		of, err := readFields(v.b)
+		if err != nil {
+			return err
+		}
+		oneofs = append(oneofs, lastString(of[1]))
+	}
+	for _, v := range fields[messageField] {
+		ff, err := readFields(v.b)
+		if err != nil {
+			return err
+		}
+		var f = &Field{
+			Name:     lastString(ff[fieldName]),
+			JsonName: lastString(ff[fieldJsonName]),
+			Number:   int32(lastNumber(ff[fieldNumber])),
+			Kind:     Kind(lastNumber(ff[fieldType])),
+			Repeated: lastNumber(ff[fieldLabel]) == labelRepeated,
+			typeName: lastString(ff[fieldTypeName]),
+			scope:    m.FullName,
+		}
+		if len(ff[fieldOneofIndex]) > 0 {
+			if i := int(lastNumber(ff[fieldOneofIndex])); i < len(oneofs) {
+				f.Oneof = oneofs[i]
+			}
+		}
+		var packable = f.Repeated && wireTypeOf(f.Kind) != wireBytes && f.Kind != KindGroup
+		f.Packed = packable && proto3
+		if options := ff[fieldOptions]; len(options) > 0 {
+			of, err := readFields(options[len(options)-1].b)
+			if err != nil {
+				return err
+			}
+			if packed := of[fieldOptionsPacked]; len(packed) > 0 {
+				f.Packed = packable && lastNumber(packed) != 0
+			}
+		}
+		if f.Kind == KindMessage || f.Kind == KindEnum || f.Kind == KindGroup {
+			// resolved once all the files are added
+			if f.Kind != KindGroup {
+				f.Kind = 0
+			}
+		} else {
+			f.typeName = ""
+		}
+		m.addField(f)
+	}
+	for _, v := range fields[messageNestedType] {
+		if err := d.addMessageDescriptor(m.FullName, v.b, proto3); err != nil {
+			return err
+		}
+	}
+	for _, v := range fields[messageEnumType] {
+		if err := d.addEnumDescriptor(m.FullName, v.b); err != nil {
+			return err
+		}
+	}
+	return d.addMessage(m)
+}
+
+func (d *Descriptors) addEnumDescriptor(scope string, b []byte) error {
+	fields, err := readFields(b)
+	if err != nil {
+		return err
+	}
+	var e = &Enum{FullName: fullName(scope, lastString(fields[enumName]))}
+	for _, v := range fields[enumValue] {
+		vf, err := readFields(v.b)
+		if err != nil {
+			return err
+		}
+		e.addValue(lastString(vf[enumValueName]), int32(lastNumber(vf[enumValueNumber])))
+	}
+	return d.addEnum(e)
+}
+
+func lastString(vs []wireValue) string {
+	if len(vs) == 0 {
+		return ""
+	}
+	return string(vs[len(vs)-1].b)
+}
+
+func lastNumber(vs []wireValue) uint64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	return vs[len(vs)-1].v
+}
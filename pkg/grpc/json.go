@@ -0,0 +1,857 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EncodeMessages encodes the json body of a call into its messages: a
+// json object is a message, and when the client streams, each item of a
+// json array is a message. An empty body is an empty message.
+func EncodeMessages(m *Message, body string, stream bool) ([][]byte, error) {
+	if strings.TrimSpace(body) == "" {
+		return [][]byte{{}}, nil
+	}
+	v, err := parseJson(body)
+	if err != nil {
+		return nil, fmt.Errorf("the body of %v is not valid json: %v", m.FullName, err.Error())
+	}
+	var items = []interface{}{v}
+	if list, ok := v.([]interface{}); ok && stream {
+		items = list
+	}
+	var messages = make([][]byte, 0, len(items))
+	for _, item := range items {
+		b, err := encodeMessage(m, item, m.FullName)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, b)
+	}
+	return messages, nil
+}
+
+// DecodeMessages decodes the messages of a response into json: the message
+// itself, or a json array of them when the server streams. Fields which
+// are not sent have their default values, except messages.
+func DecodeMessages(m *Message, messages [][]byte, stream bool) ([]byte, error) {
+	var buf = &bytes.Buffer{}
+	if stream {
+		buf.WriteByte('[')
+	}
+	for i, b := range messages {
+		if i > 0 {
+			if !stream {
+				return nil, fmt.Errorf("%v messages are received, only one is expected", len(messages))
+			}
+			buf.WriteByte(',')
+		}
+		if err := decodeMessage(buf, m, b); err != nil {
+			return nil, fmt.Errorf("cannot decode %v: %v", m.FullName, err.Error())
+		}
+	}
+	if stream {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), nil
+}
+
+func parseJson(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("it has more than one value")
+	}
+	return v, nil
+}
+
+func encodeMessage(m *Message, v interface{}, path string) ([]byte, error) {
+	if encode, ok := wellKnownEncoders[m.FullName]; ok {
+		return encode(m, v, path)
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be an object", path)
+	}
+	var keys = make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if m.Field(key) == nil {
+			return nil, fmt.Errorf("%v has no field %v", path, key)
+		}
+	}
+	var b = make([]byte, 0)
+	var oneofs = make(map[string]string)
+	for _, f := range m.Fields {
+		value, ok := obj[f.JsonName]
+		if !ok {
+			value, ok = obj[f.Name]
+		}
+		// null is the default value, except for google.protobuf.Value
+		if !ok || (value == nil && (f.Message == nil || f.Message.FullName != "google.protobuf.Value" || f.Repeated)) {
+			continue
+		}
+		if f.Oneof != "" {
+			if other, set := oneofs[f.Oneof]; set {
+				return nil, fmt.Errorf("%v: only one of %v and %v can be set", path, other, f.JsonName)
+			}
+			oneofs[f.Oneof] = f.JsonName
+		}
+		var err error
+		if b, err = encodeField(b, f, value, path+"."+f.JsonName); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func encodeField(b []byte, f *Field, v interface{}, path string) ([]byte, error) {
+	var err error
+	switch {
+	case f.Message != nil && f.Message.MapEntry:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be an object", path)
+		}
+		var keys = make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var keyField, valueField = f.Message.byNumber[1], f.Message.byNumber[2]
+		for _, key := range keys {
+			var entry = make([]byte, 0)
+			if entry, err = appendValue(entry, keyField, key, path); err != nil {
+				return nil, err
+			}
+			if obj[key] != nil || valueField.Kind == KindMessage {
+				if entry, err = appendValue(entry, valueField, obj[key], path+"."+key); err != nil {
+					return nil, err
+				}
+			}
+			b = appendTag(b, f.Number, wireBytes)
+			b = appendBytes(b, entry)
+		}
+		return b, nil
+	case f.Repeated:
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be an array", path)
+		}
+		if f.Packed {
+			var packed = make([]byte, 0)
+			for i, item := range list {
+				if packed, err = appendScalar(packed, f, item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+					return nil, err
+				}
+			}
+			b = appendTag(b, f.Number, wireBytes)
+			return appendBytes(b, packed), nil
+		}
+		for i, item := range list {
+			if b, err = appendValue(b, f, item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return appendValue(b, f, v, path)
+}
+
+// appends a value of the field with its tag
+func appendValue(b []byte, f *Field, v interface{}, path string) ([]byte, error) {
+	switch f.Kind {
+	case KindGroup:
+		return nil, fmt.Errorf("%v is a group, groups are not supported", path)
+	case KindMessage:
+		if v == nil && f.Message.FullName != "google.protobuf.Value" {
+			v = map[string]interface{}{}
+		}
+		enc, err := encodeMessage(f.Message, v, path)
+		if err != nil {
+			return nil, err
+		}
+		b = appendTag(b, f.Number, wireBytes)
+		return appendBytes(b, enc), nil
+	}
+	b = appendTag(b, f.Number, wireTypeOf(f.Kind))
+	return appendScalar(b, f, v, path)
+}
+
+// appends a scalar value of the field, without its tag
+func appendScalar(b []byte, f *Field, v interface{}, path string) ([]byte, error) {
+	switch f.Kind {
+	case KindDouble, KindFloat:
+		n, err := toFloat(v, path)
+		if err != nil {
+			return nil, err
+		}
+		if f.Kind == KindFloat {
+			return appendFixed32(b, math.Float32bits(float32(n))), nil
+		}
+		return appendFixed64(b, math.Float64bits(n)), nil
+	case KindInt32, KindSint32, KindSfixed32:
+		n, err := toInt(v, 32, path)
+		if err != nil {
+			return nil, err
+		}
+		switch f.Kind {
+		case KindSint32:
+			return appendVarint(b, zigzag(n)), nil
+		case KindSfixed32:
+			return appendFixed32(b, uint32(int32(n))), nil
+		}
+		return appendVarint(b, uint64(n)), nil
+	case KindInt64, KindSint64, KindSfixed64:
+		n, err := toInt(v, 64, path)
+		if err != nil {
+			return nil, err
+		}
+		switch f.Kind {
+		case KindSint64:
+			return appendVarint(b, zigzag(n)), nil
+		case KindSfixed64:
+			return appendFixed64(b, uint64(n)), nil
+		}
+		return appendVarint(b, uint64(n)), nil
+	case KindUint32, KindFixed32:
+		n, err := toUint(v, 32, path)
+		if err != nil {
+			return nil, err
+		}
+		if f.Kind == KindFixed32 {
+			return appendFixed32(b, uint32(n)), nil
+		}
+		return appendVarint(b, n), nil
+	case KindUint64, KindFixed64:
+		n, err := toUint(v, 64, path)
+		if err != nil {
+			return nil, err
+		}
+		if f.Kind == KindFixed64 {
+			return appendFixed64(b, n), nil
+		}
+		return appendVarint(b, n), nil
+	case KindBool:
+		switch v {
+		case true, "true":
+			return appendVarint(b, 1), nil
+		case false, "false":
+			return appendVarint(b, 0), nil
+		}
+		return nil, fmt.Errorf("%v must be true or false", path)
+	case KindString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a string", path)
+		}
+		return appendBytes(b, []byte(s)), nil
+	case KindBytes:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a base64 string", path)
+		}
+		data, err := decodeBase64(s)
+		if err != nil {
+			return nil, fmt.Errorf("%v must be a base64 string", path)
+		}
+		return appendBytes(b, data), nil
+	case KindEnum:
+		if s, ok := v.(string); ok {
+			n, ok := f.Enum.byName[s]
+			if !ok {
+				return nil, fmt.Errorf("%v must be one of: %v", path, strings.Join(f.Enum.Names, ", "))
+			}
+			return appendVarint(b, uint64(int64(n))), nil
+		}
+		n, err := toInt(v, 32, path)
+		if err != nil {
+			return nil, fmt.Errorf("%v must be one of: %v", path, strings.Join(f.Enum.Names, ", "))
+		}
+		return appendVarint(b, uint64(n)), nil
+	}
+	return nil, fmt.Errorf("%v has a type which is not supported", path)
+}
+
+// numbers are json numbers or strings, like 64 bit integers are written
+func numberText(v interface{}) (string, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String(), true
+	case string:
+		return n, true
+	}
+	return "", false
+}
+
+func toInt(v interface{}, bits int, path string) (int64, error) {
+	s, ok := numberText(v)
+	if ok {
+		if n, err := strconv.ParseInt(s, 10, bits); err == nil {
+			return n, nil
+		}
+		// like 1e3 or 2.0
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) &&
+			f >= -math.Pow(2, float64(bits-1)) && f < math.Pow(2, float64(bits-1)) {
+			return int64(f), nil
+		}
+	}
+	return 0, fmt.Errorf("%v must be an integer of %v bits", path, bits)
+}
+
+func toUint(v interface{}, bits int, path string) (uint64, error) {
+	s, ok := numberText(v)
+	if ok {
+		if n, err := strconv.ParseUint(s, 10, bits); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) && f >= 0 && f < math.Pow(2, float64(bits)) {
+			return uint64(f), nil
+		}
+	}
+	return 0, fmt.Errorf("%v must be an unsigned integer of %v bits", path, bits)
+}
+
+func toFloat(v interface{}, path string) (float64, error) {
+	s, ok := numberText(v)
+	if ok {
+		switch s {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%v must be a number", path)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("not base64")
+}
+
+// reads the fields of a message, by their numbers
+func readFields(b []byte) (map[int32][]wireValue, error) {
+	var values = make(map[int32][]wireValue)
+	var r = &wireReader{b: b}
+	for !r.done() {
+		number, value, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		values[number] = append(values[number], value)
+	}
+	return values, nil
+}
+
+func decodeMessage(buf *bytes.Buffer, m *Message, b []byte) error {
+	if decode, ok := wellKnownDecoders[m.FullName]; ok {
+		return decode(buf, m, b)
+	}
+	values, err := readFields(b)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('{')
+	var first = true
+	for _, f := range m.Fields {
+		vs, present := values[f.Number]
+		if !present && (f.Oneof != "" || (f.Kind == KindMessage && !f.Repeated) || f.Kind == KindGroup) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeString(buf, f.JsonName)
+		buf.WriteByte(':')
+		if err := decodeField(buf, f, vs); err != nil {
+			return fmt.Errorf("%v: %v", f.JsonName, err.Error())
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func decodeField(buf *bytes.Buffer, f *Field, vs []wireValue) error {
+	switch {
+	case f.Message != nil && f.Message.MapEntry:
+		buf.WriteByte('{')
+		for i, v := range vs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := decodeMapEntry(buf, f.Message, v); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case f.Repeated:
+		buf.WriteByte('[')
+		var first = true
+		for _, v := range vs {
+			var items = []wireValue{v}
+			// numbers may be packed, whatever the field says
+			if v.wireType == wireBytes && wireTypeOf(f.Kind) != wireBytes {
+				var err error
+				if items, err = unpack(f.Kind, v.b); err != nil {
+					return err
+				}
+			}
+			for _, item := range items {
+				if !first {
+					buf.WriteByte(',')
+				}
+				first = false
+				if err := writeValue(buf, f, item); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteByte(']')
+	case len(vs) == 0:
+		writeDefault(buf, f)
+	case f.Kind == KindMessage:
+		// a message written several times is merged, as its parts were one message
+		var whole = make([]byte, 0)
+		for _, v := range vs {
+			whole = append(whole, v.b...)
+		}
+		return writeValue(buf, f, wireValue{wireType: wireBytes, b: whole})
+	default:
+		return writeValue(buf, f, vs[len(vs)-1])
+	}
+	return nil
+}
+
+func decodeMapEntry(buf *bytes.Buffer, entry *Message, v wireValue) error {
+	if v.wireType != wireBytes {
+		return fmt.Errorf("a map entry is not length delimited")
+	}
+	values, err := readFields(v.b)
+	if err != nil {
+		return err
+	}
+	var keyField, valueField = entry.byNumber[1], entry.byNumber[2]
+	var key = &bytes.Buffer{}
+	if err := decodeField(key, keyField, values[1]); err != nil {
+		return err
+	}
+	if key.Len() > 0 && key.Bytes()[0] == '"' {
+		buf.Write(key.Bytes())
+	} else {
+		writeString(buf, key.String())
+	}
+	buf.WriteByte(':')
+	if len(values[2]) == 0 && valueField.Kind == KindMessage {
+		return decodeMessage(buf, valueField.Message, nil)
+	}
+	return decodeField(buf, valueField, values[2])
+}
+
+// writes a value read from the wire as json
+func writeValue(buf *bytes.Buffer, f *Field, v wireValue) error {
+	if v.wireType != wireTypeOf(f.Kind) {
+		return fmt.Errorf("wire type %v is not the one of its type", v.wireType)
+	}
+	switch f.Kind {
+	case KindDouble:
+		writeFloat(buf, float64Of(v.v), 64)
+	case KindFloat:
+		writeFloat(buf, float64(float32Of(v.v)), 32)
+	case KindInt32:
+		buf.WriteString(strconv.FormatInt(int64(int32(v.v)), 10))
+	case KindSint32:
+		buf.WriteString(strconv.FormatInt(int64(int32(unzigzag(v.v))), 10))
+	case KindSfixed32:
+		buf.WriteString(strconv.FormatInt(int64(int32(uint32(v.v))), 10))
+	case KindUint32, KindFixed32:
+		buf.WriteString(strconv.FormatUint(uint64(uint32(v.v)), 10))
+	// 64 bit numbers are strings in json, as javascript cannot hold them
+	case KindInt64, KindSfixed64:
+		writeString(buf, strconv.FormatInt(int64(v.v), 10))
+	case KindSint64:
+		writeString(buf, strconv.FormatInt(unzigzag(v.v), 10))
+	case KindUint64, KindFixed64:
+		writeString(buf, strconv.FormatUint(v.v, 10))
+	case KindBool:
+		buf.WriteString(strconv.FormatBool(v.v != 0))
+	case KindString:
+		writeString(buf, string(v.b))
+	case KindBytes:
+		writeString(buf, base64.StdEncoding.EncodeToString(v.b))
+	case KindEnum:
+		if name, ok := f.Enum.byNumber[int32(v.v)]; ok {
+			writeString(buf, name)
+		} else {
+			buf.WriteString(strconv.FormatInt(int64(int32(v.v)), 10))
+		}
+	case KindMessage:
+		return decodeMessage(buf, f.Message, v.b)
+	default:
+		return fmt.Errorf("its type is not supported")
+	}
+	return nil
+}
+
+func writeDefault(buf *bytes.Buffer, f *Field) {
+	switch f.Kind {
+	case KindInt64, KindSint64, KindSfixed64, KindUint64, KindFixed64:
+		buf.WriteString(`"0"`)
+	case KindBool:
+		buf.WriteString("false")
+	case KindString, KindBytes:
+		buf.WriteString(`""`)
+	case KindEnum:
+		if name, ok := f.Enum.byNumber[0]; ok {
+			writeString(buf, name)
+		} else {
+			buf.WriteString("0")
+		}
+	default:
+		buf.WriteString("0")
+	}
+}
+
+func writeFloat(buf *bytes.Buffer, f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		buf.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		buf.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		buf.WriteString(`"-Infinity"`)
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// the well known types which have their own json form
+var wellKnownEncoders map[string]func(m *Message, v interface{}, path string) ([]byte, error)
+var wellKnownDecoders map[string]func(buf *bytes.Buffer, m *Message, b []byte) error
+
+func init() {
+	wellKnownEncoders = map[string]func(m *Message, v interface{}, path string) ([]byte, error){
+		"google.protobuf.Timestamp": encodeTimestamp,
+		"google.protobuf.Duration":  encodeDuration,
+		"google.protobuf.Struct": func(m *Message, v interface{}, path string) ([]byte, error) {
+			return encodeStruct(v, path)
+		},
+		"google.protobuf.Value": func(m *Message, v interface{}, path string) ([]byte, error) {
+			return encodeStructValue(v, path)
+		},
+		"google.protobuf.ListValue": func(m *Message, v interface{}, path string) ([]byte, error) {
+			return encodeListValue(v, path)
+		},
+	}
+	wellKnownDecoders = map[string]func(buf *bytes.Buffer, m *Message, b []byte) error{
+		"google.protobuf.Timestamp": decodeTimestamp,
+		"google.protobuf.Duration":  decodeDuration,
+		"google.protobuf.Struct": func(buf *bytes.Buffer, m *Message, b []byte) error {
+			return decodeStruct(buf, b)
+		},
+		"google.protobuf.Value": func(buf *bytes.Buffer, m *Message, b []byte) error {
+			return decodeStructValue(buf, b)
+		},
+		"google.protobuf.ListValue": func(buf *bytes.Buffer, m *Message, b []byte) error {
+			return decodeListValue(buf, b)
+		},
+	}
+	// wrappers are their value
+	for _, name := range []string{"DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value",
+		"UInt32Value", "BoolValue", "StringValue", "BytesValue"} {
+		wellKnownEncoders["google.protobuf."+name] = encodeWrapper
+		wellKnownDecoders["google.protobuf."+name] = decodeWrapper
+	}
+}
+
+func encodeWrapper(m *Message, v interface{}, path string) ([]byte, error) {
+	var f = m.byNumber[1]
+	if f == nil {
+		return nil, fmt.Errorf("%v has no value field", m.FullName)
+	}
+	return appendValue(make([]byte, 0), f, v, path)
+}
+
+func decodeWrapper(buf *bytes.Buffer, m *Message, b []byte) error {
+	var f = m.byNumber[1]
+	if f == nil {
+		return fmt.Errorf("%v has no value field", m.FullName)
+	}
+	values, err := readFields(b)
+	if err != nil {
+		return err
+	}
+	return decodeField(buf, f, values[1])
+}
+
+// seconds and nanos of a timestamp or a duration
+func secondsAndNanos(b []byte) (int64, int32, error) {
+	values, err := readFields(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	var seconds, nanos int64
+	if vs := values[1]; len(vs) > 0 {
+		seconds = int64(vs[len(vs)-1].v)
+	}
+	if vs := values[2]; len(vs) > 0 {
+		nanos = int64(int32(vs[len(vs)-1].v))
+	}
+	return seconds, int32(nanos), nil
+}
+
+func appendSecondsAndNanos(seconds int64, nanos int32) []byte {
+	var b = make([]byte, 0)
+	if seconds != 0 {
+		b = appendTag(b, 1, wireVarint)
+		b = appendVarint(b, uint64(seconds))
+	}
+	if nanos != 0 {
+		b = appendTag(b, 2, wireVarint)
+		b = appendVarint(b, uint64(int64(nanos)))
+	}
+	return b
+}
+
+// timestamps are like 2006-01-02T15:04:05.999Z in json
+func encodeTimestamp(m *Message, v interface{}, path string) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%v must be a timestamp like 2006-01-02T15:04:05Z", path)
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, fmt.Errorf("%v must be a timestamp like 2006-01-02T15:04:05Z", path)
+	}
+	return appendSecondsAndNanos(t.Unix(), int32(t.Nanosecond())), nil
+}
+
+func decodeTimestamp(buf *bytes.Buffer, m *Message, b []byte) error {
+	seconds, nanos, err := secondsAndNanos(b)
+	if err != nil {
+		return err
+	}
+	writeString(buf, time.Unix(seconds, int64(nanos)).UTC().Format(time.RFC3339Nano))
+	return nil
+}
+
+// durations are like 1.5s in json
+func encodeDuration(m *Message, v interface{}, path string) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%v must be a duration like 1.5s", path)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v must be a duration like 1.5s", path)
+	}
+	return appendSecondsAndNanos(int64(d/time.Second), int32(d%time.Second)), nil
+}
+
+func decodeDuration(buf *bytes.Buffer, m *Message, b []byte) error {
+	seconds, nanos, err := secondsAndNanos(b)
+	if err != nil {
+		return err
+	}
+	var sign = ""
+	if seconds < 0 || nanos < 0 {
+		sign = "-"
+		seconds, nanos = -seconds, -nanos
+	}
+	var s = sign + strconv.FormatInt(seconds, 10)
+	if nanos != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%09d", nanos), "0")
+	}
+	writeString(buf, s+"s")
+	return nil
+}
+
+// a struct is a json object, its fields are a map of values
+func encodeStruct(v interface{}, path string) ([]byte, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be an object", path)
+	}
+	var keys = make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b = make([]byte, 0)
+	for _, key := range keys {
+		value, err := encodeStructValue(obj[key], path+"."+key)
+		if err != nil {
+			return nil, err
+		}
+		var entry = appendTag(make([]byte, 0), 1, wireBytes)
+		entry = appendBytes(entry, []byte(key))
+		entry = appendTag(entry, 2, wireBytes)
+		entry = appendBytes(entry, value)
+		b = appendTag(b, 1, wireBytes)
+		b = appendBytes(b, entry)
+	}
+	return b, nil
+}
+
+// a value is any json value
+func encodeStructValue(v interface{}, path string) ([]byte, error) {
+	var b = make([]byte, 0)
+	switch value := v.(type) {
+	case nil:
+		b = appendTag(b, 1, wireVarint)
+		return appendVarint(b, 0), nil
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%v must be a number", path)
+		}
+		b = appendTag(b, 2, wireFixed64)
+		return appendFixed64(b, math.Float64bits(f)), nil
+	case string:
+		b = appendTag(b, 3, wireBytes)
+		return appendBytes(b, []byte(value)), nil
+	case bool:
+		b = appendTag(b, 4, wireVarint)
+		if value {
+			return appendVarint(b, 1), nil
+		}
+		return appendVarint(b, 0), nil
+	case map[string]interface{}:
+		s, err := encodeStruct(value, path)
+		if err != nil {
+			return nil, err
+		}
+		b = appendTag(b, 5, wireBytes)
+		return appendBytes(b, s), nil
+	case []interface{}:
+		l, err := encodeListValue(value, path)
+		if err != nil {
+			return nil, err
+		}
+		b = appendTag(b, 6, wireBytes)
+		return appendBytes(b, l), nil
+	}
+	return nil, fmt.Errorf("%v is not a json value", path)
+}
+
+func encodeListValue(v interface{}, path string) ([]byte, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be an array", path)
+	}
+	var b = make([]byte, 0)
+	for i, item := range list {
+		value, err := encodeStructValue(item, fmt.Sprintf("%v[%v]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		b = appendTag(b, 1, wireBytes)
+		b = appendBytes(b, value)
+	}
+	return b, nil
+}
+
+func decodeStruct(buf *bytes.Buffer, b []byte) error {
+	values, err := readFields(b)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('{')
+	for i, entry := range values[1] {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fields, err := readFields(entry.b)
+		if err != nil {
+			return err
+		}
+		var key, value []byte
+		if vs := fields[1]; len(vs) > 0 {
+			key = vs[len(vs)-1].b
+		}
+		if vs := fields[2]; len(vs) > 0 {
+			value = vs[len(vs)-1].b
+		}
+		writeString(buf, string(key))
+		buf.WriteByte(':')
+		if err := decodeStructValue(buf, value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func decodeStructValue(buf *bytes.Buffer, b []byte) error {
+	var r = &wireReader{b: b}
+	var number int32
+	var value wireValue
+	for !r.done() {
+		var err error
+		if number, value, err = r.next(); err != nil {
+			return err
+		}
+	}
+	switch number {
+	case 2:
+		writeFloat(buf, float64Of(value.v), 64)
+	case 3:
+		writeString(buf, string(value.b))
+	case 4:
+		buf.WriteString(strconv.FormatBool(value.v != 0))
+	case 5:
+		return decodeStruct(buf, value.b)
+	case 6:
+		return decodeListValue(buf, value.b)
+	default:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+func decodeListValue(buf *bytes.Buffer, b []byte) error {
+	values, err := readFields(b)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('[')
+	for i, v := range values[1] {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := decodeStructValue(buf, v.b); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
@@ -0,0 +1,796 @@
+package grpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// the well known types commonly imported by .proto files, used when they
+// are not found in the import paths
+var wellKnownFiles = map[string]string{
+	"google/protobuf/empty.proto": `syntax = "proto3"; package google.protobuf;
+		message Empty {}`,
+	"google/protobuf/timestamp.proto": `syntax = "proto3"; package google.protobuf;
+		message Timestamp { int64 seconds = 1; int32 nanos = 2; }`,
+	"google/protobuf/duration.proto": `syntax = "proto3"; package google.protobuf;
+		message Duration { int64 seconds = 1; int32 nanos = 2; }`,
+	"google/protobuf/wrappers.proto": `syntax = "proto3"; package google.protobuf;
+		message DoubleValue { double value = 1; }
+		message FloatValue { float value = 1; }
+		message Int64Value { int64 value = 1; }
+		message UInt64Value { uint64 value = 1; }
+		message Int32Value { int32 value = 1; }
+		message UInt32Value { uint32 value = 1; }
+		message BoolValue { bool value = 1; }
+		message StringValue { string value = 1; }
+		message BytesValue { bytes value = 1; }`,
+	"google/protobuf/struct.proto": `syntax = "proto3"; package google.protobuf;
+		message Struct { map<string, Value> fields = 1; }
+		message Value {
+			oneof kind {
+				NullValue null_value = 1;
+				double number_value = 2;
+				string string_value = 3;
+				bool bool_value = 4;
+				Struct struct_value = 5;
+				ListValue list_value = 6;
+			}
+		}
+		enum NullValue { NULL_VALUE = 0; }
+		message ListValue { repeated Value values = 1; }`,
+	"google/protobuf/field_mask.proto": `syntax = "proto3"; package google.protobuf;
+		message FieldMask { repeated string paths = 1; }`,
+	"google/protobuf/any.proto": `syntax = "proto3"; package google.protobuf;
+		message Any { string type_url = 1; bytes value = 2; }`,
+}
+
+// LoadProtoFiles parses the .proto files and the files they import.
+// Imports are looked for in the import paths, then in the directory
+// of the file importing them.
+func LoadProtoFiles(files []string, importPaths []string) (*Descriptors, error) {
+	var d = NewDescriptors()
+	for _, file := range files {
+		if err := d.loadFile(file, importPaths); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.resolve(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Descriptors) loadFile(path string, importPaths []string) error {
+	// a file imported by several others, maybe by different paths, is loaded once
+	var key = path
+	if abs, err := filepath.Abs(path); err == nil && fileExists(path) {
+		key = abs
+	}
+	if d.files[key] {
+		return nil
+	}
+	d.files[key] = true
+	var src string
+	if builtin, ok := wellKnownFiles[path]; ok && !fileExists(path) {
+		src = builtin
+	} else {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		src = string(b)
+	}
+	p := newParser(path, src, d)
+	if err := p.parse(); err != nil {
+		return err
+	}
+	for _, imported := range p.imports {
+		found, err := findImport(imported, path, importPaths)
+		if err != nil {
+			return err
+		}
+		if err := d.loadFile(found, importPaths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findImport(name, importer string, importPaths []string) (string, error) {
+	var dirs = append(append([]string{}, importPaths...), filepath.Dir(importer))
+	for _, dir := range dirs {
+		if path := filepath.Join(dir, name); fileExists(path) {
+			return path, nil
+		}
+	}
+	if _, ok := wellKnownFiles[name]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("%v: import %v is not found in: %v", importer, name, strings.Join(dirs, ", "))
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokSymbol
+)
+
+type token struct {
+	kind int
+	text string
+	line int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// parser of .proto files, it keeps what is needed to encode and decode
+// messages and skips the rest, like options and extensions
+type parser struct {
+	file    string
+	src     string
+	pos     int
+	line    int
+	tok     token
+	d       *Descriptors
+	pkg     string
+	proto3  bool
+	imports []string
+}
+
+func newParser(file, src string, d *Descriptors) *parser {
+	p := &parser{file: file, src: src, line: 1, d: d}
+	p.next()
+	return p
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%v:%v: %v", p.file, p.tok.line, fmt.Sprintf(format, args...))
+}
+
+// reads the next token into p.tok
+func (p *parser) next() {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, line: p.line}
+		return
+	}
+	var start, c = p.pos, p.src[p.pos]
+	switch {
+	case isLetter(c):
+		for p.pos < len(p.src) && (isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], line: p.line}
+	case isDigit(c):
+		for p.pos < len(p.src) {
+			ch := p.src[p.pos]
+			exponent := (ch == '+' || ch == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E') &&
+				!strings.HasPrefix(strings.ToLower(p.src[start:p.pos]), "0x")
+			if !isLetter(ch) && !isDigit(ch) && ch != '.' && !exponent {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], line: p.line}
+	case c == '"' || c == '\'':
+		p.tok = token{kind: tokString, text: p.readString(c), line: p.line}
+	default:
+		p.pos++
+		p.tok = token{kind: tokSymbol, text: string(c), line: p.line}
+	}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				end = len(p.src) - p.pos - 2
+			}
+			p.line += strings.Count(p.src[p.pos:p.pos+2+end], "\n")
+			p.pos += end + 4
+			if p.pos > len(p.src) {
+				p.pos = len(p.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// reads a quoted string, escapes other than \n and \t are kept as the
+// escaped character
+func (p *parser) readString(quote byte) string {
+	var b strings.Builder
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != quote && p.src[p.pos] != '\n' {
+		c := p.src[p.pos]
+		if c == '\\' && p.pos+1 < len(p.src) {
+			p.pos++
+			switch c = p.src[p.pos]; c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			}
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	p.pos++
+	return b.String()
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *parser) isSymbol(s string) bool {
+	return p.tok.kind == tokSymbol && p.tok.text == s
+}
+
+func (p *parser) isIdent(s string) bool {
+	return p.tok.kind == tokIdent && p.tok.text == s
+}
+
+func (p *parser) expect(s string) error {
+	if !p.isSymbol(s) {
+		return p.errorf("expected '%v' but found %v", s, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	if p.tok.kind != tokIdent {
+		return "", p.errorf("expected a name but found %v", p.tok)
+	}
+	var name = p.tok.text
+	p.next()
+	return name, nil
+}
+
+// a dotted name, like google.protobuf.Timestamp or .foo.Bar
+func (p *parser) typeName() (string, error) {
+	var name = ""
+	if p.isSymbol(".") {
+		name = "."
+		p.next()
+	}
+	for {
+		part, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		name += part
+		if !p.isSymbol(".") {
+			return name, nil
+		}
+		name += "."
+		p.next()
+	}
+}
+
+func (p *parser) stringValue() (string, error) {
+	if p.tok.kind != tokString {
+		return "", p.errorf("expected a string but found %v", p.tok)
+	}
+	var s = ""
+	// adjacent strings are joined
+	for p.tok.kind == tokString {
+		s += p.tok.text
+		p.next()
+	}
+	return s, nil
+}
+
+func (p *parser) intValue() (int32, error) {
+	var sign = ""
+	if p.isSymbol("-") {
+		sign = "-"
+		p.next()
+	}
+	if p.tok.kind != tokNumber {
+		return 0, p.errorf("expected a number but found %v", p.tok)
+	}
+	v, err := strconv.ParseInt(sign+p.tok.text, 0, 32)
+	if err != nil {
+		return 0, p.errorf("%v is not a valid number", sign+p.tok.text)
+	}
+	p.next()
+	return int32(v), nil
+}
+
+// skips a statement up to its ';', with the blocks in it
+func (p *parser) skipStatement() error {
+	var depth = 0
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.isSymbol("{"):
+			depth++
+		case p.isSymbol("}"):
+			depth--
+			if depth == 0 {
+				p.next()
+				if p.isSymbol(";") {
+					p.next()
+				}
+				return nil
+			}
+		case p.isSymbol(";") && depth == 0:
+			p.next()
+			return nil
+		}
+		p.next()
+	}
+	return p.errorf("unexpected end of file")
+}
+
+func fullName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (p *parser) parse() error {
+	for p.tok.kind != tokEOF {
+		var err error
+		switch {
+		case p.isSymbol(";"):
+			p.next()
+		case p.isIdent("syntax"):
+			p.next()
+			if err = p.expect("="); err != nil {
+				return err
+			}
+			var syntax string
+			if syntax, err = p.stringValue(); err != nil {
+				return err
+			}
+			p.proto3 = syntax == "proto3"
+			err = p.expect(";")
+		case p.isIdent("edition"):
+			return p.errorf("editions are not supported, only proto2 and proto3 files")
+		case p.isIdent("package"):
+			p.next()
+			if p.pkg, err = p.typeName(); err != nil {
+				return err
+			}
+			err = p.expect(";")
+		case p.isIdent("import"):
+			p.next()
+			if p.isIdent("public") || p.isIdent("weak") {
+				p.next()
+			}
+			var path string
+			if path, err = p.stringValue(); err != nil {
+				return err
+			}
+			p.imports = append(p.imports, path)
+			err = p.expect(";")
+		case p.isIdent("option"), p.isIdent("extend"):
+			err = p.skipStatement()
+		case p.isIdent("message"):
+			err = p.parseMessage(p.pkg)
+		case p.isIdent("enum"):
+			err = p.parseEnum(p.pkg)
+		case p.isIdent("service"):
+			err = p.parseService()
+		default:
+			return p.errorf("unexpected %v", p.tok)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseMessage(scope string) error {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	var m = &Message{FullName: fullName(scope, name)}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.isSymbol("}") {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("message %v is not closed", m.FullName)
+		case p.isSymbol(";"):
+			p.next()
+		case p.isIdent("message"):
+			err = p.parseMessage(m.FullName)
+		case p.isIdent("enum"):
+			err = p.parseEnum(m.FullName)
+		case p.isIdent("option"), p.isIdent("extensions"), p.isIdent("reserved"), p.isIdent("extend"):
+			err = p.skipStatement()
+		case p.isIdent("oneof"):
+			err = p.parseOneof(m)
+		default:
+			err = p.parseField(m, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.next()
+	if err := p.d.addMessage(m); err != nil {
+		return p.errorf("%v", err.Error())
+	}
+	return nil
+}
+
+func (p *parser) parseOneof(m *Message) error {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.isSymbol("}") {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("oneof %v is not closed", name)
+		case p.isSymbol(";"):
+			p.next()
+		case p.isIdent("option"):
+			err = p.skipStatement()
+		default:
+			err = p.parseField(m, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseField(m *Message, oneof string) error {
+	var f = &Field{Oneof: oneof, scope: m.FullName}
+	var label = ""
+	if p.isIdent("optional") || p.isIdent("required") || p.isIdent("repeated") {
+		label = p.tok.text
+		p.next()
+	}
+	f.Repeated = label == "repeated"
+	if p.isIdent("map") && label == "" {
+		return p.parseMapField(m)
+	}
+	if p.isIdent("group") {
+		return p.errorf("groups are not supported")
+	}
+	typ, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	if f.Name, err = p.ident(); err != nil {
+		return err
+	}
+	if err = p.expect("="); err != nil {
+		return err
+	}
+	if f.Number, err = p.intValue(); err != nil {
+		return err
+	}
+	if kind, ok := scalarKinds[typ]; ok {
+		f.Kind = kind
+	} else {
+		f.typeName = typ
+	}
+	// repeated numbers are packed in proto3, unless they are messages
+	f.Packed = f.Repeated && p.proto3 && f.Kind != KindString && f.Kind != KindBytes
+	if err = p.parseFieldOptions(f); err != nil {
+		return err
+	}
+	if err = p.expect(";"); err != nil {
+		return err
+	}
+	m.addField(f)
+	return nil
+}
+
+// map<string, Value> fields = 1; is a repeated field of the FieldsEntry
+// message nested in m
+func (p *parser) parseMapField(m *Message) error {
+	p.next()
+	if err := p.expect("<"); err != nil {
+		return err
+	}
+	keyType, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	keyKind, ok := scalarKinds[keyType]
+	if !ok || keyKind == KindDouble || keyKind == KindFloat || keyKind == KindBytes {
+		return p.errorf("%v cannot be the key of a map", keyType)
+	}
+	if err = p.expect(","); err != nil {
+		return err
+	}
+	valueType, err := p.typeName()
+	if err != nil {
+		return err
+	}
+	if err = p.expect(">"); err != nil {
+		return err
+	}
+	var f = &Field{Repeated: true, Kind: KindMessage}
+	if f.Name, err = p.ident(); err != nil {
+		return err
+	}
+	if err = p.expect("="); err != nil {
+		return err
+	}
+	if f.Number, err = p.intValue(); err != nil {
+		return err
+	}
+	if err = p.parseFieldOptions(f); err != nil {
+		return err
+	}
+	if err = p.expect(";"); err != nil {
+		return err
+	}
+	var entryName = jsonName(f.Name)
+	entryName = strings.ToUpper(entryName[:1]) + entryName[1:] + "Entry"
+	var entry = &Message{FullName: fullName(m.FullName, entryName), MapEntry: true}
+	entry.addField(&Field{Name: "key", Number: 1, Kind: keyKind})
+	var value = &Field{Name: "value", Number: 2, scope: entry.FullName}
+	if kind, ok := scalarKinds[valueType]; ok {
+		value.Kind = kind
+	} else {
+		value.typeName = valueType
+	}
+	entry.addField(value)
+	if err := p.d.addMessage(entry); err != nil {
+		return p.errorf("%v", err.Error())
+	}
+	f.Message = entry
+	m.addField(f)
+	return nil
+}
+
+// reads [packed = true, json_name = "x"], other options are skipped
+func (p *parser) parseFieldOptions(f *Field) error {
+	if !p.isSymbol("[") {
+		return nil
+	}
+	p.next()
+	for {
+		var name = ""
+		for !p.isSymbol("=") {
+			if p.tok.kind == tokEOF || p.isSymbol(";") {
+				return p.errorf("expected '=' but found %v", p.tok)
+			}
+			name += p.tok.text
+			p.next()
+		}
+		p.next()
+		var value = ""
+		if p.isSymbol("{") {
+			var depth = 0
+			for {
+				if p.isSymbol("{") {
+					depth++
+				} else if p.isSymbol("}") {
+					depth--
+				} else if p.tok.kind == tokEOF {
+					return p.errorf("unexpected end of file")
+				}
+				p.next()
+				if depth == 0 {
+					break
+				}
+			}
+		} else {
+			if p.isSymbol("-") || p.isSymbol("+") {
+				p.next()
+			}
+			if p.tok.kind == tokSymbol || p.tok.kind == tokEOF {
+				return p.errorf("expected the value of option %v but found %v", name, p.tok)
+			}
+			value = p.tok.text
+			p.next()
+			for p.tok.kind == tokString {
+				value += p.tok.text
+				p.next()
+			}
+		}
+		switch name {
+		case "packed":
+			f.Packed = value == "true" && f.Repeated
+		case "json_name":
+			f.JsonName = value
+		}
+		if p.isSymbol("]") {
+			p.next()
+			return nil
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) parseEnum(scope string) error {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	var e = &Enum{FullName: fullName(scope, name)}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.isSymbol("}") {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("enum %v is not closed", e.FullName)
+		case p.isSymbol(";"):
+			p.next()
+		case p.isIdent("option"), p.isIdent("reserved"):
+			err = p.skipStatement()
+		default:
+			var valueName string
+			if valueName, err = p.ident(); err != nil {
+				return err
+			}
+			if err = p.expect("="); err != nil {
+				return err
+			}
+			var number int32
+			if number, err = p.intValue(); err != nil {
+				return err
+			}
+			if p.isSymbol("[") {
+				// options of the value
+				for !p.isSymbol("]") && p.tok.kind != tokEOF {
+					p.next()
+				}
+				p.next()
+			}
+			e.addValue(valueName, number)
+			err = p.expect(";")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.next()
+	if err := p.d.addEnum(e); err != nil {
+		return p.errorf("%v", err.Error())
+	}
+	return nil
+}
+
+func (p *parser) parseService() error {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	var s = &Service{FullName: fullName(p.pkg, name)}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.isSymbol("}") {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("service %v is not closed", s.FullName)
+		case p.isSymbol(";"):
+			p.next()
+		case p.isIdent("option"):
+			err = p.skipStatement()
+		case p.isIdent("rpc"):
+			err = p.parseRpc(s)
+		default:
+			return p.errorf("unexpected %v in service %v", p.tok, s.FullName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.next()
+	if err := p.d.addService(s); err != nil {
+		return p.errorf("%v", err.Error())
+	}
+	return nil
+}
+
+// rpc Name (stream In) returns (stream Out); or with a block of options
+func (p *parser) parseRpc(s *Service) error {
+	p.next()
+	var m = &Method{Service: s.FullName, scope: p.pkg}
+	var err error
+	if m.Name, err = p.ident(); err != nil {
+		return err
+	}
+	if m.ClientStreaming, m.inputType, err = p.rpcType(); err != nil {
+		return err
+	}
+	if !p.isIdent("returns") {
+		return p.errorf("expected 'returns' but found %v", p.tok)
+	}
+	p.next()
+	if m.ServerStreaming, m.outputType, err = p.rpcType(); err != nil {
+		return err
+	}
+	if p.isSymbol("{") {
+		// the options of the method
+		var depth = 0
+		for {
+			if p.isSymbol("{") {
+				depth++
+			} else if p.isSymbol("}") {
+				depth--
+			} else if p.tok.kind == tokEOF {
+				return p.errorf("rpc %v is not closed", m.Name)
+			}
+			p.next()
+			if depth == 0 {
+				break
+			}
+		}
+	} else if err = p.expect(";"); err != nil {
+		return err
+	}
+	s.Methods = append(s.Methods, m)
+	return nil
+}
+
+func (p *parser) rpcType() (bool, string, error) {
+	if err := p.expect("("); err != nil {
+		return false, "", err
+	}
+	var stream = false
+	if p.isIdent("stream") {
+		stream = true
+		p.next()
+	}
+	typ, err := p.typeName()
+	if err != nil {
+		return false, "", err
+	}
+	return stream, typ, p.expect(")")
+}
@@ -0,0 +1,331 @@
+// Package grpc calls the methods of grpc services with messages given as
+// json. The messages are described by descriptors, which are loaded from
+// .proto files or from the server reflection of the service; there is no
+// generated code, messages are encoded and decoded by their descriptors.
+// The parser of .proto files and the codec are written here, as the
+// module vendors no protobuf runtime: they cover the messages, enums and
+// services of proto2 and proto3 files (not groups nor editions), options
+// and extensions are skipped.
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind is the type of a field, numbered as in descriptor.proto
+type Kind int
+
+const (
+	KindDouble   Kind = 1
+	KindFloat    Kind = 2
+	KindInt64    Kind = 3
+	KindUint64   Kind = 4
+	KindInt32    Kind = 5
+	KindFixed64  Kind = 6
+	KindFixed32  Kind = 7
+	KindBool     Kind = 8
+	KindString   Kind = 9
+	KindGroup    Kind = 10
+	KindMessage  Kind = 11
+	KindBytes    Kind = 12
+	KindUint32   Kind = 13
+	KindEnum     Kind = 14
+	KindSfixed32 Kind = 15
+	KindSfixed64 Kind = 16
+	KindSint32   Kind = 17
+	KindSint64   Kind = 18
+)
+
+// the kinds of the scalar types of .proto files
+var scalarKinds = map[string]Kind{
+	"double":   KindDouble,
+	"float":    KindFloat,
+	"int64":    KindInt64,
+	"uint64":   KindUint64,
+	"int32":    KindInt32,
+	"fixed64":  KindFixed64,
+	"fixed32":  KindFixed32,
+	"bool":     KindBool,
+	"string":   KindString,
+	"bytes":    KindBytes,
+	"uint32":   KindUint32,
+	"sfixed32": KindSfixed32,
+	"sfixed64": KindSfixed64,
+	"sint32":   KindSint32,
+	"sint64":   KindSint64,
+}
+
+type Field struct {
+	Name     string
+	JsonName string
+	Number   int32
+	Kind     Kind
+	Repeated bool
+	// repeated scalars are sent packed
+	Packed bool
+	// the name of the oneof the field is in, if any
+	Oneof string
+	// set for message and enum fields once the descriptors are resolved
+	Message *Message
+	Enum    *Enum
+	// the type name as written, resolved in scope
+	typeName string
+	scope    string
+}
+
+type Message struct {
+	FullName string
+	Fields   []*Field
+	// the message of a map field's entries, its key is field 1 and its value field 2
+	MapEntry bool
+	byName   map[string]*Field
+	byNumber map[int32]*Field
+}
+
+// Field returns the field by its name or its json name
+func (m *Message) Field(name string) *Field {
+	return m.byName[name]
+}
+
+func (m *Message) addField(f *Field) {
+	if m.byName == nil {
+		m.byName = make(map[string]*Field)
+		m.byNumber = make(map[int32]*Field)
+	}
+	if f.JsonName == "" {
+		f.JsonName = jsonName(f.Name)
+	}
+	m.Fields = append(m.Fields, f)
+	m.byName[f.Name] = f
+	m.byName[f.JsonName] = f
+	m.byNumber[f.Number] = f
+}
+
+type Enum struct {
+	FullName string
+	// value names in the order they are defined
+	Names    []string
+	byName   map[string]int32
+	byNumber map[int32]string
+}
+
+func (e *Enum) addValue(name string, number int32) {
+	if e.byName == nil {
+		e.byName = make(map[string]int32)
+		e.byNumber = make(map[int32]string)
+	}
+	e.Names = append(e.Names, name)
+	e.byName[name] = number
+	// with allow_alias, the first name of a number is its name
+	if _, ok := e.byNumber[number]; !ok {
+		e.byNumber[number] = name
+	}
+}
+
+type Service struct {
+	FullName string
+	Methods  []*Method
+}
+
+type Method struct {
+	Name            string
+	Service         string
+	Input           *Message
+	Output          *Message
+	ClientStreaming bool
+	ServerStreaming bool
+	inputType       string
+	outputType      string
+	scope           string
+}
+
+// Path is the path of the method in the requests, like /helloworld.Greeter/SayHello
+func (m *Method) Path() string {
+	return "/" + m.Service + "/" + m.Name
+}
+
+// Descriptors holds the messages, enums and services of a set of files
+type Descriptors struct {
+	files    map[string]bool
+	messages map[string]*Message
+	enums    map[string]*Enum
+	services map[string]*Service
+}
+
+func NewDescriptors() *Descriptors {
+	return &Descriptors{
+		files:    make(map[string]bool),
+		messages: make(map[string]*Message),
+		enums:    make(map[string]*Enum),
+		services: make(map[string]*Service),
+	}
+}
+
+// Method returns the method by its name, like helloworld.Greeter/SayHello
+// (or helloworld.Greeter.SayHello)
+func (d *Descriptors) Method(name string) (*Method, error) {
+	serviceName, methodName, err := SplitMethod(name)
+	if err != nil {
+		return nil, err
+	}
+	service, ok := d.services[serviceName]
+	if !ok {
+		return nil, fmt.Errorf("service %v is not defined, services are: %v", serviceName, strings.Join(d.Services(), ", "))
+	}
+	for _, m := range service.Methods {
+		if m.Name == methodName {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("service %v has no method %v", serviceName, methodName)
+}
+
+// SplitMethod splits the name of a method, like helloworld.Greeter/SayHello,
+// into the names of its service and of the method itself
+func SplitMethod(name string) (string, string, error) {
+	var trimmed = strings.TrimPrefix(name, "/")
+	var i = strings.LastIndexAny(trimmed, "/.")
+	if i < 1 || i == len(trimmed)-1 {
+		return "", "", fmt.Errorf("method %v must be given with its service, like helloworld.Greeter/SayHello", name)
+	}
+	return trimmed[:i], trimmed[i+1:], nil
+}
+
+// Services returns the names of the services, sorted
+func (d *Descriptors) Services() []string {
+	var names = make([]string, 0, len(d.services))
+	for name := range d.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Message returns the message by its full name, like helloworld.HelloRequest
+func (d *Descriptors) Message(name string) *Message {
+	return d.messages[strings.TrimPrefix(name, ".")]
+}
+
+func (d *Descriptors) addMessage(m *Message) error {
+	if d.messages[m.FullName] != nil || d.enums[m.FullName] != nil {
+		return fmt.Errorf("%v is defined more than once", m.FullName)
+	}
+	d.messages[m.FullName] = m
+	return nil
+}
+
+func (d *Descriptors) addEnum(e *Enum) error {
+	if d.messages[e.FullName] != nil || d.enums[e.FullName] != nil {
+		return fmt.Errorf("%v is defined more than once", e.FullName)
+	}
+	d.enums[e.FullName] = e
+	return nil
+}
+
+func (d *Descriptors) addService(s *Service) error {
+	if d.services[s.FullName] != nil {
+		return fmt.Errorf("service %v is defined more than once", s.FullName)
+	}
+	d.services[s.FullName] = s
+	return nil
+}
+
+// resolve links the fields and the methods to the types they use
+func (d *Descriptors) resolve() error {
+	var problems = make([]string, 0)
+	for _, m := range d.messages {
+		for _, f := range m.Fields {
+			if f.typeName == "" || f.Message != nil || f.Enum != nil {
+				continue
+			}
+			name, ok := d.lookup(f.scope, f.typeName)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%v.%v: type %v is not defined", m.FullName, f.Name, f.typeName))
+				continue
+			}
+			if msg, ok := d.messages[name]; ok {
+				f.Message = msg
+				f.Packed = false
+				if f.Kind != KindGroup {
+					f.Kind = KindMessage
+				}
+			} else {
+				f.Enum = d.enums[name]
+				f.Kind = KindEnum
+				// enums are numbers on the wire, packed as other numbers
+				f.Packed = f.Packed && f.Repeated
+			}
+		}
+	}
+	for _, s := range d.services {
+		for _, method := range s.Methods {
+			if method.Input != nil {
+				continue
+			}
+			in, ok := d.lookup(method.scope, method.inputType)
+			out, ok2 := d.lookup(method.scope, method.outputType)
+			if !ok || d.messages[in] == nil {
+				problems = append(problems, fmt.Sprintf("%v.%v: message %v is not defined", s.FullName, method.Name, method.inputType))
+				continue
+			}
+			if !ok2 || d.messages[out] == nil {
+				problems = append(problems, fmt.Sprintf("%v.%v: message %v is not defined", s.FullName, method.Name, method.outputType))
+				continue
+			}
+			method.Input, method.Output = d.messages[in], d.messages[out]
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// finds the full name of a type used in scope, the way protoc does: a name
+// is looked for in the scope, then in each of its parents. A name starting
+// with a dot is already a full name.
+func (d *Descriptors) lookup(scope, name string) (string, bool) {
+	if strings.HasPrefix(name, ".") {
+		name = name[1:]
+		return name, d.messages[name] != nil || d.enums[name] != nil
+	}
+	for {
+		var candidate = name
+		if scope != "" {
+			candidate = scope + "." + name
+		}
+		if d.messages[candidate] != nil || d.enums[candidate] != nil {
+			return candidate, true
+		}
+		if scope == "" {
+			return "", false
+		}
+		if i := strings.LastIndex(scope, "."); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// the json name protoc gives a field: foo_bar_baz is fooBarBaz
+func jsonName(name string) string {
+	var b strings.Builder
+	var upper = false
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
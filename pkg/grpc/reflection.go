@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// the services of server reflection, v1alpha is tried when v1 is not served
+var reflectionServices = []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+
+// fields of ServerReflectionRequest and ServerReflectionResponse
+const (
+	reflectFileByFilename       = 3
+	reflectFileContainingSymbol = 4
+	reflectFileDescriptors      = 4
+	reflectError                = 7
+)
+
+// Reflect loads the descriptors of the service (like helloworld.Greeter)
+// from the server reflection of the server of baseUrl, with the files
+// it depends on
+func Reflect(client *http.Client, baseUrl string, metadata http.Header, service string) (*Descriptors, error) {
+	var d = NewDescriptors()
+	var err error
+	for _, reflection := range reflectionServices {
+		var method = &Method{Name: "ServerReflectionInfo", Service: reflection, ClientStreaming: true, ServerStreaming: true}
+		// files are asked for once, a server may not send some of them
+		var asked = make(map[string]bool)
+		var missing []string
+		missing, err = reflect(client, baseUrl, metadata, method, d, reflectFileContainingSymbol, []string{service}, asked)
+		for err == nil && len(missing) > 0 {
+			missing, err = reflect(client, baseUrl, metadata, method, d, reflectFileByFilename, missing, asked)
+		}
+		if status, ok := err.(*statusError); !ok || status.code != Unimplemented {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed: %v", err.Error())
+	}
+	if err := d.resolve(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type statusError struct {
+	code    Code
+	message string
+}
+
+func (e *statusError) Error() string {
+	if e.message == "" {
+		return e.code.String()
+	}
+	return e.code.String() + ": " + e.message
+}
+
+// asks for the files of the names (symbols or file names), adds them and
+// returns the names of the files they depend on which are not added yet
+func reflect(client *http.Client, baseUrl string, metadata http.Header, method *Method, d *Descriptors, field int32, names []string, asked map[string]bool) ([]string, error) {
+	var requests = make([][]byte, 0, len(names))
+	for _, name := range names {
+		asked[name] = true
+		var b = appendTag(nil, field, wireBytes)
+		requests = append(requests, appendBytes(b, []byte(name)))
+	}
+	resp, err := Invoke(client, baseUrl, method, metadata, requests)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != OK {
+		return nil, &statusError{code: resp.Status, message: resp.Message}
+	}
+	var files = make([]*fileDescriptor, 0)
+	for _, m := range resp.Messages {
+		fields, err := readFields(m)
+		if err != nil {
+			return nil, err
+		}
+		if errs := fields[reflectError]; len(errs) > 0 {
+			ef, _ := readFields(errs[0].b)
+			return nil, fmt.Errorf("%v: %v", strings.Join(names, ", "), lastString(ef[2]))
+		}
+		for _, v := range fields[reflectFileDescriptors] {
+			fdr, err := readFields(v.b)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range fdr[1] {
+				fd, err := parseFileDescriptor(b.b)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, fd)
+			}
+		}
+	}
+	var missing = make([]string, 0)
+	for _, fd := range files {
+		if err := d.addFileDescriptor(fd); err != nil {
+			return nil, err
+		}
+	}
+	for _, fd := range files {
+		for _, dep := range fd.dependencies {
+			if !d.files[dep] && !asked[dep] {
+				asked[dep] = true
+				missing = append(missing, dep)
+			}
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,193 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// wire types of protobuf
+const (
+	wireVarint     = 0
+	wireFixed64    = 1
+	wireBytes      = 2
+	wireGroupStart = 3
+	wireGroupEnd   = 4
+	wireFixed32    = 5
+)
+
+var errTruncated = errors.New("the message is truncated")
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, number int32, wireType int) []byte {
+	return appendVarint(b, uint64(number)<<3|uint64(wireType))
+}
+
+func appendBytes(b []byte, v []byte) []byte {
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendFixed32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// a value read from the wire, v holds varints and fixed numbers,
+// b holds length delimited values
+type wireValue struct {
+	wireType int
+	v        uint64
+	b        []byte
+}
+
+// reads the fields of a message in the order they are written
+type wireReader struct {
+	b []byte
+}
+
+func (r *wireReader) done() bool {
+	return len(r.b) == 0
+}
+
+func (r *wireReader) varint() (uint64, error) {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		if i >= len(r.b) {
+			return 0, errTruncated
+		}
+		c := r.b[i]
+		v |= uint64(c&0x7f) << (7 * uint(i))
+		if c < 0x80 {
+			r.b = r.b[i+1:]
+			return v, nil
+		}
+	}
+	return 0, errors.New("a varint of the message is too long")
+}
+
+func (r *wireReader) next() (int32, wireValue, error) {
+	tag, err := r.varint()
+	if err != nil {
+		return 0, wireValue{}, err
+	}
+	var number, value = int32(tag >> 3), wireValue{wireType: int(tag & 7)}
+	if number < 1 {
+		return 0, value, errors.New("the message has a field numbered 0")
+	}
+	switch value.wireType {
+	case wireVarint:
+		value.v, err = r.varint()
+	case wireFixed64:
+		if len(r.b) < 8 {
+			return 0, value, errTruncated
+		}
+		value.v, r.b = binary.LittleEndian.Uint64(r.b), r.b[8:]
+	case wireFixed32:
+		if len(r.b) < 4 {
+			return 0, value, errTruncated
+		}
+		value.v, r.b = uint64(binary.LittleEndian.Uint32(r.b)), r.b[4:]
+	case wireBytes:
+		var n uint64
+		if n, err = r.varint(); err != nil {
+			return 0, value, err
+		}
+		if uint64(len(r.b)) < n {
+			return 0, value, errTruncated
+		}
+		value.b, r.b = r.b[:n], r.b[n:]
+	case wireGroupStart:
+		// groups are skipped with the fields in them
+		var depth = 1
+		for depth > 0 {
+			_, inner, err := r.next()
+			if err != nil {
+				return 0, value, err
+			}
+			switch inner.wireType {
+			case wireGroupStart:
+				depth++
+			case wireGroupEnd:
+				depth--
+			}
+		}
+	case wireGroupEnd:
+	default:
+		return 0, value, errors.New("the message has an unknown wire type")
+	}
+	return number, value, err
+}
+
+// the wire type of the values of a kind, when they are not packed
+func wireTypeOf(kind Kind) int {
+	switch kind {
+	case KindDouble, KindFixed64, KindSfixed64:
+		return wireFixed64
+	case KindFloat, KindFixed32, KindSfixed32:
+		return wireFixed32
+	case KindString, KindBytes, KindMessage:
+		return wireBytes
+	}
+	return wireVarint
+}
+
+// reads the packed numbers of a repeated field
+func unpack(kind Kind, b []byte) ([]wireValue, error) {
+	var values = make([]wireValue, 0)
+	var r = &wireReader{b: b}
+	var wireType = wireTypeOf(kind)
+	for !r.done() {
+		var value = wireValue{wireType: wireType}
+		switch wireType {
+		case wireFixed64:
+			if len(r.b) < 8 {
+				return nil, errTruncated
+			}
+			value.v, r.b = binary.LittleEndian.Uint64(r.b), r.b[8:]
+		case wireFixed32:
+			if len(r.b) < 4 {
+				return nil, errTruncated
+			}
+			value.v, r.b = uint64(binary.LittleEndian.Uint32(r.b)), r.b[4:]
+		default:
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			value.v = v
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func float64Of(v uint64) float64 {
+	return math.Float64frombits(v)
+}
+
+func float32Of(v uint64) float32 {
+	return math.Float32frombits(uint32(v))
+}
@@ -0,0 +1,283 @@
+package importer
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// options of curl which are ignored, as they change nothing of the
+// request itself; the ones taking a value are true
+var ignoredCurlOptions = map[string]bool{
+	"--compressed": false, "-k": false, "--insecure": false, "-L": false, "--location": false,
+	"-s": false, "--silent": false, "-S": false, "--show-error": false, "-v": false, "--verbose": false,
+	"-i": false, "--include": false, "--http1.1": false, "--http2": false, "-f": false, "--fail": false,
+	"-o": true, "--output": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"-x": true, "--proxy": true, "--retry": true, "-w": true, "--write-out": true,
+}
+
+// options of curl taking a value, by their short names
+var curlOptionsWithValue = map[string]bool{"X": true, "H": true, "d": true, "u": true, "b": true,
+	"A": true, "e": true, "o": true, "m": true, "x": true, "w": true}
+
+// SplitCurlCommands splits a text holding curl commands, as copied from
+// a browser or written in a script, into one string per command
+func SplitCurlCommands(text string) []string {
+	text = strings.ReplaceAll(text, "\\\r\n", " ")
+	text = strings.ReplaceAll(text, "\\\n", " ")
+	var commands = make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		var trimmed = strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "curl ") || len(commands) == 0 {
+			commands = append(commands, trimmed)
+		} else {
+			commands[len(commands)-1] += "\n" + line
+		}
+	}
+	return commands
+}
+
+// ParseCurl returns the request of a curl command
+func ParseCurl(command string) (*Request, error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+	var req = &Request{}
+	var data = make([]string, 0)
+	var get, head = false, false
+	for i := 0; i < len(args); i++ {
+		var arg = args[i]
+		var value string
+		var next = func() error {
+			if i+1 >= len(args) {
+				return errors.New("curl option " + arg + " needs a value")
+			}
+			i++
+			value = args[i]
+			return nil
+		}
+		// -XPOST is -X POST, and -sSL is -s -S -L
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			if curlOptionsWithValue[arg[1:2]] {
+				args = append(args[:i], append([]string{arg[:2], arg[2:]}, args[i+1:]...)...)
+			} else {
+				var split = make([]string, 0, len(arg)-1)
+				for _, c := range arg[1:] {
+					split = append(split, "-"+string(c))
+				}
+				args = append(args[:i], append(split, args[i+1:]...)...)
+			}
+			arg = args[i]
+		}
+		switch arg {
+		case "-X", "--request":
+			if err = next(); err == nil {
+				req.Method = value
+			}
+		case "-H", "--header":
+			if err = next(); err == nil {
+				var parts = strings.SplitN(value, ":", 2)
+				if len(parts) != 2 {
+					return nil, errors.New("header " + value + " must be like Name: value")
+				}
+				req.Headers = append(req.Headers, Header{Name: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])})
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			if err = next(); err == nil {
+				if strings.HasPrefix(value, "@") {
+					b, readErr := ioutil.ReadFile(value[1:])
+					if readErr != nil {
+						return nil, readErr
+					}
+					value = string(b)
+				}
+				data = append(data, value)
+			}
+		case "--data-raw":
+			if err = next(); err == nil {
+				data = append(data, value)
+			}
+		case "--data-urlencode":
+			if err = next(); err == nil {
+				if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+					value = parts[0] + "=" + url.QueryEscape(parts[1])
+				} else {
+					value = url.QueryEscape(value)
+				}
+				data = append(data, value)
+			}
+		case "--json":
+			if err = next(); err == nil {
+				data = append(data, value)
+				setDefaultHeader(req, "Content-Type", "application/json")
+				setDefaultHeader(req, "Accept", "application/json")
+			}
+		case "-u", "--user":
+			if err = next(); err == nil {
+				req.Headers = append(req.Headers, Header{Name: "Authorization",
+					Value: "Basic " + base64.StdEncoding.EncodeToString([]byte(value))})
+			}
+		case "-b", "--cookie":
+			if err = next(); err == nil {
+				if !strings.Contains(value, "=") {
+					return nil, errors.New("cookie files are not supported, give the cookies like -b 'name=value'")
+				}
+				req.Headers = append(req.Headers, Header{Name: "Cookie", Value: value})
+			}
+		case "-A", "--user-agent":
+			if err = next(); err == nil {
+				req.Headers = append(req.Headers, Header{Name: "User-Agent", Value: value})
+			}
+		case "-e", "--referer":
+			if err = next(); err == nil {
+				req.Headers = append(req.Headers, Header{Name: "Referer", Value: value})
+			}
+		case "--url":
+			if err = next(); err == nil {
+				req.Url = value
+			}
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		default:
+			if takesValue, ok := ignoredCurlOptions[arg]; ok {
+				if takesValue {
+					err = next()
+				}
+			} else if strings.HasPrefix(arg, "-") {
+				return nil, errors.New("curl option " + arg + " is not supported")
+			} else if req.Url == "" {
+				req.Url = arg
+			} else {
+				return nil, errors.New("unexpected curl arg " + arg)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.Url == "" {
+		return nil, errors.New("curl command has no url")
+	}
+	if !strings.Contains(req.Url, "://") {
+		req.Url = "http://" + req.Url
+	}
+	var body = strings.Join(data, "&")
+	switch {
+	case get && body != "":
+		if strings.Contains(req.Url, "?") {
+			req.Url += "&" + body
+		} else {
+			req.Url += "?" + body
+		}
+	case body != "":
+		req.Body = body
+		setDefaultHeader(req, "Content-Type", "application/x-www-form-urlencoded")
+		if req.Method == "" {
+			req.Method = "POST"
+		}
+	}
+	if head && req.Method == "" {
+		req.Method = "HEAD"
+	}
+	return req, nil
+}
+
+func setDefaultHeader(req *Request, name, value string) {
+	for _, h := range req.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return
+		}
+	}
+	req.Headers = append(req.Headers, Header{Name: name, Value: value})
+}
+
+// splits a command into its words the way a posix shell does:
+// 'single' and "double" quotes, $'ansi c' quotes and backslashes
+func splitShellWords(command string) ([]string, error) {
+	var words = make([]string, 0)
+	var word strings.Builder
+	var inWord = false
+	for i := 0; i < len(command); i++ {
+		var c = command[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(command) {
+				i++
+				if command[i] != '\n' {
+					word.WriteByte(command[i])
+				}
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("the command has an unclosed ' quote")
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+		case c == '$' && i+1 < len(command) && command[i+1] == '\'':
+			inWord = true
+			i += 2
+			for ; i < len(command) && command[i] != '\''; i++ {
+				if command[i] == '\\' && i+1 < len(command) {
+					i++
+					switch command[i] {
+					case 'n':
+						word.WriteByte('\n')
+					case 't':
+						word.WriteByte('\t')
+					case 'r':
+						word.WriteByte('\r')
+					default:
+						word.WriteByte(command[i])
+					}
+					continue
+				}
+				word.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, errors.New("the command has an unclosed $' quote")
+			}
+		case c == '"':
+			inWord = true
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`\n", command[i+1]) >= 0 {
+					i++
+					if command[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, errors.New("the command has an unclosed \" quote")
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
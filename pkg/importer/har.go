@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// the parts of a har file (http archive) which are imported
+type harFile struct {
+	Log struct {
+		Entries []*harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method  string `json:"method"`
+		Url     string `json:"url"`
+		Headers []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		PostData *struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Params   []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// mime types and extensions of the requests a browser makes for a page
+// itself (images, fonts, styles and scripts), they are not imported
+// unless Options.IncludeStatic is set
+var staticMimeTypes = []string{"image/", "font/", "text/css", "javascript", "audio/", "video/"}
+var staticExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+	".ico": true, ".webp": true, ".css": true, ".js": true, ".woff": true, ".woff2": true, ".ttf": true,
+	".eot": true, ".map": true, ".mp4": true, ".mp3": true}
+
+// ParseHar returns the requests of a har file in their recorded
+// order, with the bodies of their responses
+func ParseHar(b []byte, opts Options) ([]*Request, error) {
+	var har = &harFile{}
+	if err := json.Unmarshal(b, har); err != nil {
+		return nil, errors.New("not a har file: " + err.Error())
+	}
+	if len(har.Log.Entries) == 0 {
+		return nil, errors.New("the har file has no entries")
+	}
+	var requests = make([]*Request, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		if !opts.IncludeStatic && e.isStatic() {
+			continue
+		}
+		var req = &Request{Method: e.Request.Method, Url: e.Request.Url}
+		for _, h := range e.Request.Headers {
+			req.Headers = append(req.Headers, Header{Name: h.Name, Value: h.Value})
+		}
+		if pd := e.Request.PostData; pd != nil {
+			req.Body = pd.Text
+			if req.Body == "" && len(pd.Params) > 0 {
+				var form = url.Values{}
+				for _, p := range pd.Params {
+					form.Add(p.Name, p.Value)
+				}
+				req.Body = form.Encode()
+			}
+		}
+		req.Response = e.Response.Content.Text
+		if e.Response.Content.Encoding == "base64" {
+			if decoded, err := base64.StdEncoding.DecodeString(req.Response); err == nil {
+				req.Response = string(decoded)
+			}
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+func (e *harEntry) isStatic() bool {
+	var mime = strings.ToLower(e.Response.Content.MimeType)
+	for _, m := range staticMimeTypes {
+		if strings.Contains(mime, m) {
+			return true
+		}
+	}
+	if parsed, err := url.Parse(e.Request.Url); err == nil {
+		return staticExtensions[strings.ToLower(path.Ext(parsed.Path))]
+	}
+	return false
+}
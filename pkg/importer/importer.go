@@ -0,0 +1,424 @@
+// Package importer turns recorded requests (a HAR file of a browser
+// session, or curl commands) and the operations of an OpenAPI document
+// into a yaml config of load48.
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// values shorter than this are not taken as reused, as
+// short values (like 1 or true) match by chance
+const minReusedLength = 4
+
+// Header is a request header, headers keep their recorded order
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Request is a recorded request, with the body of its
+// response when it is recorded (har)
+type Request struct {
+	Method   string
+	Url      string
+	Headers  []Header
+	Body     string
+	Response string
+}
+
+// Options of an import
+type Options struct {
+	// only the requests to these hosts are imported, all if empty
+	Hosts []string
+	// imports the requests of images, fonts, styles and scripts too (har)
+	IncludeStatic bool
+}
+
+// Target is a target of the imported config
+type Target struct {
+	Name    string
+	Request *Request
+	// variables extracted from the target's response, by name
+	Variables []*Variable
+	// checks of the responses, like status-is-ok: 200, 201
+	Assertions []Assertion
+	// targets whose variables the target sends
+	DependsOn []string
+	// notes of the import on the target, written above it
+	Notes []string
+}
+
+// Assertion is an assertion of a target on its responses
+type Assertion struct {
+	Name  string
+	Value string
+}
+
+// Variable is a value of a response which is sent by later requests, it
+// is extracted by the target and the value is replaced by the variable
+type Variable struct {
+	Name string
+	// string or number
+	Type string
+	// json path of the value in the response
+	Path string
+	// the recorded value, empty when it is not recorded
+	Value string
+}
+
+// Reused is a value sent by more than one request which no recorded
+// response returns, it is suggested to be extracted by a variable
+type Reused struct {
+	Value string
+	// where the value is sent, like "header Authorization of get-users"
+	Uses []string
+	// the target which sends the value first, the suggestion is put there
+	Target string
+}
+
+// Import is the config made of the recorded requests
+type Import struct {
+	Source  string
+	Targets []*Target
+	Reused  []*Reused
+}
+
+// headers which are set by the http client itself
+var skippedHeaders = map[string]bool{"host": true, "content-length": true, "connection": true,
+	"accept-encoding": true, "keep-alive": true, "transfer-encoding": true}
+
+// headers whose values are the same for all requests of a client,
+// they are not reported as reused values
+var commonHeaders = map[string]bool{"accept": true, "accept-language": true, "user-agent": true,
+	"content-type": true, "origin": true, "referer": true, "cache-control": true, "pragma": true,
+	"dnt": true, "upgrade-insecure-requests": true}
+
+// New makes the targets of the requests in their recorded order, finds
+// the values which later requests take from earlier responses, and the
+// values reused across requests
+func New(source string, requests []*Request, opts Options) *Import {
+	var im = &Import{Source: source}
+	var names = make(map[string]int)
+	for _, req := range requests {
+		if !matchesHost(req.Url, opts.Hosts) {
+			continue
+		}
+		if req.Method == "" {
+			req.Method = "GET"
+		}
+		req.Method = strings.ToUpper(req.Method)
+		var headers = make([]Header, 0, len(req.Headers))
+		for _, h := range req.Headers {
+			if strings.HasPrefix(h.Name, ":") || skippedHeaders[strings.ToLower(h.Name)] {
+				continue
+			}
+			headers = append(headers, h)
+		}
+		req.Headers = headers
+		im.Targets = append(im.Targets, &Target{Name: targetName(req, names), Request: req})
+	}
+	im.extractVariables()
+	im.findReused()
+	return im
+}
+
+func matchesHost(u string, hosts []string) bool {
+	if len(hosts) == 0 {
+		return true
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(parsed.Host, h) || strings.EqualFold(parsed.Hostname(), h) {
+			return true
+		}
+	}
+	return false
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+var numeric = regexp.MustCompile(`^[0-9]+$`)
+
+// a target is named by its method and the last part of its path which
+// is not an id, like get-users for GET /users/12
+func targetName(req *Request, names map[string]int) string {
+	var last = "root"
+	if parsed, err := url.Parse(req.Url); err == nil {
+		var parts = strings.Split(strings.Trim(parsed.Path, "/"), "/")
+		for i := len(parts) - 1; i >= 0; i-- {
+			if parts[i] != "" && !numeric.MatchString(parts[i]) {
+				last = parts[i]
+				break
+			}
+		}
+	}
+	last = strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(last), "-"), "-")
+	if last == "" {
+		last = "root"
+	}
+	var name = strings.ToLower(req.Method) + "-" + last
+	names[name]++
+	if names[name] > 1 {
+		name = fmt.Sprintf("%v-%v", name, names[name])
+	}
+	return name
+}
+
+// a value of a json response
+type leaf struct {
+	path  string
+	kind  string
+	value string
+}
+
+var pathKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// returns the values of the json, with their gjson paths, sorted by path
+func jsonLeaves(body string) []leaf {
+	var doc interface{}
+	dec := json.NewDecoder(strings.NewReader(body))
+	// numbers are kept as they are written, 12345678 is not 1.2345678e+07
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil
+	}
+	var leaves = make([]leaf, 0)
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		var join = func(key string) string {
+			if path == "" {
+				return key
+			}
+			return path + "." + key
+		}
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			var keys = make([]string, 0, len(vv))
+			for k := range vv {
+				if pathKey.MatchString(k) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(join(k), vv[k])
+			}
+		case []interface{}:
+			for i, item := range vv {
+				walk(join(fmt.Sprint(i)), item)
+			}
+		case string:
+			leaves = append(leaves, leaf{path: path, kind: "string", value: vv})
+		case json.Number:
+			leaves = append(leaves, leaf{path: path, kind: "number", value: vv.String()})
+		}
+	}
+	walk("", doc)
+	return leaves
+}
+
+// the parts of a request which are sent, where values are looked for
+func (r *Request) sent() string {
+	var b strings.Builder
+	b.WriteString(r.Url + "\n")
+	for _, h := range r.Headers {
+		b.WriteString(h.Value + "\n")
+	}
+	b.WriteString(r.Body)
+	return b.String()
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// finds the value as a whole word in s, so 12 is not found in 123
+func indexToken(s, value string, from int) int {
+	for from <= len(s) {
+		at := strings.Index(s[from:], value)
+		if at < 0 {
+			return -1
+		}
+		at += from
+		var end = at + len(value)
+		if (at == 0 || !isWordChar(s[at-1]) || !isWordChar(value[0])) &&
+			(end == len(s) || !isWordChar(s[end]) || !isWordChar(value[len(value)-1])) {
+			return at
+		}
+		from = at + 1
+	}
+	return -1
+}
+
+func containsToken(s, value string) bool {
+	return indexToken(s, value, 0) >= 0
+}
+
+func replaceToken(s, value, with string) string {
+	for at := indexToken(s, value, 0); at >= 0; at = indexToken(s, value, at+len(with)) {
+		s = s[:at] + with + s[at+len(value):]
+	}
+	return s
+}
+
+// a value of a response which is sent by a later request, and not by the
+// request of the response or any request before it, is taken from the
+// response: it is extracted by a variable and replaced in later requests
+func (im *Import) extractVariables() {
+	var taken = make(map[string]bool)
+	var names = make([]string, 0)
+	for i, t := range im.Targets {
+		for _, l := range jsonLeaves(t.Request.Response) {
+			if len(l.value) < minReusedLength || taken[l.value] || im.sentBefore(i+1, l.value) || !im.sentAfter(i, l.value) {
+				continue
+			}
+			taken[l.value] = true
+			var v = &Variable{Name: variableName(l.path, names), Type: l.kind, Path: l.path, Value: l.value}
+			names = append(names, v.Name)
+			t.Variables = append(t.Variables, v)
+			for _, later := range im.Targets[i+1:] {
+				later.Request.replace(l.value, v.Name)
+			}
+		}
+	}
+}
+
+// reports whether any of the first n requests sends the value
+func (im *Import) sentBefore(n int, value string) bool {
+	for _, t := range im.Targets[:n] {
+		if containsToken(t.Request.sent(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether any request after the i-th sends the value
+func (im *Import) sentAfter(i int, value string) bool {
+	for _, t := range im.Targets[i+1:] {
+		if containsToken(t.Request.sent(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Request) replace(value, variableName string) {
+	r.Url = replaceToken(r.Url, value, variableName)
+	for i := range r.Headers {
+		r.Headers[i].Value = replaceToken(r.Headers[i].Value, value, variableName)
+	}
+	r.Body = replaceToken(r.Body, value, variableName)
+}
+
+var variableChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// values holding a variable are made by the import, they are not reused
+var variableReference = regexp.MustCompile(`\$[A-Za-z_]`)
+
+// a variable is named by the last key of its path which is not an index,
+// like $token for data.token. Variables are replaced as they are found in
+// a value, so a name must not be the start of another one ($id and $id2).
+func variableName(path string, taken []string) string {
+	var parts = strings.Split(path, ".")
+	var candidates = make([]string, 0)
+	var name = ""
+	for i := len(parts) - 1; i >= 0; i-- {
+		if numeric.MatchString(parts[i]) {
+			continue
+		}
+		var part = variableChars.ReplaceAllString(parts[i], "_")
+		if name == "" {
+			name = part
+		} else {
+			name = part + "_" + name
+		}
+		candidates = append(candidates, "$"+name)
+	}
+	for i := 1; ; i++ {
+		candidates = append(candidates, fmt.Sprintf("$var%v_%v", i, name))
+		for _, c := range candidates {
+			if c != "$" && !conflicts(c, taken) {
+				return c
+			}
+		}
+	}
+}
+
+func conflicts(name string, taken []string) bool {
+	for _, t := range taken {
+		if strings.HasPrefix(t, name) || strings.HasPrefix(name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// a place a value is sent at
+type use struct {
+	target int
+	where  string
+}
+
+// finds the values which are sent by more than one request, but are not
+// taken from a response: header values (except the ones every client
+// sends), query params and the values of json bodies
+func (im *Import) findReused() {
+	var uses = make(map[string][]use)
+	var order = make([]string, 0)
+	var add = func(i int, value, where string) {
+		if len(value) < minReusedLength || variableReference.MatchString(value) {
+			return
+		}
+		for _, u := range uses[value] {
+			if u.target == i {
+				return
+			}
+		}
+		if _, ok := uses[value]; !ok {
+			order = append(order, value)
+		}
+		uses[value] = append(uses[value], use{target: i, where: where + " of " + im.Targets[i].Name})
+	}
+	for i, t := range im.Targets {
+		for _, h := range t.Request.Headers {
+			if !commonHeaders[strings.ToLower(h.Name)] && !strings.HasPrefix(strings.ToLower(h.Name), "sec-") {
+				add(i, h.Value, "header "+h.Name)
+			}
+		}
+		if parsed, err := url.Parse(t.Request.Url); err == nil {
+			var query = parsed.Query()
+			var keys = make([]string, 0, len(query))
+			for k := range query {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				for _, v := range query[k] {
+					add(i, v, "query param "+k)
+				}
+			}
+		}
+		for _, l := range jsonLeaves(t.Request.Body) {
+			add(i, l.value, "body field "+l.path)
+		}
+	}
+	for _, value := range order {
+		if len(uses[value]) < 2 {
+			continue
+		}
+		var r = &Reused{Value: value, Target: im.Targets[uses[value][0].target].Name}
+		for _, u := range uses[value] {
+			r.Uses = append(r.Uses, u.where)
+		}
+		im.Reused = append(im.Reused, r)
+	}
+}
@@ -0,0 +1,944 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemas nested deeper than this are left out of the examples,
+// it also ends the examples of recursive schemas
+const maxSchemaDepth = 8
+
+// OpenApiOptions selects the operations of an OpenAPI document which
+// are imported, all of them are imported when none is selected
+type OpenApiOptions struct {
+	// operations by their operationId, or like "GET /users/{id}"
+	Operations []string
+	// operations having any of these tags
+	Tags []string
+	// the base url of the requests, instead of the first server of the document
+	Server string
+}
+
+// the methods of a path item, in the order their targets are written
+var openApiMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// an OpenAPI 3 document, kept as yaml nodes so its order is kept
+type openApiSpec struct {
+	root *yaml.Node
+}
+
+// an operation of the document
+type operation struct {
+	method string
+	path   string
+	node   *yaml.Node
+	// path, query and header params, the ones of the path item included
+	params []*yaml.Node
+	target *Target
+}
+
+// ParseOpenApi makes the targets of the selected operations of an OpenAPI 3
+// document (yaml or json), in the order they are written. Path params are
+// taken from the response of another selected operation when it returns
+// them, otherwise their examples are put in the url.
+func ParseOpenApi(source string, b []byte, opts OpenApiOptions) (*Import, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, errors.New("not an OpenAPI document: " + err.Error())
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("not an OpenAPI document")
+	}
+	var s = &openApiSpec{root: doc.Content[0]}
+	if v := child(s.root, "openapi"); v == nil || !strings.HasPrefix(v.Value, "3.") {
+		if child(s.root, "swagger") != nil {
+			return nil, errors.New("swagger 2 documents are not supported, convert it to OpenAPI 3 first")
+		}
+		return nil, errors.New("not an OpenAPI 3 document, it has no openapi: 3.x field")
+	}
+	server, err := s.server(opts.Server)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := s.operations(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("no operation is selected to import")
+	}
+	var im = &Import{Source: source}
+	var names = make(map[string]int)
+	for _, op := range ops {
+		op.target = &Target{Name: op.name(names), Request: &Request{Method: strings.ToUpper(op.method)}}
+		if summary := child(op.node, "summary"); summary != nil && summary.Value != "" {
+			op.target.Notes = append(op.target.Notes, strings.ToUpper(op.method)+" "+op.path+": "+summary.Value)
+		}
+		im.Targets = append(im.Targets, op.target)
+	}
+	var variables = make(map[string]*Variable)
+	var taken = make([]string, 0)
+	for _, op := range ops {
+		if err := s.makeTarget(op, ops, server, variables, &taken); err != nil {
+			return nil, fmt.Errorf("%v %v: %v", strings.ToUpper(op.method), op.path, err)
+		}
+	}
+	return im, nil
+}
+
+// the base url of the requests, server variables take their defaults
+func (s *openApiSpec) server(given string) (string, error) {
+	var server = given
+	if server == "" {
+		if servers := child(s.root, "servers"); servers != nil && len(servers.Content) > 0 {
+			server = value(child(servers.Content[0], "url"))
+			if vars := child(servers.Content[0], "variables"); vars != nil {
+				for i := 0; i+1 < len(vars.Content); i += 2 {
+					server = strings.ReplaceAll(server, "{"+vars.Content[i].Value+"}", value(child(vars.Content[i+1], "default")))
+				}
+			}
+		}
+	}
+	if !strings.Contains(server, "://") {
+		if server == "" {
+			return "", errors.New("the document has no servers, give the base url of the requests by --server")
+		}
+		return "", errors.New("the server url " + server + " is relative, give the base url of the requests by --server")
+	}
+	return strings.TrimRight(server, "/"), nil
+}
+
+// the selected operations in the order they are written
+func (s *openApiSpec) operations(opts OpenApiOptions) ([]*operation, error) {
+	var ops = make([]*operation, 0)
+	var found = make(map[string]bool)
+	paths := child(s.root, "paths")
+	if paths == nil {
+		return nil, errors.New("the document has no paths")
+	}
+	for i := 0; i+1 < len(paths.Content); i += 2 {
+		var path = paths.Content[i].Value
+		item, err := s.resolve(paths.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		for _, method := range openApiMethods {
+			node := child(item, method)
+			if node == nil {
+				continue
+			}
+			var op = &operation{method: method, path: path, node: node}
+			var selected = len(opts.Operations) == 0 && len(opts.Tags) == 0
+			for _, o := range opts.Operations {
+				if o == value(child(node, "operationId")) || strings.EqualFold(o, method+" "+path) {
+					selected = true
+					found[o] = true
+				}
+			}
+			if tags := child(node, "tags"); tags != nil {
+				for _, tag := range tags.Content {
+					for _, t := range opts.Tags {
+						if tag.Value == t {
+							selected = true
+							found[t] = true
+						}
+					}
+				}
+			}
+			if !selected {
+				continue
+			}
+			if op.params, err = s.params(child(item, "parameters"), child(node, "parameters")); err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+		}
+	}
+	for _, o := range opts.Operations {
+		if !found[o] {
+			return nil, errors.New("operation " + o + " is not found in the document")
+		}
+	}
+	for _, t := range opts.Tags {
+		if !found[t] {
+			return nil, errors.New("no operation has the tag " + t)
+		}
+	}
+	return ops, nil
+}
+
+// the params of the path item and of the operation, the ones of
+// the operation replace the ones of the path item with their names
+func (s *openApiSpec) params(lists ...*yaml.Node) ([]*yaml.Node, error) {
+	var params = make([]*yaml.Node, 0)
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		for _, p := range list.Content {
+			p, err := s.resolve(p)
+			if err != nil {
+				return nil, err
+			}
+			var replaced = false
+			for i, prev := range params {
+				if value(child(prev, "name")) == value(child(p, "name")) && value(child(prev, "in")) == value(child(p, "in")) {
+					params[i] = p
+					replaced = true
+				}
+			}
+			if !replaced {
+				params = append(params, p)
+			}
+		}
+	}
+	return params, nil
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// an operation is named by its operationId, or by its method and the last
+// part of its path which is not a param, like get-users for GET /users/{id}
+func (op *operation) name(names map[string]int) string {
+	var name = value(child(op.node, "operationId"))
+	if name == "" {
+		var last = "root"
+		var parts = strings.Split(strings.Trim(op.path, "/"), "/")
+		for i := len(parts) - 1; i >= 0; i-- {
+			if parts[i] != "" && !pathParam.MatchString(parts[i]) {
+				last = parts[i]
+				break
+			}
+		}
+		last = strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(last), "-"), "-")
+		if last == "" {
+			last = "root"
+		}
+		name = op.method + "-" + last
+	}
+	names[name]++
+	if names[name] > 1 {
+		name = fmt.Sprintf("%v-%v", name, names[name])
+	}
+	return name
+}
+
+func (s *openApiSpec) makeTarget(op *operation, ops []*operation, server string,
+	variables map[string]*Variable, taken *[]string) error {
+	var t = op.target
+	var path = op.path
+	var query = make([]string, 0)
+	for _, p := range op.params {
+		var name, in = value(child(p, "name")), value(child(p, "in"))
+		var required = value(child(p, "required")) == "true"
+		switch {
+		case in == "path":
+			v, err := s.pathVariable(op, name, ops, variables, taken)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				path = strings.ReplaceAll(path, "{"+name+"}", v.Name)
+				continue
+			}
+			example, err := s.paramExample(p)
+			if err != nil {
+				return err
+			}
+			var shown = scalarText(example)
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(shown))
+			t.Notes = append(t.Notes, "{"+name+"} is the example "+shorten(shown)+", no selected operation returns it")
+		case in == "query" && required:
+			example, err := s.paramExample(p)
+			if err != nil {
+				return err
+			}
+			query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(scalarText(example)))
+		case in == "header" && required:
+			example, err := s.paramExample(p)
+			if err != nil {
+				return err
+			}
+			t.Request.Headers = append(t.Request.Headers, Header{Name: name, Value: scalarText(example)})
+		case in == "cookie" && required:
+			example, err := s.paramExample(p)
+			if err != nil {
+				return err
+			}
+			t.Request.Headers = append(t.Request.Headers, Header{Name: "Cookie", Value: name + "=" + scalarText(example)})
+		}
+	}
+	security, err := s.security(op, &query)
+	if err != nil {
+		return err
+	}
+	t.Request.Headers = append(t.Request.Headers, security...)
+	t.Request.Url = server + path
+	if len(query) > 0 {
+		t.Request.Url += "?" + strings.Join(query, "&")
+	}
+	if err = s.body(op); err != nil {
+		return err
+	}
+	return s.assertions(op)
+}
+
+// the variable of a path param, extracted from the response of another
+// selected operation without path params; nil when no operation returns it
+func (s *openApiSpec) pathVariable(op *operation, param string, ops []*operation,
+	variables map[string]*Variable, taken *[]string) (*Variable, error) {
+	var segment = segmentBefore(op.path, param)
+	for _, related := range []bool{true, false} {
+		for _, producer := range ops {
+			if producer == op || pathParam.MatchString(producer.path) {
+				continue
+			}
+			var candidates = propertyCandidates(param, segment, producer.path, related)
+			if len(candidates) == 0 {
+				continue
+			}
+			_, media, err := s.successContent(producer)
+			if err != nil {
+				return nil, err
+			}
+			if media == nil || !strings.Contains(media.typ, "json") {
+				continue
+			}
+			path, kind, err := s.findProperty(child(media.node, "schema"), candidates, 0)
+			if err != nil {
+				return nil, err
+			}
+			if path == "" {
+				continue
+			}
+			var key = producer.target.Name + " " + path
+			if v, ok := variables[key]; ok {
+				addDependency(op.target, producer.target.Name)
+				return v, nil
+			}
+			var v = &Variable{Name: variableName(param, *taken), Type: kind, Path: path}
+			*taken = append(*taken, v.Name)
+			variables[key] = v
+			producer.target.Variables = append(producer.target.Variables, v)
+			addDependency(op.target, producer.target.Name)
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func addDependency(t *Target, name string) {
+	for _, dep := range t.DependsOn {
+		if dep == name {
+			return
+		}
+	}
+	t.DependsOn = append(t.DependsOn, name)
+}
+
+// the static part of the path before the param, like users of /users/{id}
+func segmentBefore(path, param string) string {
+	var parts = strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if part == "{"+param+"}" && i > 0 && !pathParam.MatchString(parts[i-1]) {
+			return parts[i-1]
+		}
+	}
+	return ""
+}
+
+// the properties of the response of the producer which can be the path
+// param. A producer is related when it is the collection of the param
+// (/users for /users/{id}) or named by it (/users for {userId}), then its
+// id is taken too; other producers must return the param by its own name,
+// and not by a name as general as id
+func propertyCandidates(param, segment, producerPath string, related bool) []string {
+	var last = ""
+	for _, part := range strings.Split(strings.Trim(producerPath, "/"), "/") {
+		if part != "" {
+			last = part
+		}
+	}
+	var normalized = normalizeName(param)
+	var isRelated = last != "" && (last == segment || normalized == normalizeName(singular(last))+"id")
+	switch {
+	case related && isRelated:
+		if normalized == "id" {
+			return []string{"id"}
+		}
+		return []string{param, "id"}
+	case !related && !isRelated && normalized != "id":
+		return []string{param}
+	}
+	return nil
+}
+
+func normalizeName(v string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(v))
+}
+
+func singular(v string) string {
+	switch {
+	case strings.HasSuffix(v, "ies"):
+		return strings.TrimSuffix(v, "ies") + "y"
+	case strings.HasSuffix(v, "s"):
+		return strings.TrimSuffix(v, "s")
+	}
+	return v
+}
+
+// finds the first of the names among the properties of the schema, the
+// ones of its nested objects, and the ones of the first item of arrays;
+// it returns the gjson path of the property and the type of its variable
+func (s *openApiSpec) findProperty(schema *yaml.Node, names []string, depth int) (string, string, error) {
+	if schema == nil || depth > 3 {
+		return "", "", nil
+	}
+	schema, err := s.resolve(schema)
+	if err != nil {
+		return "", "", err
+	}
+	if schemaType(schema) == "array" {
+		path, kind, err := s.findProperty(child(schema, "items"), names, depth+1)
+		if path != "" {
+			path = "0." + path
+		}
+		return path, kind, err
+	}
+	props, err := s.properties(schema)
+	if err != nil {
+		return "", "", err
+	}
+	for _, name := range names {
+		for i := 0; i+1 < len(props); i += 2 {
+			if props[i].Value != name {
+				continue
+			}
+			prop, err := s.resolve(props[i+1])
+			if err != nil {
+				return "", "", err
+			}
+			switch schemaType(prop) {
+			case "integer", "number":
+				return name, "number", nil
+			case "string", "":
+				return name, "string", nil
+			}
+		}
+	}
+	for i := 0; i+1 < len(props); i += 2 {
+		if !pathKey.MatchString(props[i].Value) {
+			continue
+		}
+		path, kind, err := s.findProperty(props[i+1], names, depth+1)
+		if err != nil {
+			return "", "", err
+		}
+		if path != "" {
+			return props[i].Value + "." + path, kind, nil
+		}
+	}
+	return "", "", nil
+}
+
+// the security of the operation as headers (and query params) whose values
+// are taken from environment variables named by their schemes, like
+// Authorization: Bearer ${BEARER_AUTH}
+func (s *openApiSpec) security(op *operation, query *[]string) ([]Header, error) {
+	var requirements = child(op.node, "security")
+	if requirements == nil {
+		requirements = child(s.root, "security")
+	}
+	if requirements == nil || len(requirements.Content) == 0 {
+		return nil, nil
+	}
+	var headers = make([]Header, 0)
+	// the first requirement is enough, the others are alternatives
+	var requirement = requirements.Content[0]
+	for i := 0; i+1 < len(requirement.Content); i += 2 {
+		var name = requirement.Content[i].Value
+		scheme, err := s.resolve(child(child(child(s.root, "components"), "securitySchemes"), name))
+		if err != nil {
+			return nil, err
+		}
+		if scheme == nil {
+			return nil, errors.New("security scheme " + name + " is not defined")
+		}
+		var env = "${" + envName(name) + "}"
+		switch value(child(scheme, "type")) {
+		case "apiKey":
+			var key = value(child(scheme, "name"))
+			switch value(child(scheme, "in")) {
+			case "header":
+				headers = append(headers, Header{Name: key, Value: env})
+			case "query":
+				*query = append(*query, url.QueryEscape(key)+"="+env)
+			case "cookie":
+				headers = append(headers, Header{Name: "Cookie", Value: key + "=" + env})
+			}
+		case "http":
+			switch strings.ToLower(value(child(scheme, "scheme"))) {
+			case "basic":
+				// the env variable holds base64 of user:password
+				headers = append(headers, Header{Name: "Authorization", Value: "Basic " + env})
+			default:
+				headers = append(headers, Header{Name: "Authorization", Value: "Bearer " + env})
+			}
+		case "oauth2", "openIdConnect":
+			headers = append(headers, Header{Name: "Authorization", Value: "Bearer " + env})
+		}
+	}
+	return headers, nil
+}
+
+var envNameBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+var nonEnvChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// bearerAuth is BEARER_AUTH
+func envName(scheme string) string {
+	var name = envNameBoundary.ReplaceAllString(scheme, "${1}_${2}")
+	return strings.Trim(strings.ToUpper(nonEnvChars.ReplaceAllString(name, "_")), "_")
+}
+
+// a media type of a request or a response
+type media struct {
+	typ  string
+	node *yaml.Node
+}
+
+// the media type of the content taken first: json, then a form,
+// then the first one written
+func (s *openApiSpec) pickMedia(content *yaml.Node) (*media, error) {
+	if content == nil || len(content.Content) == 0 {
+		return nil, nil
+	}
+	var picked = 0
+	for _, preferred := range []string{"json", "application/x-www-form-urlencoded"} {
+		var found = -1
+		for i := 0; i+1 < len(content.Content); i += 2 {
+			if strings.Contains(content.Content[i].Value, preferred) {
+				found = i
+				break
+			}
+		}
+		if found >= 0 {
+			picked = found
+			break
+		}
+	}
+	node, err := s.resolve(content.Content[picked+1])
+	if err != nil {
+		return nil, err
+	}
+	return &media{typ: content.Content[picked].Value, node: node}, nil
+}
+
+// the body of the request, an example of its media type
+// (or one made of its schema) with its Content-Type
+func (s *openApiSpec) body(op *operation) error {
+	body, err := s.resolve(child(op.node, "requestBody"))
+	if err != nil || body == nil {
+		return err
+	}
+	m, err := s.pickMedia(child(body, "content"))
+	if err != nil || m == nil {
+		return err
+	}
+	example, err := s.mediaExample(m)
+	if err != nil {
+		return err
+	}
+	var t = op.target
+	switch {
+	case strings.Contains(m.typ, "json"):
+		if t.Request.Body, err = jsonText(example); err != nil {
+			return err
+		}
+	case m.typ == "application/x-www-form-urlencoded":
+		t.Request.Body = formText(example)
+	case strings.HasPrefix(m.typ, "text/") && example != nil && example.Kind == yaml.ScalarNode:
+		t.Request.Body = example.Value
+	default:
+		t.Notes = append(t.Notes, "the "+m.typ+" body is not made by the import, set form-body")
+		return nil
+	}
+	t.Request.Headers = append(t.Request.Headers, Header{Name: "Content-Type", Value: m.typ})
+	return nil
+}
+
+// the example of a media type, the first of its examples, or one made of its schema
+func (s *openApiSpec) mediaExample(m *media) (*yaml.Node, error) {
+	if example := child(m.node, "example"); example != nil {
+		return example, nil
+	}
+	if examples := child(m.node, "examples"); examples != nil && len(examples.Content) > 1 {
+		example, err := s.resolve(examples.Content[1])
+		if err != nil {
+			return nil, err
+		}
+		if v := child(example, "value"); v != nil {
+			return v, nil
+		}
+	}
+	return s.example(child(m.node, "schema"), 0)
+}
+
+// the example of a param, the first of its examples, or one made of its schema
+func (s *openApiSpec) paramExample(p *yaml.Node) (*yaml.Node, error) {
+	return s.mediaExample(&media{node: p})
+}
+
+// the status codes of the responses which are not errors, and the
+// media type of the first of them which has a content
+func (s *openApiSpec) successContent(op *operation) ([]int, *media, error) {
+	responses := child(op.node, "responses")
+	if responses == nil {
+		return nil, nil, nil
+	}
+	var codes = make([]int, 0)
+	var contents = make(map[int]*yaml.Node)
+	for i := 0; i+1 < len(responses.Content); i += 2 {
+		code, err := strconv.Atoi(responses.Content[i].Value)
+		if err != nil || code >= 400 {
+			// default and ranges like 2XX have no exact code
+			continue
+		}
+		codes = append(codes, code)
+		response, err := s.resolve(responses.Content[i+1])
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[code] = child(response, "content")
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		if contents[code] != nil && len(contents[code].Content) > 0 {
+			m, err := s.pickMedia(contents[code])
+			return codes, m, err
+		}
+	}
+	return codes, nil, nil
+}
+
+// the documented status codes, and the Content-Type of the response
+func (s *openApiSpec) assertions(op *operation) error {
+	codes, m, err := s.successContent(op)
+	if err != nil {
+		return err
+	}
+	if len(codes) > 0 {
+		var list = make([]string, 0, len(codes))
+		for _, c := range codes {
+			list = append(list, strconv.Itoa(c))
+		}
+		op.target.Assertions = append(op.target.Assertions, Assertion{Name: "status-is-ok", Value: strings.Join(list, ", ")})
+	}
+	if m != nil && !strings.Contains(m.typ, "*") {
+		op.target.Assertions = append(op.target.Assertions, Assertion{Name: "content-type", Value: m.typ})
+	}
+	return nil
+}
+
+// an example of the schema: its example, default, first enum value, or
+// one made of its type and format; objects have all of their properties
+// which are not readOnly, allOf is merged and oneOf and anyOf take their
+// first schema
+func (s *openApiSpec) example(schema *yaml.Node, depth int) (*yaml.Node, error) {
+	if schema == nil || depth > maxSchemaDepth {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	schema, err := s.resolve(schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"example", "default", "const"} {
+		if v := child(schema, key); v != nil {
+			return v, nil
+		}
+	}
+	for _, key := range []string{"enum", "examples"} {
+		if v := child(schema, key); v != nil && v.Kind == yaml.SequenceNode && len(v.Content) > 0 {
+			return v.Content[0], nil
+		}
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if v := child(schema, key); v != nil && len(v.Content) > 0 && child(schema, "allOf") == nil {
+			return s.example(v.Content[0], depth+1)
+		}
+	}
+	switch schemaType(schema) {
+	case "object":
+		props, err := s.properties(schema)
+		if err != nil {
+			return nil, err
+		}
+		var obj = mapping()
+		for i := 0; i+1 < len(props); i += 2 {
+			prop, err := s.resolve(props[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if value(child(prop, "readOnly")) == "true" {
+				continue
+			}
+			v, err := s.example(prop, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj.Content = append(obj.Content, scalar(props[i].Value), v)
+		}
+		return obj, nil
+	case "array":
+		item, err := s.example(child(schema, "items"), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{item}}, nil
+	case "integer", "number":
+		var v = "1"
+		if min := child(schema, "minimum"); min != nil {
+			v = min.Value
+		}
+		if _, err := strconv.Atoi(v); err != nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: v}, nil
+		}
+		return number(v), nil
+	case "boolean":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}, nil
+	case "string":
+		return scalar(formatExample(value(child(schema, "format")))), nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+}
+
+func formatExample(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "byte":
+		return "c3RyaW5n"
+	case "password":
+		return "password"
+	}
+	return "string"
+}
+
+// the type of the schema, an object when it has properties; in OpenAPI 3.1
+// the type can be a list, like [string, "null"]
+func schemaType(schema *yaml.Node) string {
+	t := child(schema, "type")
+	if t != nil && t.Kind == yaml.SequenceNode {
+		for _, item := range t.Content {
+			if item.Value != "null" {
+				return item.Value
+			}
+		}
+		return ""
+	}
+	if t == nil {
+		if child(schema, "properties") != nil || child(schema, "allOf") != nil {
+			return "object"
+		}
+		if child(schema, "items") != nil {
+			return "array"
+		}
+		return ""
+	}
+	return t.Value
+}
+
+// the properties of the schema as the content of a mapping (names and
+// schemas), with the ones of its allOf schemas merged in their order
+func (s *openApiSpec) properties(schema *yaml.Node) ([]*yaml.Node, error) {
+	var props = make([]*yaml.Node, 0)
+	var seen = make(map[string]bool)
+	var add = func(list *yaml.Node) {
+		if list == nil {
+			return
+		}
+		for i := 0; i+1 < len(list.Content); i += 2 {
+			if !seen[list.Content[i].Value] {
+				seen[list.Content[i].Value] = true
+				props = append(props, list.Content[i], list.Content[i+1])
+			}
+		}
+	}
+	if all := child(schema, "allOf"); all != nil {
+		for _, part := range all.Content {
+			part, err := s.resolve(part)
+			if err != nil {
+				return nil, err
+			}
+			partProps, err := s.properties(part)
+			if err != nil {
+				return nil, err
+			}
+			add(&yaml.Node{Content: partProps})
+		}
+	}
+	add(child(schema, "properties"))
+	return props, nil
+}
+
+// follows the $ref of the node, only refs in the document itself
+// (like #/components/schemas/User) are resolved
+func (s *openApiSpec) resolve(n *yaml.Node) (*yaml.Node, error) {
+	for hops := 0; n != nil; hops++ {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+			continue
+		}
+		ref := child(n, "$ref")
+		if ref == nil {
+			return n, nil
+		}
+		if hops > 32 {
+			return nil, errors.New("$ref " + ref.Value + " refers to itself")
+		}
+		if !strings.HasPrefix(ref.Value, "#/") {
+			return nil, errors.New("only the $refs in the document are supported, " + ref.Value + " is not")
+		}
+		var target = s.root
+		for _, part := range strings.Split(ref.Value[2:], "/") {
+			part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+			if unescaped, err := url.PathUnescape(part); err == nil {
+				part = unescaped
+			}
+			if target = child(target, part); target == nil {
+				return nil, errors.New("cannot resolve $ref " + ref.Value)
+			}
+		}
+		n = target
+	}
+	return n, nil
+}
+
+// the value of the key of a mapping, nil if it is not there
+func child(n *yaml.Node, key string) *yaml.Node {
+	if n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			var v = n.Content[i+1]
+			if v.Kind == yaml.AliasNode {
+				v = v.Alias
+			}
+			return v
+		}
+	}
+	return nil
+}
+
+func value(n *yaml.Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.Value
+}
+
+// the text of a scalar example, json of others
+func scalarText(n *yaml.Node) string {
+	if n != nil && n.Kind == yaml.ScalarNode {
+		if n.Tag == "!!null" {
+			return ""
+		}
+		return n.Value
+	}
+	text, _ := jsonText(n)
+	return text
+}
+
+// the json of a yaml node, keeping the order of its keys
+func jsonText(n *yaml.Node) (string, error) {
+	var b strings.Builder
+	var write func(n *yaml.Node) error
+	write = func(n *yaml.Node) error {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		switch n.Kind {
+		case yaml.MappingNode:
+			b.WriteByte('{')
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				key, _ := json.Marshal(n.Content[i].Value)
+				b.Write(key)
+				b.WriteByte(':')
+				if err := write(n.Content[i+1]); err != nil {
+					return err
+				}
+			}
+			b.WriteByte('}')
+		case yaml.SequenceNode:
+			b.WriteByte('[')
+			for i, item := range n.Content {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				if err := write(item); err != nil {
+					return err
+				}
+			}
+			b.WriteByte(']')
+		default:
+			var v interface{}
+			if err := n.Decode(&v); err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				// values json has not, like .inf
+				encoded, _ = json.Marshal(n.Value)
+			}
+			b.Write(encoded)
+		}
+		return nil
+	}
+	if n == nil {
+		return "", nil
+	}
+	if err := write(n); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// the url encoded form of an object example
+func formText(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return scalarText(n)
+	}
+	var fields = make([]string, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		fields = append(fields, url.QueryEscape(n.Content[i].Value)+"="+url.QueryEscape(scalarText(n.Content[i+1])))
+	}
+	return strings.Join(fields, "&")
+}
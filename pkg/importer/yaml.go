@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// the longest part of a reused value shown in the comments
+const maxShownValue = 24
+
+// Yaml returns the config of the import. Targets run as a seq chain in
+// their recorded order, once by a single virtual user, so the variables
+// of earlier targets reach the later ones.
+func (im *Import) Yaml() ([]byte, error) {
+	var main = mapping(
+		scalar("concurrency"), number(1),
+		scalar("request-count"), number(1),
+		scalar("strategy"), scalar("seq"),
+	)
+	var targets = mapping()
+	for _, t := range im.Targets {
+		var key = scalar(t.Name)
+		key.HeadComment = im.suggestions(t)
+		targets.Content = append(targets.Content, key, t.node())
+	}
+	var root = mapping(scalar("main"), main, scalar("targets"), targets)
+	root.Content[0].HeadComment = "# imported from " + im.Source + " by load48 import"
+	var doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (t *Target) node() *yaml.Node {
+	var r = t.Request
+	var n = mapping(scalar("url"), scalar(r.Url), scalar("httpMethod"), scalar(r.Method))
+	if len(r.Headers) > 0 {
+		var headers = mapping()
+		for _, h := range r.Headers {
+			headers.Content = append(headers.Content, scalar(h.Name), scalar(h.Value))
+		}
+		n.Content = append(n.Content, scalar("headers"), headers)
+	}
+	if r.Body != "" {
+		n.Content = append(n.Content, scalar("form-body"), scalar(r.Body))
+	}
+	if len(t.Assertions) > 0 {
+		var list = mapping()
+		for _, a := range t.Assertions {
+			list.Content = append(list.Content, scalar(a.Name), scalar(a.Value))
+		}
+		n.Content = append(n.Content, scalar("assertions"), list)
+	}
+	if len(t.DependsOn) > 0 {
+		var deps = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		for _, d := range t.DependsOn {
+			deps.Content = append(deps.Content, scalar(d))
+		}
+		n.Content = append(n.Content, scalar("depends-on"), deps)
+	}
+	if len(t.Variables) > 0 {
+		var variables = mapping()
+		for _, v := range t.Variables {
+			var key = scalar(v.Name)
+			if v.Value != "" {
+				key.LineComment = "# was " + shorten(v.Value)
+			}
+			variables.Content = append(variables.Content, key,
+				mapping(scalar("type"), scalar(v.Type), scalar("path"), scalar(v.Path)))
+		}
+		n.Content = append(n.Content, scalar("variables"), variables)
+	}
+	return n
+}
+
+// the notes of the import on the target, and the comments suggesting to
+// extract the values reused by the target first, by variables of a previous target
+func (im *Import) suggestions(t *Target) string {
+	var lines = make([]string, 0)
+	for _, note := range t.Notes {
+		lines = append(lines, "# "+note)
+	}
+	for _, r := range im.Reused {
+		if r.Target != t.Name {
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf("# %v is reused by: %v", shorten(r.Value), strings.Join(r.Uses, ", ")),
+			"#   if a previous response returns it, extract it with variables: and use the variable instead")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func shorten(v string) string {
+	if len(v) > maxShownValue {
+		return v[:maxShownValue] + "..."
+	}
+	return v
+}
+
+func mapping(content ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: content}
+}
+
+func number(v interface{}) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: fmt.Sprint(v)}
+}
+
+// scalars are strings, quoted when they would be read as another type
+func scalar(v string) *yaml.Node {
+	var n = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	if strings.Contains(v, "\n") {
+		n.Style = yaml.LiteralStyle
+	}
+	return n
+}
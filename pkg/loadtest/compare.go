@@ -0,0 +1,121 @@
+package loadtest
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	"time"
+)
+
+// Comparison is a target (or the total of a scenario) in a baseline
+// result and in a current one, either of them is nil when the target
+// is only found in the other result
+type Comparison struct {
+	Scenario string
+	Name     string
+	Baseline *stats.Summary
+	Current  *stats.Summary
+}
+
+// CompareResults matches the targets of the results by their
+// scenarios and names, in the order of the current result; the
+// targets which are only in the baseline go last
+func CompareResults(baseline, current *Result) []*Comparison {
+	var comparisons = make([]*Comparison, 0)
+	var byKey = make(map[string]*Comparison)
+	var add = func(scenario string, sm *stats.Summary, isBaseline bool) {
+		if sm == nil {
+			return
+		}
+		var key = scenario + "/" + sm.Name
+		c, ok := byKey[key]
+		if !ok {
+			c = &Comparison{Scenario: scenario, Name: sm.Name}
+			byKey[key] = c
+			comparisons = append(comparisons, c)
+		}
+		if isBaseline {
+			c.Baseline = sm
+		} else {
+			c.Current = sm
+		}
+	}
+	for i, r := range []*Result{current, baseline} {
+		for _, sr := range r.Scenarios {
+			for _, sm := range sr.Targets {
+				add(sr.Name, sm, i == 1)
+			}
+			add(sr.Name, sr.Total, i == 1)
+		}
+	}
+	return comparisons
+}
+
+// Regressions returns how the current result is worse than the baseline:
+// the average duration is grown by more than maxRegression percent, or
+// the error rate by more than maxRegression percentage points. A target
+// missing from the current result is a regression too.
+func (c *Comparison) Regressions(maxRegression float64) []string {
+	var regressions = make([]string, 0)
+	if c.Current == nil {
+		return append(regressions, "target is not found in the current result")
+	}
+	if c.Baseline == nil {
+		return regressions
+	}
+	if change, ok := percentChange(float64(c.Baseline.AverageDuration), float64(c.Current.AverageDuration)); ok && change > maxRegression {
+		regressions = append(regressions, fmt.Sprintf("average duration is grown by %.1f%%", change))
+	}
+	if change := c.Current.ErrorRate() - c.Baseline.ErrorRate(); change > maxRegression {
+		regressions = append(regressions, fmt.Sprintf("error rate is grown by %.1f points", change))
+	}
+	return regressions
+}
+
+// Print prints the metrics of the target in both results
+func (c *Comparison) Print() {
+	var title = c.Name
+	if c.Scenario != "" {
+		title = c.Scenario + "/" + c.Name
+	}
+	fmt.Println("\n======== " + title + " ========")
+	var baseline, current = c.Baseline, c.Current
+	if baseline == nil {
+		baseline = &stats.Summary{}
+	}
+	if current == nil {
+		current = &stats.Summary{}
+	}
+	printCount("Total Sent Number of Requests", baseline.TotalSent, current.TotalSent)
+	fmt.Printf("--- Error Rate => %.2f%% -> %.2f%% \n", baseline.ErrorRate(), current.ErrorRate())
+	if baseline.RetryRequests > 0 || current.RetryRequests > 0 {
+		fmt.Printf("--- First Attempt Success Rate => %.2f%% -> %.2f%% \n", baseline.FirstAttemptSuccessRate(), current.FirstAttemptSuccessRate())
+		fmt.Printf("--- Final Success Rate => %.2f%% -> %.2f%% \n", baseline.FinalSuccessRate(), current.FinalSuccessRate())
+	}
+	printDuration("Average Duration", baseline.AverageDuration, current.AverageDuration)
+	printDuration("Shortest Duration", baseline.ShortestDuration, current.ShortestDuration)
+	printDuration("Longest Duration", baseline.LongestDuration, current.LongestDuration)
+}
+
+func printCount(title string, baseline, current int64) {
+	fmt.Printf("--- %v => %v -> %v%v \n", title, baseline, current, changeOf(float64(baseline), float64(current)))
+}
+
+func printDuration(title string, baseline, current time.Duration) {
+	fmt.Printf("--- %v => %v -> %v%v \n", title, baseline, current, changeOf(float64(baseline), float64(current)))
+}
+
+func changeOf(baseline, current float64) string {
+	if change, ok := percentChange(baseline, current); ok {
+		return fmt.Sprintf(" (%+.1f%%)", change)
+	}
+	return ""
+}
+
+// the change from baseline to current in percent, not ok if
+// there is no baseline to compare with
+func percentChange(baseline, current float64) (float64, bool) {
+	if baseline == 0 {
+		return 0, false
+	}
+	return (current - baseline) * 100 / baseline, true
+}
@@ -0,0 +1,34 @@
+package loadtest
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"io"
+)
+
+// DryRun runs the data-sources and each chain of each scenario once,
+// one request at a time, and writes every rendered request, the status
+// of its response, its assertions and its extracted variables to out.
+// Offline, the requests are only rendered, see request.Trace. An error
+// tells how many requests failed.
+func (ld *LoadTest) DryRun(out io.Writer, offline bool) error {
+	var trace = request.NewTrace(out, offline)
+	if ld.dataSources != nil {
+		fmt.Fprintln(out, "# data-sources")
+		ld.dataSources.DryRunDataSources(trace)
+	}
+	for _, sc := range ld.scenarios {
+		if sc.Name != "" {
+			fmt.Fprintf(out, "# scenario %v\n", sc.Name)
+		}
+		sc.targeting.DryRun(trace)
+	}
+	logger.Flush()
+	requests, failures := trace.Requests()
+	if failures > 0 {
+		return fmt.Errorf("%v of %v request(s) failed", failures, requests)
+	}
+	fmt.Fprintf(out, "%v request(s) rendered\n", requests)
+	return nil
+}
@@ -1,13 +1,17 @@
 package loadtest
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/mostafatalebi/loadtest/pkg/config"
 	"github.com/mostafatalebi/loadtest/pkg/logger"
 	"github.com/mostafatalebi/loadtest/pkg/request"
 	"github.com/mostafatalebi/loadtest/pkg/stats"
 	"github.com/rs/xid"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
@@ -17,84 +21,267 @@ var statsMapMx = sync.RWMutex{}
 
 type LoadTest struct {
 	testStartTime time.Time
+	testDuration  time.Duration
 	workers     []*request.RequestWorker
 	workersErrors     []error
-	targeting *request.Targeting
+	scenarios []*Scenario
+	// runs the data-sources, their variables are shared by all scenarios
+	dataSources *request.Targeting
+	// the logger and the connection pools of the test, nil is the globals
+	env *request.Env
+	// the first config, its logs section is the one of the test
+	first *config.Config
+}
+
+// Scenario is a group of targets which run by their own
+// strategy and executor, simultaneously with other scenarios.
+// A config without scenarios makes a single unnamed scenario.
+type Scenario struct {
+	Name       string
+	StartDelay time.Duration
+	targeting  *request.Targeting
+}
+
+// creates the scenario's targeting from its first config, all
+// configs of a scenario share the same main-section settings
+func newScenario(cc *config.Config) *Scenario {
+	sc := &Scenario{
+		Name:       cc.Scenario,
+		StartDelay: cc.StartDelay,
+		targeting:  request.NewTargetManager(cc.Strategy, cc.Concurrency, cc.NumberOfRequests),
+	}
+	if cc.Cookies {
+		sc.targeting.EnableCookies(cc.CookieSeed)
+	}
+	sc.targeting.SetPacing(cc.Pacing)
+	sc.targeting.SetScheduler(cc.Scheduler)
+	sc.targeting.SetExecutor(cc.Executor, cc.Duration, cc.Rate, cc.Stages)
+	return sc
 }
 
 // each config means a new worker
 // for strategy, because it is a global config,
 // we use first config's strategy. This is because
-// all configs must have the same strategy
+// all configs must have the same strategy.
+// The logs of the test are written as the logs section of the
+// first config says, by the logger of the package (logger.Configure).
 func NewLoadTest(configs ...*config.Config) *LoadTest {
-	var sessionName = xid.New().String()
-	if len(configs) == 0 {
-		panic("at least one config must be specified")
+	l, err := New(configs...)
+	if err == nil {
+		err = l.ConfigureLogs()
 	}
-	l := &LoadTest{
-		workers: make([]*request.RequestWorker, 0),
-		targeting: request.NewTargetManager(configs[0].Strategy, configs[0].Concurrency, configs[0].NumberOfRequests),
+	if err != nil {
+		panic(err)
 	}
+	return l
+}
 
-	if configs[0].EnabledLogs != true {
-		fmt.Println("logs are disabled")
-		logger.LogEnabled = false
-	} else {
-		var logFileName = fmt.Sprintf("loadtest-%v-%v-%v", time.Now().Year(), time.Now().Month(), time.Now().Day()) + sessionName + ".log"
-		err := logger.Initialize(logger.LogModeFile,  configs[0].LogFileDirectory+logFileName)
-		if err != nil {
-			panic(err)
+// SetOutput makes the progress of the test be written to w instead of
+// stdout, like stderr when stdout is kept for the result
+func (ld *LoadTest) SetOutput(w io.Writer) {
+	if ld.env == nil {
+		ld.env = &request.Env{}
+	}
+	ld.env.Out = w
+}
+
+// ConfigureLogs configures the logger of the package (logger.Configure)
+// by the logs section of the first config
+func (ld *LoadTest) ConfigureLogs() error {
+	if ld.first.EnabledLogs != true {
+		var out io.Writer = os.Stdout
+		if ld.env != nil && ld.env.Out != nil {
+			out = ld.env.Out
 		}
+		fmt.Fprintln(out, "logs are disabled")
+		logger.LogEnabled = false
+		return nil
 	}
+	logger.LogEnabled = true
+	return logger.Configure(logOptions(ld.first))
+}
 
+// New makes the test of the configs as NewLoadTest does, but it returns
+// an error instead of panicking and it does not configure the logger of
+// the package; Run gives the test a logger of its own
+func New(configs ...*config.Config) (*LoadTest, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("at least one config must be specified")
+	}
+	l := &LoadTest{
+		workers: make([]*request.RequestWorker, 0),
+		first:   configs[0],
+	}
 	i := 0
+	var byName = make(map[string]*Scenario)
+	var dataSources []*config.Config
 	for _, cc := range configs {
+		if cc.DataSource {
+			dataSources = append(dataSources, cc)
+			continue
+		}
+		sc, ok := byName[cc.Scenario]
+		if !ok {
+			sc = newScenario(cc)
+			byName[cc.Scenario] = sc
+			l.scenarios = append(l.scenarios, sc)
+		}
 		// @todo it is better to put zero-initializer inside a new function and name the func as InitializeWorker()
 		w := request.NewRequestWorker(cc, fmt.Sprintf("%v%v", cc.TargetName, i))
-		sm := stats.NewStatsManager(cc.TargetName)
+		sm := stats.NewStatsManager(cc.StatsName())
 		sm.IncrSuccess(0)
 		w.AddStat(fmt.Sprintf("%v%v", cc.TargetName, i), sm)
-		l.targeting.Workers = append(l.targeting.Workers, w)
+		sc.targeting.Workers = append(sc.targeting.Workers, w)
 		i++
 	}
-	return l
+	l.ApplyDataSources(dataSources...)
+	return l, nil
+}
+
+// the options of the logs of the config, they are written to a file
+// of its own in the directory of the logs
+func logOptions(cc *config.Config) *logger.Options {
+	var opts = logger.Options{}
+	if cc.Log != nil {
+		opts = *cc.Log
+	}
+	var now = time.Now()
+	var logFileName = fmt.Sprintf("loadtest-%v-%v-%v", now.Year(), now.Month(), now.Day()) + xid.New().String() + ".log"
+	opts.File = filepath.Join(cc.LogFileDirectory, logFileName)
+	return &opts
 }
 
+// ApplyDataSources makes the data-sources run before the test (and be
+// refreshed while it runs), all scenarios share their variables
 func (ld *LoadTest) ApplyDataSources(dataSources ...*config.Config) {
-	if ld.targeting != nil {
-		i := 0
-		for _, cc := range dataSources {
-			w := request.NewRequestWorker(cc, fmt.Sprintf("data-source:%v%v", cc.TargetName, i))
-			sm := stats.NewStatsManager(cc.TargetName)
-			sm.IncrSuccess(0)
-			w.AddStat(fmt.Sprintf("%v%v", cc.TargetName, i), sm)
-			ld.targeting.DataSources = append(ld.targeting.Workers, w)
-			i++
-		}
+	if len(dataSources) == 0 {
+		return
 	}
+	ld.dataSources = request.NewTargetManager(request.StrategySeq, 1, 1)
+	var shared = request.NewSharedVariables()
+	ld.dataSources.SetSharedVariables(shared)
+	for i, cc := range dataSources {
+		var id = fmt.Sprintf("data-source:%v%v", cc.TargetName, i)
+		w := request.NewRequestWorker(cc, id)
+		sm := stats.NewStatsManager(cc.TargetName)
+		sm.IncrSuccess(0)
+		w.AddStat(id, sm)
+		ld.dataSources.DataSources = append(ld.dataSources.DataSources, w)
+	}
+	for _, sc := range ld.scenarios {
+		sc.targeting.SetSharedVariables(shared)
+	}
+}
+
+// StartWorkers runs the test until it ends
+func (ld *LoadTest) StartWorkers() error {
+	return ld.Start(context.Background())
 }
 
-func (ld *LoadTest) StartWorkers() {
+// Start runs the test until it ends or ctx is done. Once ctx is done,
+// no more iterations are started and Start returns the error of ctx
+// when the running ones end; the result has the requests sent so far.
+func (ld *LoadTest) Start(ctx context.Context) error {
+	var numOfWorkers = 0
+	for _, sc := range ld.scenarios {
+		numOfWorkers += len(sc.targeting.Workers)
+	}
+	if numOfWorkers == 0 {
+		return errors.New("no worker has been found to start")
+	}
+	var env = ld.env
+	if env == nil {
+		env = &request.Env{}
+	}
+	env.Context = ctx
+	for _, sc := range ld.scenarios {
+		sc.targeting.SetEnv(env)
+	}
+	if ld.dataSources != nil {
+		ld.dataSources.SetEnv(env)
+		ld.dataSources.Run(request.ExecDataSource)
+		stop := ld.dataSources.RefreshDataSources(ld.dataSources.DataSources)
+		defer stop()
+	}
 	ld.testStartTime = time.Now()
-	if len(ld.targeting.Workers) == 0 {
-		fmt.Println("no worker has been found to start")
-		os.Exit(1)
+	// scenarios run simultaneously, each one after its start-delay
+	wg := &sync.WaitGroup{}
+	for _, sc := range ld.scenarios {
+		wg.Add(1)
+		go func(sc *Scenario) {
+			defer wg.Done()
+			if sc.StartDelay > 0 {
+				select {
+				case <-time.After(sc.StartDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+			sc.targeting.Run(request.ExecWorker)
+		}(sc)
+	}
+	wg.Wait()
+	ld.testDuration = time.Since(ld.testStartTime)
+	env.Logger.Flush()
+	return ctx.Err()
+}
+
+// Close stops the goroutines of the test, once it is not run anymore,
+// and closes the logger and the connection pools given by SetOptions
+func (ld *LoadTest) Close() {
+	for _, sc := range ld.scenarios {
+		sc.targeting.Close()
+	}
+	if ld.dataSources != nil {
+		ld.dataSources.Close()
+	}
+	if ld.env != nil && ld.env.Logger != nil {
+		ld.env.Logger.Close()
+		ld.env.Close()
 	}
-	ld.targeting.Run(request.ExecWorker)
 }
 
 func (ld *LoadTest) PrintWorkersStats() {
-	ld.targeting.PrintTargetsStats()
+	for _, sc := range ld.scenarios {
+		if sc.Name != "" {
+			fmt.Printf("\n######## Scenario: %v ########\n", sc.Name)
+		}
+		sc.targeting.PrintTargetsStats()
+	}
+}
+
+// Scenarios returns the scenarios of the test, in the order
+// of their first target in the configs
+func (ld *LoadTest) Scenarios() []*Scenario {
+	return ld.scenarios
+}
+
+// Targeting returns the targeting which runs the scenario's targets
+func (sc *Scenario) Targeting() *request.Targeting {
+	return sc.targeting
 }
 func (ld *LoadTest) PrintGeneralInfo() {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 	fmt.Println("\n======== Test Info ========")
-	numOfRequest := int64(0)
-	for _, w := range ld.workers {
-		numOfRequest += w.Config.NumberOfRequests
+	// the iterations of duration and rate tests are not known before
+	// the test, the started ones are printed instead
+	numOfRequest, iterations := int64(0), int64(0)
+	for _, sc := range ld.scenarios {
+		if started, _ := sc.targeting.IterationCounts(); started > 0 {
+			iterations += started
+			continue
+		}
+		for _, w := range sc.targeting.Workers {
+			numOfRequest += w.Config.NumberOfRequests
+		}
+	}
+	if numOfRequest > 0 {
+		fmt.Printf("Test Target: %v\n", numOfRequest)
+	}
+	if iterations > 0 {
+		fmt.Printf("Iterations Started: %v\n", iterations)
 	}
-	fmt.Printf("Test Target: %v\n", numOfRequest)
-	fmt.Printf("Test Duration: %v\n", time.Since(ld.testStartTime))
+	fmt.Printf("Test Duration: %v\n", ld.testDuration)
 	fmt.Printf("Test RAM Usage: %vKB\n\n", memStats.Alloc/1024)
 }
@@ -0,0 +1,105 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Result is the outcome of a test. It is saved as json by run --out,
+// and read back by the report and compare commands.
+type Result struct {
+	Version   string            `json:"version,omitempty"`
+	StartedAt time.Time         `json:"started-at"`
+	Duration  time.Duration     `json:"duration"`
+	Scenarios []*ScenarioResult `json:"scenarios"`
+}
+
+// ScenarioResult holds the stats of each target of a scenario, and
+// their total when the scenario has more than one target
+type ScenarioResult struct {
+	Name              string           `json:"name,omitempty"`
+	Iterations        int64            `json:"iterations,omitempty"`
+	DroppedIterations int64            `json:"dropped-iterations,omitempty"`
+	Targets           []*stats.Summary `json:"targets"`
+	Total             *stats.Summary   `json:"total,omitempty"`
+}
+
+// Result returns the result of the test, once StartWorkers is returned
+func (ld *LoadTest) Result() *Result {
+	var r = &Result{
+		StartedAt: ld.testStartTime,
+		Duration:  ld.testDuration,
+		Scenarios: make([]*ScenarioResult, 0, len(ld.scenarios)),
+	}
+	for _, sc := range ld.scenarios {
+		var sr = &ScenarioResult{Name: sc.Name, Targets: make([]*stats.Summary, 0)}
+		sr.Iterations, sr.DroppedIterations = sc.targeting.IterationCounts()
+		for _, w := range sc.targeting.Workers {
+			if st := w.Stat(); st != nil {
+				sr.Targets = append(sr.Targets, st.Summary(w.Config.StatsName()))
+			}
+		}
+		if len(sr.Targets) > 1 && sc.targeting.StatsTotal != nil {
+			sr.Total = sc.targeting.StatsTotal.Summary("total")
+		}
+		r.Scenarios = append(r.Scenarios, sr)
+	}
+	return r
+}
+
+// Save writes the result as json to the file
+func (r *Result) Save(fileName string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(b, '\n'), 0644)
+}
+
+// LoadResult reads a result saved by Save
+func LoadResult(fileName string) (*Result, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var r = &Result{}
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("%v is not a result file: %v", fileName, err.Error())
+	}
+	return r, nil
+}
+
+// Fprint writes the stats of the result, the way the test prints them
+func (r *Result) Fprint(w io.Writer) {
+	for _, sr := range r.Scenarios {
+		if sr.Name != "" {
+			fmt.Fprintf(w, "\n######## Scenario: %v ########\n", sr.Name)
+		}
+		for _, sm := range sr.Targets {
+			sm.Fprint(w)
+		}
+		if sr.Total != nil {
+			sr.Total.Fprint(w)
+		}
+		if sr.DroppedIterations > 0 {
+			fmt.Fprintf(w, "\n--- Iterations Started => %v \n", sr.Iterations)
+			fmt.Fprintf(w, "--- Iterations Dropped (no free slot) => %v \n", sr.DroppedIterations)
+		}
+	}
+	fmt.Fprintln(w, "\n======== Test Info ========")
+	if r.Version != "" {
+		fmt.Fprintf(w, "Version: %v\n", r.Version)
+	}
+	fmt.Fprintf(w, "Test Started At: %v\n", r.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Test Duration: %v\n\n", r.Duration)
+}
+
+// Print prints the stats of the result to stdout
+func (r *Result) Print() {
+	r.Fprint(os.Stdout)
+}
@@ -0,0 +1,78 @@
+package loadtest
+
+import (
+	"context"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"io"
+	"io/ioutil"
+)
+
+// Options are how Run runs a test
+type Options struct {
+	// the progress of the test is written here, nothing is written
+	// when it is nil
+	Output io.Writer
+	// the logs are written here, at the level and in the format of
+	// the logs section of the config. When it is nil, they are written
+	// to a file of the logs section's dir if logs are enabled.
+	Logs io.Writer
+}
+
+// Run runs the test of the configs until it ends or ctx is done, and
+// returns its result. It is made for tests embedded by a program, like
+// the integration tests of a service: it prints nothing to stdout, it
+// changes no global (it has its own logger and connection pools), so
+// tests run by a process, one after another or at the same time, do
+// not touch each other. The configs are the ones of a single test,
+// like the ones of ConfigYaml.LoadConfigs. Once ctx is done, no more
+// iterations are started, and the result of the requests sent so far
+// is returned with the error of ctx.
+func Run(ctx context.Context, configs []*config.Config, opts *Options) (*Result, error) {
+	lt, err := New(configs...)
+	if err != nil {
+		return nil, err
+	}
+	defer lt.Close()
+	if err = lt.SetOptions(opts); err != nil {
+		return nil, err
+	}
+	err = lt.Start(ctx)
+	if lt.testStartTime.IsZero() {
+		return nil, err
+	}
+	return lt.Result(), err
+}
+
+// SetOptions gives the test the output and a logger of its own, as Run
+// does, instead of the globals; they are closed by Close. It is for a
+// test which is started by Start, like the ones of an agent.
+func (ld *LoadTest) SetOptions(opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var out = opts.Output
+	if out == nil {
+		out = ioutil.Discard
+	}
+	log, err := newLogger(ld.first, opts.Logs)
+	if err != nil {
+		return err
+	}
+	ld.env = request.NewEnv(context.Background(), log, out)
+	return nil
+}
+
+// the logger of a test run by Run, it writes to w if it is given,
+// or as the logs section says
+func newLogger(cc *config.Config, w io.Writer) (*logger.Logger, error) {
+	if w == nil && !cc.EnabledLogs {
+		return logger.Discard, nil
+	}
+	var opts = logOptions(cc)
+	if w != nil {
+		opts.Writer = w
+	}
+	return logger.New(opts)
+}
@@ -0,0 +1,76 @@
+package loadtest
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+)
+
+// ScenarioSnapshot is a copy of the stats of a scenario, which can be
+// taken while the test runs. Agents send them to the coordinator.
+type ScenarioSnapshot struct {
+	Name              string            `json:"name,omitempty"`
+	Iterations        int64             `json:"iterations,omitempty"`
+	DroppedIterations int64             `json:"dropped-iterations,omitempty"`
+	Targets           []*stats.Snapshot `json:"targets"`
+}
+
+// Snapshot returns the stats of each target of each scenario so far
+func (ld *LoadTest) Snapshot() []*ScenarioSnapshot {
+	var snapshots = make([]*ScenarioSnapshot, 0, len(ld.scenarios))
+	for _, sc := range ld.scenarios {
+		var sn = &ScenarioSnapshot{Name: sc.Name, Targets: make([]*stats.Snapshot, 0, len(sc.targeting.Workers))}
+		sn.Iterations, sn.DroppedIterations = sc.targeting.IterationCounts()
+		for _, w := range sc.targeting.Workers {
+			var target = &stats.Snapshot{Key: w.Config.StatsName()}
+			if st := w.Stat(); st != nil {
+				target = st.Snapshot()
+				target.Key = w.Config.StatsName()
+			}
+			sn.Targets = append(sn.Targets, target)
+		}
+		snapshots = append(snapshots, sn)
+	}
+	return snapshots
+}
+
+// MergeSnapshots merges the snapshots of the same test taken by several
+// agents into the results of its scenarios, the stats of each target are
+// merged as the stats of the targets of a scenario are merged into its total
+func MergeSnapshots(parts ...[]*ScenarioSnapshot) []*ScenarioResult {
+	var results = make([]*ScenarioResult, 0)
+	var collectors = make([][]*stats.StatsCollector, 0)
+	for _, part := range parts {
+		for i, sn := range part {
+			if i == len(results) {
+				results = append(results, &ScenarioResult{Name: sn.Name, Targets: make([]*stats.Summary, 0)})
+				collectors = append(collectors, make([]*stats.StatsCollector, 0))
+			}
+			results[i].Iterations += sn.Iterations
+			results[i].DroppedIterations += sn.DroppedIterations
+			for j, target := range sn.Targets {
+				if j == len(collectors[i]) {
+					collectors[i] = append(collectors[i], stats.NewStatsManager(target.Key))
+				}
+				merged := collectors[i][j].Merge(target.Collector())
+				collectors[i][j] = &merged
+			}
+		}
+	}
+	for i, sr := range results {
+		var total = stats.NewStatsManager("total")
+		for _, c := range collectors[i] {
+			c.CalculateAverage()
+			c.CalculateExecAverageDuration()
+			c.CalculateThinkAverageDuration()
+			sr.Targets = append(sr.Targets, c.Summary(c.Key))
+			merged := total.Merge(c)
+			total = &merged
+		}
+		if len(sr.Targets) > 1 {
+			total.CalculateAverage()
+			total.CalculateExecAverageDuration()
+			total.CalculateThinkAverageDuration()
+			sr.Total = total.Summary("total")
+		}
+	}
+	return results
+}
@@ -1,119 +1,408 @@
 package logger
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"go.uber.org/atomic"
+	"io"
 	"os"
-	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 var LogEnabled = true
 
+// levels, from the least to the most severe
+const LogLevelDebug = "debug"
+const LogLevelInfo = "info"
+const LogLevelWarn = "warn"
 const LogLevelError = "error"
 const LogLevelFatal = "fatal"
-const LogLevelInfo = "info"
 
 const LogModeFile = "file"
 const LogModeStdErr = "stderr"
 
+const FormatText = "text"
+const FormatJson = "json"
+
 const DefaultDirectory = "./logs/"
 
+// defaults of Options
+const (
+	DefaultLevel      = LogLevelInfo
+	DefaultMaxBackups = 3
+	DefaultBufferSize = 4096
+	// of each key, the first 100 messages are written, then one of every 100
+	DefaultSampleFirst = 100
+	DefaultSampleEvery = 100
+)
+
+var levels = []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, LogLevelFatal}
+
 var messageTpl = "[%level] %key: %msg %date\n"
 
-var logChan = make(chan string, 10)
+// InfoOut writes here, whether logs are enabled or not. When it is nil,
+// it writes to the stdout of the time it is called.
+var Out io.Writer
+
+// Options is where and how the logs are written
+type Options struct {
+	// file (default) or stderr
+	Mode string
+	// the file of the file mode, its directory is made if needed
+	File string
+	// messages below the level are not written, info by default
+	Level string
+	// text (default) or json, a json object per line
+	Format string
+	// the file is rotated once it would grow over MaxSize bytes, MaxBackups
+	// rotated files are kept (file.1 is the newest); zero never rotates
+	MaxSize    int64
+	MaxBackups int
+	// of each key, the first SampleFirst messages are written, then one
+	// of every SampleEvery; SampleEvery 1 writes all of them
+	SampleFirst int
+	SampleEvery int
+	// messages waiting to be written; once it is full, new messages are
+	// dropped instead of blocking the caller
+	BufferSize int
+	// the logs are written to Writer instead, when it is set; Mode and
+	// File are not used then, and Writer is not closed by Close
+	Writer io.Writer
+}
+
+// Validate checks the options and sets their defaults
+func (o *Options) Validate() error {
+	switch o.Mode {
+	case "":
+		o.Mode = LogModeFile
+	case LogModeFile, LogModeStdErr:
+	default:
+		return errors.New("logs.mode must be one of: file, stderr")
+	}
+	if o.Level == "" {
+		o.Level = DefaultLevel
+	} else if levelOf(o.Level) < 0 {
+		return errors.New("logs.level must be one of: " + strings.Join(levels, ", "))
+	}
+	switch o.Format {
+	case "":
+		o.Format = FormatText
+	case FormatText, FormatJson:
+	default:
+		return errors.New("logs.format must be one of: text, json")
+	}
+	if o.MaxSize < 0 || o.MaxBackups < 0 {
+		return errors.New("logs.max-size and logs.max-backups cannot be negative")
+	}
+	if o.MaxBackups == 0 {
+		o.MaxBackups = DefaultMaxBackups
+	}
+	if o.SampleFirst < 0 || o.SampleEvery < 0 {
+		return errors.New("logs.sample cannot be negative")
+	}
+	if o.SampleFirst == 0 && o.SampleEvery == 0 {
+		o.SampleFirst = DefaultSampleFirst
+	}
+	if o.SampleEvery == 0 {
+		o.SampleEvery = DefaultSampleEvery
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultBufferSize
+	}
+	return nil
+}
+
+func levelOf(level string) int {
+	for i, l := range levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// an entry of the queue, either a line or a flush, which is done
+// once all the lines before it are written
+type entry struct {
+	line []byte
+	done chan struct{}
+}
+
+// Logger writes the logs of a test. The package's functions (Error,
+// Flush...) write to the logger of Configure; a test embedded by a
+// program can have a logger of its own, made by New. The methods of a
+// nil Logger are the package's functions.
+type Logger struct {
+	options *Options
+	level   int
+	w       io.WriteCloser
+	queue   chan entry
+	stopped chan struct{}
+	sampler *sampler
+	dropped *atomic.Int64
+	// nothing is written by a discarding logger
+	discard bool
+}
+
+// Discard writes no logs
+var Discard = &Logger{discard: true}
 
-var initialized = false
+var lock sync.RWMutex
+
+// nil until Initialize (or Configure), messages are written to
+// stderr meanwhile
+var current *Logger
 
-var logFile *os.File
 // if logMode is "file", there fileName should be passed,
 // else, it must be passed nil
 func Initialize(logMode string, fileName string) error {
-	initialized = true
-	var err error
-	if logMode == LogModeFile {
-		if logFile == nil {
-			dir := path.Dir(fileName)
-			err = os.Mkdir(dir, os.FileMode(0775))
-			if err != nil  && !strings.Contains(err.Error(), "exists") {
-				return err
-			}
-			logFile, err = os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_RDWR, os.FileMode(0644))
-			if err != nil {
-				return err
-			}
+	return Configure(&Options{Mode: logMode, File: fileName})
+}
+
+// Configure sets where and how the logs are written, the previous
+// output is flushed and closed
+func Configure(opts *Options) error {
+	l, err := New(opts)
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	var previous = current
+	current = l
+	lock.Unlock()
+	previous.close()
+	return nil
+}
+
+// New makes a logger which writes where and how opts say, it is
+// closed by Close
+func New(opts *Options) (*Logger, error) {
+	var o = *opts
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	var w io.WriteCloser = nopCloser{os.Stderr}
+	if o.Writer != nil {
+		w = nopCloser{o.Writer}
+	} else if o.Mode == LogModeFile {
+		if o.File == "" {
+			return nil, errors.New("log mode is set to file, but no file is given")
+		}
+		if err := os.MkdirAll(filepath.Dir(o.File), os.FileMode(0775)); err != nil {
+			return nil, err
 		}
+		f, err := openRotating(o.File, o.MaxSize, o.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	var l = &Logger{
+		options: &o,
+		level:   levelOf(o.Level),
+		w:       w,
+		queue:   make(chan entry, o.BufferSize),
+		stopped: make(chan struct{}),
+		sampler: newSampler(o.SampleFirst, o.SampleEvery),
+		dropped: atomic.NewInt64(0),
 	}
+	go l.run()
+	return l, nil
+}
 
-	go func() {
-		sendLogMessage(logMode, logFile)
-	}()
-	return nil
+// Flush waits until the queued messages are written, then writes how
+// many messages were sampled out or dropped since the last flush
+func Flush() {
+	lock.RLock()
+	defer lock.RUnlock()
+	current.flush()
+}
+
+// Close flushes and closes the output, later messages are written to
+// stderr
+func Close() {
+	lock.Lock()
+	var previous = current
+	current = nil
+	lock.Unlock()
+	previous.close()
+}
+
+// Flush is the package's Flush for the logger
+func (l *Logger) Flush() {
+	if l == nil {
+		Flush()
+		return
+	}
+	l.flush()
+}
+
+// Close is the package's Close for the logger, the logger must not be
+// used once it is closed
+func (l *Logger) Close() {
+	if l == nil {
+		Close()
+		return
+	}
+	l.close()
+}
+
+func (l *Logger) Debug(key string, msg interface{}) {
+	l.print(key, LogLevelDebug, msg)
 }
 
-func sendLogMessage(logMode string, fd *os.File) {
-	if logMode == LogModeFile {
-		defer fd.Close()
-		for msg := range logChan {
-			if fd  == nil {
-				panic("log mode is set to file, but no existing file specified")
-			}
-			_, err := fd.WriteString(msg)
-			if err != nil {
-				log.Println("failed to insert log into file, "+err.Error())
-			}
+func (l *Logger) Info(key string, msg interface{}) {
+	l.print(key, LogLevelInfo, msg)
+}
+
+func (l *Logger) Warn(key string, msg interface{}) {
+	l.print(key, LogLevelWarn, msg)
+}
+
+func (l *Logger) Error(key string, msg interface{}) {
+	l.print(key, LogLevelError, msg)
+}
+
+func (l *Logger) Fatal(key string, msg interface{}) {
+	l.print(key, LogLevelFatal, msg)
+}
+
+func (l *Logger) run() {
+	defer close(l.stopped)
+	for e := range l.queue {
+		if e.done != nil {
+			close(e.done)
+			continue
 		}
-	} else if logMode == LogModeFile {
-		for msg := range logChan {
-			fmt.Println(msg)
+		if _, err := l.w.Write(e.line); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to write the log, "+err.Error())
 		}
 	}
 }
 
-func print(key string, level string, msg interface{}) {
-	if initialized == false {
-		panic("logger is not initialized")
+func (l *Logger) flush() {
+	if l == nil || l.discard {
+		return
+	}
+	var now = time.Now()
+	for _, s := range l.sampler.reset() {
+		l.queue <- entry{line: l.format(s.key, LogLevelWarn, fmt.Sprintf("%v of %v messages are sampled out", s.skipped, s.total), now)}
+	}
+	if dropped := l.dropped.Swap(0); dropped > 0 {
+		l.queue <- entry{line: l.format("logger", LogLevelWarn, fmt.Sprintf("%v messages are dropped, the queue is full", dropped), now)}
+	}
+	var done = make(chan struct{})
+	l.queue <- entry{done: done}
+	<-done
+}
+
+func (l *Logger) close() {
+	if l == nil || l.discard {
+		return
+	}
+	l.flush()
+	close(l.queue)
+	<-l.stopped
+	_ = l.w.Close()
+}
+
+func (l *Logger) format(key string, level string, msg interface{}, now time.Time) []byte {
+	if l != nil && l.options.Format == FormatJson {
+		b, err := json.Marshal(map[string]string{
+			"time":  now.Format(time.RFC3339),
+			"level": level,
+			"key":   key,
+			"msg":   fmt.Sprintf("%v", msg),
+		})
+		if err == nil {
+			return append(b, '\n')
+		}
 	}
 	var prs = strings.Replace(messageTpl, "%level", level, 1)
 	prs = strings.Replace(prs, "%key", key, 1)
 	prs = strings.Replace(prs, "%msg", fmt.Sprintf("%v", msg), 1)
-	prs = strings.Replace(prs, "%date", time.Now().Format(time.RFC3339), 1)
-	logChan <- prs
+	prs = strings.Replace(prs, "%date", now.Format(time.RFC3339), 1)
+	return []byte(prs)
 }
 
-func Error(key string, msg interface{}) {
-	if LogEnabled == false {
+// writes the message to the logger, the one of Configure when it is nil
+func (l *Logger) print(key string, level string, msg interface{}) {
+	if l == nil {
+		print(key, level, msg)
 		return
 	}
-	print(key, LogLevelError, msg)
+	if l.discard || levelOf(level) < l.level || !l.sampler.allow(key) {
+		return
+	}
+	select {
+	case l.queue <- entry{line: l.format(key, level, msg, time.Now())}:
+	default:
+		l.dropped.Inc()
+	}
 }
 
-func Info(key string, msg interface{}) {
+func print(key string, level string, msg interface{}) {
 	if LogEnabled == false {
 		return
 	}
+	lock.RLock()
+	defer lock.RUnlock()
+	if current == nil {
+		if levelOf(level) >= levelOf(DefaultLevel) {
+			os.Stderr.Write(current.format(key, level, msg, time.Now()))
+		}
+		return
+	}
+	current.print(key, level, msg)
+}
+
+func Debug(key string, msg interface{}) {
+	print(key, LogLevelDebug, msg)
+}
+
+func Info(key string, msg interface{}) {
 	print(key, LogLevelInfo, msg)
 }
 
+func Warn(key string, msg interface{}) {
+	print(key, LogLevelWarn, msg)
+}
+
+func Error(key string, msg interface{}) {
+	print(key, LogLevelError, msg)
+}
+
+func Fatal(key string, msg interface{}) {
+	print(key, LogLevelFatal, msg)
+}
+
+// InfoOut writes the message to Out, it is not a log: it is written
+// even when logs are disabled
 func InfoOut(key string, msg interface{}) {
-	if LogEnabled == false {
-		return
-	}
-	if initialized == false {
-		panic("logger is not initialized")
+	var w = Out
+	if w == nil {
+		w = os.Stdout
 	}
+	InfoTo(w, key, msg)
+}
+
+// InfoTo writes the message the way InfoOut does, to w
+func InfoTo(w io.Writer, key string, msg interface{}) {
 	var prs = strings.Replace(messageTpl, "%level", LogLevelInfo, 1)
 	prs = strings.Replace(prs, "%key", key, 1)
 	prs = strings.Replace(prs, "%msg", fmt.Sprintf("%v", msg), 1)
 	prs = strings.Replace(prs, "%date", time.Now().Format(time.RFC3339), 1)
-	fmt.Print(prs)
+	fmt.Fprint(w, prs)
 }
 
+type nopCloser struct {
+	io.Writer
+}
 
-func Fatal(key string, msg interface{}) {
-	if LogEnabled == false {
-		return
-	}
-	print(key, LogLevelFatal, msg)
+func (nopCloser) Close() error {
+	return nil
 }
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"sort"
+	"sync"
+)
+
+// a key whose messages were sampled out
+type sampled struct {
+	key     string
+	total   int64
+	skipped int64
+}
+
+// sampler counts the messages of each key
+type sampler struct {
+	first int64
+	every int64
+	lock  sync.Mutex
+	seen  map[string]int64
+}
+
+func newSampler(first, every int) *sampler {
+	return &sampler{first: int64(first), every: int64(every), seen: make(map[string]int64)}
+}
+
+// whether the next message of the key is written
+func (s *sampler) allow(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seen[key]++
+	var n = s.seen[key]
+	return n <= s.first || (n-s.first)%s.every == 0
+}
+
+// the keys which had messages sampled out, the counts start again
+func (s *sampler) reset() []sampled {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var result []sampled
+	for key, n := range s.seen {
+		var written = n
+		if n > s.first {
+			written = s.first + (n-s.first)/s.every
+		}
+		if written < n {
+			result = append(result, sampled{key: key, total: n, skipped: n - written})
+		}
+	}
+	s.seen = make(map[string]int64)
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+	return result
+}
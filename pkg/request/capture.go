@@ -0,0 +1,46 @@
+package request
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/capture"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+)
+
+// the end of execute: the request of the dump is captured when it
+// failed by err, body is the body of its response, and the result is
+// traced in a dry-run
+func (r *RequestWorker) done(dump *capture.Dump, variables variable.VariableMap, body []byte, err error) (variable.VariableMap, error) {
+	if saveErr := r.Config.Capture.Save(dump, captureCategory(err), err, body); saveErr != nil {
+		r.log().Error("capturing the failed request failed", saveErr.Error())
+	}
+	r.trace.result(r, variables, err)
+	return variables, err
+}
+
+// the category of the capture of a failure
+func captureCategory(err error) string {
+	switch err {
+	case ErrTimeout:
+		return capture.CategoryTimeout
+	case ErrConnRefused:
+		return capture.CategoryConnRefused
+	case ErrAssertionFailed:
+		return capture.CategoryAssertion
+	case ErrExtractionFailed:
+		return capture.CategoryExtraction
+	}
+	return capture.CategoryFailed
+}
+
+// the values of the variables, as they are written in a dump
+func variableValues(variables variable.VariableMap) map[string]string {
+	if len(variables) == 0 {
+		return nil
+	}
+	var values = make(map[string]string, len(variables))
+	for name, entry := range variables {
+		if entry != nil {
+			values[name] = entry.Value
+		}
+	}
+	return values
+}
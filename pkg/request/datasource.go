@@ -0,0 +1,87 @@
+package request
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"sync"
+)
+
+// SharedVariables holds the variables of the data-sources, which all the
+// targets of a test start with. They are swapped as a whole when a
+// data-source is refreshed, a request sees either the old variables or
+// the new ones.
+type SharedVariables struct {
+	lock sync.RWMutex
+	vars variable.VariableMap
+}
+
+func NewSharedVariables() *SharedVariables {
+	return &SharedVariables{}
+}
+
+// Get returns the variables, they must not be changed
+func (s *SharedVariables) Get() variable.VariableMap {
+	if s == nil {
+		return nil
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.vars
+}
+
+// Merge replaces the variables by the variables merged with vars
+func (s *SharedVariables) Merge(vars variable.VariableMap) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.vars = variable.Merge(s.vars, vars)
+}
+
+// SetSharedVariables makes the targets start with the variables of the
+// data-sources, which take over the variables of the previous targets
+func (t *Targeting) SetSharedVariables(shared *SharedVariables) {
+	t.shared = shared
+}
+
+// the variables an iteration starts with
+func (t *Targeting) variables() variable.VariableMap {
+	if t.shared == nil {
+		return t.Variables
+	}
+	return variable.Merge(t.Variables, t.shared.Get())
+}
+
+// runs a data-source and keeps its variables in the shared variables
+func (t *Targeting) runDataSource(w *RequestWorker) {
+	vars, err := w.DoSingle(t.shared.Get(), nil)
+	if err != nil {
+		t.env.log().Error("data-source "+w.Config.TargetName+" failed", err.Error())
+	}
+	if vars != nil {
+		t.shared.Merge(vars)
+	}
+}
+
+// RefreshDataSources runs each data-source with a refresh again on its
+// interval, in the background, until the returned func is called
+func (t *Targeting) RefreshDataSources(batch []*RequestWorker) (stop func()) {
+	var stopChan = make(chan bool)
+	var wg = &sync.WaitGroup{}
+	for _, w := range batch {
+		if w.Config.Refresh <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(w *RequestWorker) {
+			defer wg.Done()
+			wt := curr.NewWait(w.Config.Refresh, 0, 0)
+			wt.SetChan(stopChan)
+			for wt.Waiting() {
+				t.runDataSource(w)
+			}
+		}(w)
+	}
+	return func() {
+		close(stopChan)
+		wg.Wait()
+	}
+}
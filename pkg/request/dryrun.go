@@ -0,0 +1,177 @@
+package request
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Trace writes what the workers of a dry-run do: each rendered request,
+// the status of its response, its assertions and the variables it
+// extracted. Offline, the requests are rendered but not sent, and the
+// variables they would extract are placeholders like <$token>.
+type Trace struct {
+	out     io.Writer
+	Offline bool
+	lock    sync.Mutex
+	// the requests traced and the failed ones
+	requests int
+	failures int
+}
+
+func NewTrace(out io.Writer, offline bool) *Trace {
+	return &Trace{out: out, Offline: offline}
+}
+
+// Requests returns the number of traced requests and of the failed ones
+func (t *Trace) Requests() (requests int, failures int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.requests, t.failures
+}
+
+// SetTrace makes the worker write what it does to the trace, nil stops it
+func (r *RequestWorker) SetTrace(t *Trace) {
+	r.trace = t
+}
+
+// DryRun runs each chain of targets once, or each target once when they
+// are not chained, one request at a time, with the workers traced
+func (t *Targeting) DryRun(trace *Trace) {
+	for _, w := range t.Workers {
+		w.SetTrace(trace)
+	}
+	if t.IsSequential() {
+		if chain := t.createRecursion(t.Workers, 0); chain != nil {
+			chain(t.variables(), t.newSession())
+		}
+		return
+	}
+	for _, w := range t.Workers {
+		_, _ = w.DoInChain(t.variables(), t.newSession(), nil)
+	}
+}
+
+// DryRunDataSources runs the data-sources once, traced
+func (t *Targeting) DryRunDataSources(trace *Trace) {
+	for _, w := range t.DataSources {
+		w.SetTrace(trace)
+	}
+	t.SequentialExecutionOfDataSources(t.DataSources)
+}
+
+func (t *Trace) offline() bool {
+	return t != nil && t.Offline
+}
+
+func (t *Trace) printf(format string, args ...interface{}) {
+	fmt.Fprintf(t.out, format, args...)
+}
+
+// writes the request as it is sent, it returns whether the request is
+// not sent because the trace is offline
+func (t *Trace) request(r *RequestWorker, method, url string, headers http.Header, body []byte) bool {
+	if t == nil {
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.requests++
+	t.printf("> %v: %v %v\n", r.Config.TargetName, method, url)
+	var names = make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.printf("    %v: %v\n", name, strings.Join(headers[name], ", "))
+	}
+	if len(body) > 0 {
+		t.printf("    %v\n", strings.ReplaceAll(string(body), "\n", "\n    "))
+	}
+	if t.Offline && r.Config.Auth != nil {
+		t.printf("    (the credentials of auth are not set offline)\n")
+	}
+	return t.Offline
+}
+
+// writes the status of the response
+func (t *Trace) status(r *RequestWorker, status int) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var text = strconv.Itoa(status)
+	if r.Config.Protocol == config.ProtocolHttp {
+		text += " " + http.StatusText(status)
+	}
+	t.printf("< %v\n", strings.TrimSpace(text))
+}
+
+// writes the result of each of the assertions, which have their inputs
+func (t *Trace) assertions(manager *assertions.AssertionManager, names ...string) {
+	if t == nil || manager == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, name := range names {
+		if !manager.Exists(name) {
+			continue
+		}
+		if err := manager.Run(name); err != nil {
+			t.printf("    assertion %v: failed, %v\n", name, err.Error())
+		} else {
+			t.printf("    assertion %v: passed\n", name)
+		}
+	}
+}
+
+// writes the variables the target extracted and whether it failed
+func (t *Trace) result(r *RequestWorker, variables variable.VariableMap, err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var names = make([]string, 0, len(r.Config.VariablesMap))
+	for name := range r.Config.VariablesMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if entry, ok := variables[name]; ok && entry != nil {
+			t.printf("    %v = %v\n", name, entry.Value)
+		}
+	}
+	if err != nil {
+		t.failures++
+		t.printf("    failed: %v\n\n", err.Error())
+	} else {
+		t.printf("    ok\n\n")
+	}
+}
+
+// the variables of an offline request: $status is 0 and each variable
+// of the target is a placeholder
+func (r *RequestWorker) placeholders(variables variable.VariableMap) variable.VariableMap {
+	var extracted = variable.VariableMap{
+		variable.VarStatus: &variable.VariableEntry{Type: variable.VarNumber, Value: "0"},
+	}
+	for name, entry := range r.Config.VariablesMap {
+		var placeholder = &variable.VariableEntry{Value: "<" + name + ">"}
+		if entry != nil {
+			placeholder.Type = entry.Type
+		}
+		extracted[name] = placeholder
+	}
+	return variable.Merge(variables, extracted)
+}
@@ -0,0 +1,121 @@
+package request
+
+import (
+	"context"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Env is what the targets of a test use besides their configs: the
+// context which stops the test, the logger, where the progress is
+// written and the connection pools. A test embedded by a program has
+// an Env of its own, made by NewEnv, so two tests of a process share
+// none of them. The fields which are not set (and a nil Env) are the
+// globals: the logger of logger.Configure, stdout and a shared pool.
+type Env struct {
+	// once it is done, no more iterations are started, the running
+	// ones are not interrupted
+	Context context.Context
+	Logger  *logger.Logger
+	// the progress of the test is written here
+	Out     io.Writer
+	clients *clients
+}
+
+// NewEnv makes the env of a test, with connection pools of its own
+func NewEnv(ctx context.Context, log *logger.Logger, out io.Writer) *Env {
+	return &Env{Context: ctx, Logger: log, Out: out, clients: &clients{}}
+}
+
+// Close closes the idle connections of the env's pools
+func (e *Env) Close() {
+	if e != nil && e.clients != nil {
+		e.clients.close()
+	}
+}
+
+// returns whether the test is stopped by the context
+func (e *Env) stopped() bool {
+	if e == nil || e.Context == nil {
+		return false
+	}
+	select {
+	case <-e.Context.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// the context of the test, Background without one
+func (e *Env) context() context.Context {
+	if e == nil || e.Context == nil {
+		return context.Background()
+	}
+	return e.Context
+}
+
+func (e *Env) log() *logger.Logger {
+	if e == nil {
+		return nil
+	}
+	return e.Logger
+}
+
+func (e *Env) out() io.Writer {
+	if e == nil || e.Out == nil {
+		return os.Stdout
+	}
+	return e.Out
+}
+
+// writes the progress message, by logger.InfoOut without an env
+func (e *Env) infoOut(key string, msg interface{}) {
+	if e == nil || e.Out == nil {
+		logger.InfoOut(key, msg)
+		return
+	}
+	logger.InfoTo(e.Out, key, msg)
+}
+
+func (e *Env) httpClient(timeout time.Duration, jar http.CookieJar) *http.Client {
+	if e == nil || e.clients == nil {
+		return defaultClients.http(timeout, jar)
+	}
+	return e.clients.http(timeout, jar)
+}
+
+func (e *Env) grpcClient(timeout time.Duration) *http.Client {
+	if e == nil || e.clients == nil {
+		return defaultClients.grpc(timeout)
+	}
+	return e.clients.grpc(timeout)
+}
+
+// SetEnv sets the env of the worker, nil is the globals
+func (r *RequestWorker) SetEnv(env *Env) {
+	r.env = env
+	if r.Config.Assertions != nil {
+		r.Config.Assertions.SetLogger(env.log())
+	}
+}
+
+// SetEnv sets the env of the targeting and of its workers and
+// data-sources, nil is the globals
+func (t *Targeting) SetEnv(env *Env) {
+	t.env = env
+	for _, w := range t.Workers {
+		w.SetEnv(env)
+	}
+	for _, w := range t.DataSources {
+		w.SetEnv(env)
+	}
+}
+
+// the logger of the worker, nil is the one of logger.Configure
+func (r *RequestWorker) log() *logger.Logger {
+	return r.env.log()
+}
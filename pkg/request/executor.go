@@ -0,0 +1,240 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/common"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"go.uber.org/atomic"
+	"sync"
+	"time"
+)
+
+// the longest time the rate executors wait before checking the rate again
+const maxRateCheckInterval = 50 * time.Millisecond
+
+// SetExecutor sets how iterations are started. The closed-loop executor
+// without a duration runs request-count iterations by the strategy as it
+// always did; with a duration, or with the rate and ramping executors,
+// iterations are started by runExecutor().
+func (t *Targeting) SetExecutor(executor string, duration time.Duration, rate float64, stages []config.Stage) {
+	t.executor = executor
+	t.duration = duration
+	t.rate = rate
+	t.stages = stages
+}
+
+func (t *Targeting) usesExecutor() bool {
+	return (t.executor != "" && t.executor != config.ExecutorClosedLoop) || t.duration > 0
+}
+
+// runs the iterations of the batch by the executor, an iteration is a
+// whole chain in seq mode and a single request to a picked worker otherwise
+func (t *Targeting) runExecutor(batch []*RequestWorker) {
+	var iteration = t.newIteration(batch)
+	var duration = t.duration
+	if t.executor == config.ExecutorRamping {
+		duration = 0
+		for _, st := range t.stages {
+			duration += st.Duration
+		}
+	}
+	if duration > 0 {
+		ctx, cancel := context.WithTimeout(t.env.context(), duration)
+		defer cancel()
+		for _, w := range batch {
+			w.ended = ctx.Done()
+		}
+	}
+	switch t.executor {
+	case config.ExecutorRate:
+		t.rateExecution(iteration, duration, func(elapsed time.Duration) float64 {
+			return t.rate
+		})
+	case config.ExecutorRamping:
+		t.rateExecution(iteration, duration, t.rampingRate)
+	default:
+		t.closedLoopExecution(iteration)
+	}
+	t.StatsTotal = t.MergeTargetsStats()
+}
+
+// returns a func which runs one iteration of the batch, the workers of
+// the batch stop at once so the pacing ends with any of them
+func (t *Targeting) newIteration(batch []*RequestWorker) func() {
+	if t.IsSequential() {
+		var executionQueue = t.createRecursion(batch, 0)
+		return func() {
+			var start = time.Now()
+			executionQueue(t.variables(), t.newSession())
+			curr.Pace(start, t.pacing, batch[0].stopped())
+		}
+	}
+	var pick = t.newPicker(batch)
+	return func() {
+		var worker = pick()
+		session := t.sessions.acquire()
+		defer t.sessions.release(session)
+		var start = time.Now()
+		_, err := worker.DoSingle(t.variables(), session)
+		curr.Pace(start, t.pacing, worker.stopped())
+		if err != nil {
+			t.env.log().Error("sending single request failed", err.Error())
+		}
+	}
+}
+
+// returns a func which picks the worker of the next iteration by the
+// strategy, it is safe to be called by concurrent virtual users
+func (t *Targeting) newPicker(batch []*RequestWorker) func() *RequestWorker {
+	var lock = &sync.Mutex{}
+	var index = 0
+	if t.IsWeighted() {
+		var weights = make([]int, len(batch))
+		for i, w := range batch {
+			weights[i] = w.Config.Weight
+		}
+		var scheduler = NewScheduler(t.scheduler, weights)
+		t.dispatched = make([]int64, len(batch))
+		return func() *RequestWorker {
+			lock.Lock()
+			defer lock.Unlock()
+			index = scheduler.Next()
+			t.dispatched[index]++
+			return batch[index]
+		}
+	}
+	return func() *RequestWorker {
+		lock.Lock()
+		defer lock.Unlock()
+		var current = batch[index]
+		if len(batch) < 2 {
+			return current
+		}
+		if t.IsRoundRobin() {
+			index = common.GetRandInt(0, len(batch), index)
+		} else {
+			// parallel, every target gets the same share of iterations
+			index = (index + 1) % len(batch)
+		}
+		return current
+	}
+}
+
+// concurrency virtual users run iterations back to back, until
+// request-count iterations are run or duration is passed, whichever
+// comes first
+func (t *Targeting) closedLoopExecution(iteration func()) {
+	var deadline time.Time
+	if t.duration > 0 {
+		deadline = time.Now().Add(t.duration)
+	}
+	var remaining = atomic.NewInt64(t.numOfRequests)
+	wg := &sync.WaitGroup{}
+	for vu := int64(0); vu < t.concurrency; vu++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if !deadline.IsZero() && time.Now().After(deadline) || t.env.stopped() {
+					return
+				}
+				if t.numOfRequests > 0 && remaining.Dec() < 0 {
+					return
+				}
+				t.iterations.Inc()
+				iteration()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// iterations are started at the rate returned by rateAt (per second) for
+// the given duration or until request-count iterations are started,
+// whichever comes first. If all concurrency slots are busy when an
+// iteration is due, it is dropped, so a slow server does not slow down
+// the arrival of new iterations.
+func (t *Targeting) rateExecution(iteration func(), duration time.Duration, rateAt func(elapsed time.Duration) float64) {
+	wg := &sync.WaitGroup{}
+	var start = time.Now()
+	var last = start
+	var started int64
+	// iterations which are due but not started yet, the
+	// first iteration is started right away
+	var due = 1.0
+	for {
+		var now = time.Now()
+		var elapsed = now.Sub(start)
+		if duration > 0 && elapsed >= duration || t.env.stopped() {
+			break
+		}
+		var rate = rateAt(elapsed)
+		due += rate * now.Sub(last).Seconds()
+		last = now
+		for ; due >= 1; due-- {
+			if t.numOfRequests > 0 && started >= t.numOfRequests {
+				wg.Wait()
+				return
+			}
+			select {
+			case t.requestCounter <- int64(1):
+				started++
+				t.iterations.Inc()
+				wg.Add(1)
+				go func() {
+					defer func() { <-t.requestCounter }()
+					defer wg.Done()
+					iteration()
+				}()
+			default:
+				t.droppedIterations.Inc()
+			}
+		}
+		// the rate may change (ramping), so it is checked at least
+		// every maxRateCheckInterval
+		var wait = maxRateCheckInterval
+		if rate > 0 {
+			if untilDue := time.Duration((1 - due) / rate * float64(time.Second)); untilDue < wait {
+				wait = untilDue
+			}
+		}
+		time.Sleep(wait)
+	}
+	wg.Wait()
+}
+
+// the rate of the ramping executor at the given time since start, it
+// goes linearly from the start rate (rate) to the target of each stage
+func (t *Targeting) rampingRate(elapsed time.Duration) float64 {
+	var from = t.rate
+	var stageStart time.Duration
+	for _, st := range t.stages {
+		if elapsed < stageStart+st.Duration {
+			var progress = float64(elapsed-stageStart) / float64(st.Duration)
+			return from + (st.Target-from)*progress
+		}
+		from = st.Target
+		stageStart += st.Duration
+	}
+	return from
+}
+
+// prints the executor's counters, if an executor has been used
+func (t *Targeting) printExecutorStats() {
+	if !t.usesExecutor() {
+		return
+	}
+	fmt.Printf("\n--- Executor => %v \n", t.executor)
+	fmt.Printf("--- Iterations Started => %v \n", t.iterations.Load())
+	if t.executor == config.ExecutorRate || t.executor == config.ExecutorRamping {
+		fmt.Printf("--- Iterations Dropped (no free slot) => %v \n", t.droppedIterations.Load())
+	}
+}
+
+// IterationCounts returns the number of iterations started and dropped
+// by the executor
+func (t *Targeting) IterationCounts() (started, dropped int64) {
+	return t.iterations.Load(), t.droppedIterations.Load()
+}
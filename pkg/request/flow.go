@@ -0,0 +1,110 @@
+package request
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"strconv"
+)
+
+// number of extra attempts of a target with on-failure: retry
+const DefaultOnFailureRetries = 3
+
+// ConditionsMatch reports whether all the when conditions of the
+// target hold for the given variables. A target without conditions
+// always matches.
+func (r *RequestWorker) ConditionsMatch(variables variable.VariableMap) bool {
+	for _, cond := range r.Config.When {
+		if !cond.Evaluate(variables) {
+			return false
+		}
+	}
+	return true
+}
+
+// Iterations returns the variables to be used for each execution of
+// the target in a chain. With loop-over, the target is executed once
+// per item of the array variable, the item is available in loop-var
+// (default $item) and its index in $index. With repeat, each
+// execution is repeated the given number of times.
+func (r *RequestWorker) Iterations(variables variable.VariableMap) []variable.VariableMap {
+	var repeat = r.Config.Repeat
+	if repeat < 1 {
+		repeat = 1
+	}
+	if r.Config.LoopOver == "" {
+		var iterations = make([]variable.VariableMap, 0, repeat)
+		for i := 0; i < repeat; i++ {
+			iterations = append(iterations, variables)
+		}
+		return iterations
+	}
+	entry, ok := variables[r.Config.LoopOver]
+	if !ok || entry == nil {
+		return nil
+	}
+	var items = variable.ArrayItems(entry.Value)
+	var loopVar = r.Config.LoopVar
+	if loopVar == "" {
+		loopVar = config.DefaultLoopVar
+	}
+	var iterations = make([]variable.VariableMap, 0, repeat*len(items))
+	for i, item := range items {
+		var itemVars = variable.Merge(variables, variable.VariableMap{
+			loopVar:           &variable.VariableEntry{Type: variable.VarString, Value: item},
+			variable.VarIndex: &variable.VariableEntry{Type: variable.VarNumber, Value: strconv.Itoa(i)},
+		})
+		for j := 0; j < repeat; j++ {
+			iterations = append(iterations, itemVars)
+		}
+	}
+	return iterations
+}
+
+// executes the target and retries it on failure by the target's retry
+// policy, waiting between the attempts as its backoff says. The retries
+// and whether the request succeeded at the first or at the last attempt
+// are recorded apart from the stats of each attempt.
+func (r *RequestWorker) executeWithFailurePolicy(variables variable.VariableMap, session *Session) (variable.VariableMap, error) {
+	newVariables, err := r.execute(variables, session)
+	var policy = r.retryPolicy()
+	if policy == nil {
+		return newVariables, err
+	}
+	var firstErr = err
+	var wait = policy.Wait()
+	wait.SetDone(r.stopped())
+	for attempt := 1; err != nil && attempt < policy.MaxAttempts; attempt++ {
+		if !policy.RetriesOn(failureKind(err), statusOf(newVariables)) || !wait.Waiting() {
+			break
+		}
+		r.GetStat(r.workerId).IncrRetries(1)
+		newVariables, err = r.execute(variables, session)
+	}
+	r.GetStat(r.workerId).AddRetriedRequest(firstErr == nil, err == nil)
+	return newVariables, err
+}
+
+// returns a channel closed once the test stops: its context is done or
+// its duration is passed, the running iterations do not wait for their
+// retries then
+func (r *RequestWorker) stopped() <-chan struct{} {
+	if r.ended != nil {
+		return r.ended
+	}
+	if r.env != nil && r.env.Context != nil {
+		return r.env.Context.Done()
+	}
+	return nil
+}
+
+// takes the target's think time (if any) before a request, and records
+// it apart from the request durations. It reports false if the test is
+// stopped while thinking, the iteration ends then.
+func (r *RequestWorker) think() bool {
+	if r.Config.ThinkTime == nil || r.trace != nil {
+		return true
+	}
+	thought, ok := r.Config.ThinkTime.Think(r.stopped())
+	r.GetStat(r.workerId).AddThinkDuration(thought)
+	return ok
+}
@@ -0,0 +1,19 @@
+package request
+
+import (
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/tidwall/gjson"
+)
+
+// graphqlErrors returns an error when a graphql response carries errors,
+// graphql servers answer them with 200 too
+func graphqlErrors(body []byte, log *logger.Logger) error {
+	var errs = gjson.GetBytes(body, "errors")
+	if !errs.IsArray() || len(errs.Array()) == 0 {
+		return nil
+	}
+	var message = errs.Array()[0].Get("message").String()
+	log.Error("graphql response has errors", message)
+	return errors.New("graphql response has errors: " + message)
+}
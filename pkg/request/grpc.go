@@ -0,0 +1,102 @@
+package request
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
+	"net/http"
+	"time"
+)
+
+// sendGrpc calls the method of a grpc target with the messages of the body
+// and records its stats as sendRequest does. It returns the messages of the
+// response as json and the grpc status code; when the call has no status,
+// like when the server cannot be reached, the code is the one grpc clients
+// give, like UNAVAILABLE. A status which is not asserted (OK by default) is
+// counted as a failure with its code, as http status codes are.
+func (r *RequestWorker) sendGrpc(urlStr, body string, metadata http.Header, tout time.Duration) ([]byte, int, error) {
+	cl := r.env.grpcClient(tout)
+	method, err := r.grpcDescriptor(cl, urlStr, metadata)
+	if err != nil {
+		r.log().Error("grpc method is not found", err.Error())
+		r.GetStat(r.workerId).IncrOtherErrors(1)
+		return nil, int(grpc.Unavailable), ErrRequestFailed
+	}
+	messages, err := grpc.EncodeMessages(method.Input, body, method.ClientStreaming)
+	if err != nil {
+		r.log().Error("creating request message failed", err.Error())
+		r.GetStat(r.workerId).IncrOtherErrors(1)
+		return nil, int(grpc.Internal), ErrRequestFailed
+	}
+	req, err := grpc.NewRequest(urlStr, method, metadata, messages, tout)
+	if err != nil {
+		r.log().Error("creating request object failed", err.Error())
+		r.GetStat(r.workerId).IncrOtherErrors(1)
+		return nil, int(grpc.Internal), ErrRequestFailed
+	}
+	tn := time.Now()
+	resp, doErr := cl.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err = r.HandleResponse(r.workerId, resp, doErr); err != nil {
+		r.log().Error("request failed", err.Error())
+		return nil, int(grpc.Unavailable), requestError(doErr)
+	} else if resp == nil {
+		r.log().Error("request failed", "no error and no response")
+		return nil, int(grpc.Unavailable), requestError(doErr)
+	}
+	res, err := grpc.ReadResponse(resp)
+	var bodyData []byte
+	if err == nil && (len(res.Messages) > 0 || method.ServerStreaming) {
+		bodyData, err = grpc.DecodeMessages(method.Output, res.Messages, method.ServerStreaming)
+	}
+	if err != nil {
+		r.log().Error("failed to read the response", err.Error())
+		r.GetStat(r.workerId).IncrOtherErrors(1)
+		return nil, int(grpc.Internal), ErrRequestFailed
+	}
+
+	var asserts = r.Config.Assertions.Clone()
+	var assertErr error
+	if asserts.Exists(assertions.AssertBodyString) {
+		_ = asserts.Get(assertions.AssertBodyString).SetInput(bodyData)
+	}
+	_ = asserts.Get(assertions.AssertGrpcStatus).SetTest(res.Status)
+	if err := asserts.ChainRunner(assertions.AssertGrpcStatus, assertions.AssertBodyString); err == nil {
+		r.GetStat(r.workerId).IncrSuccess(1)
+	} else if res.Status != grpc.OK {
+		r.log().Error("grpc call failed", res.Status.String()+" "+res.Message)
+		r.GetStat(r.workerId).IncrFailedGrpc(int(res.Status), 1)
+		assertErr = ErrAssertionFailed
+	} else {
+		r.GetStat(r.workerId).IncrOtherErrors(1)
+		assertErr = ErrAssertionFailed
+	}
+	r.recordDurations(tn, res.Header)
+	return bodyData, int(res.Status), assertErr
+}
+
+// the method of a grpc target; without proto files it is looked up
+// by the server reflection at the first call
+func (r *RequestWorker) grpcDescriptor(cl *http.Client, urlStr string, metadata http.Header) (*grpc.Method, error) {
+	if r.Config.Grpc.Descriptor != nil {
+		return r.Config.Grpc.Descriptor, nil
+	}
+	r.grpcLock.Lock()
+	defer r.grpcLock.Unlock()
+	if r.grpcMethod != nil {
+		return r.grpcMethod, nil
+	}
+	service, _, err := grpc.SplitMethod(r.Config.Grpc.Method)
+	if err != nil {
+		return nil, err
+	}
+	descriptors, err := grpc.Reflect(cl, urlStr, metadata, service)
+	if err != nil {
+		return nil, err
+	}
+	if r.grpcMethod, err = descriptors.Method(r.Config.Grpc.Method); err != nil {
+		return nil, err
+	}
+	return r.grpcMethod, nil
+}
@@ -1,26 +1,66 @@
 package request
 
 import (
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
 	"net/http"
 	"sync"
 	"time"
 )
 
-var requestOnce = &sync.Once{}
-var clientOnce = &sync.Once{}
-var client *http.Client
+// the transports of the http and grpc targets of a test, the connections
+// of their pools are reused by all requests of the test
+type clients struct {
+	once          sync.Once
+	transport     *http.Transport
+	grpcOnce      sync.Once
+	grpcTransport *http.Transport
+}
 
-func GetHttpClient(timeout time.Duration) *http.Client {
-	clientOnce.Do(func() {
-		if client == nil {
-			tr := &http.Transport{
-				MaxIdleConnsPerHost: 1024,
-				MaxIdleConns: 1024,
-			}
-			client = &http.Client{}
-			client.Timeout = timeout
-			client.Transport = tr
+// the clients of the tests which have no Env of their own
+var defaultClients = &clients{}
+
+func (c *clients) http(timeout time.Duration, jar http.CookieJar) *http.Client {
+	c.once.Do(func() {
+		c.transport = &http.Transport{
+			MaxIdleConnsPerHost: 1024,
+			MaxIdleConns:        1024,
 		}
 	})
-	return client
+	return &http.Client{Transport: c.transport, Timeout: timeout, Jar: jar}
+}
+
+// the client of grpc targets talks http/2 only
+func (c *clients) grpc(timeout time.Duration) *http.Client {
+	c.grpcOnce.Do(func() {
+		c.grpcTransport = grpc.NewTransport()
+	})
+	return &http.Client{Transport: c.grpcTransport, Timeout: timeout}
+}
+
+// closes the idle connections of the pools
+func (c *clients) close() {
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+	}
+	if c.grpcTransport != nil {
+		c.grpcTransport.CloseIdleConnections()
+	}
+}
+
+// GetHttpClient returns a client with the timeout, all clients share
+// one transport (and hence one connection pool)
+func GetHttpClient(timeout time.Duration) *http.Client {
+	return defaultClients.http(timeout, nil)
+}
+
+// GetHttpClientWithJar returns a client bound to the given cookie jar,
+// it shares the transport (and hence the connection pool) of the
+// global client, so creating one per session is cheap.
+func GetHttpClientWithJar(timeout time.Duration, jar http.CookieJar) *http.Client {
+	return defaultClients.http(timeout, jar)
+}
+
+// GetGrpcClient returns the client of grpc targets, which talks http/2 only
+func GetGrpcClient(timeout time.Duration) *http.Client {
+	return defaultClients.grpc(timeout)
 }
@@ -0,0 +1,61 @@
+package request
+
+import (
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// the retry policy of a target with on-failure: retry and no retry section,
+// the request is sent again DefaultOnFailureRetries times without waiting
+var onFailureRetryPolicy = &config.RetryConfig{
+	MaxAttempts: 1 + DefaultOnFailureRetries,
+	Backoff:     curr.BackoffConstant,
+}
+
+// the retry policy of the target, nil if its requests are not retried
+func (r *RequestWorker) retryPolicy() *config.RetryConfig {
+	if r.Config.Retry != nil {
+		return r.Config.Retry
+	}
+	if r.Config.OnFailure == config.OnFailureRetry {
+		return onFailureRetryPolicy
+	}
+	return nil
+}
+
+// the error of a request which is not sent, or not answered, because of err
+func requestError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return ErrTimeout
+	} else if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrConnRefused
+	}
+	return ErrRequestFailed
+}
+
+// the kind of failure of a request, as retry.on names it
+func failureKind(err error) string {
+	switch err {
+	case ErrTimeout:
+		return config.RetryOnTimeout
+	case ErrConnRefused:
+		return config.RetryOnConnRefused
+	case ErrAssertionFailed, ErrExtractionFailed:
+		return config.RetryOnAssertion
+	}
+	return ""
+}
+
+// the $status of the variables returned by execute
+func statusOf(variables variable.VariableMap) int {
+	if entry, ok := variables[variable.VarStatus]; ok && entry != nil {
+		status, _ := strconv.Atoi(entry.Value)
+		return status
+	}
+	return 0
+}
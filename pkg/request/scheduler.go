@@ -0,0 +1,122 @@
+package request
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"math/rand"
+	"sync"
+)
+
+// Scheduler picks the index of the next worker to send a request to,
+// based on the workers' weights. Schedulers are not safe for concurrent
+// use, a single dispatching loop is expected to call Next().
+type Scheduler interface {
+	Next() int
+}
+
+// NewScheduler returns a scheduler of the given kind for the given
+// weights, a weight less than 1 (a config without a weight) is
+// considered as 1.
+func NewScheduler(kind string, weights []int) Scheduler {
+	var w = make([]int, len(weights))
+	var total = 0
+	for i, v := range weights {
+		w[i] = normalizeWeight(v)
+		total += w[i]
+	}
+	if kind == config.SchedulerRandom {
+		return &randomWeightedScheduler{weights: w, total: total}
+	}
+	return &smoothWeightedScheduler{weights: w, current: make([]int, len(w)), total: total}
+}
+
+type smoothWeightedScheduler struct {
+	weights []int
+	current []int
+	total   int
+}
+
+// on each pick, every worker gains its weight and the one with the
+// highest current value is picked and loses the total weight
+func (s *smoothWeightedScheduler) Next() int {
+	var best = -1
+	for i, w := range s.weights {
+		s.current[i] += w
+		if best == -1 || s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	if best > -1 {
+		s.current[best] -= s.total
+	}
+	return best
+}
+
+type randomWeightedScheduler struct {
+	weights []int
+	total   int
+}
+
+func (s *randomWeightedScheduler) Next() int {
+	if s.total == 0 {
+		return -1
+	}
+	var rnd = rand.Intn(s.total)
+	for i, w := range s.weights {
+		if rnd < w {
+			return i
+		}
+		rnd -= w
+	}
+	return len(s.weights) - 1
+}
+
+// WeightedExecution sends the requests of all targets (request-count in
+// total) to the workers picked by the scheduler, according to their weights.
+// It is meant for traffic shapes like 70% browse, 25% search, 5% checkout.
+func (t *Targeting) WeightedExecution(batch []*RequestWorker) {
+	var weights = make([]int, len(batch))
+	for i, w := range batch {
+		weights[i] = w.Config.Weight
+	}
+	var scheduler = NewScheduler(t.scheduler, weights)
+	wg := &sync.WaitGroup{}
+	t.dispatched = make([]int64, len(batch))
+	for j := int64(0); j < t.numOfRequests && !t.env.stopped(); j++ {
+		var index = scheduler.Next()
+		t.dispatched[index]++
+		t.sendSingle(wg, batch[index])
+	}
+	wg.Wait()
+}
+
+// PrintDistribution prints the requested share of each target (by its
+// weight) against the share it achieved
+func (t *Targeting) PrintDistribution() {
+	if t.dispatched == nil {
+		return
+	}
+	var totalWeight, totalDispatched int64
+	for i, w := range t.Workers {
+		totalWeight += int64(normalizeWeight(w.Config.Weight))
+		totalDispatched += t.dispatched[i]
+	}
+	if totalWeight == 0 || totalDispatched == 0 {
+		return
+	}
+	fmt.Println("\n======== distribution ========")
+	for i, w := range t.Workers {
+		var weight = int64(normalizeWeight(w.Config.Weight))
+		fmt.Printf("--- %v => requested %.2f%% (weight %v), achieved %.2f%% (%v requests) \n",
+			w.StageName,
+			float64(weight)*100/float64(totalWeight), weight,
+			float64(t.dispatched[i])*100/float64(totalDispatched), t.dispatched[i])
+	}
+}
+
+func normalizeWeight(w int) int {
+	if w < 1 {
+		return 1
+	}
+	return w
+}
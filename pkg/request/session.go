@@ -0,0 +1,85 @@
+package request
+
+import (
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+)
+
+// Session holds the state of a single virtual user. In seq mode
+// a new session is created for every chain iteration, so each
+// iteration behaves like a fresh browser; in parallel and round-robin
+// modes sessions are pooled, one per concurrency slot.
+type Session struct {
+	Jar        http.CookieJar
+	cookieSeed map[string]string
+	seeded     map[string]bool
+	lock       *sync.Mutex
+}
+
+// NewSession creates a session with its own cookie jar. Seed cookies
+// are set on the jar the first time a host is requested, their values
+// may contain variables which get replaced at that moment.
+func NewSession(cookieSeed map[string]string) *Session {
+	jar, _ := cookiejar.New(nil)
+	return &Session{
+		Jar:        jar,
+		cookieSeed: cookieSeed,
+		seeded:     make(map[string]bool),
+		lock:       &sync.Mutex{},
+	}
+}
+
+// SeedCookies sets the seed cookies for the host of the given url,
+// only once per host.
+func (s *Session) SeedCookies(u *url.URL, variables variable.VariableMap) {
+	if s == nil || s.Jar == nil || len(s.cookieSeed) == 0 || u == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.seeded[u.Host] {
+		return
+	}
+	var cookies = make([]*http.Cookie, 0, len(s.cookieSeed))
+	for name, value := range s.cookieSeed {
+		cookies = append(cookies, &http.Cookie{
+			Name:  name,
+			Value: variable.ReplaceVariables(variables, value),
+			Path:  "/",
+		})
+	}
+	s.Jar.SetCookies(&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}, cookies)
+	s.seeded[u.Host] = true
+}
+
+// a pool of sessions, one per virtual user, used by the strategies
+// in which requests are not chained
+type sessionPool chan *Session
+
+func newSessionPool(size int64, cookieSeed map[string]string) sessionPool {
+	if size < 1 {
+		size = 1
+	}
+	p := make(sessionPool, size)
+	for i := int64(0); i < size; i++ {
+		p <- NewSession(cookieSeed)
+	}
+	return p
+}
+
+func (p sessionPool) acquire() *Session {
+	if p == nil {
+		return nil
+	}
+	return <-p
+}
+
+func (p sessionPool) release(s *Session) {
+	if p == nil || s == nil {
+		return
+	}
+	p <- s
+}
@@ -0,0 +1,118 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// sendSocket sends the payload of a tcp or udp target, the body in the
+// encoding of its socket config, and reads the response when the config
+// says so. Stats are recorded as sendRequest does; the response must pass
+// body-string and body-hex, when they are given. There is no status code.
+func (r *RequestWorker) sendSocket(urlStr, payload string, tout time.Duration) ([]byte, int, error) {
+	var st = r.GetStat(r.workerId)
+	var socket = r.Config.Socket
+	data, err := config.DecodePayload(socket.Encoding, payload)
+	if err != nil {
+		r.log().Error("creating request payload failed", err.Error())
+		st.IncrOtherErrors(1)
+		return nil, 0, ErrRequestFailed
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		r.log().Error("creating request object failed", err.Error())
+		st.IncrOtherErrors(1)
+		return nil, 0, ErrRequestFailed
+	}
+	tn := time.Now()
+	conn, err := net.DialTimeout(r.Config.Protocol, u.Host, tout)
+	st.IncrTotalSent(1)
+	if err != nil {
+		return nil, 0, r.countConnError("connection failed", err)
+	}
+	defer conn.Close()
+	if tout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(tout))
+	}
+	if _, err := conn.Write(data); err != nil {
+		return nil, 0, r.countConnError("request failed", err)
+	}
+	var response []byte
+	if socket.Read {
+		if response, err = readSocketResponse(conn, socket); err != nil {
+			return nil, 0, r.countConnError("reading the response failed", err)
+		}
+	}
+
+	var asserts = r.Config.Assertions.Clone()
+	var assertErr error
+	if asserts.Exists(assertions.AssertBodyString) || asserts.Exists(assertions.AssertBodyHex) {
+		for _, name := range []string{assertions.AssertBodyString, assertions.AssertBodyHex} {
+			if asserts.Exists(name) {
+				_ = asserts.Get(name).SetInput(response)
+			}
+		}
+		assertErr = asserts.ChainRunner(assertions.AssertBodyString, assertions.AssertBodyHex)
+	}
+	if assertErr == nil {
+		st.IncrSuccess(1)
+	} else {
+		st.IncrOtherErrors(1)
+		assertErr = ErrAssertionFailed
+	}
+	r.recordDurations(tn, nil)
+	return response, 0, assertErr
+}
+
+// reads the response until the delimiter or the length of the config is
+// received; without them, what is received until the timeout ends or the
+// server closes the connection is the response. A udp response may come
+// in several datagrams.
+func readSocketResponse(conn net.Conn, socket *config.SocketConfig) ([]byte, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(socket.ReadTimeout))
+	var bounded = len(socket.ReadUntil) > 0 || socket.ReadLength > 0
+	var response = make([]byte, 0, 512)
+	var buf = make([]byte, 64<<10)
+	for {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if socket.ReadLength > 0 && len(response) >= socket.ReadLength {
+			return response[:socket.ReadLength], nil
+		}
+		if i := bytes.Index(response, socket.ReadUntil); len(socket.ReadUntil) > 0 && i >= 0 {
+			return response[:i+len(socket.ReadUntil)], nil
+		}
+		if err == nil {
+			continue
+		}
+		if ne, ok := err.(net.Error); !bounded && (err == io.EOF || ok && ne.Timeout()) {
+			return response, nil
+		} else if err == io.EOF {
+			return nil, errors.New("the connection is closed before the response is read")
+		}
+		return nil, err
+	}
+}
+
+// counts an error of a connection of a target which is not http: a
+// timeout, a refused connection or another error, and returns it as
+// the error of the request
+func (r *RequestWorker) countConnError(message string, err error) error {
+	r.log().Error(message, err.Error())
+	var reqErr = requestError(err)
+	switch reqErr {
+	case ErrTimeout:
+		r.GetStat(r.workerId).IncrTimeout(1)
+	case ErrConnRefused:
+		r.GetStat(r.workerId).IncrConnRefused(1)
+	default:
+		r.GetStat(r.workerId).IncrOtherErrors(1)
+	}
+	return reqErr
+}
@@ -0,0 +1,179 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/capture"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// sendStream sends the request of a target whose response is a stream of
+// events and reads the events as its stream config says. The duration of
+// the request is the time to the response; the time to the first event,
+// the gaps between the events, the events and the time the stream is read
+// for are recorded apart. max-timeout limits the time to the first event.
+// It returns the last event (the data of an sse event), which variables
+// are extracted from, and the status code. body-string is asserted on all
+// the events, one per line.
+func (r *RequestWorker) sendStream(req *http.Request, tout time.Duration, session *Session, dump *capture.Dump) ([]byte, int, error) {
+	var st = r.GetStat(r.workerId)
+	var stream = r.Config.Stream
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	// set when the duration of the stream is over, or when the
+	// first event is not received in time
+	var over, timedOut int32
+	var firstEvent int32
+	if stream.Duration > 0 {
+		timer := time.AfterFunc(stream.Duration, func() {
+			atomic.StoreInt32(&over, 1)
+			cancel()
+		})
+		defer timer.Stop()
+	}
+	if tout > 0 {
+		timer := time.AfterFunc(tout, func() {
+			if atomic.LoadInt32(&firstEvent) == 0 && atomic.LoadInt32(&over) == 0 {
+				atomic.StoreInt32(&timedOut, 1)
+				cancel()
+			}
+		})
+		defer timer.Stop()
+	}
+	// the stream is not limited by the timeout of the client
+	var cl = &http.Client{Transport: r.env.httpClient(tout, nil).Transport}
+	if session != nil {
+		cl.Jar = session.Jar
+	}
+	tn := time.Now()
+	resp, doErr := cl.Do(req.WithContext(ctx))
+	if resp != nil {
+		defer resp.Body.Close()
+		dump.SetResponse(resp.StatusCode, resp.Header)
+		r.trace.status(r, resp.StatusCode)
+	}
+	if doErr != nil && atomic.LoadInt32(&timedOut) == 1 {
+		r.log().Error("request timeout", doErr.Error())
+		st.IncrTimeout(1)
+		st.IncrTotalSent(1)
+		return nil, 0, ErrTimeout
+	}
+	if err := r.HandleResponse(r.workerId, resp, doErr); err != nil {
+		r.log().Error("request failed", err.Error())
+		if resp != nil && resp.StatusCode == 504 {
+			return nil, resp.StatusCode, ErrTimeout
+		}
+		return nil, 0, requestError(doErr)
+	} else if resp == nil {
+		r.log().Error("request failed", "no error and no response")
+		return nil, 0, requestError(doErr)
+	}
+	r.recordDurations(tn, resp.Header)
+
+	var asserts = r.Config.Assertions.Clone()
+	_ = asserts.Get(assertions.AssertStatusIsOk).SetTest(resp.StatusCode)
+	if asserts.Exists(assertions.AssertContentType) {
+		_ = asserts.Get(assertions.AssertContentType).SetInput(resp.Header.Get("Content-Type"))
+	}
+	if err := asserts.ChainRunner(assertions.AssertStatusIsOk, assertions.AssertContentType); err != nil {
+		if resp.StatusCode != 200 && resp.StatusCode != 201 {
+			st.IncrFailed(resp.StatusCode, 1)
+		} else {
+			st.IncrOtherErrors(1)
+		}
+		return nil, resp.StatusCode, ErrAssertionFailed
+	}
+
+	// the events are kept only when they are asserted
+	var keep = asserts.Exists(assertions.AssertBodyString)
+	var events = &bytes.Buffer{}
+	var last []byte
+	var count int64
+	var lastAt time.Time
+	var err error
+	var reader = bufio.NewReader(resp.Body)
+	for stream.MaxEvents == 0 || count < int64(stream.MaxEvents) {
+		var event []byte
+		event, err = readEvent(reader, stream.Format)
+		if err != nil {
+			break
+		}
+		var now = time.Now()
+		if count == 0 {
+			atomic.StoreInt32(&firstEvent, 1)
+			st.AddStreamFirstEventDuration(now.Sub(tn))
+		} else {
+			st.AddStreamEventGap(now.Sub(lastAt))
+		}
+		lastAt = now
+		count++
+		last = event
+		if keep {
+			events.Write(event)
+			events.WriteByte('\n')
+		}
+	}
+	st.AddStream(time.Since(tn), count)
+
+	if atomic.LoadInt32(&timedOut) == 1 {
+		r.log().Error("request timeout", "no event is received in time")
+		st.IncrTimeout(1)
+		return nil, resp.StatusCode, ErrTimeout
+	} else if err != nil && err != io.EOF && atomic.LoadInt32(&over) == 0 {
+		r.log().Error("reading the stream failed", err.Error())
+		st.IncrOtherErrors(1)
+		return nil, resp.StatusCode, ErrRequestFailed
+	}
+	var assertErr error
+	if keep {
+		_ = asserts.Get(assertions.AssertBodyString).SetInput(events.Bytes())
+		assertErr = asserts.ChainRunner(assertions.AssertBodyString)
+	}
+	if assertErr == nil {
+		st.IncrSuccess(1)
+	} else {
+		st.IncrOtherErrors(1)
+		assertErr = ErrAssertionFailed
+	}
+	return last, resp.StatusCode, assertErr
+}
+
+// reads the next event of a stream: the data of a server-sent event (its
+// data lines joined by new lines), or a line which is not empty
+func readEvent(reader *bufio.Reader, format string) ([]byte, error) {
+	var data [][]byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// an event which is not ended is not dispatched
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if format == config.StreamLines {
+			if len(bytes.TrimSpace(line)) > 0 {
+				return line, nil
+			}
+			continue
+		}
+		if len(line) == 0 {
+			if data != nil {
+				return bytes.Join(data, []byte("\n")), nil
+			}
+			continue
+		}
+		// comments, like keep-alives, and fields other than data are skipped
+		var field, value = line, []byte{}
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], bytes.TrimPrefix(line[i+1:], []byte(" "))
+		}
+		if string(field) == "data" {
+			data = append(data, value)
+		}
+	}
+}
@@ -2,8 +2,8 @@ package request
 
 import (
 	"github.com/mostafatalebi/loadtest/pkg/common"
+	"github.com/mostafatalebi/loadtest/pkg/config"
 	"github.com/mostafatalebi/loadtest/pkg/curr"
-	"github.com/mostafatalebi/loadtest/pkg/logger"
 	"github.com/mostafatalebi/loadtest/pkg/stats"
 	"github.com/mostafatalebi/loadtest/pkg/stats/progress"
 	variable "github.com/mostafatalebi/loadtest/pkg/variables"
@@ -13,15 +13,16 @@ import (
 )
 
 const (
-	StrategySeq        = "seq"
-	StrategyRoundRobin = "round-robin"
-	StrategyParallel   = "parallel"
+	StrategySeq        = config.StrategySeq
+	StrategyRoundRobin = config.StrategyRoundRobin
+	StrategyParallel   = config.StrategyParallel
+	StrategyWeighted   = config.StrategyWeighted
 
 	ExecWorker = "w"
 	ExecDataSource = "ds"
 )
 
-type TargetFunc func(variables variable.VariableMap)
+type TargetFunc func(variables variable.VariableMap, session *Session)
 
 var TargetAll = "all target"
 
@@ -42,6 +43,25 @@ type Targeting struct {
 	progress              *progress.ProgressIndicator
 	logFileName           string
 	Variables 			  variable.VariableMap
+	// the variables of the data-sources, if any
+	shared                *SharedVariables
+	cookies               bool
+	cookieSeed            map[string]string
+	sessions              sessionPool
+	pacing                time.Duration
+	scheduler             string
+	dispatched            []int64
+	executor              string
+	duration              time.Duration
+	rate                  float64
+	stages                []config.Stage
+	iterations            atomic.Int64
+	droppedIterations     atomic.Int64
+	// stops the test and has its logger, nil is the globals
+	env                   *Env
+	closeOnce             sync.Once
+	// closed once the progress is printed
+	progressDone          chan struct{}
 }
 
 func NewTargetManager(tp string, cc, rc int64) *Targeting {
@@ -59,6 +79,37 @@ func NewTargetManager(tp string, cc, rc int64) *Targeting {
 	return t
 }
 
+// EnableCookies gives each virtual user its own cookie jar, so cookies
+// set by a target's response are sent by the next targets of the chain.
+// Values of the seed cookies may contain variables.
+func (t *Targeting) EnableCookies(seed map[string]string) {
+	t.cookies = true
+	t.cookieSeed = seed
+	t.sessions = newSessionPool(t.concurrency, seed)
+}
+
+// SetPacing makes each iteration (a whole chain in seq mode, a single
+// request otherwise) take at least the given duration, the virtual user
+// waits for what is left before starting its next iteration.
+func (t *Targeting) SetPacing(pacing time.Duration) {
+	t.pacing = pacing
+}
+
+// SetScheduler sets the kind of scheduler (smooth or random) used
+// by the weighted strategy
+func (t *Targeting) SetScheduler(kind string) {
+	t.scheduler = kind
+}
+
+// returns a fresh session for a chain iteration, or nil if
+// cookies are not enabled
+func (t *Targeting) newSession() *Session {
+	if !t.cookies {
+		return nil
+	}
+	return NewSession(t.cookieSeed)
+}
+
 
 // Run accepts an execType which tells it to execute which batch of workers
 // because a Run() may mean running actual target workers, or data-sources.
@@ -69,30 +120,60 @@ func NewTargetManager(tp string, cc, rc int64) *Targeting {
 // targets.
 func (t *Targeting) Run(execType string) {
 	if execType == ExecWorker {
-		logger.InfoOut("running targets...", "")
-		if t.IsSequential() {
-			t.progress = progress.NewProgressIndicator(t.numOfRequests)
-			go t.progress.ListenToChannel(t.eventRequestAttempted)
+		t.env.infoOut("running targets...", "")
+		if t.usesExecutor() {
+			t.runExecutor(t.Workers)
+		} else if t.IsSequential() {
+			t.listenToProgress(t.numOfRequests)
 			t.SequentialExecution(t.Workers)
 		} else if t.IsParallel() {
-			t.progress = progress.NewProgressIndicator(t.numOfRequests*int64(len(t.Workers)))
-			go t.progress.ListenToChannel(t.eventRequestAttempted)
+			t.listenToProgress(t.numOfRequests * int64(len(t.Workers)))
 			t.ParallelExecution(t.Workers)
 		} else if t.IsRoundRobin() {
-			t.progress = progress.NewProgressIndicator(t.numOfRequests)
-			go t.progress.ListenToChannel(t.eventRequestAttempted)
+			t.listenToProgress(t.numOfRequests)
 			t.RoundRobinExecution(t.Workers)
+		} else if t.IsWeighted() {
+			t.listenToProgress(t.numOfRequests)
+			t.WeightedExecution(t.Workers)
 		}
 	} else if execType == ExecDataSource {
 		if t.DataSources != nil {
-			logger.InfoOut("running data-source(s)...", "")
+			t.env.infoOut("running data-source(s)...", "")
 			t.SequentialExecutionOfDataSources(t.DataSources)
 		}
 	} else {
-		logger.InfoOut("nothing run, no exec type specified", "")
+		t.env.infoOut("nothing run, no exec type specified", "")
 	}
 }
 
+// prints the progress of the requests attempted, out of total
+func (t *Targeting) listenToProgress(total int64) {
+	t.progress = progress.NewProgressIndicator(total)
+	t.progress.Out = t.env.out()
+	t.progressDone = make(chan struct{})
+	go func() {
+		defer close(t.progressDone)
+		t.progress.ListenToChannel(t.eventRequestAttempted)
+	}()
+}
+
+// Close stops the goroutines of the targeting and of its workers, it
+// is called once the targeting is not run anymore
+func (t *Targeting) Close() {
+	t.closeOnce.Do(func() {
+		close(t.eventRequestAttempted)
+		if t.progressDone != nil {
+			<-t.progressDone
+		}
+		for _, w := range t.Workers {
+			close(w.eventCCChanged)
+		}
+		for _, w := range t.DataSources {
+			close(w.eventCCChanged)
+		}
+	})
+}
+
 // Creates a reverse recursion from the given list of workers.
 // So, the last element in the array becomes the leaf (and hence
 // it gets executed last). Each target is responsible to execute
@@ -103,14 +184,16 @@ func (t *Targeting) Run(execType string) {
 func (t *Targeting) SequentialExecution(batch []*RequestWorker) {
 	var executionQueue = t.createRecursion(batch, 0)
 	wg := sync.WaitGroup{}
-	for i := int64(0); i < t.numOfRequests; i++ {
+	for i := int64(0); i < t.numOfRequests && !t.env.stopped(); i++ {
 		t.requestCounter <- int64(1)
 		wg.Add(1)
 		go func() {
 			defer func() { <-t.requestCounter }()
 			defer wg.Done()
 			t.eventRequestAttempted <- 1
-			executionQueue(t.Variables)
+			var start = time.Now()
+			executionQueue(t.variables(), t.newSession())
+			curr.Pace(start, t.pacing, t.env.context().Done())
 		}()
 	}
 	wg.Wait()
@@ -122,20 +205,8 @@ func (t *Targeting) ParallelExecution(batch []*RequestWorker) {
 	wg := &sync.WaitGroup{}
 	workersLen := len(batch)
 	for i := 0; i < workersLen; i++ {
-		for j := int64(0); j < t.numOfRequests; j++ {
-			var currentWorker = batch[i]
-			t.requestCounter <- int64(1)
-			wg.Add(1)
-			go func(worker *RequestWorker) {
-				var err error
-				defer func() { <-t.requestCounter }()
-				defer wg.Done()
-				t.eventRequestAttempted <- 1
-				_, err = worker.DoSingle(t.Variables)
-				if err != nil {
-					logger.Error("sending single request in parallel mode failed", err.Error())
-				}
-			}(currentWorker)
+		for j := int64(0); j < t.numOfRequests && !t.env.stopped(); j++ {
+			t.sendSingle(wg, batch[i])
 		}
 	}
 	wg.Wait()
@@ -145,49 +216,47 @@ func (t *Targeting) RoundRobinExecution(batch []*RequestWorker) {
 	wg := &sync.WaitGroup{}
 	var rrIndex = 0
 	var workersLen = len(batch)
-	for j := int64(0); j < t.numOfRequests; j++ {
+	for j := int64(0); j < t.numOfRequests && !t.env.stopped(); j++ {
 		var currentWorker = batch[rrIndex]
 		rrIndex = common.GetRandInt(0, workersLen, rrIndex)
-		t.requestCounter <- int64(1)
-		wg.Add(1)
-		go func(worker *RequestWorker) {
-			var err error
-			defer func() { <-t.requestCounter }()
-			defer wg.Done()
-			t.eventRequestAttempted <- 1
-			_, err = worker.DoSingle(t.Variables)
-			if err != nil {
-				logger.Error("sending single request in parallel mode failed", err.Error())
-			}
-		}(currentWorker)
+		t.sendSingle(wg, currentWorker)
 	}
 	wg.Wait()
 }
 
+// sends a single request by the given worker in a new goroutine, once a
+// concurrency slot is free. The request is done by one of the pooled
+// virtual users (sessions), if cookies are enabled.
+func (t *Targeting) sendSingle(wg *sync.WaitGroup, worker *RequestWorker) {
+	t.requestCounter <- int64(1)
+	wg.Add(1)
+	go func(worker *RequestWorker) {
+		var err error
+		defer func() { <-t.requestCounter }()
+		defer wg.Done()
+		t.eventRequestAttempted <- 1
+		session := t.sessions.acquire()
+		defer t.sessions.release(session)
+		var start = time.Now()
+		_, err = worker.DoSingle(t.variables(), session)
+		curr.Pace(start, t.pacing, t.env.context().Done())
+		if err != nil {
+			t.env.log().Error("sending single request in parallel mode failed", err.Error())
+		}
+	}(worker)
+}
+
 
 // This is the same as SequentialExecution(), but is aimed toward
 // data-sources and does not change any global stat or does not
-// signal any global event.
+// signal any global event. The data-sources are run once, one after
+// another, each one with the variables of the previous ones.
 func (t *Targeting) SequentialExecutionOfDataSources(batch []*RequestWorker) {
-	var executionQueue = t.createRecursion(batch, 0)
-	if t.DataSources[0].RefreshConfig.RefreshType == "ms" {
-		if t.DataSources[0].RefreshConfig.Count < 1 {
-			executionQueue(t.Variables)
-		} else {
-			wt := curr.NewWait(time.Duration(t.DataSources[0].RefreshConfig.Count)*time.Millisecond, 0, 0)
-			for wt.Waiting() {
-				executionQueue(t.Variables)
-			}
-		}
-	} else if t.DataSources[0].RefreshConfig.RefreshType == "sec" {
-		if t.DataSources[0].RefreshConfig.Count < 1 {
-			executionQueue(t.Variables)
-		} else {
-			wt := curr.NewWait(time.Duration(t.DataSources[0].RefreshConfig.Count)*time.Second, 0, 0)
-			for wt.Waiting() {
-				executionQueue(t.Variables)
-			}
-		}
+	if t.shared == nil {
+		t.shared = NewSharedVariables()
+	}
+	for _, w := range batch {
+		t.runDataSource(w)
 	}
 }
 
@@ -198,6 +267,8 @@ func (t *Targeting) PrintTargetsStats() {
 	if t.StatsTotal != nil {
 		t.StatsTotal.PrintPretty(stats.DefaultPresetWithAutoFailedCodes)
 	}
+	t.PrintDistribution()
+	t.printExecutorStats()
 }
 
 // creates a list of functions to be called recursively, this is used
@@ -205,7 +276,8 @@ func (t *Targeting) PrintTargetsStats() {
 // (on which no other target is dependent).
 // The way it works allows us to transfer defined variables (if any) to next
 // target easily. Also, it helps us to maintain max concurrency and stats
-// accurate.
+// accurate. The variables of a chain (extracted ones, $status, $item and
+// $index) are its own, the next iteration starts without them.
 func (t *Targeting) createRecursion(w []*RequestWorker, index int) TargetFunc {
 	if w != nil {
 		var reqFunc, next TargetFunc
@@ -214,11 +286,8 @@ func (t *Targeting) createRecursion(w []*RequestWorker, index int) TargetFunc {
 		} else {
 			next = t.createRecursion(w, index+1)
 		}
-		reqFunc = func(vars variable.VariableMap) {
-			vars, _ = w[index].DoInChain(vars, next)
-			if vars != nil {
-				t.Variables = variable.Merge(t.Variables, vars)
-			}
+		reqFunc = func(vars variable.VariableMap, session *Session) {
+			w[index].DoInChain(vars, session, next)
 		}
 		return reqFunc
 	}
@@ -240,6 +309,10 @@ func (t *Targeting) IsRoundRobin() bool {
 	return t.strategy == StrategyRoundRobin
 }
 
+func (t *Targeting) IsWeighted() bool {
+	return t.strategy == StrategyWeighted
+}
+
 func (t *Targeting) MergeTargetsStats() *stats.StatsCollector {
 	var totalStats stats.StatsCollector
 	for _, ww := range t.Workers {
@@ -253,10 +326,12 @@ func (t *Targeting) MergeTargetsStats() *stats.StatsCollector {
 		}
 		newStats := wsv.Merge(&totalStats)
 		wsv.CalculateAverage()
+		wsv.CalculateThinkAverageDuration()
 		newStats.Key = "total"
 		totalStats = newStats
 	}
 	totalStats.CalculateAverage()
 	totalStats.CalculateExecAverageDuration()
+	totalStats.CalculateThinkAverageDuration()
 	return &totalStats
 }
@@ -0,0 +1,162 @@
+package request
+
+import (
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"github.com/mostafatalebi/loadtest/pkg/websocket"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errExpectTimeout = errors.New("expected message is not received in time")
+
+// sendWebsocket opens a connection to the url of a websocket target, runs
+// its script, holds the connection and closes it. The whole connection is
+// one request of the stats, its duration is the duration of the request;
+// the connect duration, the round trips (from a sent message to the reply
+// an expect step waits for), the messages and the abnormal closures are
+// recorded apart. It returns the last message an expect step received,
+// the status of the handshake (101 once the connection is open) and the
+// target's variables, extracted from the replies of the expect steps.
+// Later steps of the script can use the variables extracted before them.
+func (r *RequestWorker) sendWebsocket(urlStr string, headers http.Header, variables variable.VariableMap, tout time.Duration) ([]byte, int, variable.VariableMap, error) {
+	var st = r.GetStat(r.workerId)
+	tn := time.Now()
+	conn, err := websocket.Dial(urlStr, headers, tout)
+	st.IncrTotalSent(1)
+	if err != nil {
+		if he, ok := err.(*websocket.HandshakeError); ok && he.StatusCode != 0 {
+			r.log().Error("websocket handshake failed", he.Message)
+			st.IncrFailed(he.StatusCode, 1)
+			return nil, he.StatusCode, nil, ErrAssertionFailed
+		}
+		return nil, 0, nil, r.countConnError("websocket connection failed", err)
+	}
+	st.AddWsConnectDuration(time.Since(tn))
+
+	var ws = r.Config.Websocket
+	var extracted = make(variable.VariableMap)
+	var last []byte
+	var sentAt time.Time
+	for _, step := range ws.Script {
+		var vars = variable.Merge(variables, extracted)
+		switch {
+		case step.Send != "":
+			err = conn.WriteMessage(websocket.OpText, []byte(variable.ReplaceVariables(vars, step.Send)))
+			if err == nil {
+				st.IncrWsMessagesSent(1)
+				sentAt = time.Now()
+			} else {
+				err = &websocket.CloseError{Code: websocket.CloseAbnormal, Text: err.Error()}
+			}
+		case step.Expect != "":
+			var message []byte
+			message, err = r.expectMessage(conn, variable.ReplaceVariables(vars, step.Expect), step.Timeout)
+			if err == nil {
+				if !sentAt.IsZero() {
+					st.AddWsRoundTripDuration(time.Since(sentAt))
+					sentAt = time.Time{}
+				}
+				last = message
+				extracted = variable.Merge(extracted, r.extractVariables(message))
+			}
+		default:
+			err = r.receiveUntil(conn, time.Now().Add(step.Sleep))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if ce, ok := err.(*websocket.CloseError); ok && !ce.Abnormal() {
+		err = errors.New("the server closed the connection before the end of the script")
+	} else if err == nil {
+		// the server may close the connection while it is held
+		err = r.receiveUntil(conn, time.Now().Add(ws.Hold))
+		if ce, ok := err.(*websocket.CloseError); ok && !ce.Abnormal() {
+			err = nil
+		}
+	}
+	if ce := conn.Close(websocket.CloseNormal, ws.Timeout); err == nil && ce.Abnormal() {
+		// the server does not answer the close of the client
+		st.IncrWsAbnormalClosures(1)
+	}
+
+	var assertErr error
+	if err == errExpectTimeout {
+		r.log().Error("websocket script failed", err.Error())
+		st.IncrTimeout(1)
+		assertErr = ErrTimeout
+	} else if ce, ok := err.(*websocket.CloseError); ok && ce.Abnormal() {
+		r.log().Error("websocket script failed", ce.Error())
+		st.IncrWsAbnormalClosures(1)
+		st.IncrOtherErrors(1)
+		assertErr = ErrRequestFailed
+	} else if err != nil {
+		r.log().Error("websocket script failed", err.Error())
+		st.IncrOtherErrors(1)
+		assertErr = ErrRequestFailed
+	} else if r.Config.Assertions.Exists(assertions.AssertBodyString) {
+		var asserts = r.Config.Assertions.Clone()
+		_ = asserts.Get(assertions.AssertBodyString).SetInput(last)
+		if err := asserts.ChainRunner(assertions.AssertBodyString); err == nil {
+			st.IncrSuccess(1)
+		} else {
+			st.IncrOtherErrors(1)
+			assertErr = ErrAssertionFailed
+		}
+	} else {
+		st.IncrSuccess(1)
+	}
+	r.recordDurations(tn, conn.Response.Header)
+	return last, conn.Response.StatusCode, extracted, assertErr
+}
+
+// waits for a message containing expect, the messages received before it
+// are counted and skipped
+func (r *RequestWorker) expectMessage(conn *websocket.Conn, expect string, timeout time.Duration) ([]byte, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		_, message, err := conn.ReadMessage()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil, errExpectTimeout
+		} else if err != nil {
+			return nil, err
+		}
+		r.GetStat(r.workerId).IncrWsMessagesReceived(1)
+		if strings.Contains(string(message), expect) {
+			return message, nil
+		}
+	}
+}
+
+// receives (and counts) the messages until the deadline, for the sleep
+// steps and the hold of a connection
+func (r *RequestWorker) receiveUntil(conn *websocket.Conn, deadline time.Time) error {
+	_ = conn.SetReadDeadline(deadline)
+	for {
+		_, _, err := conn.ReadMessage()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r.GetStat(r.workerId).IncrWsMessagesReceived(1)
+	}
+}
+
+// the target's variables found in a message, a message which is
+// not json has none
+func (r *RequestWorker) extractVariables(message []byte) variable.VariableMap {
+	if r.Config.VariablesMap == nil {
+		return nil
+	}
+	analysis, err := variable.NewVariableAnalysis(r.Config.VariablesMap, string(message), variable.CtJson)
+	if err != nil {
+		return nil
+	}
+	analysis.SetLogger(r.log())
+	return analysis.Extract()
+}
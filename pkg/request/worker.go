@@ -6,8 +6,9 @@ import (
 	"github.com/gojektech/valkyrie"
 	dyanmic_params "github.com/mostafatalebi/dynamic-params"
 	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/capture"
 	"github.com/mostafatalebi/loadtest/pkg/config"
-	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
 	"github.com/mostafatalebi/loadtest/pkg/stats"
 	"github.com/mostafatalebi/loadtest/pkg/stats/progress"
 	variable "github.com/mostafatalebi/loadtest/pkg/variables"
@@ -15,6 +16,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +24,16 @@ import (
 
 const DefaultStatsContainer = "default"
 
+var (
+	ErrAssertionFailed  = errors.New("assertion failed")
+	ErrExtractionFailed = errors.New("variable extraction failed")
+	// requests which are not answered in time, or whose connection is refused
+	ErrTimeout     = errors.New("request timeout")
+	ErrConnRefused = errors.New("connection refused")
+	// requests which are not sent or not answered for other reasons
+	ErrRequestFailed = errors.New("failed")
+)
+
 // Request worker is responsible to manage sending request
 // with all its config to a specific endpoint
 type RequestWorker struct {
@@ -43,12 +55,15 @@ type RequestWorker struct {
 	logFileName            string
 	requestObjUsage 	   string
 	requestObj			   *http.Request
-	RefreshConfig		   *Refresh
-}
-
-type Refresh struct {
-	RefreshType string
-	Count 	int
+	// the method of a grpc target, when it is looked up by the server reflection
+	grpcMethod *grpc.Method
+	grpcLock   sync.Mutex
+	// writes the requests in a dry-run, nil otherwise
+	trace *Trace
+	// the logger and the connection pools of the test, nil is the globals
+	env *Env
+	// closed once the duration of the test is passed, nil without a duration
+	ended <-chan struct{}
 }
 
 func NewRequestWorker(cnf *config.Config, id string) *RequestWorker {
@@ -72,16 +87,16 @@ func NewRequestWorker(cnf *config.Config, id string) *RequestWorker {
 
 func (r *RequestWorker) Do() error {
 	if r.Config.Concurrency < 1 || r.Config.NumberOfRequests < 1 {
-		logger.Fatal("incorrect params", "concurrent & request-count param must be greater than zero")
+		r.log().Fatal("incorrect params", "concurrent & request-count param must be greater than zero")
 		return errors.New("incorrect params")
 	} else if r.Config.NumberOfRequests < r.Config.Concurrency {
-		logger.Fatal("incorrect params", "concurrent cannot be greater than request-count")
+		r.log().Fatal("incorrect params", "concurrent cannot be greater than request-count")
 		return errors.New("incorrect params")
 	}
 	//r.publishRequestsToChannel()
 	r.testStartTime = time.Now()
 	wg := &sync.WaitGroup{}
-	logger.InfoOut("Logfile", r.logFileName)
+	r.env.infoOut("Logfile", r.logFileName)
 	var bt = []byte(r.Config.FormBody)
 	bd := bytes.NewBuffer(bt)
 	var err error
@@ -100,10 +115,10 @@ func (r *RequestWorker) Do() error {
 			r.UpdateConcurrentReqNum(1)
 			r.GetStat(r.workerId).IncrSuccess(0)
 			if err != nil {
-				logger.Error("creating request object failed", err.Error())
+				r.log().Error("creating request object failed", err.Error())
 				return
 			}
-			r.sendRequest(r.requestObj, time.Second*time.Duration(r.Config.MaxTimeout))
+			r.sendRequest(r.requestObj, time.Second*time.Duration(r.Config.MaxTimeout), nil, nil)
 		}()
 		j++
 	}
@@ -115,65 +130,68 @@ func (r *RequestWorker) Do() error {
 // DoInChain executes single requests and applies all assertions on response
 // it also can accept a next func which will be executed at the end of its own
 // execution, and it passes any variables defined and processed (if any), to the
-// next() handler
-func (r *RequestWorker) DoInChain(variables variable.VariableMap, next TargetFunc) (variable.VariableMap, error) {
+// next() handler. Think time (if any) is taken before each request and is not
+// part of its duration. The session (if not nil) carries the cookies of the
+// virtual user along the chain.
+// The flow of the chain is controlled by the target's config: a target whose
+// when conditions do not match is skipped, a target with repeat or loop-over
+// is executed several times, and on-failure decides whether next() is
+// called after a failed request.
+func (r *RequestWorker) DoInChain(variables variable.VariableMap, session *Session, next TargetFunc) (variable.VariableMap, error) {
 	defer r.UpdateConcurrentReqNum(-1)
 	r.UpdateConcurrentReqNum(1)
 	r.GetStat(r.workerId).IncrSuccess(0)
 
-	var urlStr = r.Config.Url
-	var formBody = r.Config.FormBody
-	var headers = make(http.Header, 0)
-	if r.Config.Headers != nil {
-		for k, v :=  range r.Config.Headers {
-			headers[k] = v
-		}
-	}
-
-	if variables != nil {
-		urlStr = variable.ReplaceVariables(variables, urlStr)
-		formBody = variable.ReplaceVariables(variables, formBody)
-
-		if r.Config.Headers != nil {
-			for k, _ := range headers {
-				hv := variable.ReplaceVariables(variables, headers.Get(k))
-				headers.Set(k, hv)
-			}
+	if !r.ConditionsMatch(variables) {
+		r.GetStat(r.workerId).IncrSkipped(1)
+		if next != nil {
+			next(variables, session)
 		}
+		return variables, nil
 	}
-	var bt = []byte(formBody)
-	bd := bytes.NewBuffer(bt)
-
-	req, err := http.NewRequest(r.Config.Method, urlStr, bd)
-	if err != nil {
-		logger.Error("creating request object failed", err.Error())
-		return nil, nil
-	}
-	req.Header = headers
-	variablesAnalyzed := &variable.VariableAnalysis{}
-	bodyResponse, err := r.sendRequest(req, time.Second*time.Duration(r.Config.MaxTimeout))
-	if r.Config.VariablesMap != nil {
-		variablesAnalyzed, err = variable.NewVariableAnalysis(r.Config.VariablesMap, string(bodyResponse), "json")
-		if err != nil {
-			variablesAnalyzed = nil
+	for _, iterationVars := range r.Iterations(variables) {
+		if !r.think() {
+			return variables, nil
 		}
-		if variablesAnalyzed != nil {
-			var newVariables = variablesAnalyzed.Extract()
-			variables = variable.Merge(variables, newVariables)
+		newVariables, err := r.executeWithFailurePolicy(iterationVars, session)
+		variables = variable.Merge(variables, newVariables)
+		if err != nil && r.Config.OnFailure == config.OnFailureStop {
+			return variables, err
 		}
 	}
 	if next != nil {
-		next(variables)
+		next(variables, session)
 	}
 	return variables, nil
 }
 
 // DoSingle executes a single request, it does not handle any next() handler calling
-func (r *RequestWorker) DoSingle(variables variable.VariableMap) (variable.VariableMap, error) {
+func (r *RequestWorker) DoSingle(variables variable.VariableMap, session *Session) (variable.VariableMap, error) {
 	defer r.UpdateConcurrentReqNum(-1)
 	r.UpdateConcurrentReqNum(1)
 	r.GetStat(r.workerId).IncrSuccess(0)
 
+	if !r.think() {
+		return variables, nil
+	}
+	return r.executeWithFailurePolicy(variables, session)
+}
+
+// execute builds the request from config and the given variables, sends it
+// and extracts the target's variables from the response. The returned
+// variables contain the given ones, the extracted ones and $status.
+// Error is returned when the request fails, an assertion fails or
+// a defined variable cannot be extracted from the response. A grpc
+// target is called by sendGrpc, its $status is the grpc status code.
+// A websocket target runs its script by sendWebsocket, its variables
+// are extracted from the replies of the script. Tcp and udp targets
+// send their body by sendSocket. The body of a graphql target is built
+// from its operation, and a streaming response is read by sendStream.
+// The credentials of the target's auth are set on the headers last, an
+// http request is signed once it is built. A failed http request is
+// dumped with its response when the target has a capture. In a dry-run
+// the request is traced, and offline it is rendered but not sent.
+func (r *RequestWorker) execute(variables variable.VariableMap, session *Session) (variable.VariableMap, error) {
 	var urlStr = r.Config.Url
 	var formBody = r.Config.FormBody
 	var headers = make(http.Header, 0)
@@ -194,80 +212,184 @@ func (r *RequestWorker) DoSingle(variables variable.VariableMap) (variable.Varia
 			}
 		}
 	}
-	var bt = []byte(formBody)
-	bd := bytes.NewBuffer(bt)
+	if r.Config.Graphql != nil {
+		var err error
+		if formBody, err = r.Config.Graphql.Body(variables); err != nil {
+			r.log().Error("creating graphql request failed", err.Error())
+			return variables, err
+		}
+	}
+	// offline, the credentials are not set as they may need a token url
+	if !r.trace.offline() {
+		if err := r.Config.Auth.Apply(headers); err != nil {
+			r.log().Error("authentication failed", err.Error())
+			r.GetStat(r.workerId).IncrOtherErrors(1)
+			return variables, ErrRequestFailed
+		}
+	}
+	var bodyResponse []byte
+	var statusCode int
+	var reqErr error
+	var replyVariables variable.VariableMap
+	var dump *capture.Dump
+	if r.Config.Protocol != config.ProtocolHttp && r.trace.request(r, strings.ToUpper(r.Config.Protocol), urlStr, headers, []byte(formBody)) {
+		return r.done(nil, r.placeholders(variables), nil, nil)
+	}
+	if r.Config.Protocol == config.ProtocolGrpc {
+		bodyResponse, statusCode, reqErr = r.sendGrpc(urlStr, formBody, headers, time.Second*time.Duration(r.Config.MaxTimeout))
+	} else if r.Config.Protocol == config.ProtocolWebsocket {
+		bodyResponse, statusCode, replyVariables, reqErr = r.sendWebsocket(urlStr, headers, variables, time.Second*time.Duration(r.Config.MaxTimeout))
+	} else if r.Config.Protocol == config.ProtocolTcp || r.Config.Protocol == config.ProtocolUdp {
+		bodyResponse, statusCode, reqErr = r.sendSocket(urlStr, formBody, time.Second*time.Duration(r.Config.MaxTimeout))
+	} else {
+		var bt = []byte(formBody)
+		bd := bytes.NewBuffer(bt)
 
-	req, err := http.NewRequest(r.Config.Method, urlStr, bd)
-	if err != nil {
-		logger.Error("creating request object failed", err.Error())
-		return nil, nil
+		req, err := http.NewRequest(r.Config.Method, urlStr, bd)
+		if err != nil {
+			r.log().Error("creating request object failed", err.Error())
+			return variables, err
+		}
+		req.Header = headers
+		session.SeedCookies(req.URL, variables)
+		if err = r.Config.Signing.Sign(req, bt, time.Now()); err != nil {
+			r.log().Error("signing request failed", err.Error())
+			r.GetStat(r.workerId).IncrOtherErrors(1)
+			return variables, ErrRequestFailed
+		}
+		if r.trace.request(r, req.Method, req.URL.String(), req.Header, bt) {
+			return r.done(nil, r.placeholders(variables), nil, nil)
+		}
+		if r.Config.Capture.HasRoom() {
+			dump = r.Config.Capture.Begin(req, bt, variableValues(variables))
+		}
+		if r.Config.Stream != nil {
+			bodyResponse, statusCode, reqErr = r.sendStream(req, time.Second*time.Duration(r.Config.MaxTimeout), session, dump)
+		} else {
+			bodyResponse, statusCode, reqErr = r.sendRequest(req, time.Second*time.Duration(r.Config.MaxTimeout), session, dump)
+		}
+	}
+	if r.Config.Protocol != config.ProtocolHttp {
+		r.trace.status(r, statusCode)
+	}
+	variables = variable.Merge(variables, variable.VariableMap{
+		variable.VarStatus: &variable.VariableEntry{Type: variable.VarNumber, Value: strconv.Itoa(statusCode)},
+	})
+	if r.Config.Protocol == config.ProtocolWebsocket {
+		variables = variable.Merge(variables, replyVariables)
+		if reqErr == nil && len(replyVariables) < len(r.Config.VariablesMap) {
+			reqErr = ErrExtractionFailed
+		}
+		return r.done(nil, variables, nil, reqErr)
+	}
+	if reqErr != nil && bodyResponse == nil {
+		return r.done(dump, variables, bodyResponse, reqErr)
 	}
-	req.Header = headers
-	variablesAnalyzed := &variable.VariableAnalysis{}
-	bodyResponse, err := r.sendRequest(req, time.Second*time.Duration(r.Config.MaxTimeout))
 	if r.Config.VariablesMap != nil {
-		variablesAnalyzed, err = variable.NewVariableAnalysis(r.Config.VariablesMap, string(bodyResponse), "json")
+		variablesAnalyzed, err := variable.NewVariableAnalysis(r.Config.VariablesMap, string(bodyResponse), "json")
 		if err != nil {
 			variablesAnalyzed = nil
 		}
+		var newVariables variable.VariableMap
 		if variablesAnalyzed != nil {
-			var newVariables = variablesAnalyzed.Extract()
+			variablesAnalyzed.SetLogger(r.log())
+			newVariables = variablesAnalyzed.Extract()
 			variables = variable.Merge(variables, newVariables)
 		}
+		if reqErr == nil && len(newVariables) < len(r.Config.VariablesMap) {
+			reqErr = ErrExtractionFailed
+		}
 	}
-	return variables, nil
+	return r.done(dump, variables, bodyResponse, reqErr)
 }
 
-func (r *RequestWorker) sendRequest(req *http.Request, tout time.Duration) ([]byte, error) {
+// sendRequest sends the request and records its stats, it returns the body
+// and the status code of the response. If the response is received but
+// fails the assertions, both the body and ErrAssertionFailed are returned.
+// The response is set on the dump, which is nil without a capture.
+func (r *RequestWorker) sendRequest(req *http.Request, tout time.Duration, session *Session, dump *capture.Dump) ([]byte, int, error) {
 	tn := time.Now()
-	resp, err := GetHttpClient(tout).Do(req)
+	var jar http.CookieJar
+	if session != nil {
+		jar = session.Jar
+	}
+	resp, doErr := r.env.httpClient(tout, jar).Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
+		dump.SetResponse(resp.StatusCode, resp.Header)
+		r.trace.status(r, resp.StatusCode)
 	}
-	err = r.HandleResponse(r.workerId, resp, err)
+	err := r.HandleResponse(r.workerId, resp, doErr)
 
 	if err != nil {
-		logger.Error("request failed", err.Error())
-		return nil, errors.New("failed")
+		var statusCode int
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		r.log().Error("request failed", err.Error())
+		if statusCode == 504 {
+			return nil, statusCode, ErrTimeout
+		}
+		return nil, statusCode, requestError(doErr)
 	} else if resp == nil {
-		logger.Error("request failed", "no error and no response")
-		return nil, errors.New("failed")
+		r.log().Error("request failed", "no error and no response")
+		return nil, 0, requestError(doErr)
 	}
+	// each response is asserted on a copy of the assertions of its own
+	var asserts = r.Config.Assertions.Clone()
 	bodyData, err := ioutil.ReadAll(resp.Body)
+	var assertErr error
 	{
 		// assertions on response
-		if r.Config.Assertions != nil && r.Config.Assertions.Exists(assertions.AssertBodyString) {
+		if asserts != nil && asserts.Exists(assertions.AssertBodyString) {
 
 			if err != nil {
-				logger.Error("failed to read body of response", err)
+				r.log().Error("failed to read body of response", err)
 				r.GetStat(r.workerId).IncrOtherErrors(1)
-				return nil, errors.New("failed")
+				return nil, resp.StatusCode, ErrRequestFailed
 			}
-			_ = r.Config.Assertions.Get(assertions.AssertBodyString).SetInput(bodyData)
+			_ = asserts.Get(assertions.AssertBodyString).SetInput(bodyData)
+		}
+		_ = asserts.Get(assertions.AssertStatusIsOk).SetTest(resp.StatusCode)
+		if asserts.Exists(assertions.AssertContentType) {
+			_ = asserts.Get(assertions.AssertContentType).SetInput(resp.Header.Get("Content-Type"))
 		}
-		_ = r.Config.Assertions.Get(assertions.AssertStatusIsOk).SetTest(resp.StatusCode)
-		if err := r.Config.Assertions.ChainRunner(assertions.AssertStatusIsOk, assertions.AssertBodyString); err == nil {
+		err := asserts.ChainRunner(assertions.AssertStatusIsOk, assertions.AssertContentType, assertions.AssertBodyString)
+		r.trace.assertions(asserts, assertions.AssertStatusIsOk, assertions.AssertContentType, assertions.AssertBodyString)
+		if err == nil && r.Config.Graphql != nil {
+			err = graphqlErrors(bodyData, r.log())
+		}
+		if err == nil {
 			r.GetStat(r.workerId).IncrSuccess(1)
 		} else if resp.StatusCode != 200 && resp.StatusCode != 201 {
 			r.GetStat(r.workerId).IncrFailed(resp.StatusCode, 1)
+			assertErr = ErrAssertionFailed
 		} else {
 			r.GetStat(r.workerId).IncrOtherErrors(1)
+			assertErr = ErrAssertionFailed
 		}
 	}
 
+	r.recordDurations(tn, resp.Header)
+	return bodyData, resp.StatusCode, assertErr
+}
+
+// records the duration of a request started at tn, with the execution
+// duration and the cache usage the server tells by the response headers
+func (r *RequestWorker) recordDurations(tn time.Time, header http.Header) {
 	var cacheUsed = int64(0)
 	if r.Config.CacheUsageHeaderName != "" {
-		if resp.Header.Get(r.Config.CacheUsageHeaderName) == "1" {
+		if header.Get(r.Config.CacheUsageHeaderName) == "1" {
 			cacheUsed = int64(1)
 		}
 	}
 	dur := time.Since(tn)
 	var appExecDure time.Duration
 	if r.Config.ExecDurationHeaderName != "" {
-		durStr := resp.Header.Get(r.Config.ExecDurationHeaderName)
+		durStr := header.Get(r.Config.ExecDurationHeaderName)
 		if durStr != "" {
-			appExecDure, err = time.ParseDuration(durStr)
-			if err != nil {
+			var err error
+			if appExecDure, err = time.ParseDuration(durStr); err != nil {
 				appExecDure = 0
 			}
 		}
@@ -279,17 +401,16 @@ func (r *RequestWorker) sendRequest(req *http.Request, tout time.Duration) ([]by
 	r.GetStat(r.workerId).AddMainDuration(dur)
 	r.GetStat(r.workerId).AddLongestDuration(dur)
 	r.GetStat(r.workerId).AddShortestDuration(dur)
-	return bodyData, nil
 }
 
 func (r *RequestWorker) HandleResponse(profileName string, resp *http.Response, err interface{}) error {
 	if err != nil || resp == nil {
 		if ve, ok := err.(net.Error); ok && ve.Timeout() {
 			r.GetStat(profileName).IncrTimeout(1)
-			logger.Error("request timeout", "["+profileName+"]"+ve.Error())
+			r.log().Error("request timeout", "["+profileName+"]"+ve.Error())
 		} else if ve, ok := err.(net.Error); ok && !ve.Timeout() {
 			r.GetStat(profileName).IncrOtherErrors(1)
-			logger.Error("request timeout", "["+profileName+"]"+ve.Error())
+			r.log().Error("request timeout", "["+profileName+"]"+ve.Error())
 		} else if ve, ok := err.(*valkyrie.MultiError); ok {
 			errStr := ve.Error()
 			if err := ve.HasError(); strings.Contains(errStr, "context deadline exceeded") {
@@ -326,6 +447,11 @@ func (r *RequestWorker) AddStat(name string, s *stats.StatsCollector) {
 	r.Stats.Add(name, s)
 }
 
+// Stat returns the stats of the worker's own target
+func (r *RequestWorker) Stat() *stats.StatsCollector {
+	return r.GetStat(r.workerId)
+}
+
 func (r *RequestWorker) GetStat(name string) *stats.StatsCollector {
 	r.Lock.Lock()
 	defer r.Lock.Unlock()
@@ -373,5 +499,6 @@ func (r *RequestWorker) MergeAll() stats.StatsCollector {
 	})
 	totalStats.CalculateAverage()
 	totalStats.CalculateExecAverageDuration()
+	totalStats.CalculateThinkAverageDuration()
 	return totalStats
 }
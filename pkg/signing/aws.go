@@ -0,0 +1,97 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const awsAlgorithm = "AWS4-HMAC-SHA256"
+
+// signs the request by aws signature version 4: the host and the x-amz-
+// headers are signed, s3 requests have the hash of their body in
+// x-amz-content-sha256 too
+func (c *Config) signAws(req *http.Request, body []byte, now time.Time) error {
+	var amzDate = now.UTC().Format("20060102T150405Z")
+	var date = amzDate[:8]
+	var payloadHash = hashHex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.Service == DefaultAwsService {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	var names = []string{"host"}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + headerValue(req, name) + "\n")
+	}
+	var signedHeaders = strings.Join(names, ";")
+	var canonicalRequest = strings.Join([]string{
+		req.Method,
+		canonicalPath(req),
+		canonicalQuery(req),
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	var scope = date + "/" + c.Region + "/" + c.Service + "/aws4_request"
+	var stringToSign = awsAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+	var key = hmacSha256([]byte("AWS4"+c.SecretKey), date)
+	for _, part := range []string{c.Region, c.Service, "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	var signature = hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", awsAlgorithm+" Credential="+c.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+// the query of the request sorted by its keys and values, each one
+// encoded as rfc 3986 says
+func canonicalQuery(req *http.Request) string {
+	var query = req.URL.Query()
+	var keys = make([]string, 0, len(query))
+	var encoded = make(map[string]string, len(query))
+	for key := range query {
+		encoded[key] = uriEncode(key)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return encoded[keys[i]] < encoded[keys[j]] })
+	var pairs = make([]string, 0, len(query))
+	for _, key := range keys {
+		var values = make([]string, 0, len(query[key]))
+		for _, value := range query[key] {
+			values = append(values, uriEncode(value))
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, encoded[key]+"="+value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	var mac = hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,175 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// types of signing
+const (
+	TypeHmac      = "hmac"
+	TypeAwsSigV4  = "aws-sigv4"
+	EncodingHex   = "hex"
+	EncodingB64   = "base64"
+	DefaultHeader = "X-Signature"
+	// the header of the timestamp of hmac signatures, in unix seconds
+	DefaultTimestampHeader = "X-Timestamp"
+	DefaultAwsService      = "s3"
+)
+
+// parts of the canonical string of hmac signatures
+const (
+	PartMethod    = "method"
+	PartPath      = "path"
+	PartQuery     = "query"
+	PartHeaders   = "headers"
+	PartBodyHash  = "body-hash"
+	PartTimestamp = "timestamp"
+)
+
+// the canonical string of hmac signatures, when it is not given
+var DefaultCanonical = []string{PartMethod, PartPath, PartQuery, PartHeaders, PartBodyHash, PartTimestamp}
+
+// Config is how the requests of a target are signed
+type Config struct {
+	Type string
+	// hmac: the key, the header of the signature and of the timestamp,
+	// the parts of the canonical string in their order, the headers it
+	// has and the encoding of the signature (hex or base64)
+	Key             []byte
+	Header          string
+	TimestampHeader string
+	Canonical       []string
+	Headers         []string
+	Encoding        string
+	// aws-sigv4
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+}
+
+// Validate checks the config and sets its defaults
+func (c *Config) Validate() error {
+	switch c.Type {
+	case TypeHmac:
+		if len(c.Key) == 0 {
+			return errors.New("signing.key or signing.key-file is needed by hmac")
+		}
+		if c.Header == "" {
+			c.Header = DefaultHeader
+		}
+		if c.TimestampHeader == "" {
+			c.TimestampHeader = DefaultTimestampHeader
+		}
+		if len(c.Canonical) == 0 {
+			c.Canonical = DefaultCanonical
+		}
+		for _, part := range c.Canonical {
+			switch part {
+			case PartMethod, PartPath, PartQuery, PartHeaders, PartBodyHash, PartTimestamp:
+			default:
+				return errors.New("signing.canonical must be made of: method, path, query, headers, body-hash, timestamp")
+			}
+		}
+		switch c.Encoding {
+		case "":
+			c.Encoding = EncodingHex
+		case EncodingHex, EncodingB64:
+		default:
+			return errors.New("signing.encoding must be one of: hex, base64")
+		}
+	case TypeAwsSigV4:
+		if c.AccessKey == "" || c.SecretKey == "" {
+			return errors.New("signing.access-key and signing.secret-key are needed by aws-sigv4")
+		}
+		if c.Region == "" {
+			return errors.New("signing.region is needed by aws-sigv4")
+		}
+		if c.Service == "" {
+			c.Service = DefaultAwsService
+		}
+	default:
+		return errors.New("signing.type must be one of: hmac, aws-sigv4")
+	}
+	return nil
+}
+
+// Sign signs the request, whose body is body, as it is at now. It must
+// be the final request, the headers which are signed must not change.
+func (c *Config) Sign(req *http.Request, body []byte, now time.Time) error {
+	if c == nil {
+		return nil
+	}
+	if c.Type == TypeAwsSigV4 {
+		return c.signAws(req, body, now)
+	}
+	var timestamp = strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(c.TimestampHeader, timestamp)
+	var mac = hmac.New(sha256.New, c.Key)
+	mac.Write([]byte(c.canonicalString(req, body, timestamp)))
+	var signature = mac.Sum(nil)
+	if c.Encoding == EncodingB64 {
+		req.Header.Set(c.Header, base64.StdEncoding.EncodeToString(signature))
+	} else {
+		req.Header.Set(c.Header, hex.EncodeToString(signature))
+	}
+	return nil
+}
+
+// the parts of the canonical string of an hmac signature, one per
+// line; the headers are lines of their lower-cased names and values
+func (c *Config) canonicalString(req *http.Request, body []byte, timestamp string) string {
+	var lines = make([]string, 0, len(c.Canonical)+len(c.Headers))
+	for _, part := range c.Canonical {
+		switch part {
+		case PartMethod:
+			lines = append(lines, req.Method)
+		case PartPath:
+			lines = append(lines, canonicalPath(req))
+		case PartQuery:
+			lines = append(lines, canonicalQuery(req))
+		case PartHeaders:
+			for _, name := range c.Headers {
+				lines = append(lines, strings.ToLower(name)+":"+headerValue(req, name))
+			}
+		case PartBodyHash:
+			lines = append(lines, hashHex(body))
+		case PartTimestamp:
+			lines = append(lines, timestamp)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func canonicalPath(req *http.Request) string {
+	if p := req.URL.EscapedPath(); p != "" {
+		return p
+	}
+	return "/"
+}
+
+// the value of a header of the request, host is taken from the url
+// when it is not set; spaces are trimmed and joined
+func headerValue(req *http.Request, name string) string {
+	if strings.EqualFold(name, "host") {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	return strings.Join(strings.Fields(strings.Join(req.Header.Values(name), ",")), " ")
+}
+
+func hashHex(b []byte) string {
+	var sum = sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
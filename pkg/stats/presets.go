@@ -13,4 +13,18 @@ var DefaultPresetWithAutoFailedCodes = map[string]string{
 	LongestExecDuration:  "Longest App Execution",
 	MaxConcurrencyAchieved:  "Max Concurrency Achieved",
 	OtherErrors:  "Other Errors",
+	Skipped:  "Skipped (when)",
+	ThinkDuration:  "Total Think Time",
+	AverageThinkDuration:  "Average Think Time",
+	AverageWsConnectDuration:  "Average WebSocket Connect",
+	AverageWsRoundTripDuration:  "Average WebSocket Round Trip",
+	WsMessagesSent:  "WebSocket Messages Sent",
+	WsMessagesReceived:  "WebSocket Messages Received",
+	WsAbnormalClosures:  "WebSocket Abnormal Closures",
+	AverageStreamFirstEventDuration:  "Average Time to First Event",
+	AverageStreamEventGapDuration:  "Average Gap Between Events",
+	LongestStreamEventGapDuration:  "Longest Gap Between Events",
+	StreamEvents:  "Total Stream Events",
+	AverageStreamDuration:  "Average Stream Duration",
+	Retries:  "Total Retries",
 }
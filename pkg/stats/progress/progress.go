@@ -3,7 +3,9 @@ package progress
 import (
 	"fmt"
 	"go.uber.org/atomic"
+	"io"
 	"math"
+	"os"
 	"sync"
 )
 
@@ -12,6 +14,8 @@ type ProgressIndicator struct {
 	Lock              *sync.Mutex
 	Total             int64
 	listenIncr        atomic.Int64
+	// the progress is printed here, stdout when it is nil
+	Out io.Writer
 }
 
 func NewProgressIndicator(total int64) *ProgressIndicator {
@@ -57,13 +61,20 @@ func (p *ProgressIndicator) Print(current int64) {
 		if percent == 0 {
 			return
 		} else if percent == int8(100) {
-			fmt.Printf("==%v%v [%v completed!]", "%", percent, p.Total)
+			fmt.Fprintf(p.out(), "==%v%v [%v completed!]", "%", percent, p.Total)
 		} else {
-			fmt.Printf("==%v%v==", "%", percent)
+			fmt.Fprintf(p.out(), "==%v%v==", "%", percent)
 		}
 	})
 }
 
+func (p *ProgressIndicator) out() io.Writer {
+	if p.Out == nil {
+		return os.Stdout
+	}
+	return p.Out
+}
+
 func (p *ProgressIndicator) ListenToChannel(ch chan int8) {
 	for _ = range ch {
 		p.listenIncr.Add(1)
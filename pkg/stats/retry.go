@@ -0,0 +1,20 @@
+package stats
+
+// IncrRetries counts the attempts of requests after their first one,
+// each attempt is counted by the other stats as a request too
+func (s *StatsCollector) IncrRetries(incr int64) {
+	s.incr(Retries, incr)
+}
+
+// AddRetriedRequest records the outcome of a request of a target with a
+// retry policy: whether its first attempt succeeded, and whether it
+// succeeded at last
+func (s *StatsCollector) AddRetriedRequest(firstSuccess, finalSuccess bool) {
+	s.incr(RetryRequests, 1)
+	if firstSuccess {
+		s.incr(FirstAttemptSuccess, 1)
+	}
+	if finalSuccess {
+		s.incr(FinalSuccess, 1)
+	}
+}
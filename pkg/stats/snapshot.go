@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"time"
+)
+
+// Snapshot is a copy of the params of a collector which can be sent as
+// json, agents send the snapshots of their targets to the coordinator
+type Snapshot struct {
+	Key       string                   `json:"key"`
+	Counts    map[string]int64         `json:"counts,omitempty"`
+	Durations map[string]time.Duration `json:"durations,omitempty"`
+}
+
+// Snapshot returns a copy of the params of the collector, it is
+// safe to be taken while the requests of the target are sent
+func (s *StatsCollector) Snapshot() *Snapshot {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var sn = &Snapshot{Key: s.Key, Counts: make(map[string]int64), Durations: make(map[string]time.Duration)}
+	s.Params.Iterate(func(key string, value interface{}) {
+		switch v := value.(type) {
+		case int64:
+			sn.Counts[key] = v
+		case time.Duration:
+			sn.Durations[key] = v
+		}
+	})
+	return sn
+}
+
+// Collector returns a collector of the params of the snapshot,
+// to be merged with the collectors of the other snapshots
+func (sn *Snapshot) Collector() *StatsCollector {
+	var s = NewStatsManager(sn.Key)
+	for key, v := range sn.Counts {
+		s.Params.Add(key, v)
+	}
+	for key, v := range sn.Durations {
+		s.Params.Add(key, v)
+	}
+	return s
+}
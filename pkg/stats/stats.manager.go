@@ -4,8 +4,6 @@ import (
 	"fmt"
 	dyanmic_params "github.com/mostafatalebi/dynamic-params"
 	"github.com/mostafatalebi/loadtest/pkg/common"
-	"regexp"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -19,7 +17,12 @@ const (
 	Timeout                = "timeout"
 	ConnRefused            = "connection-refused"
 	OtherErrors            = "other-errors"
+	Skipped                = "skipped"
+	ThinkDuration          = "think-duration"
+	ThinkCount             = "think-count"
+	AverageThinkDuration   = "average-think-duration"
 	Failed                 = "%v"
+	FailedGrpc             = "grpc-%v"
 	MainDuration           = "main-duration"
 	ExecDuration           = "exec-duration"
 	LongestDuration        = "longest-duration"
@@ -28,11 +31,45 @@ const (
 	LongestExecDuration    = "longest-exec-duration"
 	AverageExecDuration    = "average-exec-duration"
 	ShortestExecDuration   = "shortest-exec-duration"
+	// stats of websocket targets
+	WsConnectDuration          = "ws-connect-duration"
+	WsConnectCount             = "ws-connect-count"
+	AverageWsConnectDuration   = "average-ws-connect-duration"
+	WsRoundTripDuration        = "ws-round-trip-duration"
+	WsRoundTripCount           = "ws-round-trip-count"
+	AverageWsRoundTripDuration = "average-ws-round-trip-duration"
+	WsMessagesSent             = "ws-messages-sent"
+	WsMessagesReceived         = "ws-messages-received"
+	WsAbnormalClosures         = "ws-abnormal-closures"
+	// stats of streaming responses
+	StreamFirstEventDuration        = "stream-first-event-duration"
+	StreamFirstEventCount           = "stream-first-event-count"
+	AverageStreamFirstEventDuration = "average-stream-first-event-duration"
+	StreamEventGapDuration          = "stream-event-gap-duration"
+	StreamEventGapCount             = "stream-event-gap-count"
+	AverageStreamEventGapDuration   = "average-stream-event-gap-duration"
+	LongestStreamEventGapDuration   = "longest-stream-event-gap-duration"
+	StreamDuration                  = "stream-duration"
+	StreamCount                     = "stream-count"
+	AverageStreamDuration           = "average-stream-duration"
+	StreamEvents                    = "stream-events"
+	// stats of targets with a retry policy
+	Retries             = "retries"
+	RetryRequests       = "retry-requests"
+	FirstAttemptSuccess = "first-attempt-success"
+	FinalSuccess        = "final-success"
 )
 
 var DefaultAllowedStatParams = []string{TargetCount, TotalSent, CacheUsed, Success, Timeout,
 	ConnRefused, OtherErrors, Failed, MainDuration, ExecDuration, LongestDuration, AverageDuration,
-	ShortestDuration, LongestExecDuration, AverageExecDuration, ShortestExecDuration,
+	ShortestDuration, LongestExecDuration, AverageExecDuration, ShortestExecDuration, Skipped,
+	ThinkDuration, ThinkCount, AverageThinkDuration,
+	WsConnectDuration, WsConnectCount, AverageWsConnectDuration, WsRoundTripDuration, WsRoundTripCount,
+	AverageWsRoundTripDuration, WsMessagesSent, WsMessagesReceived, WsAbnormalClosures,
+	StreamFirstEventDuration, StreamFirstEventCount, AverageStreamFirstEventDuration, StreamEventGapDuration,
+	StreamEventGapCount, AverageStreamEventGapDuration, LongestStreamEventGapDuration, StreamDuration,
+	StreamCount, AverageStreamDuration, StreamEvents,
+	Retries, RetryRequests, FirstAttemptSuccess, FinalSuccess,
 }
 
 type StatsCollector struct {
@@ -102,6 +139,13 @@ func (s *StatsCollector) GetConnRefused() int64 {
 	}
 	return v.(int64)
 }
+func (s *StatsCollector) GetSkipped() int64 {
+	v := s.Params.Get(Skipped)
+	if v == nil {
+		return 0
+	}
+	return v.(int64)
+}
 
 func (s *StatsCollector) IncrSuccess(incr int64) {
 	s.lock.Lock()
@@ -168,6 +212,19 @@ func (s *StatsCollector) IncrOtherErrors(incr int64) {
 	s.Params.Add(OtherErrors, v+incr)
 }
 
+func (s *StatsCollector) IncrSkipped(incr int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, err := s.Params.GetAsInt64(Skipped)
+	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
+		return
+	} else if err != nil && err.Error() == dyanmic_params.ErrNotFound {
+		s.Params.Add(Skipped, incr)
+		return
+	}
+	s.Params.Add(Skipped, v+incr)
+}
+
 func (s *StatsCollector) IncrTotalSent(incr int64) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -197,16 +254,26 @@ func (s *StatsCollector) UpdateMaxConcurrencyAchieved(currentValue int64) {
 }
 
 func (s *StatsCollector) IncrFailed(failureCode int, incr int64) {
+	s.incrFailed(fmt.Sprintf(Failed, failureCode), incr)
+}
+
+// IncrFailedGrpc counts a failed grpc status apart from the http
+// statuses, as its codes (0-16) would be mistaken for them
+func (s *StatsCollector) IncrFailedGrpc(statusCode int, incr int64) {
+	s.incrFailed(fmt.Sprintf(FailedGrpc, statusCode), incr)
+}
+
+func (s *StatsCollector) incrFailed(key string, incr int64) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	v, err := s.Params.GetAsInt64(fmt.Sprintf(Failed, failureCode))
+	v, err := s.Params.GetAsInt64(key)
 	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
 		return
 	} else if err != nil && err.Error() == dyanmic_params.ErrNotFound {
-		s.Params.Add(fmt.Sprintf(Failed, failureCode), incr)
+		s.Params.Add(key, incr)
 		return
 	}
-	s.Params.Add(fmt.Sprintf(Failed, failureCode), v+incr)
+	s.Params.Add(key, v+incr)
 }
 
 func (s *StatsCollector) AddMainDuration(duration time.Duration) {
@@ -269,9 +336,51 @@ func (s *StatsCollector) AddShortestDuration(duration time.Duration) {
 	}
 }
 
+// AddThinkDuration records a think time taken before a request, think
+// times are kept apart from the durations of the requests.
+func (s *StatsCollector) AddThinkDuration(duration time.Duration) {
+	s.addThink(duration, 1)
+}
+
+func (s *StatsCollector) addThink(duration time.Duration, count int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.Params.GetAsTimeDuration(ThinkDuration)
+	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
+		return
+	} else if err != nil && err.Error() == dyanmic_params.ErrNotFound {
+		s.Params.Add(ThinkDuration, duration)
+	} else {
+		s.Params.Add(ThinkDuration, *r+duration)
+	}
+	v, err := s.Params.GetAsInt64(ThinkCount)
+	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
+		return
+	} else if err != nil && err.Error() == dyanmic_params.ErrNotFound {
+		s.Params.Add(ThinkCount, count)
+		return
+	}
+	s.Params.Add(ThinkCount, v+count)
+}
+
+func (s *StatsCollector) CalculateThinkAverageDuration() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rCount, err := s.Params.GetAsInt64(ThinkCount)
+	if err != nil || rCount == 0 {
+		return
+	}
+	rDur, err := s.Params.GetAsTimeDuration(ThinkDuration)
+	if err != nil || rDur == nil {
+		return
+	}
+	s.Params.Add(AverageThinkDuration, time.Duration(rDur.Nanoseconds()/rCount))
+}
+
 func (s *StatsCollector) CalculateAverage() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	s.calculateAverageDurations()
 	rSuccess, err := s.Params.GetAsInt64(Success)
 	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
 		return
@@ -335,6 +444,57 @@ func (s *StatsCollector) AddExecShortestDuration(duration time.Duration) {
 	}
 }
 
+func (s *StatsCollector) incr(key string, incr int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, err := s.Params.GetAsInt64(key)
+	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
+		return
+	} else if err != nil && err.Error() == dyanmic_params.ErrNotFound {
+		s.Params.Add(key, incr)
+		return
+	}
+	s.Params.Add(key, v+incr)
+}
+
+func (s *StatsCollector) addDuration(key string, duration time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.Params.GetAsTimeDuration(key)
+	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
+		return
+	} else if err != nil && err.Error() == dyanmic_params.ErrNotFound {
+		s.Params.Add(key, duration)
+		return
+	}
+	s.Params.Add(key, *r+duration)
+}
+
+// the averages of durations which are counted apart from the requests,
+// by their total durations and counts
+var averageDurations = map[string][2]string{
+	AverageWsConnectDuration:   {WsConnectDuration, WsConnectCount},
+	AverageWsRoundTripDuration: {WsRoundTripDuration, WsRoundTripCount},
+	AverageStreamFirstEventDuration: {StreamFirstEventDuration, StreamFirstEventCount},
+	AverageStreamEventGapDuration:   {StreamEventGapDuration, StreamEventGapCount},
+	AverageStreamDuration:           {StreamDuration, StreamCount},
+}
+
+// calculates the averages of averageDurations, the lock must be held
+func (s *StatsCollector) calculateAverageDurations() {
+	for average, keys := range averageDurations {
+		count, err := s.Params.GetAsInt64(keys[1])
+		if err != nil || count == 0 {
+			continue
+		}
+		dur, err := s.Params.GetAsTimeDuration(keys[0])
+		if err != nil || dur == nil {
+			continue
+		}
+		s.Params.Add(average, time.Duration(dur.Nanoseconds()/count))
+	}
+}
+
 func (s *StatsCollector) Copy() StatsCollector {
 	newStats := NewStatsManager(s.Key)
 	s.Params.Iterate(func(key string, value interface{}) {
@@ -349,6 +509,14 @@ func (s *StatsCollector) Merge(scp *StatsCollector) StatsCollector {
 		return *s
 	}
 	var sCopy = s.Copy()
+	// params which only exist in scp are copied as they are, after
+	// the existing ones are merged
+	var missing = make(map[string]interface{})
+	scp.Params.Iterate(func(key string, value interface{}) {
+		if !sCopy.Params.Has(key) {
+			missing[key] = value
+		}
+	})
 	sCopy.Params.Iterate(func(key string, origValue interface{}) {
 		if !scp.Params.Has(key) && !common.ExistsStrInArray(key, s.AllowedParams) {
 			return
@@ -356,10 +524,12 @@ func (s *StatsCollector) Merge(scp *StatsCollector) StatsCollector {
 
 		value := scp.Params.Get(key)
 
-		if m, err := regexp.Match(`^[0-9]+$`, []byte(key)); err == nil && m {
-			vv := value.(int64)
-			fcode, _ := strconv.Atoi(key)
-			sCopy.IncrFailed(fcode, vv)
+		if failedCode.MatchString(key) {
+			vv, ok := value.(int64)
+			if !ok {
+				return
+			}
+			sCopy.incrFailed(key, vv)
 			return
 		}
 		switch key {
@@ -426,17 +596,88 @@ func (s *StatsCollector) Merge(scp *StatsCollector) StatsCollector {
 				vv = 0
 			}
 			sCopy.IncrCacheUsed(vv)
+		case Skipped:
+			if value == nil {
+				value = 0
+			}
+			vv, ok := value.(int64)
+			if !ok {
+				vv = 0
+			}
+			sCopy.IncrSkipped(vv)
 		case ExecDuration:
-			vv := value.(time.Duration)
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
 			sCopy.AddExecDuration(vv)
 		case MainDuration:
-			vv := value.(time.Duration)
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
 			sCopy.AddMainDuration(vv)
+		case ShortestExecDuration:
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
+			sCopy.AddExecShortestDuration(vv)
+		case LongestExecDuration:
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
+			sCopy.AddExecLongestDuration(vv)
 		case ShortestDuration:
-			vv := value.(time.Duration)
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
 			sCopy.AddShortestDuration(vv)
+		case LongestDuration:
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
+			sCopy.AddLongestDuration(vv)
+		case ThinkDuration:
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
+			sCopy.addThink(vv, 0)
+		case ThinkCount:
+			vv, ok := value.(int64)
+			if !ok {
+				return
+			}
+			sCopy.addThink(0, vv)
+		case WsConnectCount, WsRoundTripCount, WsMessagesSent, WsMessagesReceived, WsAbnormalClosures,
+			StreamFirstEventCount, StreamEventGapCount, StreamCount, StreamEvents,
+			Retries, RetryRequests, FirstAttemptSuccess, FinalSuccess:
+			vv, ok := value.(int64)
+			if !ok {
+				return
+			}
+			sCopy.incr(key, vv)
+		case WsConnectDuration, WsRoundTripDuration, StreamFirstEventDuration, StreamEventGapDuration, StreamDuration:
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
+			sCopy.addDuration(key, vv)
+		case LongestStreamEventGapDuration:
+			vv, ok := value.(time.Duration)
+			if !ok {
+				return
+			}
+			sCopy.addLongestEventGap(vv)
 		}
 	})
+	for key, value := range missing {
+		sCopy.Params.Add(key, value)
+	}
 
 	return sCopy
 }
@@ -453,7 +694,7 @@ func (s *StatsCollector) PrintPretty(preset map[string]string) {
 		if !ok {
 			return
 		}
-		if m, err := regexp.Match(`^[0-9]+$`, []byte(key)); err == nil && m {
+		if failedCode.MatchString(key) {
 			fmt.Printf("--- Total Failed(%v) => %v \n", key, val)
 		}
 	})
@@ -0,0 +1,39 @@
+package stats
+
+import (
+	dyanmic_params "github.com/mostafatalebi/dynamic-params"
+	"time"
+)
+
+// AddStreamFirstEventDuration records the time from sending the request
+// of a stream to receiving its first event
+func (s *StatsCollector) AddStreamFirstEventDuration(duration time.Duration) {
+	s.addDuration(StreamFirstEventDuration, duration)
+	s.incr(StreamFirstEventCount, 1)
+}
+
+// AddStreamEventGap records the time between two events of a stream
+func (s *StatsCollector) AddStreamEventGap(duration time.Duration) {
+	s.addDuration(StreamEventGapDuration, duration)
+	s.incr(StreamEventGapCount, 1)
+	s.addLongestEventGap(duration)
+}
+
+// AddStream records a stream which is ended, with the time it
+// was read for and the number of its events
+func (s *StatsCollector) AddStream(duration time.Duration, events int64) {
+	s.addDuration(StreamDuration, duration)
+	s.incr(StreamCount, 1)
+	s.incr(StreamEvents, events)
+}
+
+func (s *StatsCollector) addLongestEventGap(duration time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, err := s.Params.GetAsTimeDuration(LongestStreamEventGapDuration)
+	if err != nil && err.Error() != dyanmic_params.ErrNotFound {
+		return
+	} else if err != nil || *r < duration {
+		s.Params.Add(LongestStreamEventGapDuration, duration)
+	}
+}
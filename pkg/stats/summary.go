@@ -0,0 +1,221 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Summary is a snapshot of the stats of a target, or of all targets of
+// a scenario, as it is saved in a result file. Durations are in
+// nanoseconds in json.
+type Summary struct {
+	Name                   string `json:"name"`
+	TotalSent              int64  `json:"total-sent"`
+	Success                int64  `json:"success"`
+	Timeout                int64  `json:"timeout"`
+	ConnRefused            int64  `json:"connection-refused"`
+	OtherErrors            int64  `json:"other-errors"`
+	Skipped                int64  `json:"skipped"`
+	CacheUsed              int64  `json:"cache-used"`
+	MaxConcurrencyAchieved int64  `json:"max-concurrency-achieved"`
+	// responses which failed the assertions, by their status codes
+	Failed               map[string]int64 `json:"failed,omitempty"`
+	AverageDuration      time.Duration    `json:"average-duration"`
+	ShortestDuration     time.Duration    `json:"shortest-duration"`
+	LongestDuration      time.Duration    `json:"longest-duration"`
+	AverageExecDuration  time.Duration    `json:"average-exec-duration,omitempty"`
+	ShortestExecDuration time.Duration    `json:"shortest-exec-duration,omitempty"`
+	LongestExecDuration  time.Duration    `json:"longest-exec-duration,omitempty"`
+	AverageThinkDuration time.Duration    `json:"average-think-duration,omitempty"`
+	// stats of websocket targets
+	AverageWsConnectDuration   time.Duration `json:"average-ws-connect-duration,omitempty"`
+	AverageWsRoundTripDuration time.Duration `json:"average-ws-round-trip-duration,omitempty"`
+	WsMessagesSent             int64         `json:"ws-messages-sent,omitempty"`
+	WsMessagesReceived         int64         `json:"ws-messages-received,omitempty"`
+	WsAbnormalClosures         int64         `json:"ws-abnormal-closures,omitempty"`
+	// stats of streaming responses
+	AverageStreamFirstEventDuration time.Duration `json:"average-stream-first-event-duration,omitempty"`
+	AverageStreamEventGapDuration   time.Duration `json:"average-stream-event-gap-duration,omitempty"`
+	LongestStreamEventGapDuration   time.Duration `json:"longest-stream-event-gap-duration,omitempty"`
+	AverageStreamDuration           time.Duration `json:"average-stream-duration,omitempty"`
+	StreamCount                     int64         `json:"stream-count,omitempty"`
+	StreamEvents                    int64         `json:"stream-events,omitempty"`
+	// stats of targets with a retry policy, the requests are counted once
+	// however many attempts they take
+	Retries             int64 `json:"retries,omitempty"`
+	RetryRequests       int64 `json:"retry-requests,omitempty"`
+	FirstAttemptSuccess int64 `json:"first-attempt-success,omitempty"`
+	FinalSuccess        int64 `json:"final-success,omitempty"`
+}
+
+var failedCode = regexp.MustCompile(`^(grpc-)?[0-9]+$`)
+
+// Summary returns a snapshot of the stats, named name
+func (s *StatsCollector) Summary(name string) *Summary {
+	var sm = &Summary{
+		Name:                            name,
+		TotalSent:                       s.getInt64(TotalSent),
+		Success:                         s.getInt64(Success),
+		Timeout:                         s.getInt64(Timeout),
+		ConnRefused:                     s.getInt64(ConnRefused),
+		OtherErrors:                     s.getInt64(OtherErrors),
+		Skipped:                         s.getInt64(Skipped),
+		CacheUsed:                       s.getInt64(CacheUsed),
+		MaxConcurrencyAchieved:          s.getInt64(MaxConcurrencyAchieved),
+		AverageDuration:                 s.getDuration(AverageDuration),
+		ShortestDuration:                s.getDuration(ShortestDuration),
+		LongestDuration:                 s.getDuration(LongestDuration),
+		AverageExecDuration:             s.getDuration(AverageExecDuration),
+		ShortestExecDuration:            s.getDuration(ShortestExecDuration),
+		LongestExecDuration:             s.getDuration(LongestExecDuration),
+		AverageThinkDuration:            s.getDuration(AverageThinkDuration),
+		AverageWsConnectDuration:        s.getDuration(AverageWsConnectDuration),
+		AverageWsRoundTripDuration:      s.getDuration(AverageWsRoundTripDuration),
+		WsMessagesSent:                  s.getInt64(WsMessagesSent),
+		WsMessagesReceived:              s.getInt64(WsMessagesReceived),
+		WsAbnormalClosures:              s.getInt64(WsAbnormalClosures),
+		AverageStreamFirstEventDuration: s.getDuration(AverageStreamFirstEventDuration),
+		AverageStreamEventGapDuration:   s.getDuration(AverageStreamEventGapDuration),
+		LongestStreamEventGapDuration:   s.getDuration(LongestStreamEventGapDuration),
+		AverageStreamDuration:           s.getDuration(AverageStreamDuration),
+		StreamCount:                     s.getInt64(StreamCount),
+		StreamEvents:                    s.getInt64(StreamEvents),
+		Retries:                         s.getInt64(Retries),
+		RetryRequests:                   s.getInt64(RetryRequests),
+		FirstAttemptSuccess:             s.getInt64(FirstAttemptSuccess),
+		FinalSuccess:                    s.getInt64(FinalSuccess),
+	}
+	s.Params.Iterate(func(key string, value interface{}) {
+		val, ok := value.(int64)
+		if ok && failedCode.MatchString(key) {
+			if sm.Failed == nil {
+				sm.Failed = make(map[string]int64)
+			}
+			sm.Failed[key] = val
+		}
+	})
+	return sm
+}
+
+func (s *StatsCollector) getInt64(key string) int64 {
+	if v, ok := s.Params.Get(key).(int64); ok {
+		return v
+	}
+	return 0
+}
+
+func (s *StatsCollector) getDuration(key string) time.Duration {
+	if v, ok := s.Params.Get(key).(time.Duration); ok {
+		return v
+	}
+	return 0
+}
+
+// EventsPerStream returns the average number of events of a stream
+func (sm *Summary) EventsPerStream() float64 {
+	if sm.StreamCount == 0 {
+		return 0
+	}
+	return float64(sm.StreamEvents) / float64(sm.StreamCount)
+}
+
+// FirstAttemptSuccessRate returns the percentage of the requests with a
+// retry policy which succeeded at their first attempt
+func (sm *Summary) FirstAttemptSuccessRate() float64 {
+	if sm.RetryRequests == 0 {
+		return 0
+	}
+	return float64(sm.FirstAttemptSuccess) * 100 / float64(sm.RetryRequests)
+}
+
+// FinalSuccessRate returns the percentage of the requests with a retry
+// policy which succeeded, at any attempt
+func (sm *Summary) FinalSuccessRate() float64 {
+	if sm.RetryRequests == 0 {
+		return 0
+	}
+	return float64(sm.FinalSuccess) * 100 / float64(sm.RetryRequests)
+}
+
+// Errors returns the number of requests which have not succeeded:
+// failed assertions, timeouts, refused connections and other errors
+func (sm *Summary) Errors() int64 {
+	var errs = sm.Timeout + sm.ConnRefused + sm.OtherErrors
+	for _, v := range sm.Failed {
+		errs += v
+	}
+	return errs
+}
+
+// ErrorRate returns the percentage of the sent requests which
+// have not succeeded
+func (sm *Summary) ErrorRate() float64 {
+	if sm.TotalSent == 0 {
+		return 0
+	}
+	return float64(sm.Errors()) * 100 / float64(sm.TotalSent)
+}
+
+// Fprint writes the summary the way PrintPretty prints the stats
+func (sm *Summary) Fprint(w io.Writer) {
+	fmt.Fprintln(w, "\n======== "+sm.Name+" ========")
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[TotalSent], sm.TotalSent)
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[Success], sm.Success)
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[Timeout], sm.Timeout)
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[ConnRefused], sm.ConnRefused)
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[OtherErrors], sm.OtherErrors)
+	if sm.Skipped > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[Skipped], sm.Skipped)
+	}
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageDuration], sm.AverageDuration)
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[ShortestDuration], sm.ShortestDuration)
+	fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[LongestDuration], sm.LongestDuration)
+	if sm.AverageExecDuration > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageExecDuration], sm.AverageExecDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[ShortestExecDuration], sm.ShortestExecDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[LongestExecDuration], sm.LongestExecDuration)
+	}
+	if sm.AverageThinkDuration > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageThinkDuration], sm.AverageThinkDuration)
+	}
+	if sm.AverageWsConnectDuration > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageWsConnectDuration], sm.AverageWsConnectDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageWsRoundTripDuration], sm.AverageWsRoundTripDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[WsMessagesSent], sm.WsMessagesSent)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[WsMessagesReceived], sm.WsMessagesReceived)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[WsAbnormalClosures], sm.WsAbnormalClosures)
+	}
+	if sm.StreamCount > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageStreamFirstEventDuration], sm.AverageStreamFirstEventDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageStreamEventGapDuration], sm.AverageStreamEventGapDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[LongestStreamEventGapDuration], sm.LongestStreamEventGapDuration)
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[StreamEvents], sm.StreamEvents)
+		fmt.Fprintf(w, "--- Events per Stream => %.2f \n", sm.EventsPerStream())
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[AverageStreamDuration], sm.AverageStreamDuration)
+	}
+	if sm.RetryRequests > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[Retries], sm.Retries)
+		fmt.Fprintf(w, "--- First Attempt Success Rate => %.2f%% \n", sm.FirstAttemptSuccessRate())
+		fmt.Fprintf(w, "--- Final Success Rate => %.2f%% \n", sm.FinalSuccessRate())
+	}
+	if sm.MaxConcurrencyAchieved > 0 {
+		fmt.Fprintf(w, "--- %v => %v \n", DefaultPresetWithAutoFailedCodes[MaxConcurrencyAchieved], sm.MaxConcurrencyAchieved)
+	}
+	var codes = make([]string, 0, len(sm.Failed))
+	for code := range sm.Failed {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "--- Total Failed(%v) => %v \n", code, sm.Failed[code])
+	}
+}
+
+// Print prints the summary to stdout
+func (sm *Summary) Print() {
+	sm.Fprint(os.Stdout)
+}
@@ -0,0 +1,33 @@
+package stats
+
+import (
+	"time"
+)
+
+// AddWsConnectDuration records the time a websocket connection took
+// to be opened, its handshake included
+func (s *StatsCollector) AddWsConnectDuration(duration time.Duration) {
+	s.addDuration(WsConnectDuration, duration)
+	s.incr(WsConnectCount, 1)
+}
+
+// AddWsRoundTripDuration records the time from sending a message of a
+// websocket script to receiving the reply it expects
+func (s *StatsCollector) AddWsRoundTripDuration(duration time.Duration) {
+	s.addDuration(WsRoundTripDuration, duration)
+	s.incr(WsRoundTripCount, 1)
+}
+
+func (s *StatsCollector) IncrWsMessagesSent(incr int64) {
+	s.incr(WsMessagesSent, incr)
+}
+
+func (s *StatsCollector) IncrWsMessagesReceived(incr int64) {
+	s.incr(WsMessagesReceived, incr)
+}
+
+// IncrWsAbnormalClosures counts websocket connections which are lost, or
+// closed by the server with a code other than normal or going away
+func (s *StatsCollector) IncrWsAbnormalClosures(incr int64) {
+	s.incr(WsAbnormalClosures, incr)
+}
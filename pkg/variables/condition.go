@@ -0,0 +1,162 @@
+package variable
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+	OpGreaterEqual = ">="
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpLess         = "<"
+	OpContains     = "contains"
+	// unary operators, a condition like "$token" holds if the
+	// variable exists and is not empty, "!$token" is its negation
+	OpNotEmpty = "not-empty"
+	OpEmpty    = "empty"
+)
+
+// the order matters, two-char operators must be checked first
+var conditionOperators = []string{OpEqual, OpNotEqual, OpGreaterEqual, OpLessEqual, OpGreater, OpLess, " " + OpContains + " "}
+
+// Condition is a simple comparison between a variable and a value (or
+// another variable), like "$status == 200" or "$role != 'admin'".
+// Numbers are compared numerically, anything else as strings.
+type Condition struct {
+	Left     string
+	Operator string
+	Right    string
+	raw      string
+}
+
+func ParseCondition(s string) (*Condition, error) {
+	var raw = s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("condition cannot be empty")
+	}
+	if i, op := findOperator(s); i >= 0 {
+		left := strings.TrimSpace(s[:i])
+		right := strings.TrimSpace(s[i+len(op):])
+		if left == "" || right == "" {
+			return nil, errors.New(fmt.Sprintf("condition '%v' needs two operands", raw))
+		}
+		if j, _ := findOperator(right); j >= 0 {
+			return nil, errors.New(fmt.Sprintf("condition '%v' has more than one operator, quote an operand having one", raw))
+		}
+		return &Condition{
+			Left:     unquote(left),
+			Operator: strings.TrimSpace(op),
+			Right:    unquote(right),
+			raw:      raw,
+		}, nil
+	}
+	if strings.HasPrefix(s, "!") {
+		s = strings.TrimSpace(s[1:])
+		if !strings.HasPrefix(s, "$") {
+			return nil, errors.New(fmt.Sprintf("condition '%v' must be on a variable", raw))
+		}
+		return &Condition{Left: s, Operator: OpEmpty, raw: raw}, nil
+	}
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.New(fmt.Sprintf("condition '%v' must be on a variable", raw))
+	}
+	return &Condition{Left: s, Operator: OpNotEmpty, raw: raw}, nil
+}
+
+// returns the first operator of s which is not in a quoted operand,
+// and its index; the index is -1 if there is none
+func findOperator(s string) (int, string) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		if quote != 0 {
+			if s[i] == quote {
+				quote = 0
+			}
+			continue
+		}
+		if s[i] == '\'' || s[i] == '"' {
+			quote = s[i]
+			continue
+		}
+		for _, op := range conditionOperators {
+			if strings.HasPrefix(s[i:], op) {
+				return i, op
+			}
+		}
+	}
+	return -1, ""
+}
+
+func (c *Condition) String() string {
+	return c.raw
+}
+
+// Evaluate resolves both operands from the given variables (an operand
+// not starting with $ is taken as is, and a missing variable resolves
+// to an empty string) and compares them.
+func (c *Condition) Evaluate(vars VariableMap) bool {
+	left := resolveOperand(vars, c.Left)
+	switch c.Operator {
+	case OpNotEmpty:
+		return left != ""
+	case OpEmpty:
+		return left == ""
+	}
+	right := resolveOperand(vars, c.Right)
+	if c.Operator == OpContains {
+		return strings.Contains(left, right)
+	}
+	var cmp int
+	lf, lErr := strconv.ParseFloat(left, 64)
+	rf, rErr := strconv.ParseFloat(right, 64)
+	if lErr == nil && rErr == nil {
+		if lf < rf {
+			cmp = -1
+		} else if lf > rf {
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(left, right)
+	}
+	switch c.Operator {
+	case OpEqual:
+		return cmp == 0
+	case OpNotEqual:
+		return cmp != 0
+	case OpGreater:
+		return cmp > 0
+	case OpGreaterEqual:
+		return cmp >= 0
+	case OpLess:
+		return cmp < 0
+	case OpLessEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+func resolveOperand(vars VariableMap, operand string) string {
+	if !strings.HasPrefix(operand, "$") {
+		return operand
+	}
+	if vars == nil {
+		return ""
+	}
+	if v, ok := vars[operand]; ok && v != nil {
+		return v.Value
+	}
+	return ""
+}
+
+func unquote(s string) string {
+	if len(s) > 1 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
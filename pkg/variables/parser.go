@@ -1,14 +1,30 @@
 package variable
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
+// ReplaceVariables replaces the variables found in s with their values.
+// Longer names are replaced first, so $userId is not mistaken
+// for $user followed by "Id".
 func ReplaceVariables(vars VariableMap, s string) string {
 	if vars == nil {
 		return s
 	}
 
-	for k, v := range vars {
-		s = strings.Replace(s, k, v.Value, 1)
+	var names = make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+	for _, k := range names {
+		if vars[k] == nil {
+			continue
+		}
+		s = strings.Replace(s, k, vars[k].Value, 1)
 	}
 
 	return s
@@ -14,6 +14,12 @@ const (
 	VarNumber = "number"
 	VarArr    = "array"
 	VarObj    = "object"
+
+	// built-in variables, $status holds the status code of the
+	// last response in a chain and $index the index of the
+	// current item of a loop-over
+	VarStatus = "$status"
+	VarIndex  = "$index"
 )
 
 type VariableMap map[string]*VariableEntry
@@ -38,6 +44,13 @@ type VariableAnalysis struct {
 	content     string
 	parser      VariableParser
 	baseMap     VariableMap
+	// failed extractions are logged here, nil is the logger of logger.Configure
+	log *logger.Logger
+}
+
+// SetLogger sets where failed extractions are logged
+func (v *VariableAnalysis) SetLogger(log *logger.Logger) {
+	v.log = log
 }
 
 func NewVariableAnalysis(varMap VariableMap, content, contentType string) (*VariableAnalysis, error) {
@@ -64,43 +77,39 @@ func (v *VariableAnalysis) Extract() VariableMap {
 			case VarString:
 				vs, err := v.parser.ParseString(v.content, vv.Path)
 				if err != nil {
-					logger.Error("variable extraction failed", err.Error())
+					v.log.Error("variable extraction failed", err.Error())
 					continue
 				}
-				vv.Value = vs
-				ve[k] = vv
+				ve[k] = &VariableEntry{Type: vv.Type, Path: vv.Path, Value: vs}
 			case VarNumber:
 				vs, err := v.parser.ParseNumber(v.content, vv.Path)
 				if err != nil {
-					logger.Error("variable extraction failed", err.Error())
+					v.log.Error("variable extraction failed", err.Error())
 					continue
 				}
-				vv.Value = vs
-				ve[k] = vv
+				ve[k] = &VariableEntry{Type: vv.Type, Path: vv.Path, Value: vs}
 			case VarArr:
 				vs, err := v.parser.ParseArray(v.content, vv.Path)
 				if err != nil {
-					logger.Error("variable extraction failed", err.Error())
+					v.log.Error("variable extraction failed", err.Error())
 					continue
 				}
 				sv, err := json.Marshal(vs)
 				if err != nil {
 					sv = nil
 				}
-				vv.Value = string(sv)
-				ve[k] = vv
+				ve[k] = &VariableEntry{Type: vv.Type, Path: vv.Path, Value: string(sv)}
 			case VarObj:
 				vs, err := v.parser.ParseArray(v.content, vv.Path)
 				if err != nil {
-					logger.Error("variable extraction failed", err.Error())
+					v.log.Error("variable extraction failed", err.Error())
 					continue
 				}
 				sv, err := json.Marshal(vs)
 				if err != nil {
 					sv = nil
 				}
-				vv.Value = string(sv)
-				ve[k] = vv
+				ve[k] = &VariableEntry{Type: vv.Type, Path: vv.Path, Value: string(sv)}
 			}
 		}
 		return ve
@@ -108,6 +117,25 @@ func (v *VariableAnalysis) Extract() VariableMap {
 	return nil
 }
 
+// ArrayItems returns the items of an array variable (which is kept
+// as a JSON string), strings are returned as is and any other item
+// as its JSON text.
+func ArrayItems(value string) []string {
+	var items = make([]string, 0)
+	r := gjson.Parse(value)
+	if !r.IsArray() {
+		return items
+	}
+	for _, item := range r.Array() {
+		if item.Type == gjson.String {
+			items = append(items, item.String())
+		} else {
+			items = append(items, item.Raw)
+		}
+	}
+	return items
+}
+
 func Merge(vars VariableMap, otherVars VariableMap) VariableMap {
 	var newVars = make(VariableMap, 0)
 	if vars != nil {
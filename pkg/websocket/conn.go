@@ -0,0 +1,375 @@
+// Package websocket is a websocket client (RFC 6455) for the websocket
+// targets: it opens a connection, sends and reads text messages and closes
+// it, answering the pings of the server on the way.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the largest message which is read
+const MaxMessageSize = 4 << 20
+
+// opcodes of frames
+const (
+	OpContinuation = 0
+	OpText         = 1
+	OpBinary       = 2
+	OpClose        = 8
+	OpPing         = 9
+	OpPong         = 10
+)
+
+// close codes
+const (
+	CloseNormal    = 1000
+	CloseGoingAway = 1001
+	// no code is given by the close frame
+	CloseNoStatus = 1005
+	// the connection is lost without a close frame
+	CloseAbnormal = 1006
+)
+
+// the guid the accept key of the handshake is made with
+const acceptGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseError is returned by ReadMessage when the connection is closed,
+// Code is CloseAbnormal when it is lost without a close frame
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket closed with %v", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with %v: %v", e.Code, e.Text)
+}
+
+// Abnormal tells whether the connection is closed by an error,
+// rather than by a normal closure or the server going away
+func (e *CloseError) Abnormal() bool {
+	return e.Code != CloseNormal && e.Code != CloseGoingAway
+}
+
+// Conn is an open websocket connection
+type Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+	// the close frame of the server, once it is received
+	closed *CloseError
+	// a close frame is sent
+	closeSent bool
+	// Response is the response of the handshake
+	Response *http.Response
+}
+
+// Dial opens a connection to the url (ws:// or wss://) with the headers
+// of the handshake, timeout limits the dial and the handshake
+func Dial(urlStr string, header http.Header, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	var secure bool
+	switch u.Scheme {
+	case "ws", "http":
+	case "wss", "https":
+		secure = true
+	default:
+		return nil, fmt.Errorf("url scheme %v is not a websocket one, like ws or wss", u.Scheme)
+	}
+	var host = u.Host
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	var dialer = &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+	c := &Conn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.handshake(u, header); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// HandshakeError is returned by Dial when the server does not
+// switch to websocket, StatusCode is the status of its response
+type HandshakeError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket handshake failed: " + e.Message
+}
+
+func (c *Conn) handshake(u *url.URL, header http.Header) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	var key = base64.StdEncoding.EncodeToString(nonce[:])
+	// the handshake is an http request to the same url
+	var httpUrl = *u
+	httpUrl.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	req, err := http.NewRequest(http.MethodGet, httpUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(c.conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(c.reader, req)
+	if err != nil {
+		return err
+	}
+	c.Response = resp
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return &HandshakeError{StatusCode: resp.StatusCode, Message: "the response is " + resp.Status}
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return &HandshakeError{StatusCode: resp.StatusCode, Message: "the response does not upgrade to websocket"}
+	}
+	var sum = sha1.Sum([]byte(key + acceptGuid))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return &HandshakeError{StatusCode: resp.StatusCode, Message: "the response has a wrong Sec-WebSocket-Accept"}
+	}
+	return nil
+}
+
+// WriteMessage sends a message of the opcode, like OpText
+func (c *Conn) WriteMessage(op int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.closeSent {
+		return errors.New("websocket is closed")
+	}
+	if op == OpClose {
+		c.closeSent = true
+	}
+	return c.writeFrame(op, data)
+}
+
+// writes a single masked frame, as clients send them
+func (c *Conn) writeFrame(op int, data []byte) error {
+	var frame = make([]byte, 0, len(data)+14)
+	frame = append(frame, 0x80|byte(op))
+	switch {
+	case len(data) < 126:
+		frame = append(frame, 0x80|byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(data)))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(data)))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// SetReadDeadline sets the time by which the next message must be read,
+// a zero time means no deadline
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// ReadMessage reads the next text or binary message, joining its
+// fragments. Pings are answered and pongs are skipped. A *CloseError
+// is returned once the connection is closed.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	if c.closed != nil {
+		return 0, nil, c.closed
+	}
+	var op int
+	var message []byte
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, nil, err
+			}
+			c.closed = &CloseError{Code: CloseAbnormal, Text: err.Error()}
+			return 0, nil, c.closed
+		}
+		switch frameOp {
+		case OpPing:
+			c.writeLock.Lock()
+			if !c.closeSent {
+				err = c.writeFrame(OpPong, payload)
+			}
+			c.writeLock.Unlock()
+			if err != nil {
+				c.closed = &CloseError{Code: CloseAbnormal, Text: err.Error()}
+				return 0, nil, c.closed
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			c.closed = &CloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				c.closed.Code = int(binary.BigEndian.Uint16(payload))
+				c.closed.Text = string(payload[2:])
+			}
+			// the close frame of the server is echoed, unless
+			// it answers the one of the client
+			c.writeLock.Lock()
+			if !c.closeSent {
+				c.closeSent = true
+				_ = c.writeFrame(OpClose, payload[:minInt(len(payload), 2)])
+			}
+			c.writeLock.Unlock()
+			return 0, nil, c.closed
+		case OpContinuation:
+			if op == 0 {
+				return 0, nil, c.fail("a continuation frame has no message to continue")
+			}
+		case OpText, OpBinary:
+			if op != 0 {
+				return 0, nil, c.fail("a message is sent before the previous one is finished")
+			}
+			op = frameOp
+		default:
+			return 0, nil, c.fail(fmt.Sprintf("unknown opcode %v", frameOp))
+		}
+		if len(message)+len(payload) > MaxMessageSize {
+			return 0, nil, c.fail(fmt.Sprintf("a message has more than %v bytes", MaxMessageSize))
+		}
+		message = append(message, payload...)
+		if fin {
+			return op, message, nil
+		}
+	}
+}
+
+// closes the connection after a protocol error of the server
+func (c *Conn) fail(message string) error {
+	c.closed = &CloseError{Code: CloseAbnormal, Text: message}
+	c.conn.Close()
+	return c.closed
+}
+
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	var fin = head[0]&0x80 != 0
+	var op = int(head[0] & 0x0f)
+	var masked = head[1]&0x80 != 0
+	var size = uint64(head[1] & 0x7f)
+	switch size {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.reader, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.reader, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	}
+	if size > MaxMessageSize {
+		return false, 0, nil, fmt.Errorf("a frame has %v bytes, more than %v", size, MaxMessageSize)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	var payload = make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// Close closes the connection with the code: it sends a close frame and
+// waits up to timeout for the one of the server. The close of the server
+// is returned, it is abnormal when the server does not answer.
+func (c *Conn) Close(code int, timeout time.Duration) *CloseError {
+	defer c.conn.Close()
+	if c.closed != nil {
+		return c.closed
+	}
+	var payload = make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if err := c.WriteMessage(OpClose, payload); err != nil {
+		return &CloseError{Code: CloseAbnormal, Text: err.Error()}
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			if ce, ok := err.(*CloseError); ok {
+				return ce
+			}
+			return &CloseError{Code: CloseAbnormal, Text: err.Error()}
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
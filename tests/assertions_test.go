@@ -56,3 +56,29 @@ func TestAssertionsChainRunner_musSkipNonExistingAssertion(t *testing.T) {
 	err = ass.ChainRunner(assertions.AssertStatusIsOk, assertions.AssertBodyString)
 	assert.NoError(t, err)
 }
+
+func TestAssertionsCloneHasItsOwnInputs(t *testing.T) {
+	ass := assertions.NewAssertionManagerWithDefaults(nil)
+	assert.NoError(t, ass.Get(assertions.AssertStatusIsOk).SetTest(200))
+	clone := ass.Clone()
+	assert.NoError(t, clone.Get(assertions.AssertStatusIsOk).SetTest(503))
+	assert.Error(t, clone.ChainRunner(assertions.AssertStatusIsOk))
+	assert.NoError(t, ass.ChainRunner(assertions.AssertStatusIsOk))
+	// the accepted codes are kept by the clone
+	assert.NoError(t, clone.Get(assertions.AssertStatusIsOk).SetTest(201))
+	assert.NoError(t, clone.ChainRunner(assertions.AssertStatusIsOk))
+}
+
+func TestAssertionContentType(t *testing.T) {
+	asrt, err := assertions.ParseAssertion(assertions.AssertContentType, "application/json")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, asrt.SetInput("application/json; charset=utf-8"))
+	assert.NoError(t, asrt.Assert())
+	assert.NoError(t, asrt.SetInput("text/html"))
+	assert.EqualError(t, asrt.Assert(), "failed to assert that the content type 'text/html' is 'application/json'")
+
+	_, err = assertions.ParseAssertion(assertions.AssertContentType, " ")
+	assert.EqualError(t, err, "content-type needs a media type, like application/json")
+}
@@ -0,0 +1,343 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/auth"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a token url which gives a new token on each call, lasting expiresIn seconds
+func newTokenServer(issued *atomic.Int64, expiresIn int, forms chan<- *http.Request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if forms != nil {
+			forms <- r
+		}
+		fmt.Fprintf(w, `{"access_token": "token-%v", "token_type": "bearer", "expires_in": %v}`, issued.Inc(), expiresIn)
+	}))
+}
+
+// the claims of a jwt, once its signature is verified by verify
+func jwtClaims(t *testing.T, token string, verify func(signed string, signature []byte) error) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if !assert.Len(t, parts, 3) {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	assert.NoError(t, verify(parts[0]+"."+parts[1], signature))
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	var claims map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func TestOAuth2TokensAreSharedAndRenewed(t *testing.T) {
+	var issued = atomic.NewInt64(0)
+	var forms = make(chan *http.Request, 10)
+	srv := newTokenServer(issued, 1, forms)
+	defer srv.Close()
+
+	p, err := auth.New(&auth.Config{Type: auth.TypeOAuth2, TokenUrl: srv.URL, ClientId: "load", ClientSecret: "s3cret", Scope: "orders"})
+	assert.NoError(t, err)
+	var headers = http.Header{}
+	assert.NoError(t, p.Apply(headers))
+	assert.NoError(t, p.Apply(headers))
+	assert.Equal(t, "Bearer token-1", headers.Get("Authorization"))
+	assert.Equal(t, int64(1), issued.Load())
+	var form = <-forms
+	assert.Equal(t, "client_credentials", form.PostForm.Get("grant_type"))
+	assert.Equal(t, "orders", form.PostForm.Get("scope"))
+	id, secret, ok := form.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "load", id)
+	assert.Equal(t, "s3cret", secret)
+
+	// the token of a second is renewed at its half, in the background
+	time.Sleep(600 * time.Millisecond)
+	assert.NoError(t, p.Apply(headers))
+	assert.Equal(t, "Bearer token-1", headers.Get("Authorization"))
+	assert.Eventually(t, func() bool { return issued.Load() == 2 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return p.Apply(headers) == nil && headers.Get("Authorization") == "Bearer token-2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestValidTokenIsUsedWhileItsRenewalFails(t *testing.T) {
+	var fetches = atomic.NewInt64(0)
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Inc() == 1 {
+			fmt.Fprint(w, `{"access_token": "token-1", "expires_in": 2}`)
+			return
+		}
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer tokens.Close()
+
+	p, err := auth.New(&auth.Config{Type: auth.TypeOAuth2, TokenUrl: tokens.URL})
+	assert.NoError(t, err)
+	var headers = http.Header{}
+	assert.NoError(t, p.Apply(headers))
+
+	// the renewal is slow and fails, the requests do not wait for it
+	// and go on with the token until it expires
+	time.Sleep(1100 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		var start = time.Now()
+		assert.NoError(t, p.Apply(headers))
+		assert.Equal(t, "Bearer token-1", headers.Get("Authorization"))
+		assert.True(t, time.Since(start) < 100*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, int64(2), fetches.Load())
+
+	// once it is expired, the failure of the renewal is returned
+	time.Sleep(time.Second)
+	assert.Error(t, p.Apply(headers))
+}
+
+func TestOAuth2PasswordGrant(t *testing.T) {
+	var issued = atomic.NewInt64(0)
+	var forms = make(chan *http.Request, 1)
+	srv := newTokenServer(issued, 3600, forms)
+	defer srv.Close()
+
+	p, err := auth.New(&auth.Config{Type: auth.TypeOAuth2, TokenUrl: srv.URL, Grant: auth.GrantPassword,
+		ClientId: "load", ClientSecret: "s3cret", ClientAuth: auth.ClientAuthBody, Username: "ada", Password: "pw"})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Apply(http.Header{}))
+	var form = <-forms
+	assert.Equal(t, "password", form.PostForm.Get("grant_type"))
+	assert.Equal(t, "ada", form.PostForm.Get("username"))
+	assert.Equal(t, "pw", form.PostForm.Get("password"))
+	assert.Equal(t, "load", form.PostForm.Get("client_id"))
+	assert.Equal(t, "s3cret", form.PostForm.Get("client_secret"))
+	_, _, ok := form.BasicAuth()
+	assert.False(t, ok)
+}
+
+func TestJwtHS256IsMinted(t *testing.T) {
+	p, err := auth.New(&auth.Config{Type: auth.TypeJwt, Key: []byte("secret"), Ttl: time.Minute,
+		Claims: map[string]interface{}{"sub": "load-test", "roles": []interface{}{"admin"}}})
+	assert.NoError(t, err)
+	var headers = http.Header{}
+	assert.NoError(t, p.Apply(headers))
+	var token = strings.TrimPrefix(headers.Get("Authorization"), "Bearer ")
+	claims := jwtClaims(t, token, func(signed string, signature []byte) error {
+		var mac = hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("wrong signature")
+		}
+		return nil
+	})
+	assert.Equal(t, "load-test", claims["sub"])
+	assert.Equal(t, []interface{}{"admin"}, claims["roles"])
+	assert.Equal(t, float64(60), claims["exp"].(float64)-claims["iat"].(float64))
+
+	// the token is kept until it is about to expire
+	var again = http.Header{}
+	assert.NoError(t, p.Apply(again))
+	assert.Equal(t, headers.Get("Authorization"), again.Get("Authorization"))
+}
+
+func TestAuthOfTheTestIsAppliedToTargets(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issued = atomic.NewInt64(0)
+	tokens := newTokenServer(issued, 3600, nil)
+	defer tokens.Close()
+	var lock sync.Mutex
+	var seen = make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		seen[r.URL.Path] = append(seen[r.URL.Path], r.Header.Get("Authorization")+"|"+r.Header.Get("X-Api-Key"))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	dir, remove := writeTestConfigFiles(t, map[string]string{
+		"keys/private.pem": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"load.yml": `
+main:
+  concurrency: 2
+  request-count: 4
+auth:
+  type: oauth2
+  token-url: ` + tokens.URL + `
+  client-id: load
+  client-secret: s3cret
+targets:
+  orders:
+    url: ` + srv.URL + `/orders
+  signed:
+    url: ` + srv.URL + `/signed
+    auth:
+      type: jwt
+      algorithm: RS256
+      key-file: keys/private.pem
+      claims:
+        iss: load48
+  legacy:
+    url: ` + srv.URL + `/legacy
+    auth:
+      type: basic
+      username: ada
+      password: pw
+  keyed:
+    url: ` + srv.URL + `/keyed
+    auth:
+      type: api-key
+      key: k-123
+  public:
+    url: ` + srv.URL + `/public
+    auth:
+      type: none
+`,
+	})
+	defer remove()
+	configs, err := config.NewConfigYaml().LoadConfigs(filepath.Join(dir, "load.yml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+
+	// one token is fetched for all the requests
+	assert.Equal(t, int64(1), issued.Load())
+	assert.Equal(t, []string{"Bearer token-1|", "Bearer token-1|", "Bearer token-1|", "Bearer token-1|"}, seen["/orders"])
+	assert.Equal(t, "Basic YWRhOnB3|", seen["/legacy"][0])
+	assert.Equal(t, "|k-123", seen["/keyed"][0])
+	assert.Equal(t, "|", seen["/public"][0])
+	if assert.Len(t, seen["/signed"], 4) {
+		var token = strings.TrimSuffix(strings.TrimPrefix(seen["/signed"][0], "Bearer "), "|")
+		claims := jwtClaims(t, token, func(signed string, signature []byte) error {
+			var digest = sha256.Sum256([]byte(signed))
+			return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature)
+		})
+		assert.Equal(t, "load48", claims["iss"])
+	}
+}
+
+func TestAuthIsValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+auth:
+  type: oauth2
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+    auth:
+      type: kerberos
+  signed:
+    url: http://127.0.0.1/signed
+    auth:
+      type: jwt
+      algorithm: ES256
+      key: secret
+  ping:
+    protocol: tcp
+    url: tcp://127.0.0.1:7000
+    auth:
+      type: basic
+      username: ada
+`)
+	assert.Equal(t, []string{
+		"line 4: auth: auth.token-url is needed by oauth2",
+		"line 9: targets.orders: auth.type must be one of: oauth2, jwt, basic, api-key, none",
+		"line 13: targets.signed: auth.algorithm must be one of: HS256, RS256",
+		"line 20: targets.ping: auth is not used by tcp targets",
+	}, errs)
+}
+
+func TestFailedAuthFailsTheRequest(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid_client"}`))
+	}))
+	defer tokens.Close()
+	var hits = atomic.NewInt64(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+	}))
+	defer srv.Close()
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 3
+targets:
+  orders:
+    url: ` + srv.URL + `/orders
+    auth:
+      type: oauth2
+      token-url: ` + tokens.URL + `
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	var sm = lt.Result().Scenarios[0].Targets[0]
+	assert.Equal(t, int64(0), hits.Load())
+	assert.Equal(t, int64(3), sm.OtherErrors)
+	assert.Equal(t, int64(0), sm.Success)
+}
+
+func TestFailedTokenFetchIsNotRepeatedByEachRequest(t *testing.T) {
+	var fetches = atomic.NewInt64(0)
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Inc()
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer tokens.Close()
+
+	p, err := auth.New(&auth.Config{Type: auth.TypeOAuth2, TokenUrl: tokens.URL})
+	assert.NoError(t, err)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Error(t, p.Apply(http.Header{}))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), fetches.Load())
+
+	// the token is fetched again once the backoff is passed
+	time.Sleep(auth.DefaultFailureBackoff)
+	assert.Error(t, p.Apply(http.Header{}))
+	assert.Equal(t, int64(2), fetches.Load())
+}
@@ -0,0 +1,269 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/mostafatalebi/loadtest/pkg/capture"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readDumps(t *testing.T, file string) []*capture.Dump {
+	var dumps []*capture.Dump
+	for _, line := range readLogLines(t, file) {
+		var d capture.Dump
+		if assert.NoError(t, json.Unmarshal([]byte(line), &d)) {
+			dumps = append(dumps, &d)
+		}
+	}
+	return dumps
+}
+
+func TestFailedRequestsAreCaptured(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			w.Write([]byte(`{"token": "t-123"}`))
+			return
+		}
+		w.Header().Set("X-Trace", "abc")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "out of stock"}`))
+	}))
+	defer srv.Close()
+	var dir = tempLogDir(t)
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 5
+capture:
+  max-failures: 2
+  dir: ` + dir + `
+targets:
+  login:
+    url: ` + srv.URL + `/login
+    variables:
+      $token:
+        type: string
+        path: token
+  order:
+    url: ` + srv.URL + `/orders?id=7&t=$token&access_token=a-123
+    httpMethod: POST
+    headers:
+      authorization: Bearer $token
+    form-body: '{"item": 3}'
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+
+	// login never fails, the failures of order are capped
+	_, err = ioutil.ReadFile(filepath.Join(dir, "capture-login.jsonl"))
+	assert.Error(t, err)
+	var dumps = readDumps(t, filepath.Join(dir, "capture-order.jsonl"))
+	if !assert.Len(t, dumps, 2) {
+		return
+	}
+	var d = dumps[0]
+	assert.Equal(t, "order", d.Target)
+	assert.Equal(t, capture.CategoryAssertion, d.Category)
+	assert.Equal(t, http.MethodPost, d.Request.Method)
+	// the token is redacted, in the url, in its header and in its variable
+	assert.Equal(t, srv.URL+"/orders?id=7&t=[redacted]&access_token=[redacted]", d.Request.Url)
+	assert.Equal(t, capture.Redacted, d.Request.Header.Get("Authorization"))
+	assert.Equal(t, `{"item": 3}`, d.Request.Body)
+	assert.Equal(t, capture.Redacted, d.Variables["$token"])
+	if assert.NotNil(t, d.Response) {
+		assert.Equal(t, 500, d.Response.Status)
+		assert.Equal(t, "abc", d.Response.Header.Get("X-Trace"))
+		assert.Equal(t, `{"error": "out of stock"}`, d.Response.Body)
+	}
+}
+
+func TestCapturedBodiesAreTruncatedAndWrittenAsFiles(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var large = strings.Repeat("x", 3000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(large))
+	}))
+	defer srv.Close()
+	// a port nothing listens on
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var closed = ls.Addr().String()
+	ls.Close()
+	var dir = tempLogDir(t)
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 3
+  strategy: parallel
+targets:
+  upload:
+    url: ` + srv.URL + `/upload
+    form-body: ` + large + `
+    capture:
+      max-body: 1
+      format: files
+      dir: ` + dir + `
+  down:
+    url: http://` + closed + `/
+    capture:
+      format: files
+      dir: ` + dir + `
+      on: conn-refused
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(t, err)
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	assert.ElementsMatch(t, []string{
+		"capture-upload-assertion-1.json", "capture-upload-assertion-2.json", "capture-upload-assertion-3.json",
+		"capture-down-conn-refused-1.json", "capture-down-conn-refused-2.json", "capture-down-conn-refused-3.json",
+	}, files)
+
+	var d capture.Dump
+	b, err := ioutil.ReadFile(filepath.Join(dir, "capture-upload-assertion-1.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &d))
+	assert.Len(t, d.Request.Body, 1024)
+	assert.Equal(t, 3000, d.Request.BodySize)
+	assert.True(t, d.Request.Truncated)
+	assert.Len(t, d.Response.Body, 1024)
+	assert.True(t, d.Response.Truncated)
+
+	var refused capture.Dump
+	b, err = ioutil.ReadFile(filepath.Join(dir, "capture-down-conn-refused-1.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &refused))
+	assert.Equal(t, capture.CategoryConnRefused, refused.Category)
+	assert.Nil(t, refused.Response)
+}
+
+func TestCapturedSecretsAreRedacted(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s-1"})
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	var dir = tempLogDir(t)
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 1
+  strategy: parallel
+capture:
+  dir: ` + dir + `
+targets:
+  orders:
+    url: ` + srv.URL + `/orders?key=k-123&by=k-123
+    headers:
+      cookie: session=s-0
+      x-trace: abc
+    auth:
+      type: api-key
+      key: k-123
+      header: X-Orders-Key
+    signing:
+      type: hmac
+      key: secret
+      header: X-Orders-Signature
+  plain:
+    url: ` + srv.URL + `/plain
+    auth:
+      type: basic
+      username: admin
+      password: p-1
+    capture:
+      dir: ` + dir + `
+      redact: false
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+
+	var dumps = readDumps(t, filepath.Join(dir, "capture-orders.jsonl"))
+	if assert.Len(t, dumps, 1) {
+		var header = dumps[0].Request.Header
+		for _, name := range []string{"X-Orders-Key", "X-Orders-Signature", "Cookie"} {
+			assert.Equal(t, capture.Redacted, header.Get(name), name)
+		}
+		assert.Equal(t, "abc", header.Get("X-Trace"))
+		assert.NotEmpty(t, header.Get("X-Timestamp"))
+		assert.Equal(t, capture.Redacted, dumps[0].Response.Header.Get("Set-Cookie"))
+		assert.Equal(t, srv.URL+"/orders?key=[redacted]&by=[redacted]", dumps[0].Request.Url)
+	}
+	dumps = readDumps(t, filepath.Join(dir, "capture-plain.jsonl"))
+	if assert.Len(t, dumps, 1) {
+		assert.Equal(t, "Basic YWRtaW46cC0x", dumps[0].Request.Header.Get("Authorization"))
+		assert.Equal(t, "session=s-1", dumps[0].Response.Header.Get("Set-Cookie"))
+	}
+}
+
+func TestFullCapturerDumpsNoMoreRequests(t *testing.T) {
+	var c = capture.New(&capture.Config{MaxFailures: 1, Dir: tempLogDir(t), Format: capture.FormatJsonl,
+		On: []string{capture.CategoryTimeout, capture.CategoryFailed}}, "orders")
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1/orders", nil)
+	assert.NoError(t, err)
+	for _, category := range []string{capture.CategoryTimeout, capture.CategoryAssertion, capture.CategoryTimeout, capture.CategoryFailed} {
+		if assert.True(t, c.HasRoom()) {
+			assert.NoError(t, c.Save(c.Begin(req, nil, nil), category, errors.New(category), nil))
+		}
+	}
+	assert.False(t, c.HasRoom())
+	assert.Nil(t, c.Begin(req, nil, nil))
+}
+
+func TestCaptureIsValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+capture:
+  format: html
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+    capture:
+      on: [timeout, 5xx]
+  ping:
+    protocol: tcp
+    url: tcp://127.0.0.1:7000
+    capture:
+      max-failures: 3
+`)
+	assert.Equal(t, []string{
+		"line 4: capture: capture.format must be one of: jsonl, files",
+		"line 9: targets.orders: capture.on must be made of: timeout, conn-refused, assertion, extraction, failed",
+		"line 14: targets.ping: capture is only used by http targets",
+	}, errs)
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writes the yaml config into a temp file, and returns the file name
+// and a func to remove it
+func writeTestConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "load48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file = filepath.Join(dir, "config.yml")
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func loadTargetNames(t *testing.T, content string) ([]string, error) {
+	file, remove := writeTestConfig(t, content)
+	defer remove()
+	configs, err := config.NewConfigYaml().LoadConfigs(file)
+	if err != nil {
+		return nil, err
+	}
+	var names = make([]string, 0, len(configs))
+	for _, cc := range configs {
+		names = append(names, cc.TargetName)
+	}
+	return names, nil
+}
+
+const chainTestMain = `
+main:
+  concurrency: 1
+  request-count: 1
+  strategy: seq
+`
+
+func TestChainKeepsDocumentOrder(t *testing.T) {
+	var content = chainTestMain + `
+targets:
+  login:
+    url: http://127.0.0.1/login
+  getUser:
+    url: http://127.0.0.1/user
+  listOrders:
+    url: http://127.0.0.1/orders
+  getOrder:
+    url: http://127.0.0.1/order
+  logout:
+    url: http://127.0.0.1/logout
+`
+	for i := 0; i < 20; i++ {
+		names, err := loadTargetNames(t, content)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"login", "getUser", "listOrders", "getOrder", "logout"}, names)
+	}
+}
+
+func TestChainAsList(t *testing.T) {
+	names, err := loadTargetNames(t, chainTestMain+`
+targets:
+  - name: login
+    url: http://127.0.0.1/login
+  - name: getUser
+    url: http://127.0.0.1/user
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"login", "getUser"}, names)
+
+	_, err = loadTargetNames(t, chainTestMain+`
+targets:
+  - url: http://127.0.0.1/login
+`)
+	assert.Error(t, err)
+}
+
+func TestChainDependsOnAndNext(t *testing.T) {
+	names, err := loadTargetNames(t, chainTestMain+`
+targets:
+  getUser:
+    url: http://127.0.0.1/user
+    depends-on: login
+  getOrder:
+    url: http://127.0.0.1/order
+    depends-on: [getUser, listOrders]
+  listOrders:
+    url: http://127.0.0.1/orders
+    depends-on: login
+  login:
+    url: http://127.0.0.1/login
+    next: getUser
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"login", "getUser", "listOrders", "getOrder"}, names)
+
+	names, err = loadTargetNames(t, chainTestMain+`
+targets:
+  logout:
+    url: http://127.0.0.1/logout
+  login:
+    url: http://127.0.0.1/login
+    next: [logout]
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"login", "logout"}, names)
+}
+
+func TestChainInvalidDependencies(t *testing.T) {
+	_, err := loadTargetNames(t, chainTestMain+`
+targets:
+  login:
+    url: http://127.0.0.1/login
+    depends-on: getUser
+  getUser:
+    url: http://127.0.0.1/user
+    depends-on: login
+`)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cycle")
+	}
+
+	_, err = loadTargetNames(t, chainTestMain+`
+targets:
+  login:
+    url: http://127.0.0.1/login
+    next: missing
+`)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "missing")
+	}
+}
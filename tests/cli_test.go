@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	args, err := config.ParseArgs([]string{"--url=http://a", "--url", "http://b", "--cookies",
+		"--header-Origin=http://c", "result.json", "--concurrency", "5"}, config.CliFlags)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"http://a", "http://b"}, args.GetAll("url"))
+	assert.Equal(t, "true", args.Get("cookies"))
+	assert.Equal(t, "5", args.Get("concurrency"))
+	assert.Equal(t, map[string]string{"Origin": "http://c"}, args.GetPrefixed("header-"))
+	assert.Equal(t, []string{"result.json"}, args.Positional)
+	assert.Equal(t, []string{"concurrency", "cookies", "header-*", "url"}, args.Given(config.CliFlags))
+
+	_, err = config.ParseArgs([]string{"--worker-count=5"}, config.CliFlags)
+	assert.EqualError(t, err, "unknown flag --worker-count")
+	_, err = config.ParseArgs([]string{"--method=GET", "--method=POST"}, config.CliFlags)
+	assert.EqualError(t, err, "flag --method is given more than once")
+	_, err = config.ParseArgs([]string{"--concurrency"}, config.CliFlags)
+	assert.EqualError(t, err, "flag --concurrency needs a value")
+}
+
+func TestCliConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "load48-cli")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	var bodyFile = filepath.Join(dir, "body.json")
+	assert.NoError(t, ioutil.WriteFile(bodyFile, []byte(`{"id":1}`), 0644))
+
+	configs, err := config.NewConfigCli().LoadConfigs([]string{"--url=http://127.0.0.1/a", "--url=http://127.0.0.1/b",
+		"--method=post", "--duration=30s", "--rate=20", "--body-file=" + bodyFile, "--assert-body-string=ok",
+		"--header-X-Token=abc"})
+	if !assert.NoError(t, err) || !assert.Len(t, configs, 2) {
+		return
+	}
+	assert.Equal(t, "target1", configs[0].TargetName)
+	assert.Equal(t, "http://127.0.0.1/b", configs[1].Url)
+	assert.Equal(t, "POST", configs[1].Method)
+	assert.Equal(t, config.ExecutorRate, configs[0].Executor)
+	assert.Equal(t, float64(20), configs[0].Rate)
+	assert.Equal(t, 30*time.Second, configs[0].Duration)
+	assert.Equal(t, int64(1), configs[0].Concurrency)
+	assert.Equal(t, config.StrategySeq, configs[0].Strategy)
+	assert.Equal(t, `{"id":1}`, configs[1].FormBody)
+	assert.Equal(t, "abc", configs[1].Headers.Get("X-Token"))
+	assert.True(t, configs[0].Assertions.Exists("body-string"))
+
+	_, err = config.NewConfigCli().LoadConfigs([]string{"--url=127.0.0.1", "--method=FETCH", "--concurrency=two"})
+	assert.EqualError(t, err, "--concurrency: concurrency must be an integer\n"+
+		"--method: httpMethod must be one of: GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE\n"+
+		"--url: url must start with http:// or https://\n"+
+		"--request-count: request-count must be greater than zero, unless a duration is given")
+	_, err = config.NewConfigCli().LoadConfigs([]string{"--request-count=1"})
+	assert.EqualError(t, err, "--url: url is required")
+}
+
+func TestSaveAndCompareResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "load48-result")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	var baseline = &loadtest.Result{Scenarios: []*loadtest.ScenarioResult{{
+		Targets: []*stats.Summary{
+			{Name: "login", TotalSent: 100, Success: 99, Failed: map[string]int64{"500": 1}, AverageDuration: 100 * time.Millisecond},
+			{Name: "logout", TotalSent: 100, Success: 100, AverageDuration: 10 * time.Millisecond},
+		},
+	}}}
+	var file = filepath.Join(dir, "baseline.json")
+	assert.NoError(t, baseline.Save(file))
+	loaded, err := loadtest.LoadResult(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, baseline.Scenarios[0].Targets, loaded.Scenarios[0].Targets)
+	assert.Equal(t, float64(1), loaded.Scenarios[0].Targets[0].ErrorRate())
+
+	var current = &loadtest.Result{Scenarios: []*loadtest.ScenarioResult{{
+		Targets: []*stats.Summary{
+			{Name: "login", TotalSent: 100, Success: 80, Timeout: 20, AverageDuration: 105 * time.Millisecond},
+			{Name: "search", TotalSent: 100, Success: 100, AverageDuration: 10 * time.Millisecond},
+		},
+	}}}
+	comparisons := loadtest.CompareResults(loaded, current)
+	if !assert.Len(t, comparisons, 3) {
+		return
+	}
+	assert.Equal(t, "login", comparisons[0].Name)
+	assert.Equal(t, []string{"error rate is grown by 19.0 points"}, comparisons[0].Regressions(10))
+	assert.Equal(t, []string{"average duration is grown by 5.0%", "error rate is grown by 19.0 points"},
+		comparisons[0].Regressions(1))
+	assert.Empty(t, comparisons[1].Regressions(10))
+	assert.Equal(t, "logout", comparisons[2].Name)
+	assert.Equal(t, []string{"target is not found in the current result"}, comparisons[2].Regressions(10))
+
+	_, err = loadtest.LoadResult(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writes the files (by their names) into a temp dir,
+// and returns the dir and a func to remove it
+func writeTestConfigFiles(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "load48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		var file = filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+var composeTestFiles = map[string]string{
+	"load.yml": `
+include: shared/targets.yml
+main:
+  concurrency: 2
+  request-count: 10
+targets:
+  getUser:
+    url: ${LOAD48_TEST_HOST:-http://127.0.0.1:3001}/user
+`,
+	"shared/targets.yml": `
+main:
+  strategy: seq
+  concurrency: 1
+targets:
+  login:
+    url: ${LOAD48_TEST_HOST:-http://127.0.0.1:3001}/login
+    httpMethod: POST
+    headers:
+      Authorization: Bearer ${LOAD48_TEST_TOKEN}
+`,
+	"load.staging.yml": `
+main:
+  concurrency: 20
+targets:
+  login:
+    httpMethod: PUT
+`,
+}
+
+func TestComposeIncludesAndEnvInterpolation(t *testing.T) {
+	dir, remove := writeTestConfigFiles(t, composeTestFiles)
+	defer remove()
+	os.Setenv("LOAD48_TEST_TOKEN", "secret")
+	defer os.Unsetenv("LOAD48_TEST_TOKEN")
+
+	configs, err := config.NewConfigYaml().LoadConfigs(filepath.Join(dir, "load.yml"))
+	if !assert.NoError(t, err) || !assert.Len(t, configs, 2) {
+		return
+	}
+	// included targets come first, the including file's values win
+	assert.Equal(t, "login", configs[0].TargetName)
+	assert.Equal(t, "http://127.0.0.1:3001/login", configs[0].Url)
+	assert.Equal(t, "Bearer secret", configs[0].Headers.Get("Authorization"))
+	assert.Equal(t, "getUser", configs[1].TargetName)
+	assert.Equal(t, int64(2), configs[1].Concurrency)
+	assert.Equal(t, config.StrategySeq, configs[1].Strategy)
+
+	os.Setenv("LOAD48_TEST_HOST", "https://staging.example.com")
+	defer os.Unsetenv("LOAD48_TEST_HOST")
+	configs, err = config.NewConfigYaml().LoadConfigs(filepath.Join(dir, "load.yml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://staging.example.com/user", configs[1].Url)
+	}
+}
+
+func TestComposeEnvOverlayAndOverrides(t *testing.T) {
+	dir, remove := writeTestConfigFiles(t, composeTestFiles)
+	defer remove()
+	os.Setenv("LOAD48_TEST_TOKEN", "secret")
+	defer os.Unsetenv("LOAD48_TEST_TOKEN")
+
+	loader := config.NewConfigYaml()
+	loader.SetEnv("staging")
+	configs, err := loader.LoadConfigs(filepath.Join(dir, "load.yml"))
+	if assert.NoError(t, err) && assert.Len(t, configs, 2) {
+		assert.Equal(t, int64(20), configs[0].Concurrency)
+		// the overlay is merged deeply, the rest of login is kept
+		assert.Equal(t, "PUT", configs[0].Method)
+		assert.Equal(t, "http://127.0.0.1:3001/login", configs[0].Url)
+	}
+
+	loader = config.NewConfigYaml()
+	loader.SetEnv("staging")
+	loader.AddOverrides("main.concurrency=50", "targets.getUser.max-timeout=3")
+	configs, err = loader.LoadConfigs(filepath.Join(dir, "load.yml"))
+	if assert.NoError(t, err) && assert.Len(t, configs, 2) {
+		assert.Equal(t, int64(50), configs[0].Concurrency)
+		assert.Equal(t, 3, configs[1].MaxTimeout)
+	}
+
+	loader = config.NewConfigYaml()
+	loader.SetEnv("prod")
+	_, err = loader.LoadConfigs(filepath.Join(dir, "load.yml"))
+	assert.Error(t, err)
+}
+
+func TestComposeErrors(t *testing.T) {
+	dir, remove := writeTestConfigFiles(t, composeTestFiles)
+	defer remove()
+	os.Unsetenv("LOAD48_TEST_TOKEN")
+
+	_, err := config.NewConfigYaml().LoadConfigs(filepath.Join(dir, "load.yml"))
+	if assert.Error(t, err) {
+		assert.Equal(t, "shared/targets.yml, line 10: environment variable LOAD48_TEST_TOKEN is not set", err.Error())
+	}
+
+	dir, remove = writeTestConfigFiles(t, map[string]string{
+		"a.yml": "include: b.yml\n",
+		"b.yml": "include: a.yml\n",
+	})
+	defer remove()
+	_, err = config.NewConfigYaml().LoadConfigs(filepath.Join(dir, "a.yml"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "include each other")
+	}
+}
+
+func TestEnvValuesDoNotChangeTheDocument(t *testing.T) {
+	os.Setenv("LOAD48_TEST_TOKEN", "a: b # \"c'\nd")
+	os.Setenv("LOAD48_TEST_USERS", "7")
+	os.Setenv("LOAD48_TEST_TIMEOUT", "soon")
+	defer os.Unsetenv("LOAD48_TEST_TOKEN")
+	defer os.Unsetenv("LOAD48_TEST_USERS")
+	defer os.Unsetenv("LOAD48_TEST_TIMEOUT")
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: ${LOAD48_TEST_USERS}
+  request-count: 10
+targets:
+  login:
+    url: http://127.0.0.1/login
+    headers:
+      X-Token: ${LOAD48_TEST_TOKEN} # a comment ${LOAD48_TEST_MISSING}
+      X-Users: "${LOAD48_TEST_USERS}"
+`))
+	if assert.NoError(t, err) && assert.Len(t, configs, 1) {
+		assert.Equal(t, int64(7), configs[0].Concurrency)
+		assert.Equal(t, "a: b # \"c'\nd", configs[0].Headers.Get("X-Token"))
+		assert.Equal(t, "7", configs[0].Headers.Get("X-Users"))
+	}
+
+	// the values are checked once they are replaced
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  login:
+    url: http://127.0.0.1/login
+    max-timeout: ${LOAD48_TEST_TIMEOUT}
+    header: ${LOAD48_TEST_USERS}
+`)
+	assert.Equal(t, []string{
+		"line 7: cannot unmarshal !!str `soon` into int",
+		"line 8: field header not found in type config.YamlConfigSectionTarget",
+	}, errs)
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newCookiesTestServer() *httptest.Server {
+	mx := http.NewServeMux()
+	mx.HandleFunc("/login", func(writer http.ResponseWriter, request *http.Request) {
+		http.SetCookie(writer, &http.Cookie{Name: "sid", Value: "abc", Path: "/"})
+		writer.Write([]byte(`{}`))
+	})
+	mx.HandleFunc("/me", func(writer http.ResponseWriter, request *http.Request) {
+		c, err := request.Cookie("sid")
+		if err != nil || c.Value != "abc" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if request.URL.Query().Get("tenant") != "" {
+			tc, err := request.Cookie("tenant")
+			if err != nil || tc.Value != request.URL.Query().Get("tenant") {
+				writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		writer.Write([]byte(`{}`))
+	})
+	return httptest.NewServer(mx)
+}
+
+func newCookiesTestWorker(name, url string) *request.RequestWorker {
+	asrt := assertions.NewAssertionManagerWithDefaults(nil)
+	// default assertions are shared, other tests may have changed them
+	_ = asrt.Get(assertions.AssertStatusIsOk).SetInput([]int{200, 201})
+	w := request.NewRequestWorker(&config.Config{
+		Concurrency:      2,
+		NumberOfRequests: 10,
+		Method:           http.MethodGet,
+		TargetName:       name,
+		Url:              url,
+		MaxTimeout:       2,
+		Assertions:       asrt,
+	}, name)
+	w.AddStat(name, stats.NewStatsManager(name))
+	return w
+}
+
+func TestCookiesFlowThroughChain(t *testing.T) {
+	srv := newCookiesTestServer()
+	defer srv.Close()
+
+	tg := request.NewTargetManager(request.StrategySeq, 2, 10)
+	tg.EnableCookies(nil)
+	tg.Workers = []*request.RequestWorker{
+		newCookiesTestWorker("login", srv.URL+"/login"),
+		newCookiesTestWorker("me", srv.URL+"/me"),
+	}
+	tg.Run(request.ExecWorker)
+	assert.Equal(t, int64(10), tg.Workers[1].GetStat("me").GetSuccess())
+}
+
+func TestCookiesAreNotSentWithoutJar(t *testing.T) {
+	// every request of this test fails, keep them out of the log channel
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := newCookiesTestServer()
+	defer srv.Close()
+
+	tg := request.NewTargetManager(request.StrategySeq, 2, 10)
+	tg.Workers = []*request.RequestWorker{
+		newCookiesTestWorker("login", srv.URL+"/login"),
+		newCookiesTestWorker("me", srv.URL+"/me"),
+	}
+	tg.Run(request.ExecWorker)
+	assert.Equal(t, int64(0), tg.Workers[1].GetStat("me").GetSuccess())
+}
+
+func TestCookiesSeedFromVariables(t *testing.T) {
+	srv := newCookiesTestServer()
+	defer srv.Close()
+
+	tg := request.NewTargetManager(request.StrategySeq, 2, 10)
+	tg.EnableCookies(map[string]string{"tenant": "$tenant"})
+	tg.Variables = variable.VariableMap{"$tenant": &variable.VariableEntry{Value: "acme"}}
+	tg.Workers = []*request.RequestWorker{
+		newCookiesTestWorker("login", srv.URL+"/login"),
+		newCookiesTestWorker("me", srv.URL+"/me?tenant=acme"),
+	}
+	tg.Run(request.ExecWorker)
+	assert.Equal(t, int64(10), tg.Workers[1].GetStat("me").GetSuccess())
+}
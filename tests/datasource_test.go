@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a server which gives a new token on each call of /token, and records
+// the tokens /orders is called with
+func newDataSourceTestServer(issued *atomic.Int64, used *sync.Map) *httptest.Server {
+	mx := http.NewServeMux()
+	mx.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"token": "t%v"}`, issued.Inc())
+	})
+	mx.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		used.Store(r.Header.Get("Authorization"), true)
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte(`{}`))
+	})
+	return httptest.NewServer(mx)
+}
+
+func TestDataSourcesAreMappedApart(t *testing.T) {
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 1
+data-sources:
+  token:
+    url: http://127.0.0.1/token
+    refresh: 5m
+  session:
+    url: http://127.0.0.1/session
+    refresh:
+      type: sec
+      value: 30
+  settings:
+    url: http://127.0.0.1/settings
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+`))
+	assert.NoError(t, err)
+	assert.Len(t, configs, 4)
+	assert.False(t, configs[0].DataSource)
+	assert.True(t, configs[1].DataSource)
+	assert.Equal(t, 5*time.Minute, configs[1].Refresh)
+	assert.Equal(t, 30*time.Second, configs[2].Refresh)
+	assert.Equal(t, time.Duration(0), configs[3].Refresh)
+}
+
+func TestDataSourceRefreshIsValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+data-sources:
+  token:
+    url: http://127.0.0.1/token
+    refresh:
+      type: min
+      value: 5
+  session:
+    url: http://127.0.0.1/session
+    refresh: soon
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+    refresh: 1s
+`)
+	assert.Equal(t, []string{
+		"line 7: data-sources.token: refresh.type must be one of: ms, sec",
+		"line 12: data-sources.session: refresh must be a duration like 1s or 250ms",
+		"line 16: targets.orders: refresh is only used by data-sources",
+	}, errs)
+}
+
+func TestDataSourcesAreRefreshedWhileTheTestRuns(t *testing.T) {
+	defer func() { logger.LogEnabled = true }()
+	var issued = atomic.NewInt64(0)
+	var used = &sync.Map{}
+	srv := newDataSourceTestServer(issued, used)
+	defer srv.Close()
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 40
+data-sources:
+  token:
+    url: ` + srv.URL + `/token
+    refresh: 20ms
+    variables:
+      $token:
+        type: string
+        path: token
+targets:
+  orders:
+    url: ` + srv.URL + `/orders
+    headers:
+      Authorization: Bearer $token
+`))
+	assert.NoError(t, err)
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+
+	var tokens = 0
+	used.Range(func(key, value interface{}) bool {
+		assert.Regexp(t, `^Bearer t[0-9]+$`, key)
+		tokens++
+		return true
+	})
+	// the first token is taken before the test, the next ones while it runs
+	_, ok := used.Load("Bearer t1")
+	assert.True(t, ok)
+	assert.Greater(t, tokens, 1)
+
+	// the refresh is stopped with the test
+	var afterTest = issued.Load()
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, afterTest, issued.Load())
+	var sm = lt.Result().Scenarios[0].Targets[0]
+	assert.Equal(t, "orders", sm.Name)
+	assert.Equal(t, int64(40), sm.Success)
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/distributed"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const agentToken = "s3cret"
+
+func TestShareConfigs(t *testing.T) {
+	var newConfigs = func() []*config.Config {
+		return []*config.Config{{TargetName: "login", Concurrency: 10, NumberOfRequests: 101, Rate: 30,
+			Stages: []config.Stage{{Duration: time.Second, Target: 60}}}}
+	}
+	var concurrency, requests int64
+	for i := 0; i < 3; i++ {
+		configs := newConfigs()
+		if !assert.NoError(t, distributed.Share(configs, i, 3)) {
+			return
+		}
+		concurrency += configs[0].Concurrency
+		requests += configs[0].NumberOfRequests
+		assert.Equal(t, float64(10), configs[0].Rate)
+		assert.Equal(t, float64(20), configs[0].Stages[0].Target)
+	}
+	assert.Equal(t, int64(10), concurrency)
+	assert.Equal(t, int64(101), requests)
+
+	assert.EqualError(t, distributed.Share(newConfigs(), 0, 11), "concurrency 10 of target login cannot be split across 11 agents")
+	var protos = []*config.Config{{TargetName: "greet", Concurrency: 2, Grpc: &config.GrpcConfig{Descriptor: &grpc.Method{}}}}
+	assert.EqualError(t, distributed.CanShare(protos, 2), "grpc.proto of target greet is not sent to agents, leave it out to use the server reflection")
+}
+
+func TestCoordinatorMergesAgents(t *testing.T) {
+	var hits = atomic.NewInt64(0)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer target.Close()
+	var agents = make([]string, 0)
+	for i := 0; i < 3; i++ {
+		agent := httptest.NewServer(distributed.NewAgent(agentToken).Handler())
+		defer agent.Close()
+		agents = append(agents, agent.URL)
+	}
+	var document = fmt.Sprintf(`
+main:
+  concurrency: 3
+  request-count: 20
+  strategy: seq
+targets:
+  ok:
+    url: %v/ok
+  fail:
+    url: %v/fail
+`, target.URL, target.URL)
+
+	coordinator := distributed.NewCoordinator(agents, agentToken)
+	coordinator.Interval = 20 * time.Millisecond
+	result, err := coordinator.Run(context.Background(), []byte(document))
+	if !assert.NoError(t, err) || !assert.Len(t, result.Scenarios, 1) {
+		return
+	}
+	// the tests of the agents have loggers of their own
+	assert.True(t, logger.LogEnabled)
+	assert.Equal(t, int64(40), hits.Load(), "the 20 iterations are split across the agents")
+	var sr = result.Scenarios[0]
+	if assert.Len(t, sr.Targets, 2) {
+		assert.Equal(t, "ok", sr.Targets[0].Name)
+		assert.Equal(t, int64(20), sr.Targets[0].TotalSent)
+		assert.Equal(t, int64(20), sr.Targets[0].Success)
+		assert.Equal(t, map[string]int64{"500": 20}, sr.Targets[1].Failed)
+	}
+	if assert.NotNil(t, sr.Total) {
+		assert.Equal(t, int64(40), sr.Total.TotalSent)
+		assert.True(t, sr.Total.AverageDuration > 0)
+	}
+
+	// a config an agent cannot load fails the test before any agent starts
+	_, err = coordinator.Run(context.Background(), []byte("main:\n  concurrency: 3\n"))
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "agent "+agents[0]), err.Error())
+	}
+	assert.Equal(t, int64(40), hits.Load())
+}
+
+func TestCoordinatorKeepsTheStatsOfAnInterruptedTest(t *testing.T) {
+	var hits = atomic.NewInt64(0)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer target.Close()
+	var agents = make([]string, 0)
+	for i := 0; i < 2; i++ {
+		agent := httptest.NewServer(distributed.NewAgent(agentToken).Handler())
+		defer agent.Close()
+		agents = append(agents, agent.URL)
+	}
+	var document = fmt.Sprintf("main:\n  concurrency: 2\n  duration: 1m\ntargets:\n  ok:\n    url: %v/ok\n", target.URL)
+
+	coordinator := distributed.NewCoordinator(agents, agentToken)
+	coordinator.Interval = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	result, err := coordinator.Run(ctx, []byte(document))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	if assert.NotNil(t, result) && assert.Len(t, result.Scenarios, 1) {
+		assert.True(t, result.Scenarios[0].Targets[0].TotalSent > 0)
+	}
+	// the agents stop their test once the coordinator is gone
+	time.Sleep(100 * time.Millisecond)
+	var stoppedAt = hits.Load()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stoppedAt, hits.Load())
+}
+
+func TestAgentsNeedTheirToken(t *testing.T) {
+	var document = "main:\n  concurrency: 1\n  request-count: 1\ntargets:\n  ok:\n    url: http://127.0.0.1:1/ok\n"
+	for _, token := range []string{agentToken, ""} {
+		agent := httptest.NewServer(distributed.NewAgent(token).Handler())
+		_, err := distributed.NewCoordinator([]string{agent.URL}, "guess").Run(context.Background(), []byte(document))
+		assert.EqualError(t, err, "agent "+agent.URL+": the token of the agent is needed")
+		agent.Close()
+	}
+}
+
+func TestConfigsSentToAgentsReadNoFiles(t *testing.T) {
+	dir, remove := writeTestConfigFiles(t, map[string]string{
+		"me.graphql":   "{ me { id } }\n",
+		"keys/signing": "k-1",
+		"load.yml": `
+main:
+  concurrency: 1
+  request-count: 1
+targets:
+  me:
+    url: http://127.0.0.1:3001/graphql
+    graphql:
+      query-file: me.graphql
+    signing:
+      type: hmac
+      key-file: keys/signing
+`,
+	})
+	defer remove()
+	var loader = config.NewConfigYaml()
+	if _, err := loader.LoadConfigs(filepath.Join(dir, "load.yml")); !assert.NoError(t, err) {
+		return
+	}
+	document, err := loader.Composed()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the files are inlined by the coordinator
+	var sent = config.NewConfigYaml()
+	sent.Untrusted()
+	configs, err := sent.LoadConfigs(document)
+	if assert.NoError(t, err) && assert.Len(t, configs, 1) {
+		assert.Equal(t, "{ me { id } }\n", configs[0].Graphql.Query)
+		assert.Equal(t, []byte("k-1"), configs[0].Signing.Key)
+	}
+
+	// the files and the environment of the agent are not read
+	os.Setenv("LOAD48_TEST_SECRET", "s-1")
+	defer os.Unsetenv("LOAD48_TEST_SECRET")
+	var target = `
+targets:
+  me:
+    url: http://127.0.0.1:3001/me
+    headers:
+      X-Secret: ${LOAD48_TEST_SECRET}
+`
+	for _, document := range []string{
+		"include: " + filepath.Join(dir, "load.yml") + target,
+		target + "    graphql:\n      query-file: " + filepath.Join(dir, "me.graphql") + "\n",
+		target + "    auth:\n      type: jwt\n      key-file: " + filepath.Join(dir, "keys/signing") + "\n",
+	} {
+		sent = config.NewConfigYaml()
+		sent.Untrusted()
+		_, err = sent.LoadConfigs([]byte("main:\n  concurrency: 1\n  request-count: 1\n" + document))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "the config is given by another host, it cannot read the files of this one")
+		}
+	}
+	sent = config.NewConfigYaml()
+	sent.Untrusted()
+	configs, err = sent.LoadConfigs([]byte("main:\n  concurrency: 1\n  request-count: 1\n" + target))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "${LOAD48_TEST_SECRET}", configs[0].Headers.Get("X-Secret"))
+	}
+
+	// nor are the files written to the dirs it sets
+	sent = config.NewConfigYaml()
+	sent.Untrusted()
+	_, err = sent.LoadConfigs([]byte(`main:
+  concurrency: 1
+  request-count: 1
+logs:
+  enabled: true
+  dir: /etc
+capture:
+  dir: /etc
+targets:
+  me:
+    url: http://127.0.0.1:3001/me
+    capture:
+      dir: /tmp
+`))
+	if errs, ok := err.(config.ConfigErrors); assert.True(t, ok, "unexpected error: %v", err) {
+		var lines = make([]string, 0, len(errs))
+		for _, e := range errs {
+			lines = append(lines, e.Error())
+		}
+		var reason = ".dir is not allowed, the config is given by another host, it cannot write to the dirs of this one"
+		assert.Equal(t, []string{
+			"line 6: logs: logs" + reason,
+			"line 8: capture: capture" + reason,
+			"line 12: targets.me: capture" + reason,
+		}, lines)
+	}
+}
+
+func TestMergeSnapshots(t *testing.T) {
+	var results = loadtest.MergeSnapshots(
+		[]*loadtest.ScenarioSnapshot{{Iterations: 2, Targets: []*stats.Snapshot{{Key: "login",
+			Counts:    map[string]int64{stats.TotalSent: 2, stats.Success: 2},
+			Durations: map[string]time.Duration{stats.MainDuration: 4 * time.Millisecond, stats.LongestDuration: 3 * time.Millisecond}}}}},
+		[]*loadtest.ScenarioSnapshot{{Iterations: 1, Targets: []*stats.Snapshot{{Key: "login",
+			Counts:    map[string]int64{stats.TotalSent: 2, stats.Success: 1, "404": 1},
+			Durations: map[string]time.Duration{stats.MainDuration: 8 * time.Millisecond, stats.LongestDuration: 8 * time.Millisecond}}}}},
+	)
+	if !assert.Len(t, results, 1) || !assert.Len(t, results[0].Targets, 1) {
+		return
+	}
+	var sm = results[0].Targets[0]
+	assert.Equal(t, int64(3), results[0].Iterations)
+	assert.Equal(t, int64(4), sm.TotalSent)
+	assert.Equal(t, int64(3), sm.Success)
+	assert.Equal(t, map[string]int64{"404": 1}, sm.Failed)
+	assert.Equal(t, 4*time.Millisecond, sm.AverageDuration)
+	assert.Equal(t, 8*time.Millisecond, sm.LongestDuration)
+	assert.Nil(t, results[0].Total)
+}
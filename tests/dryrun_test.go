@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newDryRunServer(hits *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		switch r.URL.Path {
+		case "/token":
+			w.Write([]byte(`{"tenant": "acme"}`))
+		case "/login":
+			w.Write([]byte(`{"token": "t-1"}`))
+		case "/orders":
+			if r.Header.Get("Authorization") != "Bearer t-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"orders": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func dryRunConfig(t *testing.T, url string) []*config.Config {
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 50
+  request-count: 1000
+data-sources:
+  tenant:
+    url: ` + url + `/token
+    variables:
+      $tenant:
+        type: string
+        path: tenant
+targets:
+  login:
+    url: ` + url + `/login
+    httpMethod: POST
+    form-body: '{"tenant": "$tenant"}'
+    variables:
+      $token:
+        type: string
+        path: token
+  orders:
+    url: ` + url + `/orders?tenant=$tenant
+    headers:
+      Authorization: Bearer $token
+    assertions:
+      body-string: orders
+`))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return configs
+}
+
+func TestDryRunSendsEachChainOnce(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var hits = atomic.NewInt64(0)
+	srv := newDryRunServer(hits)
+	defer srv.Close()
+
+	var out = &bytes.Buffer{}
+	err := loadtest.NewLoadTest(dryRunConfig(t, srv.URL)...).DryRun(out, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), hits.Load())
+	assert.Equal(t, `# data-sources
+> tenant: GET `+srv.URL+`/token
+< 200 OK
+    assertion status-is-ok: passed
+    $tenant = acme
+    ok
+
+> login: POST `+srv.URL+`/login
+    {"tenant": "acme"}
+< 200 OK
+    assertion status-is-ok: passed
+    $token = t-1
+    ok
+
+> orders: GET `+srv.URL+`/orders?tenant=acme
+    Authorization: Bearer t-1
+< 200 OK
+    assertion status-is-ok: passed
+    assertion body-string: passed
+    ok
+
+3 request(s) rendered
+`, out.String())
+}
+
+func TestDryRunOfflineSendsNothing(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var hits = atomic.NewInt64(0)
+	srv := newDryRunServer(hits)
+	defer srv.Close()
+
+	var out = &bytes.Buffer{}
+	err := loadtest.NewLoadTest(dryRunConfig(t, srv.URL)...).DryRun(out, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), hits.Load())
+	assert.Contains(t, out.String(), "> login: POST "+srv.URL+"/login\n    {\"tenant\": \"<$tenant>\"}\n    $token = <$token>\n    ok\n")
+	assert.Contains(t, out.String(), "> orders: GET "+srv.URL+"/orders?tenant=<$tenant>\n    Authorization: Bearer <$token>\n")
+	assert.Contains(t, out.String(), "3 request(s) rendered")
+}
+
+func TestDryRunReportsFailures(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var hits = atomic.NewInt64(0)
+	srv := newDryRunServer(hits)
+	defer srv.Close()
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 5
+  request-count: 100
+  strategy: round-robin
+targets:
+  orders:
+    url: ` + srv.URL + `/orders
+  missing:
+    url: ` + srv.URL + `/missing
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var out = &bytes.Buffer{}
+	err = loadtest.NewLoadTest(configs...).DryRun(out, false)
+	assert.EqualError(t, err, "2 of 2 request(s) failed")
+	assert.Equal(t, int64(2), hits.Load())
+	assert.Contains(t, out.String(), "< 401 Unauthorized\n    assertion status-is-ok: failed, ")
+	assert.Contains(t, out.String(), "< 404 Not Found\n")
+	assert.Contains(t, out.String(), "    failed: assertion failed\n")
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"testing"
+	"time"
+)
+
+func TestClosedLoopExecutorWithDuration(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	w := newFlowTestWorker(&config.Config{TargetName: "closed", Url: srv.URL + "/product?id=11"})
+	tg := request.NewTargetManager(request.StrategyParallel, 2, 0)
+	tg.SetExecutor(config.ExecutorClosedLoop, 300*time.Millisecond, 0, nil)
+	tg.Workers = []*request.RequestWorker{w}
+	var start = time.Now()
+	tg.Run(request.ExecWorker)
+	assert.True(t, time.Since(start) >= 300*time.Millisecond)
+	assert.True(t, time.Since(start) < 2*time.Second)
+	started, dropped := tg.IterationCounts()
+	assert.True(t, started > 2)
+	assert.Equal(t, int64(0), dropped)
+	assert.Equal(t, started, w.GetStat("closed").GetTotal())
+}
+
+func TestRateExecutor(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	w := newFlowTestWorker(&config.Config{TargetName: "rate", Url: srv.URL + "/product?id=11"})
+	tg := request.NewTargetManager(request.StrategyParallel, 5, 0)
+	tg.SetExecutor(config.ExecutorRate, time.Second, 40, nil)
+	tg.Workers = []*request.RequestWorker{w}
+	tg.Run(request.ExecWorker)
+	started, dropped := tg.IterationCounts()
+	assert.InDelta(t, 40, started, 4)
+	assert.Equal(t, int64(0), dropped)
+	assert.Equal(t, started, w.GetStat("rate").GetTotal())
+
+	// request-count stops the executor before the duration
+	w = newFlowTestWorker(&config.Config{TargetName: "rate", Url: srv.URL + "/product?id=11"})
+	tg = request.NewTargetManager(request.StrategyParallel, 5, 10)
+	tg.SetExecutor(config.ExecutorRate, time.Minute, 100, nil)
+	tg.Workers = []*request.RequestWorker{w}
+	tg.Run(request.ExecWorker)
+	started, _ = tg.IterationCounts()
+	assert.Equal(t, int64(10), started)
+}
+
+func TestRateExecutorDropsIterations(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	w := newFlowTestWorker(&config.Config{TargetName: "slow", Url: srv.URL + "/product?id=11",
+		ThinkTime: &curr.ThinkTime{Distribution: curr.ThinkFixed, Value: 200 * time.Millisecond}})
+	tg := request.NewTargetManager(request.StrategyParallel, 1, 0)
+	tg.SetExecutor(config.ExecutorRate, 500*time.Millisecond, 20, nil)
+	tg.Workers = []*request.RequestWorker{w}
+	tg.Run(request.ExecWorker)
+	started, dropped := tg.IterationCounts()
+	assert.True(t, started >= 2 && started <= 4, "started %v", started)
+	assert.True(t, dropped >= 5, "dropped %v", dropped)
+}
+
+func TestRampingExecutor(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	w := newFlowTestWorker(&config.Config{TargetName: "ramping", Url: srv.URL + "/product?id=11"})
+	tg := request.NewTargetManager(request.StrategyParallel, 5, 0)
+	// 0 -> 40/s in the first half, 40/s in the second half, 30 iterations
+	tg.SetExecutor(config.ExecutorRamping, 0, 0, []config.Stage{
+		{Duration: 500 * time.Millisecond, Target: 40},
+		{Duration: 500 * time.Millisecond, Target: 40},
+	})
+	tg.Workers = []*request.RequestWorker{w}
+	tg.Run(request.ExecWorker)
+	started, _ := tg.IterationCounts()
+	assert.InDelta(t, 30, started, 5)
+}
+
+func TestLoadScenarios(t *testing.T) {
+	file, remove := writeTestConfig(t, `
+main:
+  concurrency: 4
+  request-count: 100
+  strategy: seq
+scenarios:
+  browsers:
+    targets: [home, product]
+  buyers:
+    executor: rate
+    rate: 5
+    duration: 1m
+    start-delay: 10s
+    targets: [product, checkout]
+targets:
+  home:
+    url: http://127.0.0.1/
+    httpMethod: get
+  product:
+    url: http://127.0.0.1/product
+    httpMethod: get
+  checkout:
+    url: http://127.0.0.1/checkout
+    httpMethod: post
+`)
+	defer remove()
+
+	configs, err := config.NewConfigYaml().LoadConfigs(file)
+	assert.NoError(t, err)
+	if !assert.Len(t, configs, 4) {
+		return
+	}
+	var names = make([]string, 0)
+	for _, cc := range configs {
+		names = append(names, cc.Scenario+"."+cc.TargetName)
+	}
+	assert.Equal(t, []string{"browsers.home", "browsers.product", "buyers.product", "buyers.checkout"}, names)
+	assert.Equal(t, config.ExecutorClosedLoop, configs[0].Executor)
+	assert.Equal(t, int64(4), configs[0].Concurrency)
+	assert.Equal(t, config.ExecutorRate, configs[2].Executor)
+	assert.Equal(t, float64(5), configs[2].Rate)
+	assert.Equal(t, time.Minute, configs[2].Duration)
+	assert.Equal(t, 10*time.Second, configs[3].StartDelay)
+	assert.Equal(t, int64(100), configs[3].NumberOfRequests)
+
+	file, remove = writeTestConfig(t, `
+main:
+  concurrency: 1
+scenarios:
+  browsers:
+    targets: [home, missing]
+targets:
+  home:
+    url: http://127.0.0.1/
+    httpMethod: get
+`)
+	defer remove()
+	_, err = config.NewConfigYaml().LoadConfigs(file)
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	variable "github.com/mostafatalebi/loadtest/pkg/variables"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newFlowTestServer(productHits *atomic.Int64) *httptest.Server {
+	mx := http.NewServeMux()
+	mx.HandleFunc("/products", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(`{ "data" : { "ids" : [11, 12, 13], "role" : "guest" } }`))
+	})
+	mx.HandleFunc("/product", func(writer http.ResponseWriter, request *http.Request) {
+		id := request.URL.Query().Get("id")
+		if id != "11" && id != "12" && id != "13" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		productHits.Add(1)
+		writer.Write([]byte(`{}`))
+	})
+	mx.HandleFunc("/broken", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	})
+	return httptest.NewServer(mx)
+}
+
+func newFlowTestWorker(cnf *config.Config) *request.RequestWorker {
+	asrt := assertions.NewAssertionManagerWithDefaults(nil)
+	// default assertions are shared, other tests may have changed them
+	_ = asrt.Get(assertions.AssertStatusIsOk).SetInput([]int{200, 201})
+	cnf.Concurrency = 2
+	cnf.NumberOfRequests = 5
+	cnf.Method = http.MethodGet
+	cnf.MaxTimeout = 2
+	cnf.Assertions = asrt
+	w := request.NewRequestWorker(cnf, cnf.TargetName)
+	w.AddStat(cnf.TargetName, stats.NewStatsManager(cnf.TargetName))
+	return w
+}
+
+func runFlowChain(workers ...*request.RequestWorker) {
+	tg := request.NewTargetManager(request.StrategySeq, 2, 5)
+	tg.Workers = workers
+	tg.Run(request.ExecWorker)
+}
+
+func TestFlowLoopOverArrayVariable(t *testing.T) {
+	hits := atomic.NewInt64(0)
+	srv := newFlowTestServer(hits)
+	defer srv.Close()
+
+	list := newFlowTestWorker(&config.Config{
+		TargetName: "list",
+		Url:        srv.URL + "/products",
+		VariablesMap: variable.VariableMap{
+			"$ids": &variable.VariableEntry{Type: variable.VarArr, Path: "data.ids"},
+		},
+	})
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=$item",
+		LoopOver:   "$ids",
+	})
+	runFlowChain(list, fetch)
+	assert.Equal(t, int64(15), hits.Load())
+	assert.Equal(t, int64(15), fetch.GetStat("fetch").GetSuccess())
+}
+
+func TestFlowOnFailureStop(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	hits := atomic.NewInt64(0)
+	srv := newFlowTestServer(hits)
+	defer srv.Close()
+
+	broken := newFlowTestWorker(&config.Config{
+		TargetName: "broken",
+		Url:        srv.URL + "/broken",
+		OnFailure:  config.OnFailureStop,
+	})
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=11",
+	})
+	runFlowChain(broken, fetch)
+	assert.Equal(t, int64(0), hits.Load())
+	assert.Equal(t, int64(0), fetch.GetStat("fetch").GetTotal())
+}
+
+func TestFlowOnFailureContinue(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	hits := atomic.NewInt64(0)
+	srv := newFlowTestServer(hits)
+	defer srv.Close()
+
+	broken := newFlowTestWorker(&config.Config{
+		TargetName: "broken",
+		Url:        srv.URL + "/broken",
+		OnFailure:  config.OnFailureContinue,
+	})
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=11",
+	})
+	runFlowChain(broken, fetch)
+	assert.Equal(t, int64(5), hits.Load())
+}
+
+func TestFlowOnFailureRetry(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	hits := atomic.NewInt64(0)
+	srv := newFlowTestServer(hits)
+	defer srv.Close()
+
+	broken := newFlowTestWorker(&config.Config{
+		TargetName: "broken",
+		Url:        srv.URL + "/broken",
+		OnFailure:  config.OnFailureRetry,
+	})
+	runFlowChain(broken)
+	assert.Equal(t, int64(5*(1+request.DefaultOnFailureRetries)), broken.GetStat("broken").GetTotal())
+}
+
+func TestFlowWhenSkipsTarget(t *testing.T) {
+	hits := atomic.NewInt64(0)
+	srv := newFlowTestServer(hits)
+	defer srv.Close()
+
+	adminOnly, err := variable.ParseCondition("$role == 'admin'")
+	assert.NoError(t, err)
+	okOnly, err := variable.ParseCondition("$status == 200")
+	assert.NoError(t, err)
+	list := newFlowTestWorker(&config.Config{
+		TargetName: "list",
+		Url:        srv.URL + "/products",
+		VariablesMap: variable.VariableMap{
+			"$role": &variable.VariableEntry{Type: variable.VarString, Path: "data.role"},
+		},
+	})
+	admin := newFlowTestWorker(&config.Config{
+		TargetName: "admin",
+		Url:        srv.URL + "/product?id=11",
+		When:       []*variable.Condition{adminOnly},
+	})
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=12",
+		When:       []*variable.Condition{okOnly},
+	})
+	runFlowChain(list, admin, fetch)
+	assert.Equal(t, int64(5), admin.GetStat("admin").GetSkipped())
+	assert.Equal(t, int64(5), hits.Load())
+}
+
+func TestFlowVariablesAreScopedToTheChain(t *testing.T) {
+	hits := atomic.NewInt64(0)
+	srv := newFlowTestServer(hits)
+	defer srv.Close()
+
+	// the first target of each chain sees none of the variables of
+	// the chains before it
+	noStatus, err := variable.ParseCondition("!$status")
+	assert.NoError(t, err)
+	noRole, err := variable.ParseCondition("!$role")
+	assert.NoError(t, err)
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=11",
+		When:       []*variable.Condition{noStatus, noRole},
+	})
+	list := newFlowTestWorker(&config.Config{
+		TargetName: "list",
+		Url:        srv.URL + "/products",
+		VariablesMap: variable.VariableMap{
+			"$role": &variable.VariableEntry{Type: variable.VarString, Path: "data.role"},
+		},
+	})
+	runFlowChain(fetch, list)
+	assert.Equal(t, int64(0), fetch.GetStat("fetch").GetSkipped())
+	assert.Equal(t, int64(5), hits.Load())
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	vars := variable.VariableMap{
+		"$status": &variable.VariableEntry{Value: "200"},
+		"$name":   &variable.VariableEntry{Value: "robert"},
+		"$empty":  &variable.VariableEntry{Value: ""},
+	}
+	cases := map[string]bool{
+		"$status == 200":     true,
+		"$status != 200":     false,
+		"$status >= 200":     true,
+		"$status < 30":       false,
+		"$name == 'robert'":  true,
+		"$name contains rob": true,
+		"$name":              true,
+		"$empty":             false,
+		"!$missing":          true,
+		"$missing == ''":     true,
+		"$name != $status":   true,
+		"$name != 'a == b'":  true,
+	}
+	for expr, expected := range cases {
+		cond, err := variable.ParseCondition(expr)
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, cond.Evaluate(vars), expr)
+	}
+	_, err := variable.ParseCondition("status == 200 ==")
+	assert.Error(t, err)
+	_, err = variable.ParseCondition("$status == 200 < 300")
+	assert.Error(t, err)
+	_, err = variable.ParseCondition("status")
+	assert.Error(t, err)
+	_, err = variable.ParseCondition("$status == ")
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGraphqlTargetsRun(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var lock sync.Mutex
+	var requests = make(map[string]map[string]interface{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" ||
+			json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		requests[req.OperationName] = req.Variables
+		lock.Unlock()
+		switch {
+		case req.OperationName == "GetUser" && strings.Contains(req.Query, "user(id: $id)"):
+			w.Write([]byte(`{"data": {"user": {"name": "ada", "orderIds": [3, 5]}}}`))
+		case req.OperationName == "AddOrder":
+			w.Write([]byte(`{"data": {"addOrder": {"id": 9}}}`))
+		default:
+			w.Write([]byte(`{"data": null, "errors": [{"message": "unknown operation"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	dir, remove := writeTestConfigFiles(t, map[string]string{
+		"queries/add-order.graphql": "mutation AddOrder($input: OrderInput!) {\n  addOrder(input: $input) { id }\n}\n",
+		"load.yml": `
+main:
+  concurrency: 2
+  request-count: 4
+targets:
+  getUser:
+    url: ` + srv.URL + `/graphql
+    graphql:
+      query: |
+        query GetUser($id: ID!) {
+          user(id: $id) { name orderIds }
+        }
+      variables:
+        id: "7"
+    variables:
+      $userName:
+        type: string
+        path: data.user.name
+      $orderIds:
+        type: array
+        path: data.user.orderIds
+  addOrder:
+    url: ` + srv.URL + `/graphql
+    graphql:
+      query-file: queries/add-order.graphql
+      variables:
+        input:
+          note: for $userName
+          after: $orderIds
+    assertions:
+      body-string: '"id": 9'
+  unknown:
+    url: ` + srv.URL + `/graphql
+    graphql:
+      query: '{ me { id } }'
+`,
+	})
+	defer remove()
+	configs, err := config.NewConfigYaml().LoadConfigs(filepath.Join(dir, "load.yml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	var targets = lt.Result().Scenarios[0].Targets
+	if !assert.Len(t, targets, 3) {
+		return
+	}
+	// the stats of graphql targets are kept by their operations
+	assert.Equal(t, "GetUser", targets[0].Name)
+	assert.Equal(t, "AddOrder", targets[1].Name)
+	assert.Equal(t, "unknown", targets[2].Name)
+	assert.Equal(t, int64(4), targets[0].Success)
+	assert.Equal(t, int64(4), targets[1].Success)
+	// errors of a 200 response fail the request
+	assert.Equal(t, int64(0), targets[2].Success)
+	assert.Equal(t, int64(4), targets[2].OtherErrors)
+	assert.Equal(t, map[string]interface{}{"id": "7"}, requests["GetUser"])
+	assert.Equal(t, map[string]interface{}{
+		"input": map[string]interface{}{"note": "for ada", "after": []interface{}{float64(3), float64(5)}},
+	}, requests["AddOrder"])
+}
+
+func TestGraphqlTargetsAreValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  getUser:
+    url: http://127.0.0.1/graphql
+    httpMethod: GET
+    form-body: '{"query": "{ me }"}'
+    graphql:
+      query: '{ me { id } }'
+      query-file: me.graphql
+      variables:
+        id: $userId
+  listUsers:
+    url: http://127.0.0.1/graphql
+    graphql:
+      operation-name: ListUsers
+`)
+	assert.Equal(t, []string{
+		"line 7: targets.getUser: graphql targets are sent by POST",
+		"line 8: targets.getUser: form-body is not used by graphql targets, their body is built from graphql",
+		"line 9: targets.getUser: graphql has both query and query-file, only one of them is used",
+		"line 9: targets.getUser: variable $userId is not defined by a data-source or a previous target",
+		"line 16: targets.listUsers: graphql needs query or query-file",
+	}, errs)
+}
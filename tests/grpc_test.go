@@ -0,0 +1,366 @@
+package tests
+
+import (
+	"encoding/binary"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/grpc"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const usersProto = `syntax = "proto3";
+package users;
+
+import "google/protobuf/timestamp.proto";
+
+service Users {
+  rpc GetUser (UserRequest) returns (User);
+  // the orders of a user, one message each
+  rpc ListOrders (UserRequest) returns (stream Order);
+  rpc AddRoles (stream Role) returns (User) {}
+}
+
+message UserRequest {
+  string id = 1;
+}
+
+message User {
+  string id = 1;
+  string display_name = 2;
+  repeated string roles = 3;
+  map<string, int64> quotas = 4;
+  Status status = 5;
+  google.protobuf.Timestamp created_at = 6;
+  Address address = 7;
+  repeated int32 scores = 8 [packed = true];
+  oneof contact {
+    string email = 9;
+    string phone = 10;
+  }
+  enum Status {
+    UNKNOWN = 0;
+    ACTIVE = 1;
+  }
+  message Address {
+    string city = 1;
+  }
+}
+
+message Order {
+  int64 id = 1;
+  double total = 2;
+}
+
+message Role {
+  string name = 1;
+}
+`
+
+func writeUsersProto(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var path = filepath.Join(dir, "users.proto")
+	if err := ioutil.WriteFile(path, []byte(usersProto), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGrpcMessagesFromJson(t *testing.T) {
+	var path = writeUsersProto(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	d, err := grpc.LoadProtoFiles([]string{path}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	method, err := d.Method("users.Users/GetUser")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, method.ClientStreaming || method.ServerStreaming)
+	user := d.Message("users.User")
+	var body = `{"id": "7", "display_name": "Jo", "roles": ["admin", "dev"], "quotas": {"disk": 1024},
+		"status": "ACTIVE", "createdAt": "2024-05-01T10:00:00.5Z", "address": {"city": "Oslo"},
+		"scores": [3, -1], "email": "jo@example.com"}`
+	messages, err := grpc.EncodeMessages(user, body, false)
+	if !assert.NoError(t, err) || !assert.Len(t, messages, 1) {
+		return
+	}
+	decoded, err := grpc.DecodeMessages(user, messages, false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": "7", "displayName": "Jo", "roles": ["admin", "dev"], "quotas": {"disk": "1024"},
+		"status": "ACTIVE", "createdAt": "2024-05-01T10:00:00.5Z", "address": {"city": "Oslo"},
+		"scores": [3, -1], "email": "jo@example.com"}`, string(decoded))
+
+	// fields which are not sent have their default values
+	decoded, err = grpc.DecodeMessages(user, [][]byte{{}}, false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": "", "displayName": "", "roles": [], "quotas": {}, "status": "UNKNOWN", "scores": []}`, string(decoded))
+
+	_, err = grpc.EncodeMessages(user, `{"nickname": "x"}`, false)
+	assert.EqualError(t, err, "users.User has no field nickname")
+	_, err = grpc.EncodeMessages(user, `{"status": "GONE"}`, false)
+	assert.EqualError(t, err, "users.User.status must be one of: UNKNOWN, ACTIVE")
+	_, err = grpc.EncodeMessages(user, `{"email": "a", "phone": "b"}`, false)
+	assert.EqualError(t, err, "users.User: only one of email and phone can be set")
+
+	_, err = d.Method("users.Users/DeleteUser")
+	assert.EqualError(t, err, "service users.Users has no method DeleteUser")
+}
+
+// a grpc server of the users service, built on the descriptors of the proto
+func newGrpcTestServer(d *grpc.Descriptors, reflection []byte) *httptest.Server {
+	var handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in = readFrames(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		var status = grpc.OK
+		var out []string
+		switch r.URL.Path {
+		case "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo":
+			if reflection == nil {
+				status = grpc.Unimplemented
+				break
+			}
+			// a file_descriptor_response with the file
+			w.Write(frame(pbBytes(4, pbBytes(1, reflection))))
+		case "/users.Users/GetUser":
+			req, _ := grpc.DecodeMessages(d.Message("users.UserRequest"), in, false)
+			if string(req) != `{"id":"7"}` || r.Header.Get("Authorization") != "Bearer secret" {
+				status = grpc.NotFound
+				break
+			}
+			out = []string{`{"id": "7", "displayName": "Jo"}`}
+		case "/users.Users/ListOrders":
+			// the name of the user is extracted by the target before
+			req, _ := grpc.DecodeMessages(d.Message("users.UserRequest"), in, false)
+			if string(req) != `{"id":"Jo"}` {
+				status = grpc.NotFound
+				break
+			}
+			out = []string{`{"id": 1, "total": 9.5}`, `{"id": 2, "total": 20}`}
+		case "/users.Users/AddRoles":
+			out = []string{`{"id": "7", "roles": ["role-` + strconv.Itoa(len(in)) + `"]}`}
+		default:
+			status = grpc.Unimplemented
+		}
+		for _, o := range out {
+			var name = "users.User"
+			if r.URL.Path == "/users.Users/ListOrders" {
+				name = "users.Order"
+			}
+			messages, _ := grpc.EncodeMessages(d.Message(name), o, false)
+			w.Write(frame(messages[0]))
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(status)))
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.Protocols = &http.Protocols{}
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	return srv
+}
+
+func readFrames(r io.Reader) [][]byte {
+	var messages = make([][]byte, 0)
+	var prefix [5]byte
+	for {
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			return messages
+		}
+		var m = make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		io.ReadFull(r, m)
+		messages = append(messages, m)
+	}
+}
+
+func frame(m []byte) []byte {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(m)))
+	return append(prefix[:], m...)
+}
+
+func TestGrpcTargetsRun(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var path = writeUsersProto(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	d, err := grpc.LoadProtoFiles([]string{path}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := newGrpcTestServer(d, nil)
+	defer srv.Close()
+
+	var document = `
+main:
+  concurrency: 2
+  request-count: 4
+targets:
+  getUser:
+    protocol: grpc
+    url: ` + srv.URL + `
+    grpc:
+      method: users.Users/GetUser
+      proto: ` + path + `
+    headers:
+      authorization: Bearer secret
+    form-body: '{"id": "7"}'
+    variables:
+      $userName:
+        type: string
+        path: displayName
+  listOrders:
+    protocol: grpc
+    url: ` + srv.URL + `
+    grpc:
+      method: users.Users/ListOrders
+      proto: ` + path + `
+    form-body: '{"id": "$userName"}'
+    assertions:
+      body-string: '"total":9.5'
+  addRoles:
+    protocol: grpc
+    url: ` + srv.URL + `
+    grpc:
+      method: users.Users.AddRoles
+      proto: ` + path + `
+    form-body: '[{"name": "a"}, {"name": "b"}]'
+    assertions:
+      body-string: role-2
+  missingUser:
+    protocol: grpc
+    url: ` + srv.URL + `
+    grpc:
+      method: users.Users/GetUser
+      proto: ` + path + `
+    form-body: '{"id": "8"}'
+`
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(document))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	var targets = lt.Result().Scenarios[0].Targets
+	if !assert.Len(t, targets, 4) {
+		return
+	}
+	for _, sm := range targets[:3] {
+		assert.Equal(t, int64(4), sm.Success, sm.Name)
+	}
+	assert.Equal(t, int64(0), targets[3].Success)
+	assert.Equal(t, map[string]int64{"grpc-5": 4}, targets[3].Failed)
+}
+
+func TestGrpcServerReflection(t *testing.T) {
+	var path = writeUsersProto(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	d, err := grpc.LoadProtoFiles([]string{path}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// users.proto with UserRequest, User (without its enum, map and nested
+	// message) and GetUser, as protoc writes it
+	var file = append(pbBytes(1, []byte("users.proto")), pbBytes(2, []byte("users"))...)
+	file = append(file, pbBytes(4, append(pbBytes(1, []byte("UserRequest")), pbField("id", 1, false)...))...)
+	var user = pbBytes(1, []byte("User"))
+	user = append(user, pbField("id", 1, false)...)
+	user = append(user, pbField("display_name", 2, false)...)
+	user = append(user, pbField("roles", 3, true)...)
+	file = append(file, pbBytes(4, user)...)
+	var method = pbBytes(1, []byte("GetUser"))
+	method = append(method, pbBytes(2, []byte(".users.UserRequest"))...)
+	method = append(method, pbBytes(3, []byte(".users.User"))...)
+	file = append(file, pbBytes(6, append(pbBytes(1, []byte("Users")), pbBytes(2, method)...))...)
+	file = append(file, pbBytes(12, []byte("proto3"))...)
+
+	srv := newGrpcTestServer(d, file)
+	defer srv.Close()
+	client := &http.Client{Transport: grpc.NewTransport()}
+	reflected, err := grpc.Reflect(client, srv.URL, nil, "users.Users")
+	if !assert.NoError(t, err) {
+		return
+	}
+	getUser, err := reflected.Method("users.Users/GetUser")
+	if !assert.NoError(t, err) {
+		return
+	}
+	messages, err := grpc.EncodeMessages(getUser.Input, `{"id": "7"}`, false)
+	assert.NoError(t, err)
+	resp, err := grpc.Invoke(client, srv.URL, getUser, http.Header{"Authorization": {"Bearer secret"}}, messages)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, grpc.OK, resp.Status)
+	body, err := grpc.DecodeMessages(getUser.Output, resp.Messages, false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": "7", "displayName": "Jo", "roles": []}`, string(body))
+
+	// without the server reflection, the call fails with its status
+	noReflection := newGrpcTestServer(d, nil)
+	defer noReflection.Close()
+	_, err = grpc.Reflect(client, noReflection.URL, nil, "users.Users")
+	assert.EqualError(t, err, "server reflection failed: UNIMPLEMENTED")
+}
+
+// a length delimited field of a protobuf message
+func pbBytes(number int, b []byte) []byte {
+	var out = []byte{byte(number<<3 | 2)}
+	out = append(out, byte(len(b)))
+	if len(b) > 127 {
+		out = append(out[:1], byte(len(b)&0x7f|0x80), byte(len(b)>>7))
+	}
+	return append(out, b...)
+}
+
+// a FieldDescriptorProto of a string field
+func pbField(name string, number int, repeated bool) []byte {
+	var label = byte(1)
+	if repeated {
+		label = 3
+	}
+	var f = pbBytes(1, []byte(name))
+	f = append(f, 3<<3, byte(number), 4<<3, label, 5<<3, 9)
+	return pbBytes(2, f)
+}
+
+func TestGrpcTargetsAreValidated(t *testing.T) {
+	var path = writeUsersProto(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  getUser:
+    protocol: grpc
+    url: http://127.0.0.1:50051
+    grpc:
+      method: users.Users/FindUser
+      proto: `+path+`
+  listOrders:
+    protocol: grpc
+    url: http://127.0.0.1:50051
+    assertions:
+      status-is-ok: 200
+  login:
+    protocol: soap
+    url: http://127.0.0.1/login
+`)
+	assert.Equal(t, []string{
+		"line 8: targets.getUser: service users.Users has no method FindUser",
+		"line 11: targets.listOrders: grpc targets need grpc.method, like helloworld.Greeter/SayHello",
+		"line 14: targets.listOrders: status-is-ok is for http targets, grpc targets use grpc-status",
+		"line 17: targets.login: protocol must be one of: http, grpc, websocket, tcp, udp",
+	}, errs)
+}
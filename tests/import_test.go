@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/importer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testHar = `{"log": {"entries": [
+  {"request": {"method": "POST", "url": "https://api.example.com/login",
+    "headers": [{"name": ":authority", "value": "api.example.com"}, {"name": "Content-Type", "value": "application/json"}],
+    "postData": {"mimeType": "application/json", "text": "{\"user\":\"bob\"}"}},
+   "response": {"content": {"mimeType": "application/json", "text": "{\"data\":{\"token\":\"tok-abc123\",\"user\":{\"id\":48213}}}"}}},
+  {"request": {"method": "GET", "url": "https://cdn.example.com/logo.png", "headers": []},
+   "response": {"content": {"mimeType": "image/png"}}},
+  {"request": {"method": "GET", "url": "https://api.example.com/users/48213",
+    "headers": [{"name": "Authorization", "value": "Bearer tok-abc123"}, {"name": "X-Client", "value": "web-1.2.3"}]},
+   "response": {"content": {"mimeType": "application/json", "text": "{\"id\":48213,\"orders\":[{\"id\":90001}]}"}}},
+  {"request": {"method": "GET", "url": "https://tracker.example.com/collect", "headers": []},
+   "response": {"content": {"mimeType": "application/json", "text": "{}"}}},
+  {"request": {"method": "GET", "url": "https://api.example.com/orders/90001",
+    "headers": [{"name": "Authorization", "value": "Bearer tok-abc123"}, {"name": "X-Client", "value": "web-1.2.3"}]},
+   "response": {"content": {"mimeType": "application/json", "text": "{}"}}}
+]}}`
+
+func TestImportHar(t *testing.T) {
+	requests, err := importer.ParseHar([]byte(testHar), importer.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, requests, 4, "the image is not imported")
+	im := importer.New("session.har", requests, importer.Options{Hosts: []string{"api.example.com"}})
+	if !assert.Len(t, im.Targets, 3) {
+		return
+	}
+	assert.Equal(t, "post-login", im.Targets[0].Name)
+	assert.Equal(t, "get-users", im.Targets[1].Name)
+	assert.Equal(t, "get-orders", im.Targets[2].Name)
+	assert.Equal(t, []importer.Header{{Name: "Content-Type", Value: "application/json"}}, im.Targets[0].Request.Headers)
+
+	assert.Equal(t, []*importer.Variable{
+		{Name: "$token", Type: "string", Path: "data.token", Value: "tok-abc123"},
+		{Name: "$id", Type: "number", Path: "data.user.id", Value: "48213"},
+	}, im.Targets[0].Variables)
+	// 48213 is sent before get-users returns it, so it is not taken from there
+	assert.Equal(t, []*importer.Variable{
+		{Name: "$orders_id", Type: "number", Path: "orders.0.id", Value: "90001"},
+	}, im.Targets[1].Variables)
+	assert.Equal(t, "https://api.example.com/users/$id", im.Targets[1].Request.Url)
+	assert.Equal(t, "Bearer $token", im.Targets[1].Request.Headers[0].Value)
+	assert.Equal(t, "https://api.example.com/orders/$orders_id", im.Targets[2].Request.Url)
+
+	if assert.Len(t, im.Reused, 1) {
+		assert.Equal(t, "web-1.2.3", im.Reused[0].Value)
+		assert.Equal(t, "get-users", im.Reused[0].Target)
+		assert.Equal(t, []string{"header X-Client of get-users", "header X-Client of get-orders"}, im.Reused[0].Uses)
+	}
+
+	// the config is loaded as it is written
+	b, err := im.Yaml()
+	if !assert.NoError(t, err) {
+		return
+	}
+	file, remove := writeTestConfig(t, string(b))
+	defer remove()
+	configs, err := config.NewConfigYaml().LoadConfigs(file)
+	if !assert.NoError(t, err) || !assert.Len(t, configs, 3) {
+		return
+	}
+	assert.Equal(t, "post-login", configs[0].TargetName)
+	assert.Equal(t, `{"user":"bob"}`, configs[0].FormBody)
+	assert.Equal(t, "data.token", configs[0].VariablesMap["$token"].Path)
+	assert.Equal(t, "Bearer $token", configs[1].Headers.Get("Authorization"))
+	assert.Equal(t, config.StrategySeq, configs[2].Strategy)
+
+	_, err = importer.ParseHar([]byte(`{"log": {"entries": []}}`), importer.Options{})
+	assert.EqualError(t, err, "the har file has no entries")
+}
+
+func TestImportCurl(t *testing.T) {
+	req, err := importer.ParseCurl(`curl 'https://api.example.com/login' -H 'Content-Type: application/json' ` +
+		`-H "X-Trace: a\"b" --data-raw $'{"user":"bob\'s"}' --compressed -sSL`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "https://api.example.com/login", req.Url)
+	assert.Equal(t, []importer.Header{{Name: "Content-Type", Value: "application/json"}, {Name: "X-Trace", Value: `a"b`}}, req.Headers)
+	assert.Equal(t, `{"user":"bob's"}`, req.Body)
+
+	req, err = importer.ParseCurl(`curl -XPUT -u bob:secret -d a=1 -d b=2 example.com/items/12`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "PUT", req.Method)
+	assert.Equal(t, "http://example.com/items/12", req.Url)
+	assert.Equal(t, "a=1&b=2", req.Body)
+	assert.Equal(t, []importer.Header{
+		{Name: "Authorization", Value: "Basic Ym9iOnNlY3JldA=="},
+		{Name: "Content-Type", Value: "application/x-www-form-urlencoded"},
+	}, req.Headers)
+
+	req, err = importer.ParseCurl(`curl -G https://example.com/search --data-urlencode 'q=load test'`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/search?q=load+test", req.Url)
+		assert.Equal(t, "", req.Method)
+	}
+
+	_, err = importer.ParseCurl(`curl --upload-file x https://example.com`)
+	assert.EqualError(t, err, "curl option --upload-file is not supported")
+	_, err = importer.ParseCurl(`curl -H 'Accept: x`)
+	assert.EqualError(t, err, "the command has an unclosed ' quote")
+
+	assert.Equal(t, []string{
+		"curl https://example.com/a    -H 'X-A: 1'",
+		"curl https://example.com/b",
+	}, importer.SplitCurlCommands("# session\ncurl https://example.com/a \\\n  -H 'X-A: 1'\n\ncurl https://example.com/b\n"))
+}
@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configures the logger for a test, the one of TestMain is set back
+// once the test ends
+func configureLogger(t *testing.T, opts *logger.Options) {
+	logger.LogEnabled = true
+	if !assert.NoError(t, logger.Configure(opts)) {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		logger.Initialize(logger.LogModeStdErr, "")
+	})
+}
+
+// a directory removed once the test ends
+func tempLogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "load48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func readLogLines(t *testing.T, file string) []string {
+	b, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestLoggerSamplesRepeatedMessages(t *testing.T) {
+	var file = filepath.Join(tempLogDir(t), "logs", "test.log")
+	configureLogger(t, &logger.Options{File: file, SampleFirst: 10, SampleEvery: 100})
+	for i := 0; i < 1000; i++ {
+		logger.Error("request failed", "connection reset")
+	}
+	for i := 0; i < 5; i++ {
+		logger.Error("assertion failed", "status 500")
+	}
+	logger.Flush()
+
+	var lines = readLogLines(t, file)
+	// 10 first ones, one of every 100 of the next 990, the other
+	// key and how many were sampled out
+	assert.Len(t, lines, 25)
+	assert.True(t, strings.HasPrefix(lines[0], "[error] request failed: connection reset "))
+	assert.Contains(t, lines[24], "[warn] request failed: 981 of 1000 messages are sampled out")
+}
+
+func TestLoggerLevelAndJsonFormat(t *testing.T) {
+	var file = filepath.Join(tempLogDir(t), "test.log")
+	configureLogger(t, &logger.Options{File: file, Level: logger.LogLevelWarn, Format: logger.FormatJson})
+	logger.Debug("debug", "hidden")
+	logger.Info("info", "hidden")
+	logger.Warn("slow response", "2s")
+	logger.Error("request failed", "timeout")
+	logger.Flush()
+
+	var lines = readLogLines(t, file)
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	var entry map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "request failed", entry["key"])
+	assert.Equal(t, "timeout", entry["msg"])
+	_, err := time.Parse(time.RFC3339, entry["time"])
+	assert.NoError(t, err)
+}
+
+func TestLoggerRotatesTheFileBySize(t *testing.T) {
+	var file = filepath.Join(tempLogDir(t), "test.log")
+	configureLogger(t, &logger.Options{File: file, MaxSize: 200, MaxBackups: 2, SampleEvery: 1})
+	for i := 0; i < 20; i++ {
+		logger.Error("request failed", "connection reset by peer")
+	}
+	logger.Flush()
+
+	for _, name := range []string{file, file + ".1", file + ".2"} {
+		info, err := os.Stat(name)
+		if assert.NoError(t, err) {
+			assert.True(t, info.Size() <= 200, name)
+		}
+	}
+	_, err := os.Stat(file + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoggerDropsMessagesInsteadOfBlocking(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr = os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	configureLogger(t, &logger.Options{Mode: logger.LogModeStdErr, BufferSize: 2, SampleEvery: 1})
+
+	// nothing reads the pipe, so the first large message blocks the writer
+	var large = strings.Repeat("x", 128*1024)
+	var done = make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			logger.Error("request failed", large)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked on a full queue")
+	}
+
+	var read = make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		read <- b
+	}()
+	logger.Close()
+	w.Close()
+	var out = string(<-read)
+	assert.Regexp(t, `\[warn\] logger: 9\d messages are dropped, the queue is full`, out)
+}
+
+func TestLoggerWorksWithoutInitialize(t *testing.T) {
+	logger.Close()
+	defer logger.Initialize(logger.LogModeStdErr, "")
+	assert.NotPanics(t, func() { logger.Error("request failed", "before initialize") })
+
+	// InfoOut is not a log, it is written even when logs are disabled
+	var out = &bytes.Buffer{}
+	logger.Out = out
+	logger.LogEnabled = false
+	defer func() {
+		logger.Out = nil
+		logger.LogEnabled = true
+	}()
+	logger.InfoOut("running targets...", "")
+	assert.Contains(t, out.String(), "[info] running targets...: ")
+}
+
+func TestInfoOutWritesToTheStdoutOfTheCall(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout = os.Stdout
+	os.Stdout = w
+	logger.InfoOut("running targets...", "")
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := ioutil.ReadAll(r)
+	assert.Contains(t, string(printed), "[info] running targets...: ")
+}
+
+func TestLogsSectionIsValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+logs:
+  enabled: true
+  level: verbose
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+`)
+	assert.Equal(t, []string{
+		"line 4: logs: logs.level must be one of: debug, info, warn, error, fatal",
+	}, errs)
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 1
+logs:
+  enabled: true
+  mode: stderr
+  format: json
+  max-size: 10
+  sample:
+    first: 5
+    every: 50
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, &logger.Options{Mode: logger.LogModeStdErr, Level: logger.LogLevelInfo, Format: logger.FormatJson,
+			MaxSize: 10 * 1024 * 1024, MaxBackups: logger.DefaultMaxBackups, SampleFirst: 5, SampleEvery: 50,
+			BufferSize: logger.DefaultBufferSize}, configs[0].Log)
+	}
+}
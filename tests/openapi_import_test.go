@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/importer"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+var testOpenApi = `openapi: 3.0.3
+info: {title: Shop, version: "1"}
+servers:
+  - url: https://{env}.example.com/v1
+    variables:
+      env: {default: api}
+security:
+  - bearerAuth: []
+paths:
+  /users:
+    post:
+      operationId: createUser
+      tags: [users]
+      summary: Creates a user
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/NewUser'}
+      responses:
+        "201":
+          description: created
+          content:
+            application/json; charset=utf-8:
+              schema: {$ref: '#/components/schemas/User'}
+        "400": {description: bad}
+  /users/{userId}:
+    parameters:
+      - {name: userId, in: path, required: true, schema: {type: integer}}
+    get:
+      operationId: getUser
+      tags: [users]
+      parameters:
+        - {name: X-Request-Id, in: header, required: true, schema: {type: string, format: uuid}}
+        - {name: fields, in: query, required: true, schema: {type: string, enum: [all, short]}}
+        - {name: debug, in: query, schema: {type: boolean}}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/User'}
+        "404": {description: missing}
+  /products/{sku}:
+    get:
+      tags: [products]
+      security: [{apiKey: []}]
+      parameters:
+        - {name: sku, in: path, required: true, example: AB-12}
+      responses:
+        "200": {description: ok, content: {text/plain: {schema: {type: string}}}}
+  /login:
+    post:
+      operationId: login
+      security: []
+      requestBody:
+        content:
+          application/x-www-form-urlencoded:
+            schema:
+              type: object
+              properties:
+                user: {type: string, example: bob}
+                password: {type: string, format: password}
+      responses:
+        "204": {description: ok}
+components:
+  securitySchemes:
+    bearerAuth: {type: http, scheme: bearer}
+    apiKey: {type: apiKey, in: header, name: X-Api-Key}
+  schemas:
+    NewUser:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string, example: Bob}
+        email: {type: string, format: email}
+        age: {type: integer, minimum: 18}
+        roles: {type: array, items: {type: string, enum: [admin, user]}}
+        address: {$ref: '#/components/schemas/Address'}
+    Address:
+      properties:
+        city: {type: string}
+    User:
+      allOf:
+        - {$ref: '#/components/schemas/NewUser'}
+        - type: object
+          properties:
+            id: {type: integer, readOnly: true}
+            createdAt: {type: string, format: date-time, readOnly: true}
+`
+
+func TestImportOpenApi(t *testing.T) {
+	im, err := importer.ParseOpenApi("spec.yaml", []byte(testOpenApi), importer.OpenApiOptions{})
+	if !assert.NoError(t, err) || !assert.Len(t, im.Targets, 4) {
+		return
+	}
+	create, get, product, login := im.Targets[0], im.Targets[1], im.Targets[2], im.Targets[3]
+	assert.Equal(t, "createUser", create.Name)
+	assert.Equal(t, "https://api.example.com/v1/users", create.Request.Url)
+	// properties keep their order, readOnly ones are left out of the body
+	assert.Equal(t, `{"name":"Bob","email":"user@example.com","age":18,"roles":["admin"],"address":{"city":"string"}}`, create.Request.Body)
+	assert.Equal(t, []importer.Header{
+		{Name: "Authorization", Value: "Bearer ${BEARER_AUTH}"},
+		{Name: "Content-Type", Value: "application/json"},
+	}, create.Request.Headers)
+	assert.Equal(t, []importer.Assertion{
+		{Name: "status-is-ok", Value: "201"},
+		{Name: "content-type", Value: "application/json; charset=utf-8"},
+	}, create.Assertions)
+	assert.Equal(t, []*importer.Variable{{Name: "$userId", Type: "number", Path: "id"}}, create.Variables)
+
+	// the path param is taken from the response of createUser
+	assert.Equal(t, "https://api.example.com/v1/users/$userId?fields=all", get.Request.Url)
+	assert.Equal(t, []string{"createUser"}, get.DependsOn)
+	assert.Equal(t, importer.Header{Name: "X-Request-Id", Value: "3fa85f64-5717-4562-b3fc-2c963f66afa6"}, get.Request.Headers[0])
+
+	assert.Equal(t, "get-products", product.Name)
+	assert.Equal(t, "https://api.example.com/v1/products/AB-12", product.Request.Url)
+	assert.Equal(t, []string{"{sku} is the example AB-12, no selected operation returns it"}, product.Notes)
+	assert.Equal(t, []importer.Header{{Name: "X-Api-Key", Value: "${API_KEY}"}}, product.Request.Headers)
+
+	assert.Equal(t, "user=bob&password=password", login.Request.Body)
+	assert.Equal(t, []importer.Assertion{{Name: "status-is-ok", Value: "204"}}, login.Assertions)
+
+	// the config is loaded as it is written
+	b, err := im.Yaml()
+	if !assert.NoError(t, err) {
+		return
+	}
+	file, remove := writeTestConfig(t, string(b))
+	defer remove()
+	os.Setenv("BEARER_AUTH", "secret")
+	defer os.Unsetenv("BEARER_AUTH")
+	os.Setenv("API_KEY", "key")
+	defer os.Unsetenv("API_KEY")
+	configs, err := config.NewConfigYaml().LoadConfigs(file)
+	if !assert.NoError(t, err) || !assert.Len(t, configs, 4) {
+		return
+	}
+	assert.Equal(t, "Bearer secret", configs[1].Headers.Get("Authorization"))
+	assert.True(t, configs[1].Assertions.Exists("content-type"))
+
+	im, err = importer.ParseOpenApi("spec.yaml", []byte(testOpenApi), importer.OpenApiOptions{
+		Operations: []string{"GET /users/{userId}"}, Server: "http://127.0.0.1:3001"})
+	if assert.NoError(t, err) && assert.Len(t, im.Targets, 1) {
+		// createUser is not selected, the example is used
+		assert.Equal(t, "http://127.0.0.1:3001/users/1?fields=all", im.Targets[0].Request.Url)
+	}
+	_, err = importer.ParseOpenApi("spec.yaml", []byte(testOpenApi), importer.OpenApiOptions{Tags: []string{"orders"}})
+	assert.EqualError(t, err, "no operation has the tag orders")
+	_, err = importer.ParseOpenApi("spec.yaml", []byte("swagger: \"2.0\""), importer.OpenApiOptions{})
+	assert.EqualError(t, err, "swagger 2 documents are not supported, convert it to OpenAPI 3 first")
+}
@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"context"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// a server which answers 503 to the first failures requests of each id
+func newRetryTestServer(failures int64) *httptest.Server {
+	var hits = map[string]*atomic.Int64{"a": atomic.NewInt64(0), "b": atomic.NewInt64(0)}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits[r.URL.Query().Get("id")].Inc() <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+}
+
+func TestRetryConfigIsParsed(t *testing.T) {
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 1
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+    retry:
+      max-attempts: 5
+      backoff: jittered
+      delay: 100ms
+      max-delay: 2s
+      on: [5xx, 429, timeout]
+  users:
+    url: http://127.0.0.1/users
+    retry:
+      on: connection-refused
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, &config.RetryConfig{
+		MaxAttempts: 5,
+		Backoff:     curr.BackoffJittered,
+		Delay:       100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		On:          []string{"5xx", "429", config.RetryOnTimeout},
+	}, configs[0].Retry)
+	assert.Equal(t, &config.RetryConfig{
+		MaxAttempts: config.DefaultRetryMaxAttempts,
+		Backoff:     curr.BackoffConstant,
+		On:          []string{config.RetryOnConnRefused},
+	}, configs[1].Retry)
+}
+
+func TestRetryConfigIsValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+    retry:
+      backoff: linear
+  users:
+    url: http://127.0.0.1/users
+    retry:
+      backoff: exponential
+  items:
+    url: http://127.0.0.1/items
+    retry:
+      on: [5xx, refused]
+`)
+	assert.Equal(t, []string{
+		"line 7: targets.orders: retry.backoff must be one of: constant, exponential, jittered",
+		"line 11: targets.users: retry.delay is needed by the exponential backoff",
+		"line 15: targets.items: retry.on must be timeout, connection-refused, assertion, a status code like 503 or a class like 5xx, not refused",
+	}, errs)
+}
+
+func TestRetryOnMatchesFailures(t *testing.T) {
+	var rc = &config.RetryConfig{On: []string{"5xx", "429", config.RetryOnTimeout}}
+	assert.True(t, rc.RetriesOn(config.RetryOnAssertion, 503))
+	assert.True(t, rc.RetriesOn(config.RetryOnAssertion, 429))
+	assert.True(t, rc.RetriesOn(config.RetryOnTimeout, 0))
+	assert.False(t, rc.RetriesOn(config.RetryOnAssertion, 404))
+	assert.False(t, rc.RetriesOn(config.RetryOnConnRefused, 0))
+	assert.True(t, (&config.RetryConfig{}).RetriesOn("", 0))
+}
+
+func TestRetriedRequestsSucceedAtLast(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := newRetryTestServer(1)
+	defer srv.Close()
+
+	orders := newFlowTestWorker(&config.Config{
+		TargetName: "orders",
+		Url:        srv.URL + "/?id=a",
+		Retry: &config.RetryConfig{
+			MaxAttempts: 3,
+			Backoff:     curr.BackoffExponential,
+			Delay:       time.Millisecond,
+			On:          []string{"5xx"},
+		},
+	})
+	runFlowChain(orders)
+	var sm = orders.GetStat("orders").Summary("orders")
+	// the first attempt of one of the requests fails
+	assert.Equal(t, int64(6), sm.TotalSent)
+	assert.Equal(t, int64(1), sm.Retries)
+	assert.Equal(t, int64(5), sm.RetryRequests)
+	assert.Equal(t, int64(4), sm.FirstAttemptSuccess)
+	assert.Equal(t, int64(5), sm.FinalSuccess)
+	assert.Equal(t, float64(80), sm.FirstAttemptSuccessRate())
+	assert.Equal(t, float64(100), sm.FinalSuccessRate())
+}
+
+func TestFailuresNotInRetryOnAreNotRetried(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := newRetryTestServer(2)
+	defer srv.Close()
+
+	orders := newFlowTestWorker(&config.Config{
+		TargetName: "orders",
+		Url:        srv.URL + "/?id=b",
+		Retry:      &config.RetryConfig{MaxAttempts: 3, Backoff: curr.BackoffConstant, On: []string{"429", config.RetryOnTimeout}},
+	})
+	runFlowChain(orders)
+	var sm = orders.GetStat("orders").Summary("orders")
+	assert.Equal(t, int64(5), sm.TotalSent)
+	assert.Equal(t, int64(0), sm.Retries)
+	assert.Equal(t, int64(3), sm.FinalSuccess)
+}
+
+func TestRefusedConnectionsAreRetried(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := newRetryTestServer(0)
+	var url = srv.URL
+	srv.Close()
+
+	orders := newFlowTestWorker(&config.Config{
+		TargetName: "orders",
+		Url:        url + "/?id=a",
+		Retry:      &config.RetryConfig{MaxAttempts: 2, Backoff: curr.BackoffConstant, On: []string{config.RetryOnConnRefused}},
+	})
+	runFlowChain(orders)
+	var sm = orders.GetStat("orders").Summary("orders")
+	assert.Equal(t, int64(5), sm.Retries)
+	assert.Equal(t, int64(5), sm.RetryRequests)
+	assert.Equal(t, int64(0), sm.FinalSuccess)
+	assert.Equal(t, float64(0), sm.FinalSuccessRate())
+}
+
+func TestRetryStatsAreMerged(t *testing.T) {
+	var a, b = stats.NewStatsManager("a"), stats.NewStatsManager("b")
+	a.IncrRetries(2)
+	a.AddRetriedRequest(false, true)
+	b.AddRetriedRequest(true, true)
+	b.AddRetriedRequest(false, false)
+	var merged = a.Merge(b)
+	var sm = merged.Summary("all")
+	assert.Equal(t, int64(2), sm.Retries)
+	assert.Equal(t, int64(3), sm.RetryRequests)
+	assert.Equal(t, int64(1), sm.FirstAttemptSuccess)
+	assert.Equal(t, int64(2), sm.FinalSuccess)
+}
+
+func TestRetryWaitsEndWithTheTest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	var newConfigs = func(main *config.YamlConfigSectionMain) []*config.Config {
+		configs, err := config.NewConfigYaml().LoadConfigs(&config.YamlConfigHolder{
+			Main: main,
+			Targets: (&config.YamlConfigTargets{}).Add("orders", &config.YamlConfigSectionTarget{Url: srv.URL, MaxTimeout: 5,
+				Retry: &config.YamlConfigRetry{MaxAttempts: 10, Backoff: curr.BackoffExponential, Delay: "500ms", MaxDelay: "1m"}}),
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return configs
+	}
+
+	// by the context of the test
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	_, err := loadtest.Run(ctx, newConfigs(&config.YamlConfigSectionMain{Concurrency: 2, NumberOfRequests: 2}), nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 2*time.Second, time.Since(start).String())
+
+	// by the end of its duration
+	start = time.Now()
+	_, err = loadtest.Run(context.Background(), newConfigs(&config.YamlConfigSectionMain{Concurrency: 2, Duration: "200ms"}), nil)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second, time.Since(start).String())
+}
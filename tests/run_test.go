@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a config built by a program, a single target of the url
+func runConfig(t *testing.T, url string, main *config.YamlConfigSectionMain) []*config.Config {
+	configs, err := config.NewConfigYaml().LoadConfigs(&config.YamlConfigHolder{
+		Main:    main,
+		Targets: (&config.YamlConfigTargets{}).Add("orders", &config.YamlConfigSectionTarget{Url: url, MaxTimeout: 5}),
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return configs
+}
+
+func TestRunsTestsSideBySide(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	// nothing is printed to stdout, and the global logger is not used
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout = os.Stdout
+	os.Stdout = w
+	logger.LogEnabled = false
+	defer func() {
+		os.Stdout = stdout
+		logger.LogEnabled = true
+	}()
+
+	var okConfigs = runConfig(t, ok.URL, &config.YamlConfigSectionMain{Concurrency: 5, NumberOfRequests: 100})
+	var failingConfigs = runConfig(t, failing.URL, &config.YamlConfigSectionMain{Concurrency: 2, NumberOfRequests: 30})
+	var okOut, okLogs, failingOut, failingLogs = &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	var okResult, failingResult *loadtest.Result
+	var okErr, failingErr error
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		okResult, okErr = loadtest.Run(context.Background(), okConfigs, &loadtest.Options{Output: okOut, Logs: okLogs})
+	}()
+	go func() {
+		defer wg.Done()
+		failingResult, failingErr = loadtest.Run(context.Background(), failingConfigs, &loadtest.Options{Output: failingOut, Logs: failingLogs})
+	}()
+	wg.Wait()
+	w.Close()
+	printed, _ := ioutil.ReadAll(r)
+
+	assert.NoError(t, okErr)
+	assert.NoError(t, failingErr)
+	if assert.NotNil(t, okResult) && assert.NotNil(t, failingResult) {
+		var okTarget, failingTarget = okResult.Scenarios[0].Targets[0], failingResult.Scenarios[0].Targets[0]
+		assert.Equal(t, int64(100), okTarget.TotalSent)
+		assert.Equal(t, int64(100), okTarget.Success)
+		assert.Equal(t, int64(30), failingTarget.TotalSent)
+		assert.Equal(t, int64(30), failingTarget.Failed["503"])
+	}
+	assert.Empty(t, string(printed))
+	assert.Contains(t, okOut.String(), "running targets...")
+	assert.Contains(t, failingOut.String(), "running targets...")
+	assert.Empty(t, okLogs.String())
+	assert.Contains(t, failingLogs.String(), "[error] assertion failed [status-is-ok]")
+}
+
+func TestRunIsStoppedByTheContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	result, err := loadtest.Run(ctx, runConfig(t, srv.URL, &config.YamlConfigSectionMain{Concurrency: 4, Duration: "1m"}), nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	if assert.NotNil(t, result) {
+		var target = result.Scenarios[0].Targets[0]
+		assert.True(t, target.TotalSent > 0)
+		assert.Equal(t, target.TotalSent, target.Success)
+	}
+}
+
+func TestRunReturnsErrors(t *testing.T) {
+	_, err := loadtest.Run(context.Background(), nil, nil)
+	assert.EqualError(t, err, "at least one config must be specified")
+
+	_, err = config.NewConfigYaml().LoadConfigs(&config.YamlConfigHolder{
+		Main:    &config.YamlConfigSectionMain{Concurrency: 1, NumberOfRequests: 1},
+		Targets: (&config.YamlConfigTargets{}).Add("orders", &config.YamlConfigSectionTarget{Url: "http://127.0.0.1/orders", Method: "FETCH"}),
+	})
+	assert.EqualError(t, err, "targets.orders: httpMethod must be one of: GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE")
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"testing"
+)
+
+func TestSmoothWeightedScheduler(t *testing.T) {
+	s := request.NewScheduler(config.SchedulerSmooth, []int{70, 25, 5})
+	counts := make([]int, 3)
+	for i := 0; i < 100; i++ {
+		counts[s.Next()]++
+	}
+	assert.Equal(t, []int{70, 25, 5}, counts)
+
+	// picks are spread, not sent in bursts
+	s = request.NewScheduler(config.SchedulerSmooth, []int{2, 1})
+	picks := make([]int, 0)
+	for i := 0; i < 6; i++ {
+		picks = append(picks, s.Next())
+	}
+	assert.Equal(t, []int{0, 1, 0, 0, 1, 0}, picks)
+}
+
+func TestRandomWeightedScheduler(t *testing.T) {
+	s := request.NewScheduler(config.SchedulerRandom, []int{70, 25, 5, 0})
+	counts := make([]int, 4)
+	for i := 0; i < 101000; i++ {
+		counts[s.Next()]++
+	}
+	// a weight of zero is considered as 1
+	assert.InDelta(t, 70000, counts[0], 2000)
+	assert.InDelta(t, 25000, counts[1], 2000)
+	assert.InDelta(t, 5000, counts[2], 1000)
+	assert.InDelta(t, 1000, counts[3], 500)
+}
+
+func TestWeightedExecution(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	browse := newFlowTestWorker(&config.Config{TargetName: "browse", Url: srv.URL + "/product?id=11", Weight: 2})
+	search := newFlowTestWorker(&config.Config{TargetName: "search", Url: srv.URL + "/product?id=12", Weight: 1})
+	checkout := newFlowTestWorker(&config.Config{TargetName: "checkout", Url: srv.URL + "/product?id=13", Weight: 1})
+	tg := request.NewTargetManager(request.StrategyWeighted, 2, 20)
+	tg.Workers = []*request.RequestWorker{browse, search, checkout}
+	tg.Run(request.ExecWorker)
+	assert.Equal(t, int64(10), browse.GetStat("browse").GetTotal())
+	assert.Equal(t, int64(5), search.GetStat("search").GetTotal())
+	assert.Equal(t, int64(5), checkout.GetStat("checkout").GetTotal())
+}
+
+func TestWeightsAreValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 10
+  strategy: weighted
+targets:
+  browse:
+    url: http://127.0.0.1/browse
+  search:
+    url: http://127.0.0.1/search
+    weight: 0
+  checkout:
+    url: http://127.0.0.1/checkout
+    weight: -2
+`)
+	assert.Equal(t, []string{
+		"line 10: targets.search: weight must be 1 or more, leave the target out of the test to send it no requests",
+		"line 13: targets.checkout: weight must be 1 or more, leave the target out of the test to send it no requests",
+	}, errs)
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`main:
+  concurrency: 1
+  request-count: 10
+  strategy: weighted
+targets:
+  browse:
+    url: http://127.0.0.1/browse
+  search:
+    url: http://127.0.0.1/search
+    weight: 3
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, configs[0].Weight)
+		assert.Equal(t, 3, configs[1].Weight)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/mostafatalebi/loadtest/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHmacSignatureIsOverTheFinalRequest(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	var verified = atomic.NewInt64(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/today" {
+			w.Write([]byte(`{"day": "monday"}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var bodyHash = sha256.Sum256(body)
+		var canonical = r.Method + "\n" + r.URL.Path + "\n" + "content-type:" + r.Header.Get("Content-Type") +
+			"\n" + hex.EncodeToString(bodyHash[:]) + "\n" + r.Header.Get("X-Timestamp")
+		var mac = hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(canonical))
+		if string(body) == `{"day": "monday"}` && hex.EncodeToString(mac.Sum(nil)) == r.Header.Get("X-Signature") {
+			verified.Inc()
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 1
+  request-count: 3
+targets:
+  today:
+    url: ` + srv.URL + `/today
+    variables:
+      $day:
+        type: string
+        path: day
+  report:
+    url: ` + srv.URL + `/report
+    httpMethod: POST
+    headers:
+      content-type: application/json
+    form-body: '{"day": "$day"}'
+    signing:
+      type: hmac
+      key: secret
+      canonical: [method, path, headers, body-hash, timestamp]
+      headers: [content-type]
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	assert.Equal(t, int64(3), verified.Load())
+	assert.Equal(t, int64(3), lt.Result().Scenarios[0].Targets[1].Success)
+}
+
+// the get-vanilla request of the aws signature v4 test suite
+func TestAwsSigV4MatchesTheTestSuite(t *testing.T) {
+	var sc = &signing.Config{Type: signing.TypeAwsSigV4, AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", Region: "us-east-1", Service: "service"}
+	assert.NoError(t, sc.Validate())
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, sc.Sign(req, nil, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+	assert.Empty(t, req.Header.Get("X-Amz-Content-Sha256"))
+}
+
+func TestSigningIsValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  orders:
+    url: http://127.0.0.1/orders
+    signing:
+      type: hmac
+  upload:
+    url: http://127.0.0.1/upload
+    signing:
+      type: aws-sigv4
+      access-key: AKIDEXAMPLE
+      secret-key: secret
+  report:
+    url: http://127.0.0.1/report
+    signing:
+      type: hmac
+      key: secret
+      canonical: [method, cookies]
+  ping:
+    protocol: tcp
+    url: tcp://127.0.0.1:7000
+    signing:
+      type: hmac
+      key: secret
+`)
+	assert.Equal(t, []string{
+		"line 7: targets.orders: signing.key or signing.key-file is needed by hmac",
+		"line 11: targets.upload: signing.region is needed by aws-sigv4",
+		"line 17: targets.report: signing.canonical must be made of: method, path, query, headers, body-hash, timestamp",
+		"line 24: targets.ping: signing is only used by http targets",
+	}, errs)
+}
@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// a tcp server of a line protocol: "WHO" is answered by a json
+// naming a key, "GET key" by "VALUE key 42",
+// a binary "\x01\x02" ping by "\x01\x03\x00\x00" and anything else by
+// "ERROR" before the connection is closed
+func newTcpTestServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var reader = bufio.NewReader(conn)
+				head, err := reader.Peek(2)
+				if err != nil {
+					return
+				}
+				if bytes.Equal(head, []byte{1, 2}) {
+					conn.Write([]byte{1, 3, 0, 0, 9, 9})
+					return
+				}
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == "WHO\n" {
+					conn.Write([]byte(`{"key": "user"}` + "\n"))
+					return
+				}
+				if key := strings.TrimPrefix(strings.TrimSpace(line), "GET "); key != strings.TrimSpace(line) {
+					conn.Write([]byte("VALUE " + key + " 42\nEND\n"))
+					return
+				}
+				conn.Write([]byte("ERROR\n"))
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestSocketTargetsRun(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	ln := newTcpTestServer(t)
+	defer ln.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer udp.Close()
+	var metrics int64
+	go func() {
+		var buf = make([]byte, 1024)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(string(buf[:n]), "ping") {
+				udp.WriteTo([]byte("pong"), addr)
+			} else if string(buf[:n]) == "logins:1|c" {
+				atomic.AddInt64(&metrics, 1)
+			}
+		}
+	}()
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 2
+  request-count: 4
+targets:
+  who:
+    protocol: tcp
+    url: tcp://` + ln.Addr().String() + `
+    form-body: "WHO\n"
+    socket:
+      read:
+        until: "\n"
+    variables:
+      $key:
+        type: string
+        path: key
+  get:
+    protocol: tcp
+    url: tcp://` + ln.Addr().String() + `
+    form-body: "GET $key\n"
+    socket:
+      read:
+        until: "\n"
+    assertions:
+      body-string: VALUE user 42
+  ping:
+    protocol: tcp
+    url: tcp://` + ln.Addr().String() + `
+    form-body: 01 02
+    socket:
+      encoding: hex
+      read:
+        length: 4
+    assertions:
+      body-hex: 01 03 00 00
+  unknown:
+    protocol: tcp
+    url: tcp://` + ln.Addr().String() + `
+    form-body: "SET key\n"
+    socket:
+      read:
+        until: "\n"
+    assertions:
+      body-string: STORED
+  statsd:
+    protocol: udp
+    url: udp://` + udp.LocalAddr().String() + `
+    form-body: bG9naW5zOjF8Yw==
+    socket:
+      encoding: base64
+  udpPing:
+    protocol: udp
+    url: udp://` + udp.LocalAddr().String() + `
+    form-body: ping
+    socket:
+      read:
+        timeout: 50ms
+    assertions:
+      body-string: pong
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	var targets = lt.Result().Scenarios[0].Targets
+	if !assert.Len(t, targets, 6) {
+		return
+	}
+	for _, i := range []int{0, 1, 2, 4, 5} {
+		assert.Equal(t, int64(4), targets[i].Success, targets[i].Name)
+	}
+	assert.Equal(t, int64(0), targets[3].Success)
+	assert.Equal(t, int64(4), targets[3].OtherErrors)
+	assert.Equal(t, int64(4), atomic.LoadInt64(&metrics))
+}
+
+func TestSocketTargetsAreValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  get:
+    protocol: tcp
+    url: tcp://127.0.0.1
+    headers:
+      X-Id: 1
+    form-body: zz
+    socket:
+      encoding: hex
+      read:
+        length: -1
+  statsd:
+    protocol: udp
+    url: udp://127.0.0.1:8125
+    form-body: logins:1|c
+    socket:
+      encoding: gzip
+  ping:
+    protocol: tcp
+    url: tcp://127.0.0.1:7000
+    socket:
+      read: {}
+    assertions:
+      status-is-ok: 200
+`)
+	assert.Equal(t, []string{
+		"line 7: targets.get: url must be like tcp://host:port",
+		"line 8: targets.get: headers are not used by tcp targets",
+		"line 10: targets.get: payload is not valid hex",
+		"line 11: targets.get: socket.read.length cannot be negative",
+		"line 19: targets.statsd: socket.encoding must be one of: text, hex, base64",
+		"line 24: targets.ping: socket.read needs until, length or timeout",
+		"line 26: targets.ping: status-is-ok is not used by tcp targets, they use body-string or body-hex",
+	}, errs)
+}
@@ -64,7 +64,7 @@ func TestTimeOutCounterConcurrent_mustBeTrue(t *testing.T){
 }
 
 func TestMergingStats(t *testing.T){
-	lt := request.NewRequestWorker(&config.Config{})
+	lt := request.NewRequestWorker(&config.Config{}, "test")
 	st := stats.NewStatsManager("test_1")
 	st2 := stats.NewStatsManager("test_2")
 	st3 := stats.NewStatsManager("test_3")
@@ -105,7 +105,7 @@ func TestMergingStats(t *testing.T){
 	assert.Equal(t, int64(10000*3), v)
 }
 func TestMergingStats_onlyLastGroutineHasTimeout(t *testing.T){
-	lt := request.NewRequestWorker(&config.Config{})
+	lt := request.NewRequestWorker(&config.Config{}, "test")
 	st := stats.NewStatsManager("test_1")
 	st2 := stats.NewStatsManager("test_2")
 	st3 := stats.NewStatsManager("test_3")
@@ -147,7 +147,7 @@ func TestMergingStats_onlyLastGroutineHasTimeout(t *testing.T){
 }
 
 func TestErrorStrForFailedRequests(t *testing.T){
-	lt := request.NewRequestWorker(&config.Config{})
+	lt := request.NewRequestWorker(&config.Config{}, "test")
 	st := stats.NewStatsManager("test_1")
 
 	lt.AddStat("test_1", st)
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// /events streams server-sent events every 10ms until the client goes,
+// /orders sends three ndjson lines and ends
+func newStreamTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var flusher = w.(http.Flusher)
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			for i := 1; ; i++ {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+				fmt.Fprintf(w, "event: tick\nid: %v\ndata: {\"n\": %v,\ndata: \"room\": \"%v\"}\n\n", i, i, r.URL.Query().Get("room"))
+				flusher.Flush()
+			}
+		case "/orders":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			for i := 1; i <= 3; i++ {
+				fmt.Fprintf(w, "{\"order\": %v}\n\n", i)
+				flusher.Flush()
+			}
+		}
+	}))
+}
+
+func TestStreamTargetsRun(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := newStreamTestServer()
+	defer srv.Close()
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 2
+  request-count: 4
+targets:
+  ticks:
+    url: ` + srv.URL + `/events?room=a
+    stream:
+      max-events: 5
+    assertions:
+      body-string: '"n": 3,'
+    variables:
+      $last:
+        type: number
+        path: n
+  orders:
+    url: ` + srv.URL + `/orders?after=$last
+    stream:
+      format: lines
+    assertions:
+      body-string: '{"order": 3}'
+  watch:
+    url: ` + srv.URL + `/events
+    stream:
+      duration: 60ms
+  wrongRoom:
+    url: ` + srv.URL + `/events?room=b
+    stream:
+      max-events: 1
+    assertions:
+      body-string: '"room": "a"'
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	var targets = lt.Result().Scenarios[0].Targets
+	if !assert.Len(t, targets, 4) {
+		return
+	}
+	var ticks = targets[0]
+	assert.Equal(t, int64(4), ticks.Success)
+	assert.Equal(t, int64(4), ticks.StreamCount)
+	assert.Equal(t, int64(20), ticks.StreamEvents)
+	assert.Equal(t, float64(5), ticks.EventsPerStream())
+	assert.True(t, ticks.AverageStreamFirstEventDuration >= 10*time.Millisecond)
+	assert.True(t, ticks.AverageStreamEventGapDuration >= 5*time.Millisecond)
+	assert.True(t, ticks.LongestStreamEventGapDuration >= ticks.AverageStreamEventGapDuration)
+	assert.True(t, ticks.AverageStreamDuration >= 50*time.Millisecond)
+
+	assert.Equal(t, int64(4), targets[1].Success)
+	assert.Equal(t, int64(12), targets[1].StreamEvents)
+
+	// a stream which is over by its duration succeeds
+	var watch = targets[2]
+	assert.Equal(t, int64(4), watch.Success)
+	assert.True(t, watch.AverageStreamDuration >= 60*time.Millisecond)
+	assert.True(t, watch.StreamEvents >= 4*3)
+
+	assert.Equal(t, int64(0), targets[3].Success)
+	assert.Equal(t, int64(4), targets[3].OtherErrors)
+}
+
+func TestStreamTargetsAreValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  events:
+    url: http://127.0.0.1/events
+    stream:
+      format: websocket
+      max-events: -1
+      duration: long
+  ping:
+    protocol: tcp
+    url: tcp://127.0.0.1:7000
+    stream:
+      max-events: 1
+`)
+	assert.Equal(t, []string{
+		"line 7: targets.events: stream.format must be one of: sse, lines",
+		"line 7: targets.events: stream.max-events cannot be negative",
+		"line 7: targets.events: stream.duration must be a duration like 1s or 250ms",
+		"line 14: targets.ping: stream is only used by http targets",
+	}, errs)
+}
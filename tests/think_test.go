@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/curr"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/request"
+	"github.com/mostafatalebi/loadtest/pkg/stats"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"testing"
+	"time"
+)
+
+func TestThinkTimeDistributions(t *testing.T) {
+	fixed := &curr.ThinkTime{Distribution: curr.ThinkFixed, Value: time.Second}
+	assert.NoError(t, fixed.Validate())
+	assert.Equal(t, time.Second, fixed.Duration())
+
+	uniform := &curr.ThinkTime{Distribution: curr.ThinkUniform, Min: time.Second, Max: 2 * time.Second}
+	assert.NoError(t, uniform.Validate())
+	normal := &curr.ThinkTime{Distribution: curr.ThinkNormal, Mean: time.Second, StdDev: time.Second, Max: 2 * time.Second}
+	assert.NoError(t, normal.Validate())
+	exponential := &curr.ThinkTime{Distribution: curr.ThinkExponential, Mean: time.Second, Max: 3 * time.Second}
+	assert.NoError(t, exponential.Validate())
+	for i := 0; i < 1000; i++ {
+		d := uniform.Duration()
+		assert.True(t, d >= time.Second && d < 2*time.Second)
+		d = normal.Duration()
+		assert.True(t, d >= 0 && d <= 2*time.Second)
+		d = exponential.Duration()
+		assert.True(t, d >= 0 && d <= 3*time.Second)
+	}
+
+	assert.Error(t, (&curr.ThinkTime{Distribution: curr.ThinkUniform, Min: time.Second}).Validate())
+	assert.Error(t, (&curr.ThinkTime{Distribution: curr.ThinkExponential}).Validate())
+	assert.Error(t, (&curr.ThinkTime{Distribution: "poisson"}).Validate())
+}
+
+func TestThinkTimeIsExcludedFromDurations(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=11",
+		ThinkTime:  &curr.ThinkTime{Distribution: curr.ThinkFixed, Value: 50 * time.Millisecond},
+	})
+	runFlowChain(fetch)
+	st := fetch.GetStat("fetch")
+	st.CalculateAverage()
+	st.CalculateThinkAverageDuration()
+	assert.Equal(t, int64(5), st.Params.Get(stats.ThinkCount))
+	assert.Equal(t, 250*time.Millisecond, st.Params.Get(stats.ThinkDuration))
+	assert.Equal(t, 50*time.Millisecond, st.Params.Get(stats.AverageThinkDuration))
+	assert.True(t, st.GetAverage() < 50*time.Millisecond)
+}
+
+func TestPacing(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+
+	fetch := newFlowTestWorker(&config.Config{
+		TargetName: "fetch",
+		Url:        srv.URL + "/product?id=11",
+	})
+	tg := request.NewTargetManager(request.StrategySeq, 2, 4)
+	tg.SetPacing(50 * time.Millisecond)
+	tg.Workers = []*request.RequestWorker{fetch}
+	start := time.Now()
+	tg.Run(request.ExecWorker)
+	// 4 iterations by 2 virtual users, each taking at least 50ms
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestThinkTimeAndPacingEndWithTheTest(t *testing.T) {
+	srv := newFlowTestServer(atomic.NewInt64(0))
+	defer srv.Close()
+	var newConfigs = func(main *config.YamlConfigSectionMain, think *config.YamlConfigThinkTime) []*config.Config {
+		configs, err := config.NewConfigYaml().LoadConfigs(&config.YamlConfigHolder{
+			Main:    main,
+			Targets: (&config.YamlConfigTargets{}).Add("fetch", &config.YamlConfigSectionTarget{Url: srv.URL + "/product?id=11", MaxTimeout: 5, ThinkTime: think}),
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return configs
+	}
+
+	// the think time ends by the context of the test, the request is not sent
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	result, err := loadtest.Run(ctx, newConfigs(&config.YamlConfigSectionMain{Concurrency: 2, NumberOfRequests: 2},
+		&config.YamlConfigThinkTime{Type: curr.ThinkFixed, Value: "30s"}), nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 2*time.Second, time.Since(start).String())
+	if assert.NotNil(t, result) {
+		assert.Equal(t, int64(0), result.Scenarios[0].Targets[0].TotalSent)
+	}
+
+	// the pacing ends by the end of the test's duration
+	start = time.Now()
+	result, err = loadtest.Run(context.Background(), newConfigs(&config.YamlConfigSectionMain{Concurrency: 2, Duration: "200ms", Pacing: "30s"}, nil), nil)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second, time.Since(start).String())
+	if assert.NotNil(t, result) {
+		assert.Equal(t, int64(2), result.Scenarios[0].Targets[0].TotalSent)
+	}
+}
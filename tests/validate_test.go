@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"github.com/mostafatalebi/loadtest/pkg/assertions"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// loads the yaml config and returns its errors, one string per error
+func loadConfigErrors(t *testing.T, content string) []string {
+	file, remove := writeTestConfig(t, content)
+	defer remove()
+	_, err := config.NewConfigYaml().LoadConfigs(file)
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(config.ConfigErrors)
+	if !assert.True(t, ok, "unexpected error: %v", err) {
+		return nil
+	}
+	var lines = make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, e.Error())
+	}
+	return lines
+}
+
+func TestValidateReportsAllErrorsWithLines(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 2
+  request-count: 10
+  strategy: sequential
+logs:
+  enable: true
+targets:
+  login:
+    url: 127.0.0.1/login
+    httpMethod: FETCH
+    assertions:
+      body-contains: ok
+  getUser:
+    url: http://127.0.0.1/user?id=$userId
+    max-timeout: one
+`)
+	assert.Equal(t, []string{
+		"line 4: main: strategy must be one of: seq, parallel, round-robin, weighted",
+		"line 6: field enable not found in type config.YamlConfigSectionLogs",
+		"line 9: targets.login: url must start with http:// or https://",
+		"line 10: targets.login: httpMethod must be one of: GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE",
+		"line 11: targets.login: unknown assertion body-contains, assertions are: body-hex, body-string, content-type, grpc-status, status-is-ok",
+		"line 14: targets.getUser: variable $userId is not defined by a data-source or a previous target",
+		"line 15: cannot unmarshal !!str `one` into int",
+	}, errs)
+}
+
+func TestValidateVariableReferences(t *testing.T) {
+	var targets = `
+data-sources:
+  getToken:
+    url: http://127.0.0.1/token
+    variables:
+      $token:
+        type: string
+        path: data.token
+targets:
+  listProducts:
+    url: http://127.0.0.1/products
+    headers:
+      Authorization: Bearer $token
+    variables:
+      $productIds:
+        type: array
+        path: data.ids
+  fetchProduct:
+    url: http://127.0.0.1/product?id=$item&index=$index
+    loop-over: $productIds
+    when: $status == 200
+`
+	errs := loadConfigErrors(t, `
+main:
+  concurrency: 1
+  request-count: 1
+  strategy: seq
+`+targets)
+	assert.Empty(t, errs)
+
+	// other strategies do not pass variables between targets
+	errs = loadConfigErrors(t, `
+main:
+  concurrency: 1
+  request-count: 1
+  strategy: parallel
+`+targets)
+	assert.Equal(t, []string{
+		"line 25: targets.fetchProduct: variable $productIds is not defined by a data-source or a previous target",
+	}, errs)
+}
+
+func TestParseAssertion(t *testing.T) {
+	asrt, err := assertions.ParseAssertion(assertions.AssertStatusIsOk, "200, 204")
+	assert.NoError(t, err)
+	assert.NoError(t, asrt.SetTest(204))
+	assert.NoError(t, asrt.Assert())
+	assert.NoError(t, asrt.SetTest(201))
+	assert.Error(t, asrt.Assert())
+
+	_, err = assertions.ParseAssertion(assertions.AssertStatusIsOk, "ok")
+	assert.Error(t, err)
+	_, err = assertions.ParseAssertion("unknown", "")
+	assert.Error(t, err)
+
+	// each target has its own assertion
+	first, _ := assertions.ParseAssertion(assertions.AssertBodyString, "first")
+	second, _ := assertions.ParseAssertion(assertions.AssertBodyString, "second")
+	assert.NoError(t, first.SetInput("the first body"))
+	assert.NoError(t, second.SetInput("the second body"))
+	assert.NoError(t, first.Assert())
+	assert.NoError(t, second.Assert())
+}
@@ -23,8 +23,8 @@ func TestWaitWithBackoff(t *testing.T){
 
 func TestWaitWithBackoff_WithStopChannel(t *testing.T){
 	w := curr.NewWait(time.Nanosecond*10, time.Nanosecond*5, time.Hour*1)
-	var stopChan = make(chan bool)
-	w.SetChan(&stopChan)
+	var stopChan = make(chan bool, 1)
+	w.SetChan(stopChan)
 	itr := 0
 	for w.Waiting() {
 		if itr == 10 {
@@ -32,5 +32,47 @@ func TestWaitWithBackoff_WithStopChannel(t *testing.T){
 		}
 		itr++
 	}
+	assert.Equal(t, 11, itr)
+	assert.EqualError(t, w.Error(), curr.StoppedError)
+}
+
+func TestWait_ClosedStopChannelEndsTheSleep(t *testing.T){
+	w := curr.NewWait(time.Hour, 0, 0)
+	var stopChan = make(chan bool)
+	w.SetChan(stopChan)
+	time.AfterFunc(10*time.Millisecond, func() { close(stopChan) })
+	tn := time.Now()
+	assert.False(t, w.Waiting())
+	assert.Less(t, int64(time.Since(tn)), int64(time.Second))
+}
+
+func TestWaitWithExponentialBackoff(t *testing.T){
+	w := curr.NewBackoff(curr.BackoffExponential, time.Millisecond, time.Millisecond*5)
+	itr := 0
+	for w.Waiting() {
+		itr++
+	}
+	// 1ms, 2ms and 4ms
 	assert.Equal(t, 3, itr)
-}
\ No newline at end of file
+	assert.EqualError(t, w.Error(), curr.MaxWaitError)
+}
+
+func TestWaitWithJitteredBackoff(t *testing.T){
+	w := curr.NewBackoff(curr.BackoffJittered, time.Millisecond, time.Millisecond*5)
+	tn := time.Now()
+	itr := 0
+	for w.Waiting() {
+		itr++
+	}
+	assert.Equal(t, 3, itr)
+	// at most 1ms, 2ms and 4ms
+	assert.Less(t, int64(time.Since(tn)), int64(time.Second))
+}
+
+func TestWaitWithConstantBackoff(t *testing.T){
+	w := curr.NewBackoff(curr.BackoffConstant, time.Millisecond, 0)
+	for i := 0; i < 5; i++ {
+		assert.True(t, w.Waiting())
+	}
+	assert.Nil(t, w.Error())
+}
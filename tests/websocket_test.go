@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/mostafatalebi/loadtest/pkg/config"
+	"github.com/mostafatalebi/loadtest/pkg/loadtest"
+	"github.com/mostafatalebi/loadtest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a chat server: it welcomes each connection with its session, answers
+// join and ping messages and closes with 1011 on crash
+func newWebsocketTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var sum = sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+		writeWsFrame(rw, 9, []byte("are you there"))
+		writeWsFrame(rw, 1, []byte(`{"type":"welcome","session":"s-`+r.URL.Query().Get("user")+`"}`))
+		rw.Flush()
+		for {
+			op, payload, err := readWsFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			var message = string(payload)
+			switch {
+			case op == 8:
+				writeWsFrame(rw, 8, payload)
+				rw.Flush()
+				return
+			case op != 1:
+				continue
+			case strings.Contains(message, `"join"`):
+				writeWsFrame(rw, 1, []byte(`{"type":"news"}`))
+				writeWsFrame(rw, 1, []byte(`{"type":"joined","member":`+message+`}`))
+			case message == "ping":
+				time.Sleep(5 * time.Millisecond)
+				writeWsFrame(rw, 1, []byte("pong"))
+			case message == "crash":
+				var payload = make([]byte, 2)
+				binary.BigEndian.PutUint16(payload, 1011)
+				writeWsFrame(rw, 8, payload)
+				rw.Flush()
+				return
+			}
+			rw.Flush()
+		}
+	}))
+}
+
+func writeWsFrame(w io.Writer, op byte, payload []byte) {
+	w.Write([]byte{0x80 | op, byte(len(payload))})
+	w.Write(payload)
+}
+
+// reads a masked frame of the client
+func readWsFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head = make([]byte, 6)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	var payload = make([]byte, head[1]&0x7f)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= head[2+i%4]
+	}
+	return head[0] & 0x0f, payload, nil
+}
+
+func TestWebsocketTargetsRun(t *testing.T) {
+	logger.LogEnabled = false
+	defer func() { logger.LogEnabled = true }()
+	srv := newWebsocketTestServer()
+	defer srv.Close()
+	var wsUrl = "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	configs, err := config.NewConfigYaml().LoadConfigs([]byte(`
+main:
+  concurrency: 2
+  request-count: 4
+targets:
+  chat:
+    protocol: websocket
+    url: ` + wsUrl + `/chat?token=secret&user=7
+    variables:
+      $session:
+        type: string
+        path: session
+    websocket:
+      timeout: 2s
+      hold: 20ms
+      script:
+        - expect: welcome
+        - send: '{"type":"join","session":"$session"}'
+        - expect: joined
+        - send: ping
+        - expect: pong
+          timeout: 1s
+    assertions:
+      body-string: pong
+  rejoin:
+    protocol: websocket
+    url: ` + wsUrl + `/chat?token=secret&user=8
+    websocket:
+      script:
+        - send: '{"type":"join","session":"$session"}'
+        - expect: '"session":"s-7"'
+  crash:
+    protocol: websocket
+    url: ` + wsUrl + `/chat?token=secret
+    websocket:
+      script:
+        - send: crash
+        - expect: never
+  silent:
+    protocol: websocket
+    url: ` + wsUrl + `/chat?token=secret
+    websocket:
+      script:
+        - expect: never
+          timeout: 20ms
+  forbidden:
+    protocol: websocket
+    url: ` + wsUrl + `/chat
+    websocket:
+      script:
+        - send: ping
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	lt := loadtest.NewLoadTest(configs...)
+	lt.StartWorkers()
+	var targets = lt.Result().Scenarios[0].Targets
+	if !assert.Len(t, targets, 5) {
+		return
+	}
+	var chat = targets[0]
+	assert.Equal(t, int64(4), chat.Success)
+	assert.Equal(t, int64(8), chat.WsMessagesSent)
+	// the welcome, the news, joined and pong
+	assert.Equal(t, int64(16), chat.WsMessagesReceived)
+	assert.True(t, chat.AverageWsConnectDuration > 0)
+	assert.True(t, chat.AverageWsRoundTripDuration >= 5*time.Millisecond/2)
+	assert.True(t, chat.AverageDuration >= 20*time.Millisecond)
+	assert.Equal(t, int64(0), chat.WsAbnormalClosures)
+	// the session extracted by chat is sent by rejoin
+	assert.Equal(t, int64(4), targets[1].Success)
+
+	assert.Equal(t, int64(0), targets[2].Success)
+	assert.Equal(t, int64(4), targets[2].WsAbnormalClosures)
+	assert.Equal(t, int64(4), targets[2].OtherErrors)
+	assert.Equal(t, int64(4), targets[3].Timeout)
+	assert.Equal(t, map[string]int64{"403": 4}, targets[4].Failed)
+}
+
+func TestWebsocketTargetsAreValidated(t *testing.T) {
+	errs := loadConfigErrors(t, `main:
+  concurrency: 1
+  request-count: 1
+targets:
+  chat:
+    protocol: websocket
+    url: http://127.0.0.1/chat
+    httpMethod: GET
+    assertions:
+      status-is-ok: 101
+  feed:
+    protocol: websocket
+    url: ws://127.0.0.1/feed
+    websocket:
+      hold: forever
+      script:
+        - send: hello
+          expect: hi
+        - send: hello
+          timeout: 1s
+  login:
+    url: http://127.0.0.1/login
+    websocket:
+      script:
+        - send: hello
+`)
+	assert.Equal(t, []string{
+		"line 5: targets.chat: websocket targets need websocket.script, a list of send, expect and sleep steps",
+		"line 7: targets.chat: url must start with ws:// or wss://",
+		"line 8: targets.chat: httpMethod is not used by websocket targets",
+		"line 9: targets.chat: status-is-ok is not used by websocket targets, they use body-string on the last message received",
+		"line 14: targets.feed: websocket.hold must be a duration like 1s or 250ms",
+		"line 14: targets.feed: websocket.script[0] must have one of send, expect or sleep",
+		"line 14: targets.feed: websocket.script[1].timeout is only used by expect steps",
+		"line 23: targets.login: websocket is only used by websocket targets (protocol: websocket)",
+	}, errs)
+}